@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/cmo7/folly4/src/app/mappers"
+	"github.com/cmo7/folly4/src/app/models"
+	"github.com/cmo7/folly4/src/app/services"
+	"github.com/cmo7/folly4/src/lib/generics/apperror"
+	"github.com/cmo7/folly4/src/lib/generics/auth"
+	"github.com/cmo7/folly4/src/lib/generics/controller"
+	"github.com/cmo7/folly4/src/lib/generics/util/permission"
+)
+
+// AuthController serves the login, refresh, logout and me endpoints of the auth service.
+// Every method returns an http.HandlerFunc that can be used to handle HTTP requests.
+type AuthController struct {
+	service *services.AuthService
+}
+
+// NewAuthController creates a controller for the auth service.
+func NewAuthController(service *services.AuthService) *AuthController {
+	return &AuthController{service: service}
+}
+
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// meResponse describes the authenticated user to the frontend, with the names of their roles and
+// the permissions they have, as "Entity:OPERATION".
+type meResponse struct {
+	User        *models.UserEntity `json:"user"`
+	Roles       []string           `json:"roles"`
+	Permissions []string           `json:"permissions"`
+}
+
+// Login answers the tokens of a new session of the user whose username and password are posted.
+func (c *AuthController) Login() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body := loginRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			controller.WriteError(w, r, apperror.BadRequest(err))
+			return
+		}
+
+		tokens, err := c.service.Login(r.Context(), body.Username, body.Password)
+		if err != nil {
+			controller.WriteError(w, r, err)
+			return
+		}
+
+		respond(w, tokens)
+	}
+}
+
+// Refresh answers new tokens for the session whose refresh token is posted.
+func (c *AuthController) Refresh() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body := refreshRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			controller.WriteError(w, r, apperror.BadRequest(err))
+			return
+		}
+		if body.RefreshToken == "" {
+			controller.WriteError(w, r, apperror.BadRequest(errors.New("refresh_token is required")))
+			return
+		}
+
+		tokens, err := c.service.Refresh(r.Context(), body.RefreshToken)
+		if err != nil {
+			controller.WriteError(w, r, tokenError(err))
+			return
+		}
+
+		respond(w, tokens)
+	}
+}
+
+// Logout closes the session of the bearer token of the request. It runs after authentication.
+func (c *AuthController) Logout() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, _ := auth.BearerToken(r)
+		if err := c.service.Logout(r.Context(), token); err != nil {
+			controller.WriteError(w, r, tokenError(err))
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Me answers the authenticated user, with their roles and effective permissions. It runs after
+// authentication.
+func (c *AuthController) Me() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := permission.Principal(r.Context()).(*models.UserEntity)
+		if !ok {
+			controller.WriteError(w, r, apperror.Unauthorized("not authenticated"))
+			return
+		}
+
+		response := meResponse{
+			User:        mappers.UserMapper{}.Map(user),
+			Roles:       []string{},
+			Permissions: []string{},
+		}
+		for _, role := range user.Roles {
+			response.Roles = append(response.Roles, role.Name)
+		}
+		for _, p := range permission.EffectivePermissions(r.Context()) {
+			response.Permissions = append(response.Permissions, p.ToString())
+		}
+
+		respond(w, response)
+	}
+}
+
+// tokenError makes errors of tokens the client sent client errors.
+func tokenError(err error) error {
+	if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrExpiredToken) {
+		return apperror.New(apperror.ErrUnauthorized, err, "%s", err.Error())
+	}
+	return err
+}
+
+func respond(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cmo7/folly4/src/app/mappers"
+	"github.com/cmo7/folly4/src/app/models"
+	"github.com/cmo7/folly4/src/lib/generics/controller"
+	"github.com/cmo7/folly4/src/lib/generics/router"
+	"github.com/cmo7/folly4/src/lib/generics/util/credentials"
+	gorm_impl "github.com/cmo7/folly4/src/lib/impl/gorm-repository"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// newUserRouter serves the users of a new database, alice and bob, who share the admin role.
+func newUserRouter(t *testing.T) (http.Handler, *models.UserEntity, string) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	assert.Nil(t, err)
+	assert.Nil(t, db.AutoMigrate(&models.RoleEntity{}, &models.PermissionEntity{}, &models.UserEntity{}))
+
+	hash, err := credentials.NewHasher().Hash("password1")
+	assert.Nil(t, err)
+	admin := &models.RoleEntity{Name: "admin", LocalizedName: "Admin"}
+	alice := &models.UserEntity{Username: "alice", Email: "alice@example.com", Password: hash, Roles: []*models.RoleEntity{admin}}
+	bob := &models.UserEntity{Username: "bob", Email: "bob@example.com", Password: hash, Roles: []*models.RoleEntity{admin}}
+	assert.Nil(t, db.Create(alice).Error)
+	assert.Nil(t, db.Create(bob).Error)
+
+	c := controller.NewController(
+		gorm_impl.NewGormGenericRepository[*models.UserEntity](db),
+		mappers.UserMapper{},
+		mappers.UserRequestMapper{},
+	)
+	return router.NewRouter(c), alice, hash
+}
+
+func TestPasswordsAreNotReturnedThroughRelations(t *testing.T) {
+	handler, alice, hash := newUserRouter(t)
+	for _, target := range []string{
+		"/User/",
+		"/User/?relations=roles",
+		"/User/?relations=roles.users",
+		"/User/?relations=roles.users.roles",
+		"/User/" + alice.ID.String() + "?relations=roles.users",
+		"/User/first?filter=username:eq:alice",
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(t, http.StatusOK, w.Code, target)
+		assert.Contains(t, w.Body.String(), "alice", target)
+		assert.NotContains(t, w.Body.String(), hash, target)
+		assert.NotContains(t, w.Body.String(), "$argon2id", target)
+	}
+
+	// The users of the roles are returned, without their passwords.
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/User/"+alice.ID.String()+"?relations=roles.users", nil))
+	assert.Contains(t, w.Body.String(), `"Username":"bob"`)
+}
+
+func TestPasswordsCannotBeSelectedThroughRelations(t *testing.T) {
+	handler, _, _ := newUserRouter(t)
+	for _, target := range []string{
+		"/User/?fields=password",
+		"/User/?relations=roles.users&fields[roles.users]=password",
+		"/User/?relations=roles.users&fields[roles.users]=username,password",
+		"/User/?relations=roles.users.roles&fields[roles.users.roles.users]=password",
+		"/User/?relations=roles&fields[roles.parents]=name",
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, target)
+		assert.NotContains(t, w.Body.String(), "$argon2id", target)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/User/?relations=roles.users&fields[roles.users]=username", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"Username":"bob"`)
+}
+
+func TestPostedRolesAreIgnored(t *testing.T) {
+	handler, alice, _ := newUserRouter(t)
+	admin := alice.Roles[0]
+	body := `{"Username":"mallory","Email":"mallory@example.com","Password":"password1","Roles":[` +
+		`{"ID":"` + admin.ID.String() + `"},` +
+		`{"Name":"root","LocalizedName":"Root","Permissions":[{"Entity":"*","Operation":"*"}]}]}`
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/User/", strings.NewReader(body)))
+	assert.Less(t, w.Code, 300, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/User/?relations=roles&filter=username:eq:mallory", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"Username":"mallory"`)
+	assert.NotContains(t, w.Body.String(), `"Name":"admin"`)
+	assert.NotContains(t, w.Body.String(), `"Name":"root"`)
+
+	// No user got the role the request carried.
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/User/?relations=roles", nil))
+	assert.NotContains(t, w.Body.String(), `"Name":"root"`)
+}
@@ -0,0 +1,8 @@
+// Package mappers holds the generated mappers between the models and the DTOs of the API.
+// Regenerate them with go generate after changing the models.
+package mappers
+
+//go:generate go run ../../.. generate mapper --name UserMapper --exclude Password --nested Roles=RoleMapper -o user.mapper.go *../models.UserEntity *../models.UserEntity
+//go:generate go run ../../.. generate mapper --name UserRequestMapper --exclude ID,CreatedAt,UpdatedAt,DeletedAt,Roles -o user-request.mapper.go *../models.UserEntity *../models.UserEntity
+//go:generate go run ../../.. generate mapper --name RoleMapper --exclude Parents --nested Permissions=PermissionMapper,Users=UserMapper -o role.mapper.go *../models.RoleEntity *../models.RoleEntity
+//go:generate go run ../../.. generate mapper --name PermissionMapper -o permission.mapper.go *../models.PermissionEntity *../models.PermissionEntity
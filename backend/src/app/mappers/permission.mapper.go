@@ -0,0 +1,42 @@
+// Code generated by folly generate mapper. DO NOT EDIT.
+
+package mappers
+
+import (
+	"github.com/cmo7/folly4/src/app/models"
+	"github.com/cmo7/folly4/src/lib/generics"
+)
+
+// PermissionMapper maps *models.PermissionEntity to *models.PermissionEntity without reflection.
+type PermissionMapper struct{}
+
+var (
+	_ generics.Mapper[*models.PermissionEntity, *models.PermissionEntity] = PermissionMapper{}
+	_ generics.RelationMapper                                             = PermissionMapper{}
+)
+
+// Map copies the fields of input to a new output.
+func (PermissionMapper) Map(input *models.PermissionEntity) *models.PermissionEntity {
+	output := &models.PermissionEntity{}
+	output.ID = input.ID
+	output.CreatedAt = input.CreatedAt
+	output.UpdatedAt = input.UpdatedAt
+	output.DeletedAt = input.DeletedAt
+	output.Entity = input.Entity
+	output.Operation = input.Operation
+	return output
+}
+
+// MapsField reports whether Map maps the input field with the Go name to the output.
+func (PermissionMapper) MapsField(name string) bool {
+	switch name {
+	case "ID", "CreatedAt", "UpdatedAt", "DeletedAt", "Entity", "Operation":
+		return true
+	}
+	return false
+}
+
+// MapperOf returns the mapper of the input relation with the Go name, or nil when it has none.
+func (PermissionMapper) MapperOf(name string) generics.FieldMapper {
+	return nil
+}
@@ -0,0 +1,66 @@
+// Code generated by folly generate mapper. DO NOT EDIT.
+
+package mappers
+
+import (
+	"github.com/cmo7/folly4/src/app/models"
+	"github.com/cmo7/folly4/src/lib/generics"
+)
+
+// RoleMapper maps *models.RoleEntity to *models.RoleEntity without reflection.
+type RoleMapper struct{}
+
+var (
+	_ generics.Mapper[*models.RoleEntity, *models.RoleEntity] = RoleMapper{}
+	_ generics.RelationMapper                                 = RoleMapper{}
+)
+
+// Map copies the fields of input to a new output.
+func (RoleMapper) Map(input *models.RoleEntity) *models.RoleEntity {
+	output := &models.RoleEntity{}
+	output.ID = input.ID
+	output.CreatedAt = input.CreatedAt
+	output.UpdatedAt = input.UpdatedAt
+	output.DeletedAt = input.DeletedAt
+	output.Name = input.Name
+	output.LocalizedName = input.LocalizedName
+	if input.Permissions != nil {
+		output.Permissions = input.Permissions[:0:0]
+		for _, value := range input.Permissions {
+			if value != nil {
+				value = PermissionMapper{}.Map(value)
+			}
+			output.Permissions = append(output.Permissions, value)
+		}
+	}
+	if input.Users != nil {
+		output.Users = input.Users[:0:0]
+		for _, value := range input.Users {
+			if value != nil {
+				value = UserMapper{}.Map(value)
+			}
+			output.Users = append(output.Users, value)
+		}
+	}
+	return output
+}
+
+// MapsField reports whether Map maps the input field with the Go name to the output.
+func (RoleMapper) MapsField(name string) bool {
+	switch name {
+	case "ID", "CreatedAt", "UpdatedAt", "DeletedAt", "Name", "LocalizedName", "Permissions", "Users":
+		return true
+	}
+	return false
+}
+
+// MapperOf returns the mapper of the input relation with the Go name, or nil when it has none.
+func (RoleMapper) MapperOf(name string) generics.FieldMapper {
+	switch name {
+	case "Permissions":
+		return PermissionMapper{}
+	case "Users":
+		return UserMapper{}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+// Code generated by folly generate mapper. DO NOT EDIT.
+
+package mappers
+
+import (
+	"github.com/cmo7/folly4/src/app/models"
+	"github.com/cmo7/folly4/src/lib/generics"
+)
+
+// UserRequestMapper maps *models.UserEntity to *models.UserEntity without reflection.
+type UserRequestMapper struct{}
+
+var (
+	_ generics.Mapper[*models.UserEntity, *models.UserEntity] = UserRequestMapper{}
+	_ generics.RelationMapper                                 = UserRequestMapper{}
+)
+
+// Map copies the fields of input to a new output.
+func (UserRequestMapper) Map(input *models.UserEntity) *models.UserEntity {
+	output := &models.UserEntity{}
+	output.Username = input.Username
+	output.Password = input.Password
+	output.Email = input.Email
+	return output
+}
+
+// MapsField reports whether Map maps the input field with the Go name to the output.
+func (UserRequestMapper) MapsField(name string) bool {
+	switch name {
+	case "Username", "Password", "Email":
+		return true
+	}
+	return false
+}
+
+// MapperOf returns the mapper of the input relation with the Go name, or nil when it has none.
+func (UserRequestMapper) MapperOf(name string) generics.FieldMapper {
+	return nil
+}
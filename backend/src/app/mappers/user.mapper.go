@@ -0,0 +1,55 @@
+// Code generated by folly generate mapper. DO NOT EDIT.
+
+package mappers
+
+import (
+	"github.com/cmo7/folly4/src/app/models"
+	"github.com/cmo7/folly4/src/lib/generics"
+)
+
+// UserMapper maps *models.UserEntity to *models.UserEntity without reflection.
+type UserMapper struct{}
+
+var (
+	_ generics.Mapper[*models.UserEntity, *models.UserEntity] = UserMapper{}
+	_ generics.RelationMapper                                 = UserMapper{}
+)
+
+// Map copies the fields of input to a new output.
+func (UserMapper) Map(input *models.UserEntity) *models.UserEntity {
+	output := &models.UserEntity{}
+	output.ID = input.ID
+	output.CreatedAt = input.CreatedAt
+	output.UpdatedAt = input.UpdatedAt
+	output.DeletedAt = input.DeletedAt
+	output.Username = input.Username
+	output.Email = input.Email
+	if input.Roles != nil {
+		output.Roles = input.Roles[:0:0]
+		for _, value := range input.Roles {
+			if value != nil {
+				value = RoleMapper{}.Map(value)
+			}
+			output.Roles = append(output.Roles, value)
+		}
+	}
+	return output
+}
+
+// MapsField reports whether Map maps the input field with the Go name to the output.
+func (UserMapper) MapsField(name string) bool {
+	switch name {
+	case "ID", "CreatedAt", "UpdatedAt", "DeletedAt", "Username", "Email", "Roles":
+		return true
+	}
+	return false
+}
+
+// MapperOf returns the mapper of the input relation with the Go name, or nil when it has none.
+func (UserMapper) MapperOf(name string) generics.FieldMapper {
+	switch name {
+	case "Roles":
+		return RoleMapper{}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package app
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/cmo7/folly4/src/app/models"
+	"github.com/cmo7/folly4/src/lib/generics/util/audit"
+	"github.com/cmo7/folly4/src/lib/generics/util/permission"
+)
+
+// withAudit starts the audit entry of every request, which the audit layers of the services
+// complete and store. It runs after authentication, when there is one, so the entry records who
+// made the request.
+func withAudit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entry := &models.AuditEntity{
+			Location:  r.URL.Path,
+			IP:        clientIP(r),
+			UserAgent: r.UserAgent(),
+		}
+		if user, ok := permission.GetUser(r.Context()); ok {
+			entry.UserID = user.GetID()
+		}
+		next.ServeHTTP(w, r.WithContext(audit.WithAudit(r.Context(), entry)))
+	})
+}
+
+// clientIP returns the address of the client of r, without the port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"github.com/cmo7/folly4/src/lib/generics/common"
 	"github.com/cmo7/folly4/src/lib/generics/util/permission"
+	"gorm.io/gorm"
 )
 
 type PermissionEntity struct {
@@ -40,3 +41,16 @@ func (p *PermissionEntity) SetOperation(operation permission.Operation) {
 func (p *PermissionEntity) ToString() string {
 	return p.Entity.String() + ":" + p.Operation.String()
 }
+
+// AfterSave discards the cached permissions of users, which may have changed with the permission.
+// Adding to the relations of a permission saves it too.
+func (p *PermissionEntity) AfterSave(tx *gorm.DB) error {
+	permission.Invalidate()
+	return nil
+}
+
+// AfterDelete discards the cached permissions of users, which may have changed with the permission.
+func (p *PermissionEntity) AfterDelete(tx *gorm.DB) error {
+	permission.Invalidate()
+	return nil
+}
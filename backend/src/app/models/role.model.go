@@ -1,6 +1,10 @@
 package models
 
-import "github.com/cmo7/folly4/src/lib/generics/common"
+import (
+	"github.com/cmo7/folly4/src/lib/generics/common"
+	"github.com/cmo7/folly4/src/lib/generics/util/permission"
+	"gorm.io/gorm"
+)
 
 type RoleEntity struct {
 	BaseModel     `gorm:"embedded"`
@@ -10,6 +14,10 @@ type RoleEntity struct {
 	// A role can have many permissions.
 	Permissions []*PermissionEntity `gorm:"many2many:role_permissions;"`
 
+	// A role can extend many roles, and has their permissions too. Parents are not serialized,
+	// as the roles of a user are linked to their parents to resolve their permissions.
+	Parents []*RoleEntity `gorm:"many2many:role_parents;joinForeignKey:RoleID;joinReferences:ParentID" json:"-"`
+
 	// A role can have many users.
 	Users []*UserEntity `gorm:"many2many:user_roles;"`
 }
@@ -21,3 +29,42 @@ func (r *RoleEntity) GetEntityName() common.EntityName {
 func (r *RoleEntity) GetName() string {
 	return r.Name
 }
+
+// Implement permission.Role interface.
+func (r *RoleEntity) GetPermissions() []permission.Permission {
+	permissions := make([]permission.Permission, len(r.Permissions))
+	for i, p := range r.Permissions {
+		permissions[i] = p
+	}
+	return permissions
+}
+
+func (r *RoleEntity) SetPermissions(permissions []permission.Permission) {
+	r.Permissions = nil
+	for _, p := range permissions {
+		if p, ok := p.(*PermissionEntity); ok {
+			r.Permissions = append(r.Permissions, p)
+		}
+	}
+}
+
+func (r *RoleEntity) GetParents() []permission.Role {
+	parents := make([]permission.Role, len(r.Parents))
+	for i, parent := range r.Parents {
+		parents[i] = parent
+	}
+	return parents
+}
+
+// AfterSave discards the cached permissions of users, which may have changed with the role.
+// Adding to the relations of a role saves it too.
+func (r *RoleEntity) AfterSave(tx *gorm.DB) error {
+	permission.Invalidate()
+	return nil
+}
+
+// AfterDelete discards the cached permissions of users, which may have changed with the role.
+func (r *RoleEntity) AfterDelete(tx *gorm.DB) error {
+	permission.Invalidate()
+	return nil
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/cmo7/folly4/src/lib/generics/common"
+	"github.com/google/uuid"
+)
+
+// SessionEntity is a session opened by a login, until the user logs out or it expires. Only the
+// hashes of its tokens are stored. The access token of the session is a JSON Web Token, identified
+// by the ID of the session, when a key is configured to sign them, or else an opaque token.
+type SessionEntity struct {
+	BaseModel        `gorm:"embedded"`
+	TokenHash        string      `gorm:"index" json:"-"` // Empty for sessions with JSON Web Tokens.
+	ExpiresAt        time.Time   `gorm:"not null"`       // When the access token expires.
+	RefreshTokenHash string      `gorm:"uniqueIndex;not null" json:"-"`
+	RefreshExpiresAt time.Time   `gorm:"not null"`
+	UserID           uuid.UUID   `gorm:"type:char(36);not null;index"`
+	User             *UserEntity `gorm:"constraint:OnDelete:CASCADE"`
+	IP               string
+	UserAgent        string
+}
+
+func (s *SessionEntity) GetEntityName() common.EntityName {
+	return common.EntityName("Session")
+}
+
+func (s *SessionEntity) GetName() string {
+	return s.ID.String()
+}
+
+// Expired reports whether the access token of the session can no longer be used.
+func (s *SessionEntity) Expired() bool {
+	return !time.Now().Before(s.ExpiresAt)
+}
+
+// Ended reports whether the session can no longer be refreshed.
+func (s *SessionEntity) Ended() bool {
+	return !time.Now().Before(s.RefreshExpiresAt)
+}
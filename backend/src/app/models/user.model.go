@@ -1,12 +1,15 @@
 package models
 
-import "github.com/cmo7/folly4/src/lib/generics/common"
+import (
+	"github.com/cmo7/folly4/src/lib/generics/common"
+	"github.com/cmo7/folly4/src/lib/generics/util/permission"
+)
 
 type UserEntity struct {
 	BaseModel `gorm:"embedded"`
-	Username  string        `gorm:"unique;not null"`
-	Password  string        `gorm:"not null"`
-	Email     string        `gorm:"unique;not null"`
+	Username  string        `gorm:"unique;not null" validate:"required,min=3,max=64"`
+	Password  string        `gorm:"not null" query:"-" json:",omitempty" validate:"min=8"` // Hashed by the credentials layer, left out of responses by the user mapper.
+	Email     string        `gorm:"unique;not null" validate:"required,email"`
 	Roles     []*RoleEntity `gorm:"many2many:user_roles;"`
 }
 
@@ -19,23 +22,38 @@ func (u *UserEntity) GetName() string {
 	return u.Username
 }
 
-// Implement permission.User interface.
-func (u *UserEntity) GetRoles() []*RoleEntity {
-	return u.Roles
+// Implement credentials.Credentials interface.
+func (u *UserEntity) GetPassword() string {
+	return u.Password
 }
 
-func (u *UserEntity) SetRoles(roles []*RoleEntity) {
-	u.Roles = roles
+func (u *UserEntity) SetPassword(password string) {
+	u.Password = password
 }
 
-func (u *UserEntity) GetPermissions() []*PermissionEntity {
-	var permissions []*PermissionEntity
-	for _, role := range u.Roles {
-		permissions = append(permissions, role.Permissions...)
+// Implement permission.User interface.
+func (u *UserEntity) GetRoles() []permission.Role {
+	roles := make([]permission.Role, len(u.Roles))
+	for i, role := range u.Roles {
+		roles[i] = role
 	}
-	return permissions
+	return roles
+}
+
+func (u *UserEntity) SetRoles(roles []permission.Role) {
+	u.Roles = nil
+	for _, role := range roles {
+		if role, ok := role.(*RoleEntity); ok {
+			u.Roles = append(u.Roles, role)
+		}
+	}
+}
+
+// GetPermissions returns no permissions: users are granted permissions through their roles.
+func (u *UserEntity) GetPermissions() []permission.Permission {
+	return nil
 }
 
-func (u *UserEntity) SetPermissions(permissions []*PermissionEntity) {
+func (u *UserEntity) SetPermissions(permissions []permission.Permission) {
 	// Do nothing.
 }
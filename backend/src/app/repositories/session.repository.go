@@ -0,0 +1,41 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/cmo7/folly4/src/app/models"
+	gorm_impl "github.com/cmo7/folly4/src/lib/impl/gorm-repository"
+	"gorm.io/gorm"
+)
+
+// SessionGormRepository is the repository for the SessionEntity model.
+// It is a wrapper around the GormGenericRepository. This is so we can easily add custom methods to the repository.
+type SessionGormRepository struct {
+	*gorm_impl.GormGenericRepository[*models.SessionEntity]
+	db *gorm.DB
+}
+
+// The singleton instance of the SessionGormRepository.
+var sessionRepo *SessionGormRepository
+
+// GetSessionRepository returns the singleton instance of the SessionGormRepository.
+func GetSessionRepository(db *gorm.DB) *SessionGormRepository {
+	if sessionRepo == nil {
+		sessionRepo = &SessionGormRepository{
+			GormGenericRepository: gorm_impl.NewGormGenericRepository[*models.SessionEntity](db),
+			db:                    db,
+		}
+	}
+	return sessionRepo
+}
+
+// Rotate stores the new tokens of session, but only while the hash of its refresh token in the
+// database is still refreshTokenHash, and reports whether it did. Of concurrent refreshes with the
+// same refresh token, only the first rotates the session.
+func (r *SessionGormRepository) Rotate(ctx context.Context, session *models.SessionEntity, refreshTokenHash string) (bool, error) {
+	result := r.db.WithContext(ctx).Model(session).
+		Where("refresh_token_hash = ?", refreshTokenHash).
+		Select("TokenHash", "ExpiresAt", "RefreshTokenHash", "RefreshExpiresAt", "UpdatedAt").
+		Updates(session)
+	return result.RowsAffected > 0, result.Error
+}
@@ -3,10 +3,12 @@ package app
 import (
 	"net/http"
 
+	"github.com/cmo7/folly4/src/app/controllers"
+	"github.com/cmo7/folly4/src/app/mappers"
 	"github.com/cmo7/folly4/src/app/models"
 	"github.com/cmo7/folly4/src/app/services"
 	"github.com/cmo7/folly4/src/data/database"
-	"github.com/cmo7/folly4/src/lib/generics"
+	"github.com/cmo7/folly4/src/lib/generics/auth"
 	"github.com/cmo7/folly4/src/lib/generics/controller"
 	"github.com/cmo7/folly4/src/lib/generics/router"
 	"gorm.io/gorm"
@@ -28,16 +30,32 @@ func Serve() {
 		&models.RoleEntity{},
 		&models.PermissionEntity{},
 		&models.UserEntity{},
+		&models.SessionEntity{},
+		&models.AuditEntity{},
 	)
 
 	userController := controller.NewController(
 		services.GetUserService(db),
-		generics.NewGenericMapperExcluding[*models.UserEntity, *models.UserEntity]([]string{"Password"}),
+		mappers.UserMapper{},
+		mappers.UserRequestMapper{},
 	)
 
 	userRouter := router.NewRouter(userController)
 
+	// Requests are authenticated before the controllers run, so the services can check the
+	// permissions of the user and audit what they do.
+	authService := services.GetAuthService(db)
+	authenticate := auth.Middleware(authService)
+	// The entities can also be requested without a token, with the permissions of the public role.
+	authenticateOptionally := auth.OptionalMiddleware(authService)
+	authController := controllers.NewAuthController(authService)
+
 	router := http.NewServeMux()
-	router.Handle(userRouter.GetBaseRoute(), userRouter)
+	router.Handle(userRouter.GetBaseRoute(), authenticateOptionally(withAudit(userRouter)))
+	// Clients log in and refresh their tokens before they are authenticated.
+	router.Handle("POST /auth/login", withAudit(authController.Login()))
+	router.Handle("POST /auth/refresh", withAudit(authController.Refresh()))
+	router.Handle("POST /auth/logout", authenticate(withAudit(authController.Logout())))
+	router.Handle("GET /auth/me", authenticate(authController.Me()))
 	http.ListenAndServe(":8080", router)
 }
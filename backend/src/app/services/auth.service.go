@@ -0,0 +1,298 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/cmo7/folly4/src/app/models"
+	"github.com/cmo7/folly4/src/app/repositories"
+	"github.com/cmo7/folly4/src/lib/generics/apperror"
+	"github.com/cmo7/folly4/src/lib/generics/auth"
+	"github.com/cmo7/folly4/src/lib/generics/common"
+	"github.com/cmo7/folly4/src/lib/generics/filter"
+	"github.com/cmo7/folly4/src/lib/generics/relation"
+	"github.com/cmo7/folly4/src/lib/generics/util/audit"
+	"github.com/cmo7/folly4/src/lib/generics/util/permission"
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// AuthService logs users in and out, and resolves the users bearer tokens belong to. It implements
+// auth.Authenticator.
+//
+// Every login opens a session, with an access token and a refresh token. Access tokens are either
+// JSON Web Tokens signed with the configured key, whose subject is the ID of the user and whose ID
+// is the ID of the session, or opaque tokens of the session. Either way they are only valid while
+// the session exists, so logging out revokes them.
+type AuthService struct {
+	// Users and sessions are read from the repositories, as permissions cannot be checked
+	// before the user is known.
+	users    *repositories.UserGormRepository
+	roles    *repositories.RoleRepository
+	sessions *repositories.SessionGormRepository
+	audits   *repositories.AuditGormRepository
+	// Passwords are verified by the user service.
+	credentials *UserService
+	jwt         *auth.JWT
+
+	accessTokenTTL time.Duration
+	sessionTTL     time.Duration
+}
+
+// Tokens are the tokens of a session, as OAuth 2.0 token responses describe them, RFC 6749.
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"` // Seconds until the access token expires.
+	RefreshToken string `json:"refresh_token"`
+}
+
+var authService *AuthService
+
+// Return the auth service singleton.
+func GetAuthService(db *gorm.DB) *AuthService {
+	if authService == nil {
+		authService = &AuthService{
+			users:          repositories.GetUserRepository(db),
+			roles:          repositories.GetRoleRepository(db),
+			sessions:       repositories.GetSessionRepository(db),
+			audits:         repositories.GetAuditRepository(db),
+			credentials:    GetUserService(db),
+			jwt:            auth.NewJWT(),
+			accessTokenTTL: viper.GetDuration("auth.access_token_ttl"),
+			sessionTTL:     viper.GetDuration("auth.session_ttl"),
+		}
+	}
+	return authService
+}
+
+// Login opens a session for the user called username if password is their password, and returns
+// its tokens. Logins are audited whether they succeed or not.
+func (s *AuthService) Login(ctx context.Context, username string, password string) (Tokens, error) {
+	user, err := s.credentials.VerifyPassword(ctx, username, password)
+	if err != nil {
+		s.record(ctx, audit.AuditActionLogin, uuid.Nil, fmt.Errorf("login as %q: %w", username, err))
+		return Tokens{}, err
+	}
+
+	entry := s.entry(ctx)
+	session := &models.SessionEntity{UserID: user.ID, IP: entry.IP, UserAgent: entry.UserAgent}
+	session.ID = uuid.New()
+	tokens, err := s.issue(session)
+	if err == nil {
+		_, err = s.sessions.Create(ctx, session)
+	}
+	s.record(ctx, audit.AuditActionLogin, user.ID, err)
+	if err != nil {
+		return Tokens{}, err
+	}
+	return tokens, nil
+}
+
+// Refresh replaces the tokens of the session refreshToken belongs to. Refresh tokens can only be
+// used once: the session gets a new one. Refreshes are audited whether they succeed or not.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (Tokens, error) {
+	session, err := s.sessions.First(ctx, filter.Equal("RefreshTokenHash", auth.HashToken(refreshToken)))
+	if errors.Is(err, apperror.ErrNotFound) {
+		err = fmt.Errorf("%w: unknown session", auth.ErrInvalidToken)
+	}
+	if err == nil && session.Ended() {
+		err = auth.ErrExpiredToken
+		if deleteErr := s.sessions.Delete(ctx, session); deleteErr != nil {
+			log.Printf("auth: could not delete ended session %s: %v", session.ID, deleteErr)
+		}
+	}
+	if err != nil {
+		s.record(ctx, audit.AuditActionRefresh, uuid.Nil, err)
+		return Tokens{}, err
+	}
+
+	// The session is only rotated if no concurrent refresh used the refresh token first.
+	previous := session.RefreshTokenHash
+	tokens, err := s.issue(session)
+	if err == nil {
+		var rotated bool
+		rotated, err = s.sessions.Rotate(ctx, session, previous)
+		if err == nil && !rotated {
+			err = fmt.Errorf("%w: refresh token already used", auth.ErrInvalidToken)
+		}
+	}
+	s.record(ctx, audit.AuditActionRefresh, session.UserID, err)
+	if err != nil {
+		return Tokens{}, err
+	}
+	return tokens, nil
+}
+
+// Logout closes the session the access token belongs to, so neither its access token nor its
+// refresh token can be used again.
+func (s *AuthService) Logout(ctx context.Context, token string) error {
+	session, err := s.session(ctx, token)
+	if err == nil {
+		err = s.sessions.Delete(ctx, session)
+	}
+	userID := uuid.Nil
+	if session != nil {
+		userID = session.UserID
+	}
+	s.record(ctx, audit.AuditActionLogout, userID, err)
+	return err
+}
+
+// Authenticate returns the user token belongs to, with their roles, the parents of their roles
+// and the permissions of all of them.
+func (s *AuthService) Authenticate(ctx context.Context, token string) (permission.User, error) {
+	session, err := s.session(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if session.Expired() {
+		return nil, auth.ErrExpiredToken
+	}
+
+	user, err := s.users.FindOne(ctx, session.UserID, []relation.Relation{
+		relation.New("Roles.Permissions"),
+		relation.New("Roles.Parents"),
+	})
+	if errors.Is(err, apperror.ErrNotFound) {
+		// Tokens of deleted users are no longer valid.
+		return nil, fmt.Errorf("%w: unknown user", auth.ErrInvalidToken)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.linkParents(ctx, user.Roles); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// linkParents links roles to their parents, with their permissions, and those to their own
+// parents, up the role graph. Every role is loaded once, so cycles, which the permission checks
+// reject, end the walk too.
+func (s *AuthService) linkParents(ctx context.Context, roles []*models.RoleEntity) error {
+	loaded := map[uuid.UUID]*models.RoleEntity{}
+	pending := []*models.RoleEntity{}
+	for _, role := range roles {
+		loaded[role.ID] = role
+		pending = append(pending, role)
+	}
+
+	for len(pending) > 0 {
+		role := pending[0]
+		pending = pending[1:]
+		for i, parent := range role.Parents {
+			if linked, ok := loaded[parent.ID]; ok {
+				role.Parents[i] = linked
+				continue
+			}
+			linked, err := s.roles.FindOne(ctx, parent.ID, []relation.Relation{
+				relation.New("Permissions"),
+				relation.New("Parents"),
+			})
+			if err != nil {
+				return err
+			}
+			loaded[parent.ID] = linked
+			role.Parents[i] = linked
+			pending = append(pending, linked)
+		}
+	}
+	return nil
+}
+
+// session returns the session of an access token, either by the ID of a JSON Web Token or by the
+// hash of an opaque token.
+func (s *AuthService) session(ctx context.Context, token string) (*models.SessionEntity, error) {
+	var session *models.SessionEntity
+	var err error
+	if auth.IsJWT(token) {
+		claims, verifyErr := s.jwt.Verify(token)
+		if verifyErr != nil {
+			return nil, verifyErr
+		}
+		sessionID, parseErr := uuid.Parse(claims.ID)
+		if parseErr != nil {
+			return nil, fmt.Errorf("%w: bad ID", auth.ErrInvalidToken)
+		}
+		session, err = s.sessions.FindOne(ctx, sessionID, nil)
+		if err == nil && session.UserID.String() != claims.Subject {
+			return nil, fmt.Errorf("%w: bad subject", auth.ErrInvalidToken)
+		}
+	} else {
+		session, err = s.sessions.First(ctx, filter.Equal("TokenHash", auth.HashToken(token)))
+	}
+	if errors.Is(err, apperror.ErrNotFound) {
+		return nil, fmt.Errorf("%w: unknown session", auth.ErrInvalidToken)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// issue sets new tokens to session, and returns them. Only their hashes are set, besides the ID
+// of the session that JSON Web Tokens carry.
+func (s *AuthService) issue(session *models.SessionEntity) (Tokens, error) {
+	now := time.Now()
+	tokens := Tokens{TokenType: "Bearer", ExpiresIn: int64(s.accessTokenTTL.Seconds())}
+	session.ExpiresAt = now.Add(s.accessTokenTTL)
+	session.RefreshExpiresAt = now.Add(s.sessionTTL)
+
+	var err error
+	if s.jwt.Enabled() {
+		session.TokenHash = ""
+		tokens.AccessToken, err = s.jwt.Sign(auth.Claims{
+			Subject:   session.UserID.String(),
+			ID:        session.ID.String(),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: session.ExpiresAt.Unix(),
+		})
+	} else {
+		tokens.AccessToken, err = auth.NewOpaqueToken()
+		session.TokenHash = auth.HashToken(tokens.AccessToken)
+	}
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	if tokens.RefreshToken, err = auth.NewOpaqueToken(); err != nil {
+		return Tokens{}, err
+	}
+	session.RefreshTokenHash = auth.HashToken(tokens.RefreshToken)
+	return tokens, nil
+}
+
+// entry returns the audit entry of the request, with its client, or a new entry for requests
+// without one.
+func (s *AuthService) entry(ctx context.Context) *models.AuditEntity {
+	if entry := audit.GetAudit[*models.AuditEntity](ctx); entry != nil {
+		return entry
+	}
+	return &models.AuditEntity{}
+}
+
+// record stores the audit entry of a login, refresh or logout of the user with userID, which failed
+// with err unless it is nil. Failures to store it are logged, so they do not fail the action.
+func (s *AuthService) record(ctx context.Context, action audit.AuditAction, userID uuid.UUID, err error) {
+	entry := s.entry(ctx)
+	entry.SetAction(action)
+	entry.SetUserID(userID)
+	entry.SetEntity(common.EntityNameOf[*models.UserEntity]())
+	entry.SetEntityID(userID)
+	entry.SetActionResult(audit.AuditActionResultSuccess)
+	if err != nil {
+		entry.SetActionResult(audit.AuditActionResultFailure)
+		entry.SetMessage(err.Error())
+	}
+	if _, err := s.audits.Create(ctx, entry); err != nil {
+		log.Printf("auth: could not store the audit entry of %s: %v", action, err)
+	}
+}
+
+var _ auth.Authenticator = (*AuthService)(nil)
+var _ permission.User = (*models.UserEntity)(nil)
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cmo7/folly4/src/app/models"
+	"github.com/cmo7/folly4/src/lib/generics/auth"
+	"github.com/cmo7/folly4/src/lib/generics/util/audit"
+	"github.com/cmo7/folly4/src/lib/generics/util/credentials"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// testDB is the database of the tests, opened once as the services and repositories are singletons.
+var testDB *gorm.DB
+
+func openTestDB(t *testing.T) *gorm.DB {
+	if testDB == nil {
+		db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+		assert.Nil(t, err)
+		assert.Nil(t, db.AutoMigrate(&models.RoleEntity{}, &models.PermissionEntity{}, &models.UserEntity{}, &models.SessionEntity{}, &models.AuditEntity{}))
+		testDB = db
+	}
+	return testDB
+}
+
+func TestRefreshesAreAudited(t *testing.T) {
+	db := openTestDB(t)
+	hash, err := credentials.NewHasher().Hash("password1")
+	assert.Nil(t, err)
+	username := "alice-" + uuid.NewString()
+	alice := &models.UserEntity{Username: username, Email: username + "@example.com", Password: hash}
+	assert.Nil(t, db.Create(alice).Error)
+	start := time.Now()
+
+	ctx := context.Background()
+	s := GetAuthService(db)
+	tokens, err := s.Login(ctx, username, "password1")
+	assert.Nil(t, err)
+	_, err = s.Refresh(ctx, tokens.RefreshToken)
+	assert.Nil(t, err)
+	// Refresh tokens can only be used once.
+	_, err = s.Refresh(ctx, tokens.RefreshToken)
+	assert.NotNil(t, err)
+
+	var entries []models.AuditEntity
+	assert.Nil(t, db.Where("created_at >= ?", start).Order("created_at").Find(&entries).Error)
+	actions := []string{}
+	for _, entry := range entries {
+		actions = append(actions, string(entry.Action)+" "+string(entry.Result))
+	}
+	assert.Equal(t, []string{
+		string(audit.AuditActionLogin) + " " + string(audit.AuditActionResultSuccess),
+		string(audit.AuditActionRefresh) + " " + string(audit.AuditActionResultSuccess),
+		string(audit.AuditActionRefresh) + " " + string(audit.AuditActionResultFailure),
+	}, actions)
+	if assert.Len(t, entries, 3) {
+		assert.Equal(t, alice.ID, entries[1].UserID)
+	}
+}
+
+func TestUsedRefreshTokensCannotBeReplayed(t *testing.T) {
+	db := openTestDB(t)
+	hash, err := credentials.NewHasher().Hash("password1")
+	assert.Nil(t, err)
+	username := "carol-" + uuid.NewString()
+	assert.Nil(t, db.Create(&models.UserEntity{Username: username, Email: username + "@example.com", Password: hash}).Error)
+
+	ctx := context.Background()
+	s := GetAuthService(db)
+	tokens, err := s.Login(ctx, username, "password1")
+	assert.Nil(t, err)
+
+	// A concurrent refresh read the session before this one rotated it.
+	used := auth.HashToken(tokens.RefreshToken)
+	stale := &models.SessionEntity{}
+	assert.Nil(t, db.Where("refresh_token_hash = ?", used).First(stale).Error)
+
+	refreshed, err := s.Refresh(ctx, tokens.RefreshToken)
+	assert.Nil(t, err)
+
+	_, err = s.issue(stale)
+	assert.Nil(t, err)
+	rotated, err := s.sessions.Rotate(ctx, stale, used)
+	assert.Nil(t, err)
+	assert.False(t, rotated)
+
+	// The used refresh token is rejected, and the one that replaced it still works.
+	_, err = s.Refresh(ctx, tokens.RefreshToken)
+	assert.ErrorIs(t, err, auth.ErrInvalidToken)
+	_, err = s.Refresh(ctx, refreshed.RefreshToken)
+	assert.Nil(t, err)
+}
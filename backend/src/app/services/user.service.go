@@ -1,11 +1,16 @@
 package services
 
 import (
+	"context"
+
 	"github.com/cmo7/folly4/src/app/models"
 	"github.com/cmo7/folly4/src/app/repositories"
+	"github.com/cmo7/folly4/src/lib/generics/filter"
 	"github.com/cmo7/folly4/src/lib/generics/service"
 	auditservice "github.com/cmo7/folly4/src/lib/impl/audit-service"
+	credentialsservice "github.com/cmo7/folly4/src/lib/impl/credentials-service"
 	permissionservice "github.com/cmo7/folly4/src/lib/impl/permission-service"
+	validationservice "github.com/cmo7/folly4/src/lib/impl/validation-service"
 	"gorm.io/gorm"
 )
 
@@ -19,9 +24,17 @@ type UserService struct {
 	// This method would not be part of the CRUD operations.
 	// The user service can also have a method to get a user by email.
 	// This method would not be part of the CRUD operations.
-	// The user service can also have a method to get a user by username and password.
-	// This method would not be part of the CRUD operations.
 	// ...
+
+	// The credentials layer verifies passwords, see VerifyPassword.
+	credentials *credentialsservice.CredentialsService[*models.UserEntity]
+}
+
+// VerifyPassword returns the user called username if password is their password, or
+// credentials.ErrInvalidCredentials. It does not check permissions, as users verify their
+// password before they are known.
+func (s *UserService) VerifyPassword(ctx context.Context, username string, password string) (*models.UserEntity, error) {
+	return s.credentials.Verify(ctx, filter.Equal("username", username), password)
 }
 
 var userService *UserService
@@ -30,6 +43,8 @@ var userService *UserService
 // It composes the user service with the following layers:
 // - User Repository: Interacts with the database.
 // - User Audit Service: Logs all CRUD operations performed on the user entity.
+// - User Credentials Service: Hashes the passwords of the users before they are logged or stored.
+// - User Validation Service: Rejects invalid users, with the passwords as the clients sent them.
 // - User Permission Service: Checks if the user has the required permissions to perform CRUD operations.
 // - User Service: Adds user-specific functionality to the user permission service.
 //
@@ -40,27 +55,41 @@ func instantiate(db *gorm.DB) {
 
 	// The user service is a composition of:
 	// - A user permission service.
+	// - A user validation service.
+	// - A user credentials service.
 	// - A user audit service.
 	// - A user repository.
 
 	// Layer 1: User Repository. The lowest layer in the user service. This layer interacts with the database.
 	userRepository := repositories.GetUserRepository(db)
 
-	// Layer 2: User Audit Service. Adds audit functionality to the user repository. The audit service will log all the CRUD operations performed on the user entity.
+	// Layer 2: User Audit Service. Adds audit functionality to the user repository. The audit service will log all the CRUD operations performed on the user entity, without the password hashes.
 	userAuditService := auditservice.NewAuditService(
 		userRepository,
 		repositories.GetAuditRepository(db),
+		"Password",
 	)
 
-	// Layer 3: User Permission Service. Adds permission functionality to the user audit service. The permission service will check if the user has the required permissions to perform the CRUD operations on the user entity.
-	userPermissionService := permissionservice.NewPermissionService(
+	// Layer 3: User Credentials Service. Hashes the passwords of the users before the audit service logs them, and verifies passwords against the stored hashes.
+	userCredentialsService := credentialsservice.NewCredentialsService(
 		userAuditService,
+		userRepository,
+		"Password",
+	)
+
+	// Layer 4: User Validation Service. Validates the users before they are created or updated, so invalid users are rejected with the problems of their fields.
+	userValidationService := validationservice.NewValidationService(userCredentialsService)
+
+	// Layer 5: User Permission Service. Adds permission functionality to the user validation service. The permission service will check if the user has the required permissions to perform the CRUD operations on the user entity.
+	userPermissionService := permissionservice.NewPermissionService(
+		userValidationService,
 		repositories.GetPermissionRepository(db),
 	)
 
-	// Layer 4: User Service. Adds user-specific functionality to the user permission service. The user service will have methods that are specific to the user entity.
+	// Layer 6: User Service. Adds user-specific functionality to the user permission service. The user service will have methods that are specific to the user entity.
 	userService = &UserService{
-		userPermissionService,
+		CrudService: userPermissionService,
+		credentials: userCredentialsService,
 	}
 }
 
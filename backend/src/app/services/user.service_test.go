@@ -0,0 +1,40 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cmo7/folly4/src/app/models"
+	"github.com/cmo7/folly4/src/lib/generics/util/audit"
+	"github.com/cmo7/folly4/src/lib/generics/util/permission"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordsAreRedactedFromAudits(t *testing.T) {
+	db := openTestDB(t)
+	s := GetUserService(db)
+	username := "bob-" + uuid.NewString()
+
+	ctx := audit.WithAudit(permission.WithSystem(context.Background()), &models.AuditEntity{})
+	bob, err := s.Create(ctx, &models.UserEntity{Username: username, Email: username + "@example.com", Password: "password1"})
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(bob.Password, "$argon2id"))
+
+	ctx = audit.WithAudit(permission.WithSystem(context.Background()), &models.AuditEntity{})
+	bob.Password = "password2"
+	_, err = s.Update(ctx, bob)
+	assert.Nil(t, err)
+
+	var entries []models.AuditEntity
+	assert.Nil(t, db.Where("new_value LIKE ?", "%"+username+"%").Find(&entries).Error)
+	assert.Len(t, entries, 2)
+	for _, entry := range entries {
+		assert.Contains(t, entry.NewValue, `"Password":"REDACTED"`)
+		for _, value := range []string{entry.NewValue, entry.PrevValue} {
+			assert.NotContains(t, value, "$argon2id")
+			assert.NotContains(t, value, "password")
+		}
+	}
+}
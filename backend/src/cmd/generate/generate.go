@@ -0,0 +1,15 @@
+package generate
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var GenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Code generation commands",
+	Long:  `Code generation commands`,
+}
+
+func init() {
+	GenerateCmd.AddCommand(mapperCmd)
+}
@@ -0,0 +1,90 @@
+package generate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cmo7/folly4/src/lib/chroma"
+	"github.com/cmo7/folly4/src/lib/generics/mappergen"
+	"github.com/spf13/cobra"
+)
+
+var mapperFlags struct {
+	name     string
+	pkg      string
+	output   string
+	excluded []string
+	included []string
+	nested   map[string]string
+}
+
+var mapperCmd = &cobra.Command{
+	Use:   "mapper <input type> <output type>",
+	Short: "Generate a mapper",
+	Long: `Generate a mapper that copies the fields of the input type to the output type without reflection.
+Types are given as the directory of their package and their name, behind a * for pointers:
+
+  folly generate mapper --exclude Password --output src/app/mappers/user.mapper.go '*src/app/models.UserEntity' '*src/app/models.UserEntity'
+
+Relations are mapped with the mappers of their types, named with --nested, or must be excluded:
+
+  folly generate mapper --exclude Password --nested Roles=RoleMapper ...`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		input, err := mappergen.ParseType(args[0])
+		if err != nil {
+			return err
+		}
+		output, err := mappergen.ParseType(args[1])
+		if err != nil {
+			return err
+		}
+
+		// Without an output file the mapper is written to the package of the input type.
+		dir := input.Dir
+		if mapperFlags.output != "" {
+			dir = filepath.Dir(mapperFlags.output)
+		}
+		pkg := mapperFlags.pkg
+		if pkg == "" {
+			pkg = filepath.Base(dir)
+			if abs, err := filepath.Abs(dir); err == nil {
+				pkg = filepath.Base(abs)
+			}
+		}
+
+		source, err := mappergen.Generate(mappergen.Config{
+			Input:    input,
+			Output:   output,
+			Name:     mapperFlags.name,
+			Package:  pkg,
+			Dir:      dir,
+			Excluded: mapperFlags.excluded,
+			Included: mapperFlags.included,
+			Nested:   mapperFlags.nested,
+		})
+		if err != nil {
+			return err
+		}
+
+		if mapperFlags.output == "" {
+			_, err = cmd.OutOrStdout().Write(source)
+			return err
+		}
+		if err := os.WriteFile(mapperFlags.output, source, 0o644); err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), "Wrote mapper to", chroma.Color("green")(mapperFlags.output))
+		return nil
+	},
+}
+
+func init() {
+	mapperCmd.Flags().StringVar(&mapperFlags.name, "name", "", "name of the mapper type (default <input>Mapper or <input>To<output>Mapper)")
+	mapperCmd.Flags().StringVar(&mapperFlags.pkg, "package", "", "package of the generated file (default the name of its directory)")
+	mapperCmd.Flags().StringVarP(&mapperFlags.output, "output", "o", "", "file to write the mapper to (default stdout)")
+	mapperCmd.Flags().StringSliceVar(&mapperFlags.excluded, "exclude", nil, "input fields not copied")
+	mapperCmd.Flags().StringSliceVar(&mapperFlags.included, "include", nil, "input fields copied, all when empty")
+	mapperCmd.Flags().StringToStringVar(&mapperFlags.nested, "nested", nil, "mappers of the relations, as <input field>=<mapper>")
+}
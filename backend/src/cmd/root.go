@@ -5,6 +5,7 @@ import (
 	"os"
 
 	"github.com/cmo7/folly4/src/cmd/config"
+	"github.com/cmo7/folly4/src/cmd/generate"
 	"github.com/cmo7/folly4/src/cmd/serve"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -22,6 +23,7 @@ func init() {
 	cobra.OnInitialize(initConfig)
 	rootCmd.AddCommand(config.ConfigCmd)
 	rootCmd.AddCommand(serve.ServeCmd)
+	rootCmd.AddCommand(generate.GenerateCmd)
 }
 
 func Execute() {
@@ -0,0 +1,130 @@
+// Package apperror provides the kinds of errors repositories and services return for requests
+// that cannot be served, so controllers can answer them with the right status code.
+//
+// Errors of a kind match their sentinel with errors.Is, and keep the error that caused them,
+// if any, in their chain:
+//
+//	err := apperror.New(apperror.ErrNotFound, gorm.ErrRecordNotFound, "User %s not found", id)
+//	errors.Is(err, apperror.ErrNotFound)    // true
+//	errors.Is(err, gorm.ErrRecordNotFound) // true
+//	err.Error()                             // "User ... not found"
+package apperror
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrBadRequest is the kind of errors for requests that are malformed.
+	ErrBadRequest = errors.New("bad request")
+	// ErrUnauthorized is the kind of errors for requests without valid credentials.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrForbidden is the kind of errors for requests the user has no permission for.
+	ErrForbidden = errors.New("forbidden")
+	// ErrNotFound is the kind of errors for entities that do not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is the kind of errors for changes that conflict with the stored entities,
+	// such as duplicated unique values.
+	ErrConflict = errors.New("conflict")
+	// ErrValidation is the kind of errors for entities with invalid fields, see ValidationError.
+	ErrValidation = errors.New("validation failed")
+	// ErrUnavailable is the kind of errors for requests that cannot be served at the moment, such
+	// as transactions that lost a deadlock, but may succeed if retried.
+	ErrUnavailable = errors.New("service unavailable")
+)
+
+// kindError is an error of a kind, with a message for clients and the error that caused it.
+type kindError struct {
+	kind    error
+	message string
+	cause   error
+}
+
+func (e *kindError) Error() string {
+	return e.message
+}
+
+func (e *kindError) Unwrap() []error {
+	if e.cause == nil {
+		return []error{e.kind}
+	}
+	return []error{e.kind, e.cause}
+}
+
+// New returns an error of the kind, one of the sentinel errors of the package, caused by cause,
+// which may be nil. The message is written for clients, the cause is not shown to them.
+func New(kind error, cause error, format string, args ...interface{}) error {
+	return &kindError{kind: kind, message: fmt.Sprintf(format, args...), cause: cause}
+}
+
+// BadRequest returns an ErrBadRequest error with the message of err.
+func BadRequest(err error) error {
+	if errors.Is(err, ErrBadRequest) {
+		return err
+	}
+	return New(ErrBadRequest, err, "%s", err.Error())
+}
+
+// Unauthorized returns an ErrUnauthorized error.
+func Unauthorized(format string, args ...interface{}) error {
+	return New(ErrUnauthorized, nil, format, args...)
+}
+
+// Forbidden returns an ErrForbidden error.
+func Forbidden(format string, args ...interface{}) error {
+	return New(ErrForbidden, nil, format, args...)
+}
+
+// NotFound returns an ErrNotFound error.
+func NotFound(format string, args ...interface{}) error {
+	return New(ErrNotFound, nil, format, args...)
+}
+
+// Conflict returns an ErrConflict error.
+func Conflict(format string, args ...interface{}) error {
+	return New(ErrConflict, nil, format, args...)
+}
+
+// FieldError is a problem with the value of a field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError is the error of an entity with invalid fields. It matches ErrValidation.
+type ValidationError struct {
+	Fields []FieldError
+	Err    error // The error that caused it, if any.
+}
+
+// Validation returns a ValidationError for the problems of the fields.
+func Validation(fields ...FieldError) error {
+	return &ValidationError{Fields: fields}
+}
+
+func (e *ValidationError) Error() string {
+	problems := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		problems[i] = f.Field + ": " + f.Message
+	}
+	return ErrValidation.Error() + ": " + strings.Join(problems, "; ")
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// Fields returns the problems of the fields of the ValidationError in the chain of err, if any.
+func Fields(err error) []FieldError {
+	var validation *ValidationError
+	if errors.As(err, &validation) {
+		return validation.Fields
+	}
+	return nil
+}
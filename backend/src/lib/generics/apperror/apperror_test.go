@@ -0,0 +1,55 @@
+package apperror
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	cause := errors.New("record not found")
+	err := New(ErrNotFound, cause, "User %d not found", 7)
+
+	if err.Error() != "User 7 not found" {
+		t.Errorf("Error() = %q, want the message", err.Error())
+	}
+	if !errors.Is(err, ErrNotFound) || !errors.Is(err, cause) {
+		t.Errorf("Expected %v to match its kind and its cause", err)
+	}
+	if errors.Is(err, ErrConflict) {
+		t.Errorf("Expected %v not to match other kinds", err)
+	}
+	if !errors.Is(Forbidden("no"), ErrForbidden) || !errors.Is(Unauthorized("no"), ErrUnauthorized) || !errors.Is(Conflict("no"), ErrConflict) {
+		t.Errorf("Expected the shortcuts to return errors of their kind")
+	}
+}
+
+func TestBadRequest(t *testing.T) {
+	cause := errors.New("invalid UUID length")
+	err := BadRequest(cause)
+
+	if err.Error() != cause.Error() || !errors.Is(err, ErrBadRequest) || !errors.Is(err, cause) {
+		t.Errorf("BadRequest(%v) = %v, want a bad request with its message", cause, err)
+	}
+	if BadRequest(err) != err {
+		t.Errorf("Expected BadRequest not to wrap bad requests again")
+	}
+}
+
+func TestValidation(t *testing.T) {
+	fields := []FieldError{{Field: "email", Message: "must be an email"}, {Field: "username", Message: "is required"}}
+	err := Validation(fields...)
+
+	if err.Error() != "validation failed: email: must be an email; username: is required" {
+		t.Errorf("Error() = %q", err.Error())
+	}
+	if !errors.Is(err, ErrValidation) {
+		t.Errorf("Expected %v to match ErrValidation", err)
+	}
+	if wrapped := New(ErrBadRequest, err, "invalid user"); !reflect.DeepEqual(Fields(wrapped), fields) {
+		t.Errorf("Fields = %v, want %v", Fields(wrapped), fields)
+	}
+	if Fields(errors.New("other")) != nil {
+		t.Errorf("Expected no fields for other errors")
+	}
+}
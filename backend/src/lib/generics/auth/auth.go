@@ -0,0 +1,132 @@
+// Package auth authenticates HTTP requests by their bearer token, either a JSON Web Token signed
+// with the configured key or an opaque session token, and puts the user they belong to, with
+// their roles and permissions, in the context of the request for the permission checks of the
+// services.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/cmo7/folly4/src/lib/generics/apperror"
+	"github.com/cmo7/folly4/src/lib/generics/controller"
+	"github.com/cmo7/folly4/src/lib/generics/util/permission"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	// JSON Web Tokens are signed with jwt_key, which must be configured for them to be accepted:
+	//
+	//	[auth]
+	//	jwt_key = "a long random secret"
+	viper.SetDefault("auth.jwt_algorithm", "HS256")
+	viper.SetDefault("auth.jwt_key", "")
+	viper.SetDefault("auth.issuer", "folly")
+	viper.SetDefault("auth.access_token_ttl", "15m")
+	viper.SetDefault("auth.session_ttl", "720h")
+}
+
+var (
+	// ErrInvalidToken is returned for bearer tokens that are malformed, forged or revoked.
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrExpiredToken is returned for bearer tokens that have expired.
+	ErrExpiredToken = errors.New("expired token")
+)
+
+// Authenticator resolves the user a bearer token belongs to, with their roles and permissions.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (permission.User, error)
+}
+
+// AuthenticatorFunc is a function that implements Authenticator.
+type AuthenticatorFunc func(ctx context.Context, token string) (permission.User, error)
+
+func (f AuthenticatorFunc) Authenticate(ctx context.Context, token string) (permission.User, error) {
+	return f(ctx, token)
+}
+
+// BearerToken returns the token of the Authorization header of r, if it has one.
+func BearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	token = strings.TrimSpace(token)
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+// NewOpaqueToken returns a random session token. Only its hash, see HashToken, is stored.
+func NewOpaqueToken() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// HashToken returns the hash an opaque token is stored and looked up by.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// WithUser returns a context with user, their roles and their permissions, as the permission
+// checks read them.
+func WithUser(ctx context.Context, user permission.User) context.Context {
+	ctx = permission.WithUser(ctx, user)
+	ctx = permission.WithRoles(ctx, user.GetRoles())
+	return permission.WithPermissions(ctx, user.GetPermissions())
+}
+
+// Middleware returns a middleware that authenticates requests with authenticator before the next
+// handler serves them. Requests without a valid bearer token are answered with 401 Unauthorized.
+func Middleware(authenticator Authenticator) func(http.Handler) http.Handler {
+	return middleware(authenticator, false)
+}
+
+// OptionalMiddleware returns a middleware like Middleware's, but requests without a bearer token
+// are served as permission.Anonymous, with the public role. Requests with an invalid bearer token
+// are still answered with 401 Unauthorized.
+func OptionalMiddleware(authenticator Authenticator) func(http.Handler) http.Handler {
+	return middleware(authenticator, true)
+}
+
+func middleware(authenticator Authenticator, optional bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := BearerToken(r)
+			if !ok && optional {
+				next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), permission.Anonymous)))
+				return
+			}
+			if !ok {
+				unauthorized(w, r, apperror.Unauthorized("missing bearer token"))
+				return
+			}
+			user, err := authenticator.Authenticate(r.Context(), token)
+			if err != nil {
+				unauthorized(w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), user)))
+		})
+	}
+}
+
+// unauthorized answers a request that could not be authenticated. Token errors are client errors,
+// other errors, such as those of the database, are not.
+func unauthorized(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrExpiredToken) {
+		err = apperror.New(apperror.ErrUnauthorized, err, "%s", err.Error())
+	}
+	if errors.Is(err, apperror.ErrUnauthorized) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="`+viper.GetString("auth.issuer")+`"`)
+	}
+	controller.WriteError(w, r, err)
+}
@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cmo7/folly4/src/lib/generics/common"
+	"github.com/cmo7/folly4/src/lib/generics/util/permission"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type account struct {
+	id    uuid.UUID
+	roles []permission.Role
+}
+
+func (a *account) GetID() uuid.UUID                         { return a.id }
+func (a *account) SetID(id uuid.UUID)                       { a.id = id }
+func (a *account) GetName() string                          { return a.id.String() }
+func (a *account) GetEntityName() common.EntityName         { return "Account" }
+func (a *account) GetRoles() []permission.Role              { return a.roles }
+func (a *account) SetRoles(roles []permission.Role)         { a.roles = roles }
+func (a *account) GetPermissions() []permission.Permission  { return nil }
+func (a *account) SetPermissions(_ []permission.Permission) {}
+
+func TestBearerToken(t *testing.T) {
+	for header, expected := range map[string]string{
+		"Bearer abc": "abc",
+		"bearer abc": "abc",
+		"Basic abc":  "",
+		"Bearer ":    "",
+		"":           "",
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Authorization", header)
+		token, ok := BearerToken(r)
+		assert.Equal(t, expected, token, header)
+		assert.Equal(t, expected != "", ok, header)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	alice := &account{id: uuid.New()}
+	authenticator := AuthenticatorFunc(func(ctx context.Context, token string) (permission.User, error) {
+		switch token {
+		case "alice":
+			return alice, nil
+		case "expired":
+			return nil, ErrExpiredToken
+		}
+		return nil, errors.New("database is down")
+	})
+	var seen permission.User
+	handler := Middleware(authenticator)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = permission.GetUser(r.Context())
+		_, hasRoles := permission.GetRoles(r.Context())
+		_, hasPermissions := permission.GetPermissions(r.Context())
+		assert.True(t, hasRoles && hasPermissions)
+	}))
+
+	serve := func(header string) *httptest.ResponseRecorder {
+		seen = nil
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/User", nil)
+		if header != "" {
+			r.Header.Set("Authorization", header)
+		}
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve("Bearer alice")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, alice, seen)
+
+	for _, header := range []string{"", "Basic alice", "Bearer expired"} {
+		w = serve(header)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, header)
+		assert.Contains(t, w.Header().Get("WWW-Authenticate"), "Bearer", header)
+		assert.Nil(t, seen)
+	}
+
+	w = serve("Bearer other")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Nil(t, seen)
+}
+
+func TestOptionalMiddleware(t *testing.T) {
+	authenticator := AuthenticatorFunc(func(ctx context.Context, token string) (permission.User, error) {
+		return nil, ErrInvalidToken
+	})
+	var seen permission.User
+	handler := OptionalMiddleware(authenticator)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = permission.GetUser(r.Context())
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/User", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, permission.Anonymous, seen)
+
+	seen = nil
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/User", nil)
+	r.Header.Set("Authorization", "Bearer forged")
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Nil(t, seen)
+}
+
+func TestOpaqueTokens(t *testing.T) {
+	token, err := NewOpaqueToken()
+	assert.Nil(t, err)
+	other, _ := NewOpaqueToken()
+	assert.NotEqual(t, token, other)
+	assert.False(t, IsJWT(token))
+	assert.Equal(t, HashToken(token), HashToken(token))
+	assert.NotEqual(t, token, HashToken(token))
+}
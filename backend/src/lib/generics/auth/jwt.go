@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Claims are the claims of the JSON Web Tokens the JWT signs, RFC 7519.
+type Claims struct {
+	Issuer    string `json:"iss,omitempty"`
+	Subject   string `json:"sub"`
+	ID        string `json:"jti,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+	NotBefore int64  `json:"nbf,omitempty"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+}
+
+// JWT signs and verifies JSON Web Tokens with a shared key, with HMAC SHA-256, SHA-384 or SHA-512.
+type JWT struct {
+	Algorithm string // HS256, HS384 or HS512.
+	Key       []byte
+	Issuer    string // Issuer of the tokens, verified when not empty.
+}
+
+// NewJWT returns the JWT configured under auth. Tokens cannot be signed or verified without a key.
+func NewJWT() *JWT {
+	return &JWT{
+		Algorithm: viper.GetString("auth.jwt_algorithm"),
+		Key:       []byte(viper.GetString("auth.jwt_key")),
+		Issuer:    viper.GetString("auth.issuer"),
+	}
+}
+
+// Enabled reports whether a key is configured, so the JWT can sign and verify tokens.
+func (j *JWT) Enabled() bool {
+	return len(j.Key) > 0
+}
+
+func (j *JWT) hash() (func() hash.Hash, error) {
+	if !j.Enabled() {
+		return nil, fmt.Errorf("%w: no key is configured", ErrInvalidToken)
+	}
+	switch j.Algorithm {
+	case "HS256":
+		return sha256.New, nil
+	case "HS384":
+		return sha512.New384, nil
+	case "HS512":
+		return sha512.New, nil
+	}
+	return nil, fmt.Errorf("unsupported JWT algorithm %q", j.Algorithm)
+}
+
+// Sign returns the signed token of claims. The issuer of the JWT is set when claims have none.
+func (j *JWT) Sign(claims Claims) (string, error) {
+	newHash, err := j.hash()
+	if err != nil {
+		return "", err
+	}
+	if claims.Issuer == "" {
+		claims.Issuer = j.Issuer
+	}
+	encodedHeader, err := encodeSegment(header{Algorithm: j.Algorithm, Type: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	encodedClaims, err := encodeSegment(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := encodedHeader + "." + encodedClaims
+	return signingInput + "." + sign(newHash, j.Key, signingInput), nil
+}
+
+// Verify returns the claims of a token signed by the JWT, which has not expired. Tokens signed with
+// other algorithms than the JWT's, "none" included, are rejected.
+func (j *JWT) Verify(token string) (Claims, error) {
+	claims := Claims{}
+	newHash, err := j.hash()
+	if err != nil {
+		return claims, err
+	}
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return claims, fmt.Errorf("%w: malformed JWT", ErrInvalidToken)
+	}
+
+	h := header{}
+	if err := decodeSegment(segments[0], &h); err != nil || h.Algorithm != j.Algorithm {
+		return claims, fmt.Errorf("%w: unexpected JWT header", ErrInvalidToken)
+	}
+	expected := sign(newHash, j.Key, segments[0]+"."+segments[1])
+	if !hmac.Equal([]byte(expected), []byte(segments[2])) {
+		return claims, fmt.Errorf("%w: bad JWT signature", ErrInvalidToken)
+	}
+	if err := decodeSegment(segments[1], &claims); err != nil {
+		return claims, fmt.Errorf("%w: malformed JWT claims", ErrInvalidToken)
+	}
+
+	now := time.Now().Unix()
+	switch {
+	case claims.ExpiresAt == 0 || now >= claims.ExpiresAt:
+		return claims, ErrExpiredToken
+	case claims.NotBefore != 0 && now < claims.NotBefore:
+		return claims, fmt.Errorf("%w: JWT not valid yet", ErrInvalidToken)
+	case j.Issuer != "" && claims.Issuer != j.Issuer:
+		return claims, fmt.Errorf("%w: unexpected JWT issuer", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+// IsJWT reports whether a bearer token is a JSON Web Token, rather than an opaque token.
+func IsJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+func sign(newHash func() hash.Hash, key []byte, signingInput string) string {
+	mac := hmac.New(newHash, key)
+	mac.Write([]byte(signingInput))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func encodeSegment(v interface{}) (string, error) {
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	bytes, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bytes, v)
+}
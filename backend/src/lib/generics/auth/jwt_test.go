@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestJWT() *JWT {
+	return &JWT{Algorithm: "HS256", Key: []byte("test key"), Issuer: "folly"}
+}
+
+func validClaims() Claims {
+	now := time.Now()
+	return Claims{Subject: "42", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Minute).Unix()}
+}
+
+func TestJWTSignAndVerify(t *testing.T) {
+	for _, algorithm := range []string{"HS256", "HS384", "HS512"} {
+		j := newTestJWT()
+		j.Algorithm = algorithm
+		token, err := j.Sign(validClaims())
+		assert.Nil(t, err)
+		assert.True(t, IsJWT(token))
+
+		claims, err := j.Verify(token)
+		assert.Nil(t, err)
+		assert.Equal(t, "42", claims.Subject)
+		assert.Equal(t, "folly", claims.Issuer)
+	}
+}
+
+func TestJWTRejectsInvalidTokens(t *testing.T) {
+	j := newTestJWT()
+	token, _ := j.Sign(validClaims())
+	segments := strings.Split(token, ".")
+
+	otherKey := newTestJWT()
+	otherKey.Key = []byte("other key")
+	forged, _ := otherKey.Sign(validClaims())
+
+	otherAlgorithm := newTestJWT()
+	otherAlgorithm.Algorithm = "HS512"
+	downgraded, _ := otherAlgorithm.Sign(validClaims())
+
+	otherIssuer := newTestJWT()
+	otherIssuer.Issuer = "someone else"
+	foreign, _ := otherIssuer.Sign(validClaims())
+
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	tampered := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"1","exp":9999999999}`))
+
+	for _, invalid := range []string{
+		"",
+		"not.a.jwt",
+		forged,
+		downgraded,
+		foreign,
+		none + "." + segments[1] + ".",
+		segments[0] + "." + tampered + "." + segments[2],
+	} {
+		_, err := j.Verify(invalid)
+		assert.True(t, errors.Is(err, ErrInvalidToken), invalid)
+	}
+
+	expired := validClaims()
+	expired.ExpiresAt = time.Now().Add(-time.Second).Unix()
+	token, _ = j.Sign(expired)
+	_, err := j.Verify(token)
+	assert.True(t, errors.Is(err, ErrExpiredToken))
+}
+
+func TestJWTRequiresKey(t *testing.T) {
+	j := newTestJWT()
+	token, _ := j.Sign(validClaims())
+
+	j.Key = nil
+	_, err := j.Sign(validClaims())
+	assert.True(t, errors.Is(err, ErrInvalidToken))
+	_, err = j.Verify(token)
+	assert.True(t, errors.Is(err, ErrInvalidToken))
+}
@@ -1,6 +1,10 @@
 package common
 
-import "github.com/google/uuid"
+import (
+	"reflect"
+
+	"github.com/google/uuid"
+)
 
 // Entity is an interface that represents a generic entity.
 // It provides a method to retrieve the entity's ID.
@@ -21,3 +25,13 @@ type EntityName string
 func (e EntityName) String() string {
 	return string(e)
 }
+
+// EntityNameOf returns the entity name of E. Pointer types are instantiated first, so
+// GetEntityName may have a value receiver.
+func EntityNameOf[E Entity]() EntityName {
+	var zero E
+	if t := reflect.TypeOf(zero); t != nil && t.Kind() == reflect.Pointer {
+		zero = reflect.New(t.Elem()).Interface().(E)
+	}
+	return zero.GetEntityName()
+}
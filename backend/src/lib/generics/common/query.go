@@ -0,0 +1,41 @@
+package common
+
+import (
+	"reflect"
+	"strings"
+)
+
+// QueryTag is the struct tag used to restrict how clients may query an entity field.
+//
+//	Password string `query:"-"`        // neither filterable nor sortable
+//	Bio      string `query:"nosort"`   // filterable only
+//	Token    string `query:"nofilter"` // sortable only
+const QueryTag = "query"
+
+// QueryOptions tells whether a field may be used in filters and in sort orders.
+type QueryOptions struct {
+	Filterable bool
+	Sortable   bool
+}
+
+// ParseQueryTag reads the QueryTag of a struct field. Fields without the tag are
+// filterable and sortable.
+func ParseQueryTag(tag reflect.StructTag) QueryOptions {
+	options := QueryOptions{Filterable: true, Sortable: true}
+	value, ok := tag.Lookup(QueryTag)
+	if !ok {
+		return options
+	}
+	for _, option := range strings.Split(value, ",") {
+		switch strings.TrimSpace(option) {
+		case "-":
+			options.Filterable = false
+			options.Sortable = false
+		case "nofilter":
+			options.Filterable = false
+		case "nosort":
+			options.Sortable = false
+		}
+	}
+	return options
+}
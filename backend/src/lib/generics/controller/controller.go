@@ -1,12 +1,20 @@
 package controller
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"reflect"
 	"strconv"
+	"strings"
 
 	"github.com/cmo7/folly4/src/lib/generics"
+	"github.com/cmo7/folly4/src/lib/generics/apperror"
 	"github.com/cmo7/folly4/src/lib/generics/common"
+	"github.com/cmo7/folly4/src/lib/generics/fieldset"
 	"github.com/cmo7/folly4/src/lib/generics/filter"
 	"github.com/cmo7/folly4/src/lib/generics/order"
 	"github.com/cmo7/folly4/src/lib/generics/pagination"
@@ -34,37 +42,78 @@ type Controller interface {
 // Every method returns an http.HandlerFunc that can be used to handle HTTP requests.
 
 // The controller uses a generics.Mapper to map entities to DTOs and vice versa.
+// Every entity in a response goes through mapper, and every request body through reverse.
 type CrudController[E common.Entity, D common.Entity] struct {
 	service.CrudService[E]
-	mapper generics.Mapper[E, D]
+	mapper  generics.Mapper[E, D]
+	reverse generics.Mapper[D, E]
 }
 
-func NewController[E common.Entity, D common.Entity](crudService service.CrudService[E], mapper generics.Mapper[E, D]) *CrudController[E, D] {
+// NewController creates a controller that responds with the DTOs mapper maps entities to and reads
+// request bodies as DTOs mapped to entities by reverse. A nil reverse mapper defaults to
+// generics.NewReverseMapper, so clients cannot set the generics.ServerOwnedFields.
+func NewController[E common.Entity, D common.Entity](crudService service.CrudService[E], mapper generics.Mapper[E, D], reverse generics.Mapper[D, E]) *CrudController[E, D] {
+	if reverse == nil {
+		reverse = generics.NewReverseMapper[D, E]()
+	}
 	return &CrudController[E, D]{
 		CrudService: crudService,
 		mapper:      mapper,
+		reverse:     reverse,
+	}
+}
+
+// decodeBody reads a DTO from the request body and maps it to the entity it describes.
+func (c *CrudController[E, D]) decodeBody(r *http.Request) (E, error) {
+	var dto D
+	var entity E
+	if err := json.NewDecoder(r.Body).Decode(&dto); err != nil {
+		return entity, err
+	}
+	if isNil(dto) {
+		return entity, errors.New("request body is empty")
+	}
+	return c.reverse.Map(dto), nil
+}
+
+// respond writes entity to the response as the DTO it maps to, pruned to the fieldset.
+func (c *CrudController[E, D]) respond(w http.ResponseWriter, entity E, fields fieldset.Fieldset) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c.dto(entity, fields))
+}
+
+// dto maps entity to its DTO, pruned to the fieldset. Nil entities stay nil.
+func (c *CrudController[E, D]) dto(entity E, fields fieldset.Fieldset) interface{} {
+	if isNil(entity) {
+		return nil
 	}
+	return fieldset.Prune(c.mapper.Map(entity), fields)
+}
+
+// isNil reports whether v is nil or a nil pointer.
+func isNil(v interface{}) bool {
+	value := reflect.ValueOf(v)
+	return !value.IsValid() || (value.Kind() == reflect.Pointer && value.IsNil())
 }
 
 func (c *CrudController[E, D]) Create() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Parse the request body.
-		var entity E
-		if err := json.NewDecoder(r.Body).Decode(&entity); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		entity, err := c.decodeBody(r)
+		if err != nil {
+			WriteError(w, r, apperror.BadRequest(err))
 			return
 		}
 
 		// Create the entity.
 		createdEntity, err := c.CrudService.Create(r.Context(), entity)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			WriteError(w, r, err)
 			return
 		}
 
 		// Send the response.
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(createdEntity)
+		c.respond(w, createdEntity, nil)
 	}
 }
 
@@ -73,20 +122,29 @@ func (c *CrudController[E, D]) Find() http.HandlerFunc {
 		id := r.PathValue("id")
 		uid, err := uuid.Parse(id)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			WriteError(w, r, apperror.BadRequest(err))
 			return
 		}
 
-		relations := extractRelationsFromRequest(r)
+		relations, err := extractRelationsFromRequest[E](r)
+		if err != nil {
+			WriteError(w, r, apperror.BadRequest(err))
+			return
+		}
+		fields, err := extractFieldsetFromRequest(r, c.mapper)
+		if err != nil {
+			WriteError(w, r, apperror.BadRequest(err))
+			return
+		}
 
-		entity, err := c.CrudService.FindOne(r.Context(), uid, relations)
+		ctx := fieldset.WithFieldset(r.Context(), common.EntityNameOf[E](), fields)
+		entity, err := c.CrudService.FindOne(ctx, uid, relations)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			WriteError(w, r, err)
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(entity)
+		c.respond(w, entity, fields)
 	}
 }
 
@@ -95,13 +153,13 @@ func (c *CrudController[E, D]) Update() http.HandlerFunc {
 		id := r.PathValue("id")
 		uid, err := uuid.Parse(id)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			WriteError(w, r, apperror.BadRequest(err))
 			return
 		}
 
-		var entity E
-		if err := json.NewDecoder(r.Body).Decode(&entity); err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		entity, err := c.decodeBody(r)
+		if err != nil {
+			WriteError(w, r, apperror.BadRequest(err))
 			return
 		}
 
@@ -109,12 +167,11 @@ func (c *CrudController[E, D]) Update() http.HandlerFunc {
 
 		updatedEntity, err := c.CrudService.Update(r.Context(), entity)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			WriteError(w, r, err)
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(updatedEntity)
+		c.respond(w, updatedEntity, nil)
 	}
 }
 
@@ -123,15 +180,19 @@ func (c *CrudController[E, D]) Delete() http.HandlerFunc {
 		id := r.PathValue("id")
 		uid, err := uuid.Parse(id)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			WriteError(w, r, apperror.BadRequest(err))
 			return
 		}
 
 		entity, err := c.CrudService.FindOne(r.Context(), uid, nil)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
 
 		err = c.CrudService.Delete(r.Context(), entity)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			WriteError(w, r, err)
 			return
 		}
 
@@ -141,29 +202,87 @@ func (c *CrudController[E, D]) Delete() http.HandlerFunc {
 
 func (c *CrudController[E, D]) FindAll() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		pageable := extractPageableFromRequest(r)
-		filter := extractFilterFromRequest(r)
-		relations := extractRelationsFromRequest(r)
-		orderBys := extractOrderBysFromRequest(r)
+		filter, err := extractFilterFromRequest[E](r)
+		if err != nil {
+			WriteError(w, r, apperror.BadRequest(err))
+			return
+		}
+		c.findAll(w, r, filter)
+	}
+}
 
-		page, err := c.CrudService.FindAll(r.Context(), pageable, filter, relations, orderBys)
+// Search works like FindAll, but reads the filter from the request body in the JSON filter format,
+// for filters too long for a query string. Paging, order and relations are still query parameters.
+func (c *CrudController[E, D]) Search() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := extractFilterFromBody[E](w, r)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			WriteError(w, r, apperror.BadRequest(err))
 			return
 		}
+		c.findAll(w, r, filter)
+	}
+}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(page)
+func (c *CrudController[E, D]) findAll(w http.ResponseWriter, r *http.Request, filter filter.Filter) {
+	pageable, err := extractPageableFromRequest[E](r)
+	if err != nil {
+		WriteError(w, r, apperror.BadRequest(err))
+		return
+	}
+	relations, err := extractRelationsFromRequest[E](r)
+	if err != nil {
+		WriteError(w, r, apperror.BadRequest(err))
+		return
+	}
+	orderBys, err := extractOrderBysFromRequest(r)
+	if err != nil {
+		WriteError(w, r, apperror.BadRequest(err))
+		return
+	}
+	fields, err := extractFieldsetFromRequest(r, c.mapper)
+	if err != nil {
+		WriteError(w, r, apperror.BadRequest(err))
+		return
+	}
+
+	ctx := fieldset.WithFieldset(r.Context(), common.EntityNameOf[E](), fields)
+	var page pagination.Page[E]
+	if r.URL.Query().Has("cursor") {
+		// ?cursor= asks for keyset pagination, starting from the beginning when empty.
+		cursor := pagination.Cursor(r.URL.Query().Get("cursor"))
+		page, err = c.CrudService.FindAllCursor(ctx, pagination.NewCursorPageable(cursor, pageable.Size), filter, relations, orderBys)
+	} else {
+		page, err = c.CrudService.FindAll(ctx, pageable, filter, relations, orderBys)
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	// Links are followed with GET, so only listings read with GET get them.
+	if r.Method == http.MethodGet {
+		if links := pageLinks(r.URL, page); links != "" {
+			w.Header().Set("Link", links)
+		}
 	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pagination.Map(page, func(entity E) interface{} {
+		return c.dto(entity, fields)
+	}))
 }
 
 func (c *CrudController[E, D]) Count() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		filter := extractFilterFromRequest(r)
+		filter, err := extractFilterFromRequest[E](r)
+		if err != nil {
+			WriteError(w, r, apperror.BadRequest(err))
+			return
+		}
 
 		count, err := c.CrudService.Count(r.Context(), filter)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			WriteError(w, r, err)
 			return
 		}
 
@@ -177,7 +296,7 @@ func (c *CrudController[E, D]) Associate() http.HandlerFunc {
 		id := r.PathValue("id")
 		uid, err := uuid.Parse(id)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			WriteError(w, r, apperror.BadRequest(err))
 			return
 		}
 
@@ -185,18 +304,17 @@ func (c *CrudController[E, D]) Associate() http.HandlerFunc {
 		targetID := r.URL.Query().Get("target")
 		targetUID, err := uuid.Parse(targetID)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			WriteError(w, r, apperror.BadRequest(err))
 			return
 		}
 
 		entity, err := c.CrudService.Associate(r.Context(), uid, association, targetUID)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			WriteError(w, r, err)
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(entity)
+		c.respond(w, entity, nil)
 	}
 }
 
@@ -205,7 +323,7 @@ func (c *CrudController[E, D]) Dissociate() http.HandlerFunc {
 		id := r.PathValue("id")
 		uid, err := uuid.Parse(id)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			WriteError(w, r, apperror.BadRequest(err))
 			return
 		}
 
@@ -213,18 +331,17 @@ func (c *CrudController[E, D]) Dissociate() http.HandlerFunc {
 		targetID := r.URL.Query().Get("target")
 		targetUID, err := uuid.Parse(targetID)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			WriteError(w, r, apperror.BadRequest(err))
 			return
 		}
 
 		entity, err := c.CrudService.Dissociate(r.Context(), uid, association, targetUID)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			WriteError(w, r, err)
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(entity)
+		c.respond(w, entity, nil)
 	}
 }
 
@@ -233,13 +350,13 @@ func (c *CrudController[E, D]) Exists() http.HandlerFunc {
 		id := r.PathValue("id")
 		uid, err := uuid.Parse(id)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			WriteError(w, r, apperror.BadRequest(err))
 			return
 		}
 
 		exists, err := c.CrudService.Exists(r.Context(), uid)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			WriteError(w, r, err)
 			return
 		}
 
@@ -250,38 +367,77 @@ func (c *CrudController[E, D]) Exists() http.HandlerFunc {
 
 func (c *CrudController[E, D]) Random() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		entity, err := c.CrudService.Random(r.Context())
+		fields, err := extractFieldsetFromRequest(r, c.mapper)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			WriteError(w, r, apperror.BadRequest(err))
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(entity)
+		ctx := fieldset.WithFieldset(r.Context(), common.EntityNameOf[E](), fields)
+		entity, err := c.CrudService.Random(ctx)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
 
+		c.respond(w, entity, fields)
 	}
 }
 
 func (c *CrudController[E, D]) First() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		filter := extractFilterFromRequest(r)
+		filter, err := extractFilterFromRequest[E](r)
+		if err != nil {
+			WriteError(w, r, apperror.BadRequest(err))
+			return
+		}
 
-		entity, err := c.CrudService.First(r.Context(), filter)
+		fields, err := extractFieldsetFromRequest(r, c.mapper)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			WriteError(w, r, apperror.BadRequest(err))
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(entity)
+		ctx := fieldset.WithFieldset(r.Context(), common.EntityNameOf[E](), fields)
+		entity, err := c.CrudService.First(ctx, filter)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+
+		c.respond(w, entity, fields)
 	}
 }
 
 func (c *CrudController[E, D]) Combo() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		entities, err := c.CrudService.ComboBox(r.Context(), extractPageableFromRequest(r), extractFilterFromRequest(r), extractRelationsFromRequest(r), extractOrderBysFromRequest(r))
+		filter, err := extractFilterFromRequest[E](r)
+		if err != nil {
+			WriteError(w, r, apperror.BadRequest(err))
+			return
+		}
+
+		orderBys, err := extractOrderBysFromRequest(r)
+		if err != nil {
+			WriteError(w, r, apperror.BadRequest(err))
+			return
+		}
+
+		pageable, err := extractPageableFromRequest[E](r)
+		if err != nil {
+			WriteError(w, r, apperror.BadRequest(err))
+			return
+		}
+
+		relations, err := extractRelationsFromRequest[E](r)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			WriteError(w, r, apperror.BadRequest(err))
+			return
+		}
+
+		entities, err := c.CrudService.ComboBox(r.Context(), pageable, filter, relations, orderBys)
+		if err != nil {
+			WriteError(w, r, err)
 			return
 		}
 
@@ -290,58 +446,121 @@ func (c *CrudController[E, D]) Combo() http.HandlerFunc {
 	}
 }
 
-func extractPageableFromRequest(r *http.Request) pagination.Pageable {
-	page := r.URL.Query().Get("page")
-	size := r.URL.Query().Get("size")
-	intPage, err := strconv.Atoi(page)
+// extractPageableFromRequest reads the page, size and count query parameters. The size falls back to
+// the default page size of E and is capped at its maximum page size, see pagination.LimitsFor.
+func extractPageableFromRequest[E common.Entity](r *http.Request) (pagination.Pageable, error) {
+	limits := pagination.LimitsFor(string(common.EntityNameOf[E]()))
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	size, err := strconv.Atoi(r.URL.Query().Get("size"))
 	if err != nil {
-		intPage = 1
+		size = 0
 	}
-	intSize, err := strconv.Atoi(size)
+	count, err := pagination.ParseCountMode(r.URL.Query().Get("count"))
 	if err != nil {
-		intSize = 10
+		return pagination.Pageable{}, err
 	}
 
 	return pagination.Pageable{
-		Page: intPage,
-		Size: intSize,
-	}
+		Page:  page,
+		Size:  limits.Size(size),
+		Count: count,
+	}, nil
 }
 
-func extractFilterFromRequest(r *http.Request) filter.Filter {
-	filterString := r.URL.Query().Get("filter")
+// extractFilterFromRequest parses the filter query parameter and coerces its values
+// to the types of the fields of E. Any error is a client error.
+// The parameter holds either the compact syntax or, when it starts with '{', the JSON filter format.
+func extractFilterFromRequest[E common.Entity](r *http.Request) (filter.Filter, error) {
+	filterString := strings.TrimSpace(r.URL.Query().Get("filter"))
 	if filterString == "" {
-		return nil
+		return nil, nil
+	}
+	var f filter.Filter
+	var err error
+	if strings.HasPrefix(filterString, "{") {
+		f, err = filter.ParseJSON([]byte(filterString))
+	} else {
+		f, err = filter.Parse(filterString)
 	}
-	f, err := filter.Parse(filterString)
 	if err != nil {
-		return nil
+		return nil, err
 	}
-	return f
+	return coerceFilter[E](f)
 }
 
-func extractOrderBysFromRequest(r *http.Request) []order.OrderBy {
-	orderString := r.URL.Query().Get("order")
-	if orderString == "" {
-		return nil
+// coerceFilter coerces the values of f to the types of the fields of E and brings it to its
+// normalized form, so equivalent filters reach the repository in the same shape.
+func coerceFilter[E common.Entity](f filter.Filter) (filter.Filter, error) {
+	coerced, err := filter.SchemaOf[E]().Coerce(f)
+	if err != nil {
+		return nil, err
 	}
-	order, err := order.Parse(orderString)
+	return filter.Normalize(coerced), nil
+}
+
+// maxFilterBodySize limits the size of the filters sent to the search endpoint.
+const maxFilterBodySize = 1 << 20
+
+// extractFilterFromBody reads a filter in the JSON filter format from the request body and coerces
+// its values to the types of the fields of E. An empty body means no filter.
+func extractFilterFromBody[E common.Entity](w http.ResponseWriter, r *http.Request) (filter.Filter, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxFilterBodySize))
 	if err != nil {
-		return nil
+		return nil, err
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, nil
 	}
-	return order
+	f, err := filter.ParseJSON(body)
+	if err != nil {
+		return nil, err
+	}
+	return coerceFilter[E](f)
 }
 
-func extractRelationsFromRequest(r *http.Request) []relation.Relation {
-	rel := r.URL.Query().Get("relations")
-	if rel == "" {
-		return nil
+// extractOrderBysFromRequest parses the order query parameter. Any error is a client error.
+func extractOrderBysFromRequest(r *http.Request) ([]order.OrderBy, error) {
+	orderString := r.URL.Query().Get("order")
+	if orderString == "" {
+		return nil, nil
 	}
+	return order.Parse(orderString)
+}
 
-	relations, err := relation.Parse(rel)
+// extractRelationsFromRequest parses the relations query parameter and coerces the values of the
+// filters of the relations to the types of the fields of the related entities. Any error is a client error.
+func extractRelationsFromRequest[E common.Entity](r *http.Request) ([]relation.Relation, error) {
+	relations, err := relation.Parse(r.URL.Query().Get("relations"))
 	if err != nil {
-		return nil
+		return nil, err
 	}
+	return coerceRelations(filter.SchemaOf[E](), relations)
+}
 
-	return relations
+// coerceRelations coerces the filters of relations of the entities of schema. Relations the
+// schema does not know are left for the repository to reject.
+func coerceRelations(schema *filter.Schema, relations []relation.Relation) ([]relation.Relation, error) {
+	for i, rel := range relations {
+		related, ok := schema.Related(rel.Name)
+		if !ok {
+			continue
+		}
+		if rel.Filter != nil {
+			coerced, err := related.Coerce(rel.Filter)
+			if err != nil {
+				return nil, fmt.Errorf("relation %s: %w", rel.Name, err)
+			}
+			relations[i].Filter = filter.Normalize(coerced)
+		}
+		nested, err := coerceRelations(related, rel.Relations)
+		if err != nil {
+			return nil, err
+		}
+		relations[i].Relations = nested
+	}
+	return relations, nil
 }
@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cmo7/folly4/src/lib/generics"
+	"github.com/cmo7/folly4/src/lib/generics/common"
+	"github.com/cmo7/folly4/src/lib/generics/filter"
+	"github.com/cmo7/folly4/src/lib/generics/order"
+	"github.com/cmo7/folly4/src/lib/generics/pagination"
+	"github.com/cmo7/folly4/src/lib/generics/relation"
+	"github.com/cmo7/folly4/src/lib/generics/service"
+	"github.com/google/uuid"
+)
+
+type account struct {
+	ID       uuid.UUID
+	Username string
+	Password string `json:",omitempty"`
+}
+
+func (a *account) GetID() uuid.UUID                 { return a.ID }
+func (a *account) SetID(id uuid.UUID)               { a.ID = id }
+func (a *account) GetName() string                  { return a.Username }
+func (a *account) GetEntityName() common.EntityName { return "Account" }
+
+// accountService stores the accounts it is given. Methods the tests do not use panic.
+type accountService struct {
+	service.CrudService[*account]
+	saved *account
+}
+
+func (s *accountService) Create(ctx context.Context, payload *account) (*account, error) {
+	s.saved = payload
+	created := *payload
+	created.ID = uuid.New()
+	return &created, nil
+}
+
+func (s *accountService) Update(ctx context.Context, payload *account) (*account, error) {
+	s.saved = payload
+	return payload, nil
+}
+
+func (s *accountService) FindAll(ctx context.Context, pageable pagination.Pageable, filter filter.Filter, relations []relation.Relation, orderBys []order.OrderBy) (pagination.Page[*account], error) {
+	return pagination.NewPage([]*account{{ID: uuid.New(), Username: "alice", Password: "hash"}}, 1, pageable.Size, 1, 1), nil
+}
+
+func newAccountController() (*CrudController[*account, *account], *accountService) {
+	s := &accountService{}
+	return NewController(s, generics.NewGenericMapperExcluding[*account, *account]([]string{"Password"}), nil), s
+}
+
+func TestResponsesAreMapped(t *testing.T) {
+	c, _ := newAccountController()
+
+	w := httptest.NewRecorder()
+	c.FindAll()(w, httptest.NewRequest(http.MethodGet, "/Account/", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("FindAll responded %d: %s", w.Code, w.Body)
+	}
+	if strings.Contains(w.Body.String(), "hash") || !strings.Contains(w.Body.String(), "alice") {
+		t.Errorf("Expected the listing to leave the password out, got %s", w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	c.Create()(w, httptest.NewRequest(http.MethodPost, "/Account/", strings.NewReader(`{"Username":"bob","Password":"secret"}`)))
+	if strings.Contains(w.Body.String(), "secret") || !strings.Contains(w.Body.String(), "bob") {
+		t.Errorf("Expected the created account to leave the password out, got %s", w.Body)
+	}
+}
+
+func TestRequestsAreMapped(t *testing.T) {
+	c, s := newAccountController()
+	forged := uuid.New()
+
+	w := httptest.NewRecorder()
+	body := `{"ID":"` + forged.String() + `","Username":"bob","Password":"secret"}`
+	c.Create()(w, httptest.NewRequest(http.MethodPost, "/Account/", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Create responded %d: %s", w.Code, w.Body)
+	}
+	if s.saved.ID != uuid.Nil || s.saved.Username != "bob" || s.saved.Password != "secret" {
+		t.Errorf("Expected the ID sent by the client to be dropped, got %+v", s.saved)
+	}
+
+	id := uuid.New()
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPut, "/Account/"+id.String(), strings.NewReader(body))
+	r.SetPathValue("id", id.String())
+	c.Update()(w, r)
+	if s.saved.ID != id {
+		t.Errorf("Expected the ID of the path to be updated, got %s", s.saved.ID)
+	}
+	var updated map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &updated)
+	if updated["ID"] != id.String() || updated["Password"] != nil {
+		t.Errorf("Expected the updated account without its password, got %v", updated)
+	}
+
+	w = httptest.NewRecorder()
+	c.Create()(w, httptest.NewRequest(http.MethodPost, "/Account/", strings.NewReader(`null`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected an empty body to be rejected, got %d", w.Code)
+	}
+}
+
+func TestErrorsAreProblems(t *testing.T) {
+	c, _ := newAccountController()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/Account/not-an-id", nil)
+	r.SetPathValue("id", "not-an-id")
+	c.Find()(w, r)
+	if w.Code != http.StatusBadRequest || w.Header().Get("Content-Type") != ProblemContentType {
+		t.Errorf("Expected a malformed id to be a bad request problem, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	w = httptest.NewRecorder()
+	c.FindAll()(w, httptest.NewRequest(http.MethodGet, "/Account/?filter=unknown:eq:1", nil))
+	if w.Code != http.StatusBadRequest || w.Header().Get("Content-Type") != ProblemContentType {
+		t.Errorf("Expected an unknown filter field to be a bad request problem, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+}
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/cmo7/folly4/src/lib/generics"
+	"github.com/cmo7/folly4/src/lib/generics/common"
+	"github.com/cmo7/folly4/src/lib/generics/fieldset"
+	"github.com/cmo7/folly4/src/lib/generics/filter"
+)
+
+// extractFieldsetFromRequest parses the sparse fieldset of the request and resolves the names in it
+// to the Go names of the fields and relations of E, which the repository and fieldset.Prune expect.
+// When the mapper is a generics.FieldMapper, the fields of E it does not map cannot be selected,
+// and neither can the fields of relations the mappers of their types do not map, when the mapper
+// is a generics.RelationMapper. Any error is a client error.
+func extractFieldsetFromRequest[E common.Entity, D common.Entity](r *http.Request, mapper generics.Mapper[E, D]) (fieldset.Fieldset, error) {
+	fs, err := fieldset.Parse(r.URL.Query())
+	if err != nil || fs == nil {
+		return nil, err
+	}
+	fieldMapper, _ := interface{}(mapper).(generics.FieldMapper)
+
+	resolved := fieldset.Fieldset{}
+	for path, fields := range fs {
+		schema, goPath, pathMapper, err := resolveFieldsetPath(filter.SchemaOf[E](), fieldMapper, path)
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, 0, len(fields))
+		for _, field := range fields {
+			name, ok := fieldsetName(schema, field)
+			if ok && pathMapper != nil {
+				ok = pathMapper.MapsField(name)
+			}
+			if !ok {
+				return nil, fmt.Errorf("%w: %s", fieldset.ErrUnknownField, field)
+			}
+			names = append(names, name)
+		}
+		resolved[goPath] = names
+	}
+	return resolved, nil
+}
+
+// resolveFieldsetPath resolves a dotted relation path of a fieldset to its Go names, the schema of
+// the entities at the end of it and the mapper of those entities, starting from the mapper of the
+// schema. The mapper is nil when the fields at the path are not restricted. Relations a mapper
+// does not map cannot be in the path.
+func resolveFieldsetPath(schema *filter.Schema, mapper generics.FieldMapper, path string) (*filter.Schema, string, generics.FieldMapper, error) {
+	if path == "" {
+		return schema, "", mapper, nil
+	}
+	goNames := []string{}
+	for _, segment := range strings.Split(path, ".") {
+		name, ok := schema.RelationName(segment)
+		if ok && mapper != nil {
+			ok = mapper.MapsField(name)
+		}
+		if !ok {
+			return nil, "", nil, fmt.Errorf("%w: fields[%s] names no relation", fieldset.ErrInvalidFieldset, path)
+		}
+		schema, _ = schema.Related(segment)
+		goNames = append(goNames, name)
+
+		// Relations are copied as is unless the mapper maps them with the mapper of their type.
+		if relationMapper, ok := mapper.(generics.RelationMapper); ok {
+			mapper = relationMapper.MapperOf(name)
+		} else {
+			mapper = nil
+		}
+	}
+	return schema, strings.Join(goNames, "."), mapper, nil
+}
+
+// fieldsetName returns the Go name of a field or a relation of the schema.
+func fieldsetName(schema *filter.Schema, name string) (string, bool) {
+	if strings.Contains(name, ".") {
+		return "", false
+	}
+	if field, ok := schema.Field(name); ok {
+		return field.Name, true
+	}
+	return schema.RelationName(name)
+}
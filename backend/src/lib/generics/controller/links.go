@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/cmo7/folly4/src/lib/generics/pagination"
+)
+
+// pageLinks returns the RFC 8288 Link header of a page of the listing at u: the first, previous, next
+// and last pages of offset listings, and the first, previous and next pages of keyset listings.
+// The links keep every query parameter of u but the position in the listing.
+func pageLinks[T any](u *url.URL, page pagination.Page[T]) string {
+	links := []string{}
+	link := func(rel string, param string, value string) {
+		query := u.Query()
+		query.Set(param, value)
+		query.Set("size", strconv.Itoa(page.Size))
+		target := url.URL{Path: u.Path, RawQuery: query.Encode()}
+		links = append(links, fmt.Sprintf("<%s>; rel=%q", target.String(), rel))
+	}
+
+	if page.Keyset() {
+		link("first", "cursor", "")
+		if page.PrevCursor != "" {
+			link("prev", "cursor", string(page.PrevCursor))
+		}
+		if page.NextCursor != "" {
+			link("next", "cursor", string(page.NextCursor))
+		}
+		return strings.Join(links, ", ")
+	}
+
+	link("first", "page", "1")
+	if page.HasPrev {
+		link("prev", "page", strconv.Itoa(page.Page-1))
+	}
+	if page.HasNext {
+		link("next", "page", strconv.Itoa(page.Page+1))
+	}
+	if page.Count != pagination.CountNone && page.TotalPages > 0 {
+		link("last", "page", strconv.FormatInt(page.TotalPages, 10))
+	}
+	return strings.Join(links, ", ")
+}
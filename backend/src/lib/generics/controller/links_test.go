@@ -0,0 +1,37 @@
+package controller
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/cmo7/folly4/src/lib/generics/pagination"
+)
+
+func TestPageLinks(t *testing.T) {
+	u, _ := url.Parse("/User/?filter=age:gt:3&page=2&size=1000&count=exact")
+
+	tests := []struct {
+		page     pagination.Page[int]
+		expected string
+	}{
+		{pagination.NewPage([]int{1, 2}, 2, 2, 10, 5),
+			`</User/?count=exact&filter=age%3Agt%3A3&page=1&size=2>; rel="first", ` +
+				`</User/?count=exact&filter=age%3Agt%3A3&page=1&size=2>; rel="prev", ` +
+				`</User/?count=exact&filter=age%3Agt%3A3&page=3&size=2>; rel="next", ` +
+				`</User/?count=exact&filter=age%3Agt%3A3&page=3&size=2>; rel="last"`},
+		{pagination.NewPage([]int{}, 1, 2, 0, 0),
+			`</User/?count=exact&filter=age%3Agt%3A3&page=1&size=2>; rel="first"`},
+		{pagination.NewUncountedPage([]int{1}, 1, 1, true),
+			`</User/?count=exact&filter=age%3Agt%3A3&page=1&size=1>; rel="first", ` +
+				`</User/?count=exact&filter=age%3Agt%3A3&page=2&size=1>; rel="next"`},
+		{pagination.NewCursorPage([]int{1}, 1, "abc", ""),
+			`</User/?count=exact&cursor=&filter=age%3Agt%3A3&page=2&size=1>; rel="first", ` +
+				`</User/?count=exact&cursor=abc&filter=age%3Agt%3A3&page=2&size=1>; rel="next"`},
+	}
+
+	for _, test := range tests {
+		if links := pageLinks(u, test.page); links != test.expected {
+			t.Errorf("pageLinks = %s, expected %s", links, test.expected)
+		}
+	}
+}
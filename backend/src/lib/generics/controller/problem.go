@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/cmo7/folly4/src/lib/generics/apperror"
+	"github.com/cmo7/folly4/src/lib/generics/fieldset"
+	"github.com/cmo7/folly4/src/lib/generics/filter"
+	"github.com/cmo7/folly4/src/lib/generics/order"
+	"github.com/cmo7/folly4/src/lib/generics/pagination"
+	"github.com/cmo7/folly4/src/lib/generics/relation"
+)
+
+// ProblemContentType is the content type of error responses.
+const ProblemContentType = "application/problem+json"
+
+// Problem is the body of error responses, an RFC 7807 problem details object.
+type Problem struct {
+	Type     string                `json:"type"`
+	Title    string                `json:"title"`
+	Status   int                   `json:"status"`
+	Detail   string                `json:"detail,omitempty"`
+	Instance string                `json:"instance,omitempty"`
+	Errors   []apperror.FieldError `json:"errors,omitempty"` // Problems of the fields of invalid entities.
+}
+
+// WriteError answers a request that failed with err with a problem, with the status code of the
+// kind of err, see apperror. Errors of no kind are server errors: they are logged, and their
+// messages are not shown to clients. Unavailable errors are logged too.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	status := errorStatus(err)
+	problem := Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   err.Error(),
+		Instance: r.URL.Path,
+		Errors:   apperror.Fields(err),
+	}
+	if status >= http.StatusInternalServerError {
+		log.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+	}
+	if status == http.StatusInternalServerError {
+		problem.Detail = ""
+	}
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(problem)
+}
+
+// errorStatus returns the status code for an error returned while serving a request. Fields that
+// do not exist or may not be filtered or sorted by are client errors, like malformed requests.
+func errorStatus(err error) int {
+	for _, kind := range []struct {
+		err    error
+		status int
+	}{
+		{apperror.ErrBadRequest, http.StatusBadRequest},
+		{apperror.ErrUnauthorized, http.StatusUnauthorized},
+		{apperror.ErrForbidden, http.StatusForbidden},
+		{apperror.ErrNotFound, http.StatusNotFound},
+		{apperror.ErrConflict, http.StatusConflict},
+		{apperror.ErrValidation, http.StatusUnprocessableEntity},
+		{apperror.ErrUnavailable, http.StatusServiceUnavailable},
+	} {
+		if errors.Is(err, kind.err) {
+			return kind.status
+		}
+	}
+	for _, clientErr := range []error{
+		filter.ErrUnknownField, filter.ErrNotFilterable, filter.ErrInvalidValue,
+		order.ErrUnknownField, order.ErrNotSortable, order.ErrInvalidDirection,
+		pagination.ErrInvalidCursor,
+		fieldset.ErrInvalidFieldset, fieldset.ErrUnknownField,
+		relation.ErrInvalidRelation, relation.ErrUnknownRelation, relation.ErrTooDeep,
+	} {
+		if errors.Is(err, clientErr) {
+			return http.StatusBadRequest
+		}
+	}
+	return http.StatusInternalServerError
+}
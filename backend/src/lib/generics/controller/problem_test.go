@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/cmo7/folly4/src/lib/generics/apperror"
+	"github.com/cmo7/folly4/src/lib/generics/filter"
+)
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		detail string
+	}{
+		{apperror.NotFound("Account not found"), http.StatusNotFound, "Account not found"},
+		{apperror.Conflict("Account already exists"), http.StatusConflict, "Account already exists"},
+		{apperror.Forbidden("permission denied"), http.StatusForbidden, "permission denied"},
+		{apperror.Unauthorized("invalid token"), http.StatusUnauthorized, "invalid token"},
+		{apperror.BadRequest(errors.New("invalid UUID")), http.StatusBadRequest, "invalid UUID"},
+		{filter.ErrUnknownField, http.StatusBadRequest, filter.ErrUnknownField.Error()},
+		{apperror.Validation(apperror.FieldError{Field: "email", Message: "is required"}), http.StatusUnprocessableEntity, "validation failed: email: is required"},
+		{apperror.New(apperror.ErrUnavailable, nil, "try again"), http.StatusServiceUnavailable, "try again"},
+		{errors.New("connection refused"), http.StatusInternalServerError, ""},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		WriteError(w, httptest.NewRequest(http.MethodGet, "/Account/1", nil), test.err)
+
+		if w.Code != test.status || w.Header().Get("Content-Type") != ProblemContentType {
+			t.Errorf("%v: responded %d %s, want %d %s", test.err, w.Code, w.Header().Get("Content-Type"), test.status, ProblemContentType)
+		}
+		var problem Problem
+		if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+			t.Fatal(err)
+		}
+		expected := Problem{
+			Type:     "about:blank",
+			Title:    http.StatusText(test.status),
+			Status:   test.status,
+			Detail:   test.detail,
+			Instance: "/Account/1",
+			Errors:   apperror.Fields(test.err),
+		}
+		if !reflect.DeepEqual(problem, expected) {
+			t.Errorf("%v: problem %+v, want %+v", test.err, problem, expected)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+// Package fieldset provides sparse fieldsets: the fields of an entity, and of the relations
+// loaded with it, that a client wants to read.
+//
+// Clients send them as query parameters, the fields of the entity in fields and the fields
+// of a relation in fields[<relation path>]:
+//
+//	?relations=roles.permissions&fields=id,username,email&fields[roles]=name&fields[roles.permissions]=entity,operation
+//
+// The primary and foreign keys needed to load the relations are read even when not selected,
+// but only the selected fields are returned.
+package fieldset
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/cmo7/folly4/src/lib/generics/common"
+)
+
+var (
+	// ErrInvalidFieldset is returned for fieldset parameters that are malformed.
+	ErrInvalidFieldset = errors.New("invalid fieldset")
+	// ErrUnknownField is returned when a fieldset names a field that is not returned to clients.
+	ErrUnknownField = errors.New("unknown field")
+)
+
+// Fieldset maps a relation path to the fields selected in the entities at that path. The empty
+// path is the entity itself. Paths without fields select every field.
+type Fieldset map[string][]string
+
+// Parse reads the fields and fields[<relation path>] parameters of a query. A query without them
+// selects every field and returns a nil Fieldset.
+func Parse(query url.Values) (Fieldset, error) {
+	var fs Fieldset
+	for key, values := range query {
+		var path string
+		switch {
+		case key == "fields":
+		case strings.HasPrefix(key, "fields[") && strings.HasSuffix(key, "]"):
+			path = strings.TrimSpace(key[len("fields[") : len(key)-1])
+			if path == "" {
+				return nil, fmt.Errorf("%w: %s names no relation", ErrInvalidFieldset, key)
+			}
+		default:
+			continue
+		}
+
+		fields := []string{}
+		for _, value := range values {
+			for _, field := range strings.Split(value, ",") {
+				if field = strings.TrimSpace(field); field == "" {
+					return nil, fmt.Errorf("%w: empty field in %s", ErrInvalidFieldset, key)
+				}
+				if !slices.Contains(fields, field) {
+					fields = append(fields, field)
+				}
+			}
+		}
+		if fs == nil {
+			fs = Fieldset{}
+		}
+		fs[path] = fields
+	}
+	return fs, nil
+}
+
+// Fields returns the fields selected at a relation path. ok is false when every field is selected.
+func (fs Fieldset) Fields(path string) (fields []string, ok bool) {
+	fields, ok = fs[path]
+	return fields, ok
+}
+
+type contextKey struct {
+	entity common.EntityName
+}
+
+// WithFieldset returns a context in which the reads of entity are narrowed to fs.
+// Reads of other entities made with the context are not affected.
+func WithFieldset(ctx context.Context, entity common.EntityName, fs Fieldset) context.Context {
+	if len(fs) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, contextKey{entity}, fs)
+}
+
+// FromContext returns the fieldset of the reads of entity, or nil when every field is read.
+func FromContext(ctx context.Context, entity common.EntityName) Fieldset {
+	fs, _ := ctx.Value(contextKey{entity}).(Fieldset)
+	return fs
+}
+
+// Prune returns v, a struct, a slice of structs or a pointer to either, with only the fields
+// selected by fs, ready to be encoded as JSON. Struct fields are written under their json name.
+// The fieldset must name fields and relations by their Go names, as in "Roles.Permissions".
+func Prune(v interface{}, fs Fieldset) interface{} {
+	if len(fs) == 0 {
+		return v
+	}
+	return prune(reflect.ValueOf(v), fs, "")
+}
+
+func prune(v reflect.Value, fs Fieldset, path string) interface{} {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return prune(v.Elem(), fs, path)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = prune(v.Index(i), fs, path)
+		}
+		return items
+	case reflect.Struct:
+	default:
+		return v.Interface()
+	}
+
+	selected, narrowed := fs.Fields(path)
+	object := map[string]interface{}{}
+	for _, sf := range reflect.VisibleFields(v.Type()) {
+		if sf.Anonymous || !sf.IsExported() {
+			continue
+		}
+		name, ok := jsonName(sf)
+		if !ok {
+			continue
+		}
+		field, err := v.FieldByIndexErr(sf.Index)
+		if err != nil {
+			continue
+		}
+
+		fieldPath := sf.Name
+		if path != "" {
+			fieldPath = path + "." + sf.Name
+		}
+		switch {
+		case fs.covers(fieldPath):
+			object[name] = prune(field, fs, fieldPath)
+		case !narrowed || slices.Contains(selected, sf.Name):
+			object[name] = field.Interface()
+		}
+	}
+	return object
+}
+
+// covers reports whether the fieldset narrows the relation at path or a relation below it.
+func (fs Fieldset) covers(path string) bool {
+	for key := range fs {
+		if key == path || strings.HasPrefix(key, path+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonName returns the name encoding/json writes a struct field under, and false for fields it skips.
+func jsonName(sf reflect.StructField) (string, bool) {
+	tag, ok := sf.Tag.Lookup("json")
+	if !ok {
+		return sf.Name, true
+	}
+	name := strings.Split(tag, ",")[0]
+	switch name {
+	case "-":
+		return "", strings.HasPrefix(tag, "-,")
+	case "":
+		return sf.Name, true
+	}
+	return name, true
+}
@@ -0,0 +1,111 @@
+package fieldset
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+type permission struct {
+	Entity    string `json:"entity"`
+	Operation string `json:"operation"`
+}
+
+type role struct {
+	Name        string        `json:"name"`
+	Permissions []*permission `json:"permissions"`
+}
+
+type user struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	Email    string
+	Password string `json:"-"`
+	Roles    []role `json:"roles"`
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected Fieldset
+	}{
+		{"", nil},
+		{"page=1&size=10", nil},
+		{"fields=id,username", Fieldset{"": {"id", "username"}}},
+		{"fields=id&fields=username,id", Fieldset{"": {"id", "username"}}},
+		{"fields[roles]=name&fields[roles.permissions]=entity", Fieldset{"roles": {"name"}, "roles.permissions": {"entity"}}},
+		{"fields= id , username", Fieldset{"": {"id", "username"}}},
+	}
+
+	for _, test := range tests {
+		query, _ := url.ParseQuery(test.query)
+		result, err := Parse(query)
+		if err != nil {
+			t.Errorf("Parse(%q) returned an error: %v", test.query, err)
+		}
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("Parse(%q) = %v, want %v", test.query, result, test.expected)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, input := range []string{"fields=", "fields=id,,name", "fields[]=id", "fields[roles]="} {
+		query, _ := url.ParseQuery(input)
+		if _, err := Parse(query); !errors.Is(err, ErrInvalidFieldset) {
+			t.Errorf("Parse(%q) = %v, want %v", input, err, ErrInvalidFieldset)
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	u := user{
+		ID:       1,
+		Username: "alice",
+		Email:    "alice@example.com",
+		Password: "secret",
+		Roles: []role{{
+			Name:        "admin",
+			Permissions: []*permission{{Entity: "User", Operation: "READ"}},
+		}},
+	}
+
+	if result := Prune(u, nil); !reflect.DeepEqual(result, u) {
+		t.Errorf("Prune without a fieldset = %v, want the value itself", result)
+	}
+
+	result := Prune(&u, Fieldset{"": {"ID", "Email"}})
+	expected := map[string]interface{}{"id": 1, "Email": "alice@example.com"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Prune of the root = %v, want %v", result, expected)
+	}
+
+	result = Prune([]user{u}, Fieldset{"": {"Username"}, "Roles.Permissions": {"Operation"}})
+	expected = map[string]interface{}{
+		"username": "alice",
+		"roles": []interface{}{map[string]interface{}{
+			"name":        "admin",
+			"permissions": []interface{}{map[string]interface{}{"operation": "READ"}},
+		}},
+	}
+	if !reflect.DeepEqual(result, []interface{}{expected}) {
+		t.Errorf("Prune of a nested relation = %v, want %v", result, []interface{}{expected})
+	}
+}
+
+func TestContext(t *testing.T) {
+	fs := Fieldset{"": {"ID"}}
+	ctx := WithFieldset(context.Background(), "User", fs)
+
+	if result := FromContext(ctx, "User"); !reflect.DeepEqual(result, fs) {
+		t.Errorf("FromContext(User) = %v, want %v", result, fs)
+	}
+	if result := FromContext(ctx, "Role"); result != nil {
+		t.Errorf("FromContext(Role) = %v, want nil", result)
+	}
+	if ctx := WithFieldset(context.Background(), "User", nil); FromContext(ctx, "User") != nil {
+		t.Errorf("WithFieldset with an empty fieldset narrowed the reads")
+	}
+}
@@ -43,6 +43,23 @@ const (
 	ComparatorNotIn              comparisonOperator = "not_in"
 	ComparatorIsNull             comparisonOperator = "is_null"
 	ComparatorIsNotNull          comparisonOperator = "is_not_null"
+	// ComparatorBetween matches values within an inclusive range given as a two item list, e.g. age:between:[18|65].
+	ComparatorBetween comparisonOperator = "between"
+	// ComparatorStartsWith, ComparatorEndsWith and ComparatorContains match text literally;
+	// unlike like patterns, % and _ in the value have no special meaning.
+	ComparatorStartsWith comparisonOperator = "starts_with"
+	ComparatorEndsWith   comparisonOperator = "ends_with"
+	ComparatorContains   comparisonOperator = "contains"
+	// ComparatorILike is a case-insensitive like.
+	ComparatorILike comparisonOperator = "ilike"
+	// ComparatorAny matches when at least one of the listed values is present, e.g. roles.name:any:[admin|editor].
+	// On a field of a to-many relation it matches entities with at least one related row holding one of the values.
+	ComparatorAny comparisonOperator = "any"
+	// ComparatorAll matches when every listed value is present. On a field of a to-many relation it
+	// matches entities whose related rows hold all of the values.
+	ComparatorAll comparisonOperator = "all"
+	// ComparatorSearch is a full-text search, backed by the full-text index of the database engine.
+	ComparatorSearch comparisonOperator = "search"
 )
 
 type Leaf struct {
@@ -55,8 +72,14 @@ func (f Leaf) IsComposite() bool {
 	return false
 }
 
+// ToString returns the compact string form of the leaf, quoting the value
+// when needed so that Parse(f.ToString()) yields the same leaf.
+// Null checks without a value are rendered as "field:comparator".
 func (f Leaf) ToString() string {
-	return fmt.Sprintf("%s:%s:%v", f.Field, f.Comparator, f.Value)
+	if f.Value == nil && f.Comparator.isUnary() {
+		return fmt.Sprintf("%s:%s", f.Field, f.Comparator)
+	}
+	return fmt.Sprintf("%s:%s:%s", f.Field, f.Comparator, formatValue(f.Value))
 }
 
 type LogicalOperator string
@@ -136,6 +159,39 @@ func NotIn(field string, value interface{}) Leaf {
 	return Leaf{Field: field, Comparator: ComparatorNotIn, Value: value}
 }
 
+// Between matches values in the inclusive range [from, to].
+func Between(field string, from, to interface{}) Leaf {
+	return Leaf{Field: field, Comparator: ComparatorBetween, Value: []interface{}{from, to}}
+}
+
+func StartsWith(field string, value interface{}) Leaf {
+	return Leaf{Field: field, Comparator: ComparatorStartsWith, Value: value}
+}
+
+func EndsWith(field string, value interface{}) Leaf {
+	return Leaf{Field: field, Comparator: ComparatorEndsWith, Value: value}
+}
+
+func Contains(field string, value interface{}) Leaf {
+	return Leaf{Field: field, Comparator: ComparatorContains, Value: value}
+}
+
+func ILike(field string, value interface{}) Leaf {
+	return Leaf{Field: field, Comparator: ComparatorILike, Value: value}
+}
+
+func Any(field string, value interface{}) Leaf {
+	return Leaf{Field: field, Comparator: ComparatorAny, Value: value}
+}
+
+func All(field string, value interface{}) Leaf {
+	return Leaf{Field: field, Comparator: ComparatorAll, Value: value}
+}
+
+func Search(field string, value interface{}) Leaf {
+	return Leaf{Field: field, Comparator: ComparatorSearch, Value: value}
+}
+
 func IsNull(field string) Leaf {
 	return Leaf{Field: field, Comparator: ComparatorIsNull, Value: nil}
 }
@@ -161,12 +217,19 @@ func NewLeaf(field string, comparator comparisonOperator, value interface{}) Lea
 // Composite Filter Format: Operator(Filter1, Filter2, ...)
 // Example: and(name:eq:John,age:gt:30)
 //
-// Composite filters can be nested and can contain both leaf filters and other composite filters.
+// Composite filters can be nested to any depth and can contain both leaf filters and other composite filters.
 // Example: and(name:eq:John,or(age:gt:30,age:lt:20))
 //
-// If the filter string starts with a logical operator (and, or, not) followed by a parenthesis,
-// it is considered a composite filter and will be parsed by ParseComposite.
-// Otherwise, it is considered a leaf filter and will be parsed by ParseLeaf.
+// Values containing commas, colons, parentheses or quotes must be either quoted or escaped with a backslash.
+// Example: name:eq:"Smith, J."
+// Example: url:eq:https\://example.com
+//
+// Null checks may omit the value.
+// Example: deleted_at:is_null
+//
+// Lists are written between brackets, separated by pipes.
+// Example: age:between:[18|65]
+// Example: roles.name:any:[admin|editor]
 //
 // Parameters:
 //
@@ -175,63 +238,69 @@ func NewLeaf(field string, comparator comparisonOperator, value interface{}) Lea
 // Returns:
 //
 //	Filter - The parsed Filter object.
-//	error - An error if the filter string is invalid.
+//	error - A *SyntaxError if the filter string is invalid.
 func Parse(s string) (Filter, error) {
-	// Leaf Filter Format: FieldName:Comparator:Value
-	// Composite Filter Format: Operator(Filter1, Filter2, ...)
-	// Example: and(name:eq:John,age:gt:30)
-
-	// The filter list is enclosed in parentheses
-	// The filter list can contain both leaf filters and composite filters
-	// Filters in the filter list are separated by commas, but they can also be nested
-	// Example: and(name:eq:John,or(age:gt:30,age:lt:20))
-
-	// If the filter starts with an logical operator and parenthesis, it is a composite filter
-	if strings.HasPrefix(s, "and(") || strings.HasPrefix(s, "or(") || strings.HasPrefix(s, "not(") {
-		return ParseComposite(s)
+	p, err := newParser(s)
+	if err != nil {
+		return nil, err
 	}
-
-	// Otherwise, it is a leaf filter
-	return ParseLeaf(s)
-
+	f, err := p.parseFilter()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.end(); err != nil {
+		return nil, err
+	}
+	return f, nil
 }
 
+// ParseLeaf parses a single leaf filter, e.g. "name:eq:John".
 func ParseLeaf(s string) (Leaf, error) {
-	parts := strings.Split(s, ":")
-	if len(parts) != 3 {
-		return Leaf{}, fmt.Errorf("invalid leaf filter format: %s", s)
+	p, err := newParser(s)
+	if err != nil {
+		return Leaf{}, err
 	}
-
-	comparator := comparisonOperator(parts[1])
-	return Leaf{Field: parts[0], Comparator: comparator, Value: parts[2]}, nil
+	leaf, err := p.parseLeaf()
+	if err != nil {
+		return Leaf{}, err
+	}
+	if err := p.end(); err != nil {
+		return Leaf{}, err
+	}
+	return leaf, nil
 }
 
+// ParseComposite parses a composite filter, e.g. "and(name:eq:John,age:gt:30)".
 func ParseComposite(s string) (Composite, error) {
-	operator := strings.Split(s, "(")[0]
-	if operator != "and" && operator != "or" && operator != "not" {
-		return Composite{}, fmt.Errorf("invalid composite filter operator: %s", operator)
+	p, err := newParser(s)
+	if err != nil {
+		return Composite{}, err
 	}
-
-	// Remove the operator and the last parenthesis
-	s = s[len(operator)+1 : len(s)-1]
-
-	filterList, err := ParseFilterList(s)
+	if p.tok.kind != tokenWord {
+		return Composite{}, p.unexpected("logical operator (and, or, not)")
+	}
+	composite, err := p.parseComposite()
 	if err != nil {
 		return Composite{}, err
 	}
-	return Composite{Operator: LogicalOperator(operator), Filters: filterList}, nil
+	if err := p.end(); err != nil {
+		return Composite{}, err
+	}
+	return composite, nil
 }
 
+// ParseFilterList parses a comma separated list of filters, e.g. "name:eq:John,or(age:gt:30,age:lt:20)".
 func ParseFilterList(s string) ([]Filter, error) {
-	// Split the filter list by commas
-	parts := strings.Split(s, ",")
-	filters := make([]Filter, 0, len(parts))
-	for _, part := range parts {
-		filter, err := Parse(part)
-		if err != nil {
-			return nil, err
-		}
-		filters = append(filters, filter)
+	p, err := newParser(s)
+	if err != nil {
+		return nil, err
+	}
+	filters, err := p.parseList()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.end(); err != nil {
+		return nil, err
 	}
 	return filters, nil
 }
@@ -1,6 +1,7 @@
 package filter
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -133,6 +134,13 @@ func TestLeafComparators(t *testing.T) {
 		{"NotLike", NotLike, "name", "Jo%", Leaf{Field: "name", Comparator: ComparatorNotLike, Value: "Jo%"}},
 		{"In", In, "age", "20,30", Leaf{Field: "age", Comparator: ComparatorIn, Value: "20,30"}},
 		{"NotIn", NotIn, "age", "20,30", Leaf{Field: "age", Comparator: ComparatorNotIn, Value: "20,30"}},
+		{"StartsWith", StartsWith, "name", "Jo", Leaf{Field: "name", Comparator: ComparatorStartsWith, Value: "Jo"}},
+		{"EndsWith", EndsWith, "name", "hn", Leaf{Field: "name", Comparator: ComparatorEndsWith, Value: "hn"}},
+		{"Contains", Contains, "name", "oh", Leaf{Field: "name", Comparator: ComparatorContains, Value: "oh"}},
+		{"ILike", ILike, "name", "jo%", Leaf{Field: "name", Comparator: ComparatorILike, Value: "jo%"}},
+		{"Any", Any, "roles.name", "admin", Leaf{Field: "roles.name", Comparator: ComparatorAny, Value: "admin"}},
+		{"All", All, "roles.name", "admin", Leaf{Field: "roles.name", Comparator: ComparatorAll, Value: "admin"}},
+		{"Search", Search, "bio", "quick fox", Leaf{Field: "bio", Comparator: ComparatorSearch, Value: "quick fox"}},
 		{"IsNull", func(field string, _ interface{}) Leaf { return IsNull(field) }, "name", nil, Leaf{Field: "name", Comparator: ComparatorIsNull, Value: nil}},
 		{"IsNotNull", func(field string, _ interface{}) Leaf { return IsNotNull(field) }, "name", nil, Leaf{Field: "name", Comparator: ComparatorIsNotNull, Value: nil}},
 	}
@@ -147,6 +155,17 @@ func TestLeafComparators(t *testing.T) {
 	}
 }
 
+func TestBetween(t *testing.T) {
+	expected := Leaf{Field: "age", Comparator: ComparatorBetween, Value: []interface{}{18, 65}}
+	result := Between("age", 18, 65)
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Between(age, 18, 65) = %v, expected %v", result, expected)
+	}
+	if result.ToString() != "age:between:[18|65]" {
+		t.Errorf("ToString() = %s, expected age:between:[18|65]", result.ToString())
+	}
+}
+
 func compareFilters(a, b Filter) bool {
 	if a.IsComposite() != b.IsComposite() {
 		return false
@@ -154,7 +173,7 @@ func compareFilters(a, b Filter) bool {
 	if a.IsComposite() {
 		return compareComposites(a.(Composite), b.(Composite))
 	}
-	return a.(Leaf) == b.(Leaf)
+	return reflect.DeepEqual(a.(Leaf), b.(Leaf))
 }
 
 func compareComposites(a, b Composite) bool {
@@ -0,0 +1,182 @@
+package filter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+/**
+* Filters can also be written as JSON trees, which are easier to generate than the compact syntax.
+*
+*	{"and": [
+*		{"field": "age", "op": "gt", "value": 30},
+*		{"or": [
+*			{"field": "name", "op": "like", "value": "Jo%"},
+*			{"not": {"field": "roles.name", "op": "in", "value": ["admin", "editor"]}}
+*		]},
+*		{"field": "deleted_at", "op": "is_null"}
+*	]}
+*
+* A leaf is an object with "field", "op" (any comparator of the compact syntax) and "value".
+* The value may be omitted for is_null and is_not_null. A composite is an object with a single
+* "and", "or" or "not" key holding a list of filters; "not" also accepts a single filter.
+* Numbers are kept as json.Number until the filter is coerced to the schema of an entity.
+ */
+
+// jsonLeaf is the JSON shape of a leaf.
+type jsonLeaf struct {
+	Field string             `json:"field"`
+	Op    comparisonOperator `json:"op"`
+	Value interface{}        `json:"value"`
+}
+
+// jsonUnaryLeaf is the JSON shape of a null check without a value.
+type jsonUnaryLeaf struct {
+	Field string             `json:"field"`
+	Op    comparisonOperator `json:"op"`
+}
+
+// MarshalJSON renders the leaf as {"field": ..., "op": ..., "value": ...}.
+func (f Leaf) MarshalJSON() ([]byte, error) {
+	if f.Value == nil && f.Comparator.isUnary() {
+		return json.Marshal(jsonUnaryLeaf{Field: f.Field, Op: f.Comparator})
+	}
+	return json.Marshal(jsonLeaf{Field: f.Field, Op: f.Comparator, Value: f.Value})
+}
+
+// UnmarshalJSON reads a leaf in the JSON filter format.
+func (f *Leaf) UnmarshalJSON(data []byte) error {
+	parsed, err := ParseJSON(data)
+	if err != nil {
+		return err
+	}
+	leaf, ok := parsed.(Leaf)
+	if !ok {
+		return fmt.Errorf("filter: expected a leaf, found %s", parsed.(Composite).Operator)
+	}
+	*f = leaf
+	return nil
+}
+
+// MarshalJSON renders the composite as {"and": [...]}, {"or": [...]} or {"not": {...}}.
+func (f Composite) MarshalJSON() ([]byte, error) {
+	filters := f.Filters
+	if filters == nil {
+		filters = []Filter{}
+	}
+	if f.Operator == LogicalNot && len(filters) == 1 {
+		return json.Marshal(map[LogicalOperator]Filter{f.Operator: filters[0]})
+	}
+	return json.Marshal(map[LogicalOperator][]Filter{f.Operator: filters})
+}
+
+// UnmarshalJSON reads a composite in the JSON filter format.
+func (f *Composite) UnmarshalJSON(data []byte) error {
+	parsed, err := ParseJSON(data)
+	if err != nil {
+		return err
+	}
+	composite, ok := parsed.(Composite)
+	if !ok {
+		return fmt.Errorf("filter: expected a logical operator (and, or, not), found field %s", parsed.(Leaf).Field)
+	}
+	*f = composite
+	return nil
+}
+
+// ParseJSON parses a filter in the JSON filter format. It is the JSON counterpart of Parse.
+func ParseJSON(data []byte) (Filter, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var raw interface{}
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("filter: invalid JSON: %w", err)
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("filter: invalid JSON: unexpected data after the filter")
+	}
+	return fromJSON(raw, "$")
+}
+
+// fromJSON converts a decoded JSON value into a filter. path locates the value in error messages.
+func fromJSON(raw interface{}, path string) (Filter, error) {
+	object, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("filter: %s: expected an object", path)
+	}
+
+	if _, ok := object["field"]; ok {
+		return leafFromJSON(object, path)
+	}
+
+	if len(object) != 1 {
+		return nil, fmt.Errorf("filter: %s: expected a leaf or a single logical operator (and, or, not)", path)
+	}
+	var key string
+	var value interface{}
+	for key, value = range object {
+	}
+	operator := LogicalOperator(key)
+	if !operator.isValid() {
+		return nil, fmt.Errorf("filter: %s: unknown logical operator %q", path, key)
+	}
+	path = path + "." + key
+
+	items, ok := value.([]interface{})
+	if !ok {
+		if operator != LogicalNot {
+			return nil, fmt.Errorf("filter: %s: expected a list of filters", path)
+		}
+		items = []interface{}{value}
+	}
+	filters := make([]Filter, 0, len(items))
+	for i, item := range items {
+		child, err := fromJSON(item, fmt.Sprintf("%s[%d]", path, i))
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, child)
+	}
+	return Composite{Operator: operator, Filters: filters}, nil
+}
+
+func leafFromJSON(object map[string]interface{}, path string) (Leaf, error) {
+	for key := range object {
+		if key != "field" && key != "op" && key != "value" {
+			return Leaf{}, fmt.Errorf("filter: %s: unknown leaf key %q", path, key)
+		}
+	}
+	field, ok := object["field"].(string)
+	if !ok || field == "" {
+		return Leaf{}, fmt.Errorf("filter: %s.field: expected a field name", path)
+	}
+	op, _ := object["op"].(string)
+	comparator := comparisonOperator(op)
+	if !comparator.isValid() {
+		return Leaf{}, fmt.Errorf("filter: %s.op: unknown comparator %q", path, op)
+	}
+
+	value, hasValue := object["value"]
+	if !hasValue && !comparator.isUnary() {
+		return Leaf{}, fmt.Errorf("filter: %s.value: comparator %s requires a value", path, comparator)
+	}
+	if items, ok := value.([]interface{}); ok {
+		for i, item := range items {
+			if !isJSONScalar(item) {
+				return Leaf{}, fmt.Errorf("filter: %s.value[%d]: expected a scalar value", path, i)
+			}
+		}
+	} else if !isJSONScalar(value) {
+		return Leaf{}, fmt.Errorf("filter: %s.value: expected a scalar value or a list", path)
+	}
+	return Leaf{Field: field, Comparator: comparator, Value: value}, nil
+}
+
+func isJSONScalar(value interface{}) bool {
+	switch value.(type) {
+	case nil, string, bool, json.Number:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package filter
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseJSON(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Filter
+	}{
+		{`{"field":"age","op":"gt","value":30}`, GreaterThan("age", json.Number("30"))},
+		{`{"field":"deleted_at","op":"is_null"}`, IsNull("deleted_at")},
+		{`{"field":"nickname","op":"eq","value":null}`, Equal("nickname", nil)},
+		{`{"field":"role","op":"in","value":["admin","editor"]}`, In("role", []interface{}{"admin", "editor"})},
+		{`{"and":[]}`, And()},
+		{`{"and":[{"field":"age","op":"gt","value":30},{"or":[{"field":"name","op":"like","value":"Jo%"},{"not":{"field":"active","op":"eq","value":false}}]}]}`,
+			And(
+				GreaterThan("age", json.Number("30")),
+				Or(Like("name", "Jo%"), Not(Equal("active", false))),
+			)},
+		{`{"not":[{"field":"a","op":"eq","value":"b"}]}`, Not(Equal("a", "b"))},
+	}
+
+	for _, test := range tests {
+		result, err := ParseJSON([]byte(test.input))
+		if err != nil {
+			t.Errorf("ParseJSON(%s) returned an error: %v", test.input, err)
+			continue
+		}
+		if !compareFilters(result, test.expected) {
+			t.Errorf("ParseJSON(%s) = %#v, expected %#v", test.input, result, test.expected)
+		}
+	}
+}
+
+func TestParseJSONErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`[]`, "$: expected an object"},
+		{`{"field":"age","op":"gt"}`, "$.value: comparator gt requires a value"},
+		{`{"field":"age","op":"greater","value":1}`, `$.op: unknown comparator "greater"`},
+		{`{"field":"","op":"eq","value":1}`, "$.field: expected a field name"},
+		{`{"field":"age","op":"eq","value":{"x":1}}`, "$.value: expected a scalar value or a list"},
+		{`{"field":"age","op":"in","value":[1,[2]]}`, "$.value[1]: expected a scalar value"},
+		{`{"field":"age","op":"eq","value":1,"extra":true}`, `unknown leaf key "extra"`},
+		{`{"xor":[]}`, `$: unknown logical operator "xor"`},
+		{`{"and":[],"or":[]}`, "expected a leaf or a single logical operator"},
+		{`{"and":{"field":"a","op":"eq","value":1}}`, "$.and: expected a list of filters"},
+		{`{"and":[{"or":[1]}]}`, "$.and[0].or[0]: expected an object"},
+		{`{"and":[]} {}`, "unexpected data after the filter"},
+		{`{"and":[`, "invalid JSON"},
+	}
+
+	for _, test := range tests {
+		_, err := ParseJSON([]byte(test.input))
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("ParseJSON(%s) error = %v, expected %q", test.input, err, test.expected)
+		}
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	f := And(
+		GreaterThan("age", 30),
+		Equal("active", false),
+		Not(In("role", []string{"admin"})),
+		IsNull("deleted_at"),
+		GreaterThan("created_at", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)),
+	)
+	expected := `{"and":[{"field":"age","op":"gt","value":30},{"field":"active","op":"eq","value":false},` +
+		`{"not":{"field":"role","op":"in","value":["admin"]}},{"field":"deleted_at","op":"is_null"},` +
+		`{"field":"created_at","op":"gt","value":"2024-01-01T00:00:00Z"}]}`
+
+	data, err := json.Marshal(f)
+	if err != nil {
+		t.Fatalf("Marshal returned an error: %v", err)
+	}
+	if string(data) != expected {
+		t.Errorf("Marshal = %s, expected %s", data, expected)
+	}
+
+	coerced, err := SchemaOf[testEntity]().Coerce(mustParseJSON(t, data))
+	if err != nil {
+		t.Fatalf("Coerce returned an error: %v", err)
+	}
+	roundTrip := And(
+		GreaterThan("age", int32(30)),
+		Equal("active", false),
+		Not(In("role", []testRole{"admin"})),
+		IsNull("deleted_at"),
+		GreaterThan("created_at", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)),
+	)
+	if !compareFilters(coerced, roundTrip) {
+		t.Errorf("round trip = %#v, expected %#v", coerced, roundTrip)
+	}
+}
+
+func TestUnmarshalJSONTypes(t *testing.T) {
+	var payload struct {
+		Where Composite `json:"where"`
+		Leaf  Leaf      `json:"leaf"`
+	}
+	err := json.Unmarshal([]byte(`{"where":{"or":[{"field":"a","op":"eq","value":"b"}]},"leaf":{"field":"age","op":"le","value":3}}`), &payload)
+	if err != nil {
+		t.Fatalf("Unmarshal returned an error: %v", err)
+	}
+	if !compareFilters(payload.Where, Or(Equal("a", "b"))) {
+		t.Errorf("Where = %#v", payload.Where)
+	}
+	if !compareFilters(payload.Leaf, LessThanOrEqual("age", json.Number("3"))) {
+		t.Errorf("Leaf = %#v", payload.Leaf)
+	}
+
+	var leaf Leaf
+	if err := json.Unmarshal([]byte(`{"and":[]}`), &leaf); err == nil {
+		t.Errorf("Unmarshal of a composite into a Leaf should fail")
+	}
+}
+
+func mustParseJSON(t *testing.T, data []byte) Filter {
+	t.Helper()
+	f, err := ParseJSON(data)
+	if err != nil {
+		t.Fatalf("ParseJSON(%s) returned an error: %v", data, err)
+	}
+	return f
+}
@@ -0,0 +1,387 @@
+package filter
+
+import (
+	"bytes"
+	"cmp"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// truth is a value of SQL's three-valued logic. Comparisons with NULL are unknown, and
+// unknown propagates through and/or/not exactly as it does in a WHERE clause, where
+// only true rows are returned.
+type truth int
+
+const (
+	truthFalse truth = iota
+	truthUnknown
+	truthTrue
+)
+
+func truthOf(b bool) truth {
+	if b {
+		return truthTrue
+	}
+	return truthFalse
+}
+
+func (t truth) not() truth {
+	return truthTrue - t
+}
+
+// Match reports whether entity, a struct or a pointer to a struct, satisfies f.
+// It evaluates the filter in memory with the semantics of the SQL generated by the
+// repositories, so the same filter selects the same entities from a database, a cache or a slice:
+//
+//   - Values are coerced to the field types as by Schema.Coerce, and the same errors are returned.
+//   - Comparisons with a nil field are unknown, as comparisons with NULL are in SQL; eq and ne
+//     with a nil value are null checks.
+//   - Dotted paths such as "roles.name" match when at least one related entity matches.
+//   - like patterns use % and _ wildcards and are case-sensitive; ilike ignores case.
+//   - search matches when the text contains every word of the query, ignoring case. It is an
+//     approximation of the full-text search of the databases, which also stem words.
+func Match(entity any, f Filter) (bool, error) {
+	v := reflect.ValueOf(entity)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return false, errors.New("filter: cannot match a nil entity")
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return false, fmt.Errorf("filter: cannot match a %s, expected a struct", v.Kind())
+	}
+	result, err := schemaFor(v.Type()).match(v, f)
+	return result == truthTrue, err
+}
+
+func (s *Schema) match(v reflect.Value, f Filter) (truth, error) {
+	switch f := f.(type) {
+	case nil:
+		return truthTrue, nil
+	case Leaf:
+		leaf, err := s.coerceLeaf(f)
+		if err != nil {
+			return truthFalse, err
+		}
+		return s.matchLeaf(v, leaf, leaf.Field)
+	case Composite:
+		return s.matchComposite(v, f)
+	}
+	return truthFalse, fmt.Errorf("filter: unsupported filter type %T", f)
+}
+
+func (s *Schema) matchComposite(v reflect.Value, f Composite) (truth, error) {
+	switch f.Operator {
+	case LogicalAnd, LogicalNot:
+		if f.Operator == LogicalNot && len(f.Filters) == 0 {
+			return truthFalse, errors.New("filter: not() requires a filter")
+		}
+		result := truthTrue
+		for _, child := range f.Filters {
+			t, err := s.match(v, child)
+			if err != nil {
+				return truthFalse, err
+			}
+			result = min(result, t)
+		}
+		if f.Operator == LogicalNot {
+			return result.not(), nil
+		}
+		return result, nil
+	case LogicalOr:
+		result := truthFalse
+		for _, child := range f.Filters {
+			t, err := s.match(v, child)
+			if err != nil {
+				return truthFalse, err
+			}
+			result = max(result, t)
+		}
+		return result, nil
+	}
+	return truthFalse, fmt.Errorf("filter: unsupported logical operator: %s", f.Operator)
+}
+
+// matchLeaf evaluates an already coerced leaf on the field at path.
+func (s *Schema) matchLeaf(v reflect.Value, f Leaf, path string) (truth, error) {
+	name, rest, dotted := strings.Cut(path, ".")
+	if !dotted {
+		field, ok := s.Field(name)
+		if !ok {
+			return truthFalse, &FieldError{Field: f.Field, Value: f.Value, Err: ErrUnknownField}
+		}
+		return compareField(fieldValue(v.FieldByName(field.Name)), f)
+	}
+
+	relation, ok := s.relations[name]
+	if !ok {
+		return truthFalse, &FieldError{Field: f.Field, Value: f.Value, Err: ErrUnknownField}
+	}
+	related := schemaFor(relation.Type)
+	entities := relatedValues(v.FieldByName(relation.Name))
+
+	// Every listed value must be held by some related entity, not necessarily the same one.
+	if f.Comparator == ComparatorAll {
+		values := reflect.ValueOf(f.Value)
+		for i := 0; i < values.Len(); i++ {
+			t, err := s.matchLeaf(v, Leaf{Field: f.Field, Comparator: ComparatorEqual, Value: values.Index(i).Interface()}, path)
+			if err != nil || t != truthTrue {
+				return truthFalse, err
+			}
+		}
+		return truthTrue, nil
+	}
+
+	// Like an EXISTS subquery, the result is never unknown.
+	for _, entity := range entities {
+		t, err := related.matchLeaf(entity, f, rest)
+		if err != nil {
+			return truthFalse, err
+		}
+		if t == truthTrue {
+			return truthTrue, nil
+		}
+	}
+	return truthFalse, nil
+}
+
+// relatedValues returns the non-nil structs held by a relation field.
+func relatedValues(rv reflect.Value) []reflect.Value {
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() == reflect.Struct {
+		return []reflect.Value{rv}
+	}
+	values := []reflect.Value{}
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		for i := 0; i < rv.Len(); i++ {
+			values = append(values, relatedValues(rv.Index(i))...)
+		}
+	}
+	return values
+}
+
+// fieldValue returns the value of a field, or nil if it holds a null: a nil pointer or an
+// invalid sql.NullTime-like value such as gorm.DeletedAt.
+func fieldValue(rv reflect.Value) interface{} {
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Type() != timeType && rv.Type().ConvertibleTo(nullTimeType) {
+		nullTime := rv.Convert(nullTimeType).Interface().(sql.NullTime)
+		if !nullTime.Valid {
+			return nil
+		}
+		return nullTime.Time
+	}
+	return rv.Interface()
+}
+
+// compareField evaluates a leaf against the value of a field.
+func compareField(value interface{}, f Leaf) (truth, error) {
+	switch f.Comparator {
+	case ComparatorIsNull:
+		return truthOf(value == nil), nil
+	case ComparatorIsNotNull:
+		return truthOf(value != nil), nil
+	case ComparatorEqual, ComparatorNotEqual:
+		if f.Value == nil {
+			return truthOf((value == nil) == (f.Comparator == ComparatorEqual)), nil
+		}
+	case ComparatorIn, ComparatorAny:
+		// x IN () is false even when x is null.
+		if reflect.ValueOf(f.Value).Len() == 0 {
+			return truthFalse, nil
+		}
+	case ComparatorNotIn, ComparatorAll:
+		if reflect.ValueOf(f.Value).Len() == 0 {
+			return truthTrue, nil
+		}
+	}
+	if value == nil {
+		return truthUnknown, nil
+	}
+
+	switch f.Comparator {
+	case ComparatorEqual, ComparatorNotEqual, ComparatorGreaterThan, ComparatorGreaterThanOrEqual,
+		ComparatorLessThan, ComparatorLessThanOrEqual:
+		c, err := compareValues(value, f.Value)
+		if err != nil {
+			return truthFalse, err
+		}
+		switch f.Comparator {
+		case ComparatorEqual:
+			return truthOf(c == 0), nil
+		case ComparatorNotEqual:
+			return truthOf(c != 0), nil
+		case ComparatorGreaterThan:
+			return truthOf(c > 0), nil
+		case ComparatorGreaterThanOrEqual:
+			return truthOf(c >= 0), nil
+		case ComparatorLessThan:
+			return truthOf(c < 0), nil
+		}
+		return truthOf(c <= 0), nil
+	case ComparatorBetween:
+		values := reflect.ValueOf(f.Value)
+		from, err := compareValues(value, values.Index(0).Interface())
+		if err != nil {
+			return truthFalse, err
+		}
+		to, err := compareValues(value, values.Index(1).Interface())
+		if err != nil {
+			return truthFalse, err
+		}
+		return truthOf(from >= 0 && to <= 0), nil
+	case ComparatorIn, ComparatorAny, ComparatorNotIn, ComparatorAll:
+		found, all := false, true
+		values := reflect.ValueOf(f.Value)
+		for i := 0; i < values.Len(); i++ {
+			c, err := compareValues(value, values.Index(i).Interface())
+			if err != nil {
+				return truthFalse, err
+			}
+			found = found || c == 0
+			all = all && c == 0
+		}
+		switch f.Comparator {
+		case ComparatorNotIn:
+			return truthOf(!found), nil
+		case ComparatorAll:
+			return truthOf(all), nil
+		}
+		return truthOf(found), nil
+	}
+
+	text := textOf(value)
+	pattern := fmt.Sprint(f.Value)
+	switch f.Comparator {
+	case ComparatorLike:
+		return truthOf(matchLike(text, pattern)), nil
+	case ComparatorNotLike:
+		return truthOf(!matchLike(text, pattern)), nil
+	case ComparatorILike:
+		return truthOf(matchLike(strings.ToLower(text), strings.ToLower(pattern))), nil
+	case ComparatorStartsWith:
+		return truthOf(strings.HasPrefix(text, pattern)), nil
+	case ComparatorEndsWith:
+		return truthOf(strings.HasSuffix(text, pattern)), nil
+	case ComparatorContains:
+		return truthOf(strings.Contains(text, pattern)), nil
+	case ComparatorSearch:
+		text = strings.ToLower(text)
+		for _, word := range strings.Fields(strings.ToLower(pattern)) {
+			if !strings.Contains(text, word) {
+				return truthFalse, nil
+			}
+		}
+		return truthTrue, nil
+	}
+	return truthFalse, fmt.Errorf("filter: unsupported comparator: %s", f.Comparator)
+}
+
+// compareValues compares two non-nil values of the same kind, returning -1, 0 or +1.
+func compareValues(a, b interface{}) (int, error) {
+	switch x := a.(type) {
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			return x.Compare(y), nil
+		}
+	case uuid.UUID:
+		if y, ok := b.(uuid.UUID); ok {
+			return bytes.Compare(x[:], y[:]), nil
+		}
+	}
+
+	ra, rb := reflect.ValueOf(a), reflect.ValueOf(b)
+	ka, kb := kindOf(ra.Type()), kindOf(rb.Type())
+	switch {
+	case ka == KindInt && kb == KindInt:
+		return cmp.Compare(ra.Int(), rb.Int()), nil
+	case ka == KindUint && kb == KindUint:
+		return cmp.Compare(ra.Uint(), rb.Uint()), nil
+	case isNumeric(ka) && isNumeric(kb):
+		return cmp.Compare(toFloat(ra), toFloat(rb)), nil
+	case ra.Kind() == reflect.String && rb.Kind() == reflect.String:
+		return strings.Compare(ra.String(), rb.String()), nil
+	case ra.Kind() == reflect.Bool && rb.Kind() == reflect.Bool:
+		return cmp.Compare(boolToInt(ra.Bool()), boolToInt(rb.Bool())), nil
+	}
+	return 0, fmt.Errorf("filter: cannot compare %T with %T", a, b)
+}
+
+func toFloat(rv reflect.Value) float64 {
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	}
+	return rv.Float()
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// textOf returns the text a database would match patterns against.
+func textOf(value interface{}) string {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.String {
+		return rv.String()
+	}
+	return formatScalar(value)
+}
+
+// matchLike reports whether s matches a SQL like pattern, in which % matches any
+// sequence of characters and _ matches a single character.
+func matchLike(s, pattern string) bool {
+	// Position of the last % seen, and of the text it is currently matched up to.
+	star, next := -1, 0
+	i, j := 0, 0
+	for i < len(s) {
+		if j < len(pattern) && pattern[j] == '%' {
+			star, next = j, i
+			j++
+			continue
+		}
+		if j < len(pattern) {
+			r, rs := utf8.DecodeRuneInString(s[i:])
+			p, ps := utf8.DecodeRuneInString(pattern[j:])
+			if p == '_' || p == r {
+				i += rs
+				j += ps
+				continue
+			}
+		}
+		if star < 0 {
+			return false
+		}
+		// Let the last % absorb one more character and retry.
+		_, size := utf8.DecodeRuneInString(s[next:])
+		next += size
+		i, j = next, star+1
+	}
+	for j < len(pattern) && pattern[j] == '%' {
+		j++
+	}
+	return j == len(pattern)
+}
@@ -0,0 +1,192 @@
+package filter
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestMatch(t *testing.T) {
+	nick := "bobby"
+	id := uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	entity := &testEntity{
+		testBase: testBase{
+			ID:        id,
+			CreatedAt: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		},
+		Username: "Bob_Smith",
+		Age:      30,
+		Score:    4.5,
+		Active:   true,
+		Role:     "editor",
+		Nickname: &nick,
+		Friends: []*testEntity{
+			{Username: "alice", Age: 25, Role: "admin"},
+			nil,
+			{Username: "carol", Age: 41, Role: "editor"},
+		},
+	}
+
+	tests := []struct {
+		filter   string
+		expected bool
+	}{
+		{"username:eq:Bob_Smith", true},
+		{"username:ne:Bob_Smith", false},
+		{"age:gt:29", true},
+		{"age:ge:31", false},
+		{"score:lt:5", true},
+		{"score:le:4.4", false},
+		{"active:eq:true", true},
+		{"id:eq:" + id.String(), true},
+		{"created_at:gt:2024-01-01", true},
+		{"created_at:between:[2024-01-01|2024-02-01]", false},
+		{"age:between:[30|40]", true},
+		{"role:in:[admin|editor]", true},
+		{"role:not_in:[admin|editor]", false},
+		{"role:any:[admin]", false},
+		{"age:all:[30|30]", true},
+		{"username:like:Bob%", true},
+		{"username:like:bob%", false},
+		{"username:like:Bob_Smit_", true},
+		{"username:like:%_S%h", true},
+		{"username:like:B%x%", false},
+		{"username:not_like:%Smith", false},
+		{"username:ilike:bob%", true},
+		{"username:starts_with:Bob_", true},
+		{"username:ends_with:smith", false},
+		{"username:contains:b_S", true},
+		{"username:search:smith BOB", true},
+		{"username:search:smith alice", false},
+		{"nick:eq:bobby", true},
+		{"deleted_at:is_null", true},
+		{"deleted_at:is_not_null", false},
+		{"and(age:gt:18,or(role:eq:admin,active:eq:true))", true},
+		{"not(and(age:gt:18,active:eq:true))", false},
+		{"or()", false},
+		{"and()", true},
+		{"friends.username:eq:carol", true},
+		{"friends.age:gt:50", false},
+		{"friends.role:all:[admin|editor]", true},
+		{"and(friends.role:eq:admin,friends.age:gt:40)", true},
+		{"not(friends.username:eq:dave)", true},
+		{"friends.friends.username:eq:x", false},
+	}
+
+	for _, test := range tests {
+		f, err := Parse(test.filter)
+		if err != nil {
+			t.Fatalf("Parse(%s) returned an error: %v", test.filter, err)
+		}
+		result, err := Match(entity, f)
+		if err != nil {
+			t.Errorf("Match(%s) returned an error: %v", test.filter, err)
+			continue
+		}
+		if result != test.expected {
+			t.Errorf("Match(%s) = %v, expected %v", test.filter, result, test.expected)
+		}
+	}
+}
+
+func TestMatchNulls(t *testing.T) {
+	entity := testEntity{Username: "bob", testBase: testBase{DeletedAt: testDeletedAt(sql.NullTime{Time: time.Now(), Valid: true})}}
+
+	tests := []struct {
+		filter   Filter
+		expected bool
+	}{
+		{IsNull("nick"), true},
+		{Equal("nick", nil), true},
+		{NotEqual("nick", nil), false},
+		{IsNotNull("deleted_at"), true},
+		// Comparisons with null are unknown, and so is their negation.
+		{Equal("nick", "x"), false},
+		{Not(Equal("nick", "x")), false},
+		{NotEqual("nick", "x"), false},
+		{Not(Like("nick", "%")), false},
+		{NotIn("nick", []string{"x"}), false},
+		{Or(Equal("nick", "x"), Equal("username", "bob")), true},
+		{Not(And(Equal("nick", "x"), Equal("username", "alice"))), true},
+		// Empty lists do not depend on the value.
+		{In("nick", []string{}), false},
+		{NotIn("nick", []string{}), true},
+		// Missing relations match nothing.
+		{Equal("friends.username", "x"), false},
+		{Not(Equal("friends.username", "x")), true},
+		{All("friends.username", []string{}), true},
+	}
+
+	for _, test := range tests {
+		result, err := Match(entity, test.filter)
+		if err != nil {
+			t.Errorf("Match(%s) returned an error: %v", test.filter.ToString(), err)
+			continue
+		}
+		if result != test.expected {
+			t.Errorf("Match(%s) = %v, expected %v", test.filter.ToString(), result, test.expected)
+		}
+	}
+}
+
+func TestMatchErrors(t *testing.T) {
+	entity := testEntity{}
+
+	tests := []struct {
+		filter   Filter
+		expected error
+	}{
+		{Equal("unknown", "x"), ErrUnknownField},
+		{Equal("password", "x"), ErrNotFilterable},
+		{Equal("age", "x"), ErrInvalidValue},
+		{Equal("friends.unknown", "x"), ErrUnknownField},
+		{And(Equal("username", "bob"), Equal("age", "x")), ErrInvalidValue},
+	}
+
+	for _, test := range tests {
+		_, err := Match(entity, test.filter)
+		if !errors.Is(err, test.expected) {
+			t.Errorf("Match(%s) error = %v, expected %v", test.filter.ToString(), err, test.expected)
+		}
+	}
+
+	if _, err := Match((*testEntity)(nil), And()); err == nil {
+		t.Errorf("Match of a nil entity should fail")
+	}
+	if _, err := Match(42, And()); err == nil {
+		t.Errorf("Match of a non struct should fail")
+	}
+	if _, err := Match(entity, Composite{Operator: LogicalNot}); err == nil {
+		t.Errorf("Match of an empty not() should fail")
+	}
+}
+
+func TestMatchLike(t *testing.T) {
+	tests := []struct {
+		s, pattern string
+		expected   bool
+	}{
+		{"", "", true},
+		{"", "%", true},
+		{"abc", "", false},
+		{"abc", "abc", true},
+		{"abc", "a%", true},
+		{"abc", "%c", true},
+		{"abc", "%b%", true},
+		{"abc", "a_c", true},
+		{"abc", "a__c", false},
+		{"abcabc", "%abc", true},
+		{"aXbXc", "a%b%c", true},
+		{"ab", "a%b%c", false},
+		{"ñandú", "_and_", true},
+		{"100%", "100%", true},
+	}
+	for _, test := range tests {
+		if result := matchLike(test.s, test.pattern); result != test.expected {
+			t.Errorf("matchLike(%q, %q) = %v, expected %v", test.s, test.pattern, result, test.expected)
+		}
+	}
+}
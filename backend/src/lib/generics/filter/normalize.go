@@ -0,0 +1,171 @@
+package filter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// negations pairs the comparators whose negation is another comparator. NOT (a = b) and a <> b
+// are equivalent in SQL's three-valued logic, including when a is NULL.
+var negations = map[comparisonOperator]comparisonOperator{
+	ComparatorEqual:              ComparatorNotEqual,
+	ComparatorNotEqual:           ComparatorEqual,
+	ComparatorGreaterThan:        ComparatorLessThanOrEqual,
+	ComparatorLessThanOrEqual:    ComparatorGreaterThan,
+	ComparatorGreaterThanOrEqual: ComparatorLessThan,
+	ComparatorLessThan:           ComparatorGreaterThanOrEqual,
+	ComparatorLike:               ComparatorNotLike,
+	ComparatorNotLike:            ComparatorLike,
+	ComparatorIn:                 ComparatorNotIn,
+	ComparatorNotIn:              ComparatorIn,
+	ComparatorIsNull:             ComparatorIsNotNull,
+	ComparatorIsNotNull:          ComparatorIsNull,
+}
+
+// Normalize returns an equivalent filter in canonical form, so that filters that only differ
+// in their shape, like and(a,b), and(b,a) and and(and(a),b), become identical:
+//
+//   - eq and ne with a nil value become is_null and is_not_null.
+//   - Lists of in, not_in, any and all are sorted and duplicates removed.
+//   - Negations are pushed down to the leaves with De Morgan's laws, double negations cancel
+//     out and negated leaves become the opposite comparator where one exists (not(eq) is ne).
+//     Leaves on fields of related entities keep their not(), since not(roles.name:eq:x), no role
+//     named x, differs from roles.name:ne:x, some role not named x.
+//   - Nested composites with the same operator are flattened, and() is dropped from and()
+//     and absorbs or(), or() is dropped from or() and absorbs and().
+//   - Duplicated children are removed, children are sorted and single child composites are unwrapped.
+//
+// The empty filter is and().
+func Normalize(f Filter) Filter {
+	if f == nil {
+		return And()
+	}
+	return normalize(f, false)
+}
+
+// Hash returns a stable key for a filter: equivalent filters that Normalize brings to
+// the same form have the same hash.
+func Hash(f Filter) string {
+	sum := sha256.Sum256([]byte(Normalize(f).ToString()))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalize normalizes f, or the negation of f if negate is set.
+func normalize(f Filter, negate bool) Filter {
+	switch f := f.(type) {
+	case Leaf:
+		return normalizeLeaf(f, negate)
+	case Composite:
+		switch f.Operator {
+		case LogicalNot:
+			// not(a, b) negates and(a, b).
+			return normalize(And(f.Filters...), !negate)
+		case LogicalAnd, LogicalOr:
+			operator := f.Operator
+			if negate {
+				operator = dual(operator)
+			}
+			children := make([]Filter, 0, len(f.Filters))
+			for _, child := range f.Filters {
+				children = append(children, normalize(child, negate))
+			}
+			return simplify(operator, children)
+		}
+	}
+	if negate {
+		return Not(f)
+	}
+	return f
+}
+
+func dual(operator LogicalOperator) LogicalOperator {
+	if operator == LogicalAnd {
+		return LogicalOr
+	}
+	return LogicalAnd
+}
+
+func normalizeLeaf(f Leaf, negate bool) Filter {
+	if f.Value == nil {
+		switch f.Comparator {
+		case ComparatorEqual:
+			f.Comparator = ComparatorIsNull
+		case ComparatorNotEqual:
+			f.Comparator = ComparatorIsNotNull
+		}
+	}
+	if f.Comparator.isUnary() {
+		f.Value = nil
+	}
+	switch f.Comparator {
+	case ComparatorIn, ComparatorNotIn, ComparatorAny, ComparatorAll:
+		f.Value = sortedList(f.Value)
+	}
+
+	if !negate {
+		return f
+	}
+	if opposite, ok := negations[f.Comparator]; ok && !strings.Contains(f.Field, ".") {
+		f.Comparator = opposite
+		return f
+	}
+	return Not(f)
+}
+
+// sortedList returns a copy of a list value sorted by the text of its items, without duplicates.
+// Other values are returned unchanged.
+func sortedList(value interface{}) interface{} {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && (rv.Kind() != reflect.Array || rv.Type() == uuidType) {
+		return value
+	}
+	indexes := make([]int, rv.Len())
+	for i := range indexes {
+		indexes[i] = i
+	}
+	text := func(i int) string { return formatScalar(rv.Index(i).Interface()) }
+	slices.SortStableFunc(indexes, func(a, b int) int { return strings.Compare(text(a), text(b)) })
+
+	out := reflect.MakeSlice(reflect.SliceOf(rv.Type().Elem()), 0, rv.Len())
+	for n, i := range indexes {
+		if n > 0 && text(i) == text(indexes[n-1]) {
+			continue
+		}
+		out = reflect.Append(out, rv.Index(i))
+	}
+	return out.Interface()
+}
+
+// simplify builds the canonical and()/or() of already normalized children.
+func simplify(operator LogicalOperator, children []Filter) Filter {
+	flat := []Filter{}
+	seen := map[string]bool{}
+	for _, child := range children {
+		grandchildren := []Filter{child}
+		if composite, ok := child.(Composite); ok {
+			switch {
+			case composite.Operator == operator:
+				grandchildren = composite.Filters
+			case len(composite.Filters) == 0:
+				// and() is true and or() is false: either the neutral or the absorbing element.
+				return composite
+			}
+		}
+		for _, grandchild := range grandchildren {
+			key := grandchild.ToString()
+			if !seen[key] {
+				seen[key] = true
+				flat = append(flat, grandchild)
+			}
+		}
+	}
+
+	if len(flat) == 1 {
+		return flat[0]
+	}
+	slices.SortFunc(flat, func(a, b Filter) int { return strings.Compare(a.ToString(), b.ToString()) })
+	return Composite{Operator: operator, Filters: flat}
+}
@@ -0,0 +1,128 @@
+package filter
+
+import (
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a:eq:1", "a:eq:1"},
+		{"and(b:eq:2,a:eq:1)", "and(a:eq:1,b:eq:2)"},
+		{"and(and(a:eq:1),b:eq:2)", "and(a:eq:1,b:eq:2)"},
+		{"and(a:eq:1,and(b:eq:2,and(c:eq:3)))", "and(a:eq:1,b:eq:2,c:eq:3)"},
+		{"or(b:eq:2,or(a:eq:1,c:eq:3))", "or(a:eq:1,b:eq:2,c:eq:3)"},
+		{"and(a:eq:1,and(),b:eq:2)", "and(a:eq:1,b:eq:2)"},
+		{"and(a:eq:1)", "a:eq:1"},
+		{"and(a:eq:1,a:eq:1)", "a:eq:1"},
+		{"and()", "and()"},
+		{"and(and(),and())", "and()"},
+		{"or(a:eq:1,and())", "and()"},
+		{"and(a:eq:1,or())", "or()"},
+		{"or(a:eq:1,or())", "a:eq:1"},
+		{"not(not(a:eq:1))", "a:eq:1"},
+		{"not(a:eq:1)", "a:ne:1"},
+		{"not(a:gt:1)", "a:le:1"},
+		{"not(a:in:[2|1])", "a:not_in:[1|2]"},
+		{"not(a:is_null)", "a:is_not_null"},
+		{"not(a:contains:x)", "not(a:contains:x)"},
+		{"not(roles.name:eq:admin)", "not(roles.name:eq:admin)"},
+		{"not(and(a:eq:1,b:lt:2))", "or(a:ne:1,b:ge:2)"},
+		{"not(or(a:eq:1,not(b:like:x%)))", "and(a:ne:1,b:like:x%)"},
+		{"not(and(a:eq:1,or(b:eq:2,c:between:[1|2])))", "or(a:ne:1,and(b:ne:2,not(c:between:[1|2])))"},
+		{"not(and())", "or()"},
+		{"not(or())", "and()"},
+		{"not(a:eq:1,b:eq:2)", "or(a:ne:1,b:ne:2)"},
+		{"a:in:[c|a|b|a]", "a:in:[a|b|c]"},
+		{"a:between:[2|1]", "a:between:[2|1]"},
+	}
+
+	for _, test := range tests {
+		f, err := Parse(test.input)
+		if err != nil {
+			t.Fatalf("Parse(%s) returned an error: %v", test.input, err)
+		}
+		if result := Normalize(f).ToString(); result != test.expected {
+			t.Errorf("Normalize(%s) = %s, expected %s", test.input, result, test.expected)
+		}
+	}
+}
+
+func TestNormalizeValues(t *testing.T) {
+	if result := Normalize(Equal("a", nil)).ToString(); result != "a:is_null" {
+		t.Errorf("Normalize(eq nil) = %s, expected a:is_null", result)
+	}
+	if result := Normalize(Not(NotEqual("a", nil))).ToString(); result != "a:is_null" {
+		t.Errorf("Normalize(not(ne nil)) = %s, expected a:is_null", result)
+	}
+	if result := Normalize(nil).ToString(); result != "and()" {
+		t.Errorf("Normalize(nil) = %s, expected and()", result)
+	}
+
+	leaf := Normalize(In("age", []int32{3, 1, 3})).(Leaf)
+	if values, ok := leaf.Value.([]int32); !ok || len(values) != 2 || values[0] != 1 || values[1] != 3 {
+		t.Errorf("Normalize should keep typed lists, got %#v", leaf.Value)
+	}
+}
+
+func TestNormalizeKeepsMeaning(t *testing.T) {
+	nick := "bobby"
+	entities := []testEntity{
+		{Username: "bob", Age: 30, Role: "editor", Nickname: &nick},
+		{Username: "alice", Age: 20, Role: "admin"},
+		{Username: "carol", Age: 40, Friends: []*testEntity{{Username: "bob"}}},
+	}
+	filters := []string{
+		"not(and(age:gt:25,or(nick:eq:bobby,role:eq:admin)))",
+		"not(or(nick:eq:x,friends.username:eq:bob))",
+		"not(not(and(age:le:30,not(role:in:[admin]))))",
+		"not(and(username:like:%o%,nick:is_null))",
+	}
+
+	for _, input := range filters {
+		f, _ := Parse(input)
+		normalized := Normalize(f)
+		for _, entity := range entities {
+			expected, err := Match(entity, f)
+			if err != nil {
+				t.Fatalf("Match(%s) returned an error: %v", input, err)
+			}
+			result, err := Match(entity, normalized)
+			if err != nil {
+				t.Fatalf("Match(%s) returned an error: %v", normalized.ToString(), err)
+			}
+			if result != expected {
+				t.Errorf("%s matches %s, but %s does not", input, entity.Username, normalized.ToString())
+			}
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	equivalent := []string{
+		"and(a:eq:1,b:eq:2)",
+		"and(b:eq:2,a:eq:1)",
+		"and(and(a:eq:1),b:eq:2)",
+		"and(a:eq:1,and(),b:eq:2,a:eq:1)",
+		"not(or(a:ne:1,b:ne:2))",
+	}
+	hash := ""
+	for _, input := range equivalent {
+		f, _ := Parse(input)
+		h := Hash(f)
+		if len(h) != 64 {
+			t.Errorf("Hash(%s) = %s, expected a sha256 hex digest", input, h)
+		}
+		if hash != "" && h != hash {
+			t.Errorf("Hash(%s) = %s, expected %s", input, h, hash)
+		}
+		hash = h
+	}
+
+	different, _ := Parse("and(a:eq:1,b:eq:3)")
+	if Hash(different) == hash {
+		t.Errorf("Hash should differ for different filters")
+	}
+}
@@ -0,0 +1,490 @@
+package filter
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+)
+
+/**
+* Tokenizer and recursive-descent parser for the compact filter syntax.
+*
+* Grammar:
+*
+*	filter    = composite | leaf
+*	composite = operator "(" [ filter { "," filter } ] ")"
+*	leaf      = field ":" comparator [ ":" value ]
+*	value     = word | string | list
+*	list      = "[" [ item { "|" item } ] "]"
+*	item      = word | string
+*
+* A word is any run of characters that are not one of , : ( ) " and may
+* contain backslash escapes (\, \: \( \) \" \\). Leading and trailing
+* whitespace around a word is ignored.
+* A string is a double quoted sequence in which \" and \\ are escaped.
+* A list is only recognised when "[" is the first character of a value;
+* inside a list, | and ] are delimiters as well.
+ */
+
+// SyntaxError is returned when a filter string cannot be parsed.
+// Column is the 1-based position (in runes) where the error was found.
+type SyntaxError struct {
+	Input    string
+	Column   int
+	Expected string
+	Found    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("filter: syntax error at column %d: expected %s, found %s", e.Column, e.Expected, e.Found)
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenString
+	tokenLParen
+	tokenRParen
+	tokenComma
+	tokenColon
+	tokenList
+)
+
+func (k tokenKind) String() string {
+	switch k {
+	case tokenEOF:
+		return "end of input"
+	case tokenWord:
+		return "word"
+	case tokenString:
+		return "quoted string"
+	case tokenLParen:
+		return "'('"
+	case tokenRParen:
+		return "')'"
+	case tokenComma:
+		return "','"
+	case tokenColon:
+		return "':'"
+	case tokenList:
+		return "list"
+	}
+	return "unknown token"
+}
+
+type token struct {
+	kind  tokenKind
+	text  string
+	items []string // only set for tokenList
+	pos   int      // 0-based rune offset of the first character of the token
+	width int      // number of runes consumed by the token
+}
+
+func (t token) describe() string {
+	switch t.kind {
+	case tokenWord:
+		return fmt.Sprintf("%q", t.text)
+	case tokenString:
+		return fmt.Sprintf("quoted string %q", t.text)
+	}
+	return t.kind.String()
+}
+
+// lexer splits a filter string into tokens.
+type lexer struct {
+	input []rune
+	pos   int
+}
+
+func isDelimiter(r rune) bool {
+	return r == ',' || r == ':' || r == '(' || r == ')' || r == '"'
+}
+
+func (l *lexer) skipSpaces() {
+	for l.pos < len(l.input) && unicode.IsSpace(l.input[l.pos]) {
+		l.pos++
+	}
+}
+
+func (l *lexer) next() (token, error) {
+	l.skipSpaces()
+	start := l.pos
+	if l.pos >= len(l.input) {
+		return token{kind: tokenEOF, pos: start}, nil
+	}
+
+	switch l.input[l.pos] {
+	case '(':
+		l.pos++
+		return token{kind: tokenLParen, pos: start, width: 1}, nil
+	case ')':
+		l.pos++
+		return token{kind: tokenRParen, pos: start, width: 1}, nil
+	case ',':
+		l.pos++
+		return token{kind: tokenComma, pos: start, width: 1}, nil
+	case ':':
+		l.pos++
+		return token{kind: tokenColon, pos: start, width: 1}, nil
+	case '"':
+		return l.quoted()
+	case '[':
+		return l.list()
+	}
+	return l.word(isDelimiter)
+}
+
+// quoted reads a double quoted string. The opening quote is at l.pos.
+func (l *lexer) quoted() (token, error) {
+	start := l.pos
+	l.pos++
+	var sb strings.Builder
+	for l.pos < len(l.input) {
+		r := l.input[l.pos]
+		switch r {
+		case '\\':
+			if l.pos+1 >= len(l.input) {
+				return token{}, l.errorAt(l.pos+1, "escaped character", "end of input")
+			}
+			sb.WriteRune(l.input[l.pos+1])
+			l.pos += 2
+		case '"':
+			l.pos++
+			return token{kind: tokenString, text: sb.String(), pos: start, width: l.pos - start}, nil
+		default:
+			sb.WriteRune(r)
+			l.pos++
+		}
+	}
+	return token{}, l.errorAt(l.pos, "closing '\"'", "end of input")
+}
+
+// list reads a bracketed list of items separated by |. The opening bracket is at l.pos.
+func (l *lexer) list() (token, error) {
+	start := l.pos
+	l.pos++
+	items := []string{}
+	l.skipSpaces()
+	if l.pos < len(l.input) && l.input[l.pos] == ']' {
+		l.pos++
+		return token{kind: tokenList, items: items, pos: start, width: l.pos - start}, nil
+	}
+	for {
+		l.skipSpaces()
+		var item token
+		var err error
+		if l.pos < len(l.input) && l.input[l.pos] == '"' {
+			item, err = l.quoted()
+		} else {
+			item, err = l.word(isListDelimiter)
+		}
+		if err != nil {
+			return token{}, err
+		}
+		items = append(items, item.text)
+
+		l.skipSpaces()
+		if l.pos >= len(l.input) {
+			return token{}, l.errorAt(l.pos, "'|' or ']'", "end of input")
+		}
+		switch l.input[l.pos] {
+		case '|':
+			l.pos++
+		case ']':
+			l.pos++
+			return token{kind: tokenList, items: items, pos: start, width: l.pos - start}, nil
+		default:
+			return token{}, l.errorAt(l.pos, "'|' or ']'", fmt.Sprintf("%q", l.input[l.pos]))
+		}
+	}
+}
+
+func isListDelimiter(r rune) bool {
+	return r == '|' || r == ']' || r == '"'
+}
+
+// word reads an unquoted run of characters up to the next delimiter.
+func (l *lexer) word(delimiter func(rune) bool) (token, error) {
+	start := l.pos
+	var sb strings.Builder
+	// keep is the length of sb up to the last character that must not be trimmed.
+	keep := 0
+	for l.pos < len(l.input) {
+		r := l.input[l.pos]
+		if delimiter(r) {
+			break
+		}
+		if r == '\\' {
+			if l.pos+1 >= len(l.input) {
+				return token{}, l.errorAt(l.pos+1, "escaped character", "end of input")
+			}
+			sb.WriteRune(l.input[l.pos+1])
+			keep = sb.Len()
+			l.pos += 2
+			continue
+		}
+		sb.WriteRune(r)
+		if !unicode.IsSpace(r) {
+			keep = sb.Len()
+		}
+		l.pos++
+	}
+	return token{kind: tokenWord, text: sb.String()[:keep], pos: start, width: l.pos - start}, nil
+}
+
+func (l *lexer) errorAt(pos int, expected string, found string) *SyntaxError {
+	return &SyntaxError{Input: string(l.input), Column: pos + 1, Expected: expected, Found: found}
+}
+
+// parser is a recursive-descent parser with a single token of lookahead.
+type parser struct {
+	lex  *lexer
+	tok  token
+	peek *token
+}
+
+func newParser(s string) (*parser, error) {
+	p := &parser{lex: &lexer{input: []rune(s)}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *parser) advance() error {
+	if p.peek != nil {
+		p.tok = *p.peek
+		p.peek = nil
+		return nil
+	}
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *parser) lookahead() (token, error) {
+	if p.peek == nil {
+		tok, err := p.lex.next()
+		if err != nil {
+			return token{}, err
+		}
+		p.peek = &tok
+	}
+	return *p.peek, nil
+}
+
+func (p *parser) unexpected(expected string) *SyntaxError {
+	return p.lex.errorAt(p.tok.pos, expected, p.tok.describe())
+}
+
+func (p *parser) expect(kind tokenKind) error {
+	if p.tok.kind != kind {
+		return p.unexpected(kind.String())
+	}
+	return p.advance()
+}
+
+// parseFilter parses a leaf or a composite filter starting at the current token.
+func (p *parser) parseFilter() (Filter, error) {
+	if p.tok.kind != tokenWord || p.tok.text == "" {
+		return nil, p.unexpected("filter")
+	}
+	next, err := p.lookahead()
+	if err != nil {
+		return nil, err
+	}
+	if next.kind == tokenLParen {
+		return p.parseComposite()
+	}
+	return p.parseLeaf()
+}
+
+func (p *parser) parseComposite() (Composite, error) {
+	operator := LogicalOperator(p.tok.text)
+	if !operator.isValid() {
+		return Composite{}, p.unexpected("logical operator (and, or, not)")
+	}
+	if err := p.advance(); err != nil {
+		return Composite{}, err
+	}
+	if err := p.expect(tokenLParen); err != nil {
+		return Composite{}, err
+	}
+
+	filters := []Filter{}
+	if p.tok.kind != tokenRParen {
+		list, err := p.parseList()
+		if err != nil {
+			return Composite{}, err
+		}
+		filters = list
+	}
+	if err := p.expect(tokenRParen); err != nil {
+		if p.tok.kind != tokenEOF {
+			return Composite{}, p.unexpected("',' or ')'")
+		}
+		return Composite{}, err
+	}
+	return Composite{Operator: operator, Filters: filters}, nil
+}
+
+// parseList parses one or more comma separated filters.
+func (p *parser) parseList() ([]Filter, error) {
+	filters := []Filter{}
+	for {
+		f, err := p.parseFilter()
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+		if p.tok.kind != tokenComma {
+			return filters, nil
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) parseLeaf() (Leaf, error) {
+	if p.tok.kind != tokenWord || p.tok.text == "" {
+		return Leaf{}, p.unexpected("field name")
+	}
+	field := p.tok.text
+	if err := p.advance(); err != nil {
+		return Leaf{}, err
+	}
+	if err := p.expect(tokenColon); err != nil {
+		return Leaf{}, err
+	}
+
+	if p.tok.kind != tokenWord {
+		return Leaf{}, p.unexpected("comparator")
+	}
+	comparator := comparisonOperator(p.tok.text)
+	if !comparator.isValid() {
+		return Leaf{}, p.unexpected("comparator")
+	}
+	if err := p.advance(); err != nil {
+		return Leaf{}, err
+	}
+
+	// Null checks do not take a value.
+	if comparator.isUnary() && p.tok.kind != tokenColon {
+		return Leaf{Field: field, Comparator: comparator, Value: nil}, nil
+	}
+	if err := p.expect(tokenColon); err != nil {
+		return Leaf{}, err
+	}
+
+	var value interface{} = ""
+	switch p.tok.kind {
+	case tokenWord, tokenString:
+		value = p.tok.text
+		if err := p.advance(); err != nil {
+			return Leaf{}, err
+		}
+	case tokenList:
+		value = p.tok.items
+		if err := p.advance(); err != nil {
+			return Leaf{}, err
+		}
+	case tokenComma, tokenRParen, tokenEOF:
+		// An empty value, e.g. "name:eq:".
+	default:
+		return Leaf{}, p.unexpected("value")
+	}
+	return Leaf{Field: field, Comparator: comparator, Value: value}, nil
+}
+
+// end checks that the whole input has been consumed.
+func (p *parser) end() error {
+	if p.tok.kind != tokenEOF {
+		return p.unexpected(tokenEOF.String())
+	}
+	return nil
+}
+
+func (o LogicalOperator) isValid() bool {
+	return o == LogicalAnd || o == LogicalOr || o == LogicalNot
+}
+
+func (c comparisonOperator) isValid() bool {
+	switch c {
+	case ComparatorEqual, ComparatorNotEqual,
+		ComparatorGreaterThan, ComparatorGreaterThanOrEqual,
+		ComparatorLessThan, ComparatorLessThanOrEqual,
+		ComparatorLike, ComparatorNotLike,
+		ComparatorIn, ComparatorNotIn,
+		ComparatorIsNull, ComparatorIsNotNull,
+		ComparatorBetween, ComparatorStartsWith, ComparatorEndsWith, ComparatorContains,
+		ComparatorILike, ComparatorAny, ComparatorAll, ComparatorSearch:
+		return true
+	}
+	return false
+}
+
+// isUnary reports whether the comparator takes no value.
+func (c comparisonOperator) isUnary() bool {
+	return c == ComparatorIsNull || c == ComparatorIsNotNull
+}
+
+// formatValue renders a leaf value so that it can be parsed back unchanged.
+// Slices and arrays (other than UUIDs) are rendered as lists.
+func formatValue(v interface{}) string {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Slice || (rv.Kind() == reflect.Array && rv.Type() != uuidType) {
+		items := make([]string, rv.Len())
+		for i := range items {
+			items[i] = quoteItem(formatScalar(rv.Index(i).Interface()))
+		}
+		return "[" + strings.Join(items, "|") + "]"
+	}
+	return quoteValue(formatScalar(v))
+}
+
+func formatScalar(v interface{}) string {
+	if t, ok := v.(time.Time); ok {
+		return t.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(v)
+}
+
+// quoteItem is like quoteValue but also quotes the list delimiters.
+func quoteItem(s string) string {
+	if strings.ContainsAny(s, "|]") {
+		return quote(s)
+	}
+	return quoteValue(s)
+}
+
+// quoteValue wraps values that contain delimiters, quotes, backslashes or
+// surrounding whitespace (or that would be read as a list) in double quotes.
+func quoteValue(s string) string {
+	needsQuotes := s == "" || strings.TrimSpace(s) != s ||
+		strings.HasPrefix(s, "[") || strings.ContainsAny(s, ",:()\"\\")
+	if !needsQuotes {
+		return s
+	}
+	return quote(s)
+}
+
+func quote(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		if r == '"' || r == '\\' {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
@@ -0,0 +1,179 @@
+package filter
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseNested(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Filter
+	}{
+		{"and(name:eq:John,or(age:gt:30,age:lt:20))", And(
+			Equal("name", "John"),
+			Or(GreaterThan("age", "30"), LessThan("age", "20")),
+		)},
+		{"or(and(a:eq:1,not(b:eq:2)),and(c:eq:3,or(d:eq:4,not(and(e:eq:5)))))", Or(
+			And(Equal("a", "1"), Not(Equal("b", "2"))),
+			And(Equal("c", "3"), Or(Equal("d", "4"), Not(And(Equal("e", "5"))))),
+		)},
+		{"and()", And()},
+		{"and( name:eq:John , age:gt:30 )", And(Equal("name", "John"), GreaterThan("age", "30"))},
+	}
+
+	for _, test := range tests {
+		result, err := Parse(test.input)
+		if err != nil {
+			t.Errorf("Parse(%s) returned an error: %v", test.input, err)
+			continue
+		}
+		if !compareFilters(result, test.expected) {
+			t.Errorf("Parse(%s) = %v, expected %v", test.input, result, test.expected)
+		}
+	}
+}
+
+func TestParseQuotingAndEscaping(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Leaf
+	}{
+		{`name:eq:"Smith, J."`, Equal("name", "Smith, J.")},
+		{`created_at:ge:"2024-01-01T10:00:00Z"`, GreaterThanOrEqual("created_at", "2024-01-01T10:00:00Z")},
+		{`email:eq:"a(b)c@example.com"`, Equal("email", "a(b)c@example.com")},
+		{`name:eq:"say \"hi\" \\ bye"`, Equal("name", `say "hi" \ bye`)},
+		{`url:eq:https\://example.com/a\,b`, Equal("url", "https://example.com/a,b")},
+		{`name:eq:John Smith`, Equal("name", "John Smith")},
+		{`name:eq:""`, Equal("name", "")},
+		{`name:eq:`, Equal("name", "")},
+		{`deleted_at:is_null`, IsNull("deleted_at")},
+		{`deleted_at:is_not_null`, IsNotNull("deleted_at")},
+	}
+
+	for _, test := range tests {
+		result, err := ParseLeaf(test.input)
+		if err != nil {
+			t.Errorf("ParseLeaf(%s) returned an error: %v", test.input, err)
+			continue
+		}
+		if result != test.expected {
+			t.Errorf("ParseLeaf(%s) = %v, expected %v", test.input, result, test.expected)
+		}
+	}
+}
+
+func TestParseList(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Leaf
+	}{
+		{"role:in:[admin|editor]", In("role", []string{"admin", "editor"})},
+		{"role:not_in:[ admin | editor ]", NotIn("role", []string{"admin", "editor"})},
+		{`name:in:["a|b"|c\]d]`, In("name", []string{"a|b", "c]d"})},
+		{"name:in:[]", In("name", []string{})},
+		{"name:eq:a[b]", Equal("name", "a[b]")},
+		{"age:between:[18|65]", NewLeaf("age", ComparatorBetween, []string{"18", "65"})},
+		{"roles.name:any:[admin|editor]", Any("roles.name", []string{"admin", "editor"})},
+		{"tags.name:all:[go|sql]", All("tags.name", []string{"go", "sql"})},
+		{`bio:search:"quick, brown fox"`, Search("bio", "quick, brown fox")},
+		{"name:starts_with:Jo", StartsWith("name", "Jo")},
+		{"name:ilike:jo%", ILike("name", "jo%")},
+	}
+
+	for _, test := range tests {
+		result, err := ParseLeaf(test.input)
+		if err != nil {
+			t.Errorf("ParseLeaf(%s) returned an error: %v", test.input, err)
+			continue
+		}
+		if !compareFilters(result, test.expected) {
+			t.Errorf("ParseLeaf(%s) = %v, expected %v", test.input, result, test.expected)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		column   int
+		expected string
+	}{
+		{"name", 5, "':'"},
+		{"name:eq", 8, "':'"},
+		{"name:xx:John", 6, "comparator"},
+		{"and(name:eq:John", 17, "')'"},
+		{"and(name:eq:John,)", 18, "filter"},
+		{"xor(name:eq:John)", 1, "logical operator (and, or, not)"},
+		{"name:eq:John)", 13, "end of input"},
+		{`name:eq:"John`, 14, "closing '\"'"},
+		{`name:eq:John\`, 14, "escaped character"},
+		{"and(a:eq:b c:eq:d)", 13, "',' or ')'"},
+		{"", 1, "filter"},
+		{"role:in:[admin|editor", 22, "'|' or ']'"},
+	}
+
+	for _, test := range tests {
+		_, err := Parse(test.input)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("Parse(%q) error = %v, expected a *SyntaxError", test.input, err)
+			continue
+		}
+		if syntaxErr.Column != test.column || syntaxErr.Expected != test.expected {
+			t.Errorf("Parse(%q) error at column %d expecting %s, expected column %d expecting %s",
+				test.input, syntaxErr.Column, syntaxErr.Expected, test.column, test.expected)
+		}
+	}
+}
+
+func TestParseFilterList(t *testing.T) {
+	result, err := ParseFilterList(`name:eq:"a,b",or(age:gt:30,age:lt:20)`)
+	if err != nil {
+		t.Fatalf("ParseFilterList returned an error: %v", err)
+	}
+	expected := []Filter{
+		Equal("name", "a,b"),
+		Or(GreaterThan("age", "30"), LessThan("age", "20")),
+	}
+	if len(result) != len(expected) {
+		t.Fatalf("ParseFilterList returned %d filters, expected %d", len(result), len(expected))
+	}
+	for i := range expected {
+		if !compareFilters(result[i], expected[i]) {
+			t.Errorf("ParseFilterList()[%d] = %v, expected %v", i, result[i], expected[i])
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	filters := []Filter{
+		Equal("name", "John"),
+		Equal("name", "Smith, J."),
+		Equal("name", `quote " and \ backslash`),
+		Equal("name", " padded "),
+		Equal("name", ""),
+		GreaterThanOrEqual("created_at", "2024-01-01T10:00:00Z"),
+		IsNull("deleted_at"),
+		And(),
+		And(Equal("name", "John"), Or(GreaterThan("age", "30"), Not(Like("email", "%(work)%")))),
+		In("role", []string{"admin", "editor"}),
+		In("name", []string{"a|b", "c]d", "[e]"}),
+		Equal("name", "[not a list]"),
+	}
+
+	for _, f := range filters {
+		s := f.ToString()
+		parsed, err := Parse(s)
+		if err != nil {
+			t.Errorf("Parse(%s) returned an error: %v", s, err)
+			continue
+		}
+		if !compareFilters(parsed, f) {
+			t.Errorf("Parse(%s) = %v, expected %v", s, parsed, f)
+		}
+		if parsed.ToString() != s {
+			t.Errorf("ToString() = %s after round trip, expected %s", parsed.ToString(), s)
+		}
+	}
+}
@@ -0,0 +1,494 @@
+package filter
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/cmo7/folly4/src/lib/generics/common"
+	"github.com/google/uuid"
+)
+
+// FieldKind is the kind of value a field holds, as far as filtering is concerned.
+type FieldKind string
+
+const (
+	KindString FieldKind = "string"
+	KindInt    FieldKind = "int"
+	KindUint   FieldKind = "uint"
+	KindFloat  FieldKind = "float"
+	KindBool   FieldKind = "bool"
+	KindTime   FieldKind = "time"
+	KindUUID   FieldKind = "uuid"
+	KindEnum   FieldKind = "enum"
+)
+
+// Enum is implemented by named string types that only accept a fixed set of values,
+// such as permission.Operation. Filter values for enum fields are checked against EnumValues.
+type Enum interface {
+	EnumValues() []string
+}
+
+var (
+	// ErrUnknownField is returned when a filter references a field that is not part of the schema.
+	ErrUnknownField = errors.New("unknown field")
+	// ErrInvalidValue is returned when a filter value cannot be coerced to the type of its field.
+	ErrInvalidValue = errors.New("invalid value")
+	// ErrNotFilterable is returned when a filter references a field tagged with `query:"-"` or `query:"nofilter"`.
+	ErrNotFilterable = errors.New("field is not filterable")
+)
+
+// FieldError describes a filter leaf that does not fit the schema.
+// It wraps ErrUnknownField, ErrNotFilterable or ErrInvalidValue, so callers can use errors.Is
+// to tell a client error (400 Bad Request) from other failures.
+type FieldError struct {
+	Field  string
+	Value  interface{}
+	Kind   FieldKind
+	Err    error
+	Reason string
+}
+
+func (e *FieldError) Error() string {
+	switch {
+	case errors.Is(e.Err, ErrUnknownField):
+		return fmt.Sprintf("filter: unknown field %q", e.Field)
+	case errors.Is(e.Err, ErrNotFilterable):
+		return fmt.Sprintf("filter: field %q is not filterable", e.Field)
+	}
+	return fmt.Sprintf("filter: invalid value %q for %s field %q: %s", fmt.Sprint(e.Value), e.Kind, e.Field, e.Reason)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	uuidType     = reflect.TypeOf(uuid.UUID{})
+	timeType     = reflect.TypeOf(time.Time{})
+	nullTimeType = reflect.TypeOf(sql.NullTime{})
+	enumType     = reflect.TypeOf((*Enum)(nil)).Elem()
+)
+
+// timeLayouts are the layouts accepted for time values, tried in order.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// SchemaField describes a single filterable field of an entity.
+type SchemaField struct {
+	Name string       // Go field name, e.g. "CreatedAt".
+	Type reflect.Type // Value type, with pointers removed.
+	Kind FieldKind
+	// Values holds the accepted values of an enum field.
+	Values []string
+	// Filterable is false for fields tagged with `query:"-"` or `query:"nofilter"`.
+	Filterable bool
+}
+
+// Schema describes the filterable fields of an entity type.
+// Fields can be looked up by their Go name, their json tag name or their snake_case name,
+// so "CreatedAt", "createdAt" (if tagged) and "created_at" all resolve to the same field.
+// Fields of related entities are addressed with dotted paths such as "roles.name".
+type Schema struct {
+	fields    []SchemaField
+	index     map[string]int
+	relations map[string]schemaRelation
+}
+
+// schemaRelation is a field holding related entities: a struct, a slice of structs or a pointer to either.
+type schemaRelation struct {
+	Name string       // Go field name.
+	Type reflect.Type // Related struct type.
+}
+
+var schemaCache sync.Map // map[reflect.Type]*Schema
+
+// SchemaOf returns the (cached) schema of the entity type E.
+// E may be a struct or a pointer to a struct, e.g. *models.UserEntity.
+func SchemaOf[E any]() *Schema {
+	return schemaFor(reflect.TypeOf((*E)(nil)).Elem())
+}
+
+func schemaFor(t reflect.Type) *Schema {
+	if cached, ok := schemaCache.Load(t); ok {
+		return cached.(*Schema)
+	}
+	schema, _ := schemaCache.LoadOrStore(t, NewSchema(t))
+	return schema.(*Schema)
+}
+
+// NewSchema builds the schema of a struct type (or pointer to struct type) by reflection.
+// Fields promoted from embedded structs are included. Relations (structs and slices of structs)
+// are reachable through dotted paths; unexported fields are not part of the schema.
+func NewSchema(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	s := &Schema{index: map[string]int{}, relations: map[string]schemaRelation{}}
+	if t.Kind() != reflect.Struct {
+		return s
+	}
+
+	for _, sf := range reflect.VisibleFields(t) {
+		if sf.Anonymous || !sf.IsExported() {
+			continue
+		}
+		if field, ok := newSchemaField(sf); ok {
+			s.add(field, sf)
+		} else if related, ok := relatedType(sf.Type); ok && common.ParseQueryTag(sf.Tag).Filterable {
+			for _, name := range fieldNames(sf) {
+				if _, exists := s.relations[name]; !exists {
+					s.relations[name] = schemaRelation{Name: sf.Name, Type: related}
+				}
+			}
+		}
+	}
+	return s
+}
+
+func (s *Schema) add(field SchemaField, sf reflect.StructField) {
+	i := len(s.fields)
+	s.fields = append(s.fields, field)
+	for _, name := range fieldNames(sf) {
+		if _, exists := s.index[name]; !exists {
+			s.index[name] = i
+		}
+	}
+}
+
+// fieldNames returns the names a struct field can be referenced by.
+func fieldNames(sf reflect.StructField) []string {
+	names := []string{sf.Name, toSnakeCase(sf.Name)}
+	if tag, ok := sf.Tag.Lookup("json"); ok {
+		if name := strings.Split(tag, ",")[0]; name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// relatedType returns the struct type of a relation field: a struct, a slice of structs
+// or a pointer to either.
+func relatedType(t reflect.Type) (reflect.Type, bool) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+	}
+	return t, t.Kind() == reflect.Struct
+}
+
+func newSchemaField(sf reflect.StructField) (SchemaField, bool) {
+	t := sf.Type
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	field := SchemaField{Name: sf.Name, Type: t, Filterable: common.ParseQueryTag(sf.Tag).Filterable}
+
+	switch {
+	case t == uuidType:
+		field.Kind = KindUUID
+	case t == timeType || t.ConvertibleTo(nullTimeType):
+		field.Kind = KindTime
+	case t.Implements(enumType) || reflect.PointerTo(t).Implements(enumType):
+		field.Kind = KindEnum
+		field.Values = reflect.New(t).Interface().(Enum).EnumValues()
+	default:
+		switch t.Kind() {
+		case reflect.String:
+			field.Kind = KindString
+		case reflect.Bool:
+			field.Kind = KindBool
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			field.Kind = KindInt
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			field.Kind = KindUint
+		case reflect.Float32, reflect.Float64:
+			field.Kind = KindFloat
+		default:
+			return SchemaField{}, false
+		}
+	}
+	return field, true
+}
+
+// Fields returns the fields of the schema in declaration order.
+func (s *Schema) Fields() []SchemaField {
+	return slices.Clone(s.fields)
+}
+
+// Field looks up a field by its Go, json or snake_case name.
+// A dotted path such as "roles.name" looks up the field of a related entity.
+func (s *Schema) Field(name string) (SchemaField, bool) {
+	if relation, rest, ok := strings.Cut(name, "."); ok {
+		related, ok := s.relations[relation]
+		if !ok {
+			return SchemaField{}, false
+		}
+		return schemaFor(related.Type).Field(rest)
+	}
+	i, ok := s.index[name]
+	if !ok {
+		return SchemaField{}, false
+	}
+	return s.fields[i], true
+}
+
+// Related returns the schema of the entities of a relation, looked up by its Go, json or snake_case name.
+func (s *Schema) Related(name string) (*Schema, bool) {
+	related, ok := s.relations[name]
+	if !ok {
+		return nil, false
+	}
+	return schemaFor(related.Type), true
+}
+
+// RelationName returns the Go name of a relation looked up by its Go, json or snake_case name.
+func (s *Schema) RelationName(name string) (string, bool) {
+	related, ok := s.relations[name]
+	return related.Name, ok
+}
+
+// Coerce returns a copy of f in which every leaf value has been converted to the type
+// of its field: strings become ints, floats, bools, time.Time, uuid.UUID or enum values,
+// and lists used with in/not_in become typed slices (e.g. []int).
+// Leaves referencing unknown fields or holding values that cannot be converted
+// produce a *FieldError.
+func (s *Schema) Coerce(f Filter) (Filter, error) {
+	switch f := f.(type) {
+	case nil:
+		return nil, nil
+	case Leaf:
+		return s.coerceLeaf(f)
+	case Composite:
+		filters := make([]Filter, 0, len(f.Filters))
+		for _, child := range f.Filters {
+			coerced, err := s.Coerce(child)
+			if err != nil {
+				return nil, err
+			}
+			filters = append(filters, coerced)
+		}
+		return Composite{Operator: f.Operator, Filters: filters}, nil
+	}
+	return nil, fmt.Errorf("filter: unsupported filter type %T", f)
+}
+
+func (s *Schema) coerceLeaf(f Leaf) (Leaf, error) {
+	field, ok := s.Field(f.Field)
+	if !ok {
+		return Leaf{}, &FieldError{Field: f.Field, Value: f.Value, Err: ErrUnknownField}
+	}
+	if !field.Filterable {
+		return Leaf{}, &FieldError{Field: f.Field, Value: f.Value, Kind: field.Kind, Err: ErrNotFilterable}
+	}
+
+	switch f.Comparator {
+	case ComparatorIsNull, ComparatorIsNotNull:
+		f.Value = nil
+		return f, nil
+	case ComparatorEqual, ComparatorNotEqual:
+		// Comparing with nil is a null check.
+		if f.Value == nil {
+			return f, nil
+		}
+	case ComparatorLike, ComparatorNotLike, ComparatorILike,
+		ComparatorStartsWith, ComparatorEndsWith, ComparatorContains, ComparatorSearch:
+		// Patterns and search terms are always matched as text.
+		pattern, ok := f.Value.(string)
+		if !ok {
+			return Leaf{}, field.invalid(f.Value, errors.New("pattern must be a string"))
+		}
+		f.Value = pattern
+		return f, nil
+	case ComparatorIn, ComparatorNotIn, ComparatorAny, ComparatorAll:
+		values, err := field.CoerceList(f.Value)
+		if err != nil {
+			return Leaf{}, err
+		}
+		f.Value = values
+		return f, nil
+	case ComparatorBetween:
+		values, err := field.CoerceList(f.Value)
+		if err != nil {
+			return Leaf{}, err
+		}
+		if reflect.ValueOf(values).Len() != 2 {
+			return Leaf{}, field.invalid(f.Value, errors.New("between requires a list of two values"))
+		}
+		f.Value = values
+		return f, nil
+	}
+
+	value, err := field.Coerce(f.Value)
+	if err != nil {
+		return Leaf{}, err
+	}
+	f.Value = value
+	return f, nil
+}
+
+// CoerceList converts a list value into a typed slice whose element type is the field type.
+// A single scalar value is treated as a list of one element.
+func (field SchemaField) CoerceList(value interface{}) (interface{}, error) {
+	rv := reflect.ValueOf(value)
+	if !rv.IsValid() || (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) || rv.Type() == uuidType {
+		rv = reflect.ValueOf([]interface{}{value})
+	}
+
+	elemType := field.Type
+	if field.Kind == KindTime {
+		elemType = timeType
+	}
+	out := reflect.MakeSlice(reflect.SliceOf(elemType), 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		item, err := field.Coerce(rv.Index(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		out = reflect.Append(out, reflect.ValueOf(item))
+	}
+	return out.Interface(), nil
+}
+
+// Coerce converts a single value to the field type.
+// Strings are parsed; values of other types are converted when Go allows it.
+func (field SchemaField) Coerce(value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, field.invalid(value, errors.New("value is required"))
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Type() == field.Type {
+		return field.check(value)
+	}
+	if t, ok := value.(time.Time); ok && field.Kind == KindTime {
+		return t, nil
+	}
+
+	s, isString := value.(string)
+	if !isString {
+		if isNumeric(field.Kind) && isNumeric(kindOf(rv.Type())) {
+			return rv.Convert(field.Type).Interface(), nil
+		}
+		s = fmt.Sprint(value)
+	}
+
+	parsed, err := field.parse(s)
+	if err != nil {
+		return nil, field.invalid(value, err)
+	}
+	return field.check(parsed)
+}
+
+// parse converts a string into a value of the field type.
+func (field SchemaField) parse(s string) (interface{}, error) {
+	s = strings.TrimSpace(s)
+	var v reflect.Value
+	switch field.Kind {
+	case KindString, KindEnum:
+		v = reflect.ValueOf(s)
+	case KindBool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, errors.New("not a boolean")
+		}
+		v = reflect.ValueOf(b)
+	case KindInt:
+		i, err := strconv.ParseInt(s, 10, field.Type.Bits())
+		if err != nil {
+			return nil, errors.New("not an integer")
+		}
+		v = reflect.ValueOf(i)
+	case KindUint:
+		u, err := strconv.ParseUint(s, 10, field.Type.Bits())
+		if err != nil {
+			return nil, errors.New("not an unsigned integer")
+		}
+		v = reflect.ValueOf(u)
+	case KindFloat:
+		f, err := strconv.ParseFloat(s, field.Type.Bits())
+		if err != nil {
+			return nil, errors.New("not a number")
+		}
+		v = reflect.ValueOf(f)
+	case KindUUID:
+		id, err := uuid.Parse(s)
+		if err != nil {
+			return nil, errors.New("not a UUID")
+		}
+		return id, nil
+	case KindTime:
+		// Time values are always returned as time.Time, also for sql.NullTime-like fields.
+		return parseTime(s)
+	default:
+		return nil, fmt.Errorf("unsupported field kind %s", field.Kind)
+	}
+	return v.Convert(field.Type).Interface(), nil
+}
+
+// check validates an already typed value, e.g. enum membership.
+func (field SchemaField) check(value interface{}) (interface{}, error) {
+	if field.Kind == KindEnum && !slices.Contains(field.Values, fmt.Sprint(value)) {
+		return nil, field.invalid(value, fmt.Errorf("must be one of %s", strings.Join(field.Values, ", ")))
+	}
+	return value, nil
+}
+
+func (field SchemaField) invalid(value interface{}, err error) *FieldError {
+	return &FieldError{Field: field.Name, Value: value, Kind: field.Kind, Err: ErrInvalidValue, Reason: err.Error()}
+}
+
+func isNumeric(kind FieldKind) bool {
+	return kind == KindInt || kind == KindUint || kind == KindFloat
+}
+
+// kindOf returns the FieldKind of a plain Go type, or "" if it is not a scalar.
+func kindOf(t reflect.Type) FieldKind {
+	field, ok := newSchemaField(reflect.StructField{Type: t})
+	if !ok {
+		return ""
+	}
+	return field.Kind
+}
+
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("not a date or RFC 3339 timestamp")
+}
+
+// toSnakeCase converts a Go field name to snake_case the way GORM names columns,
+// e.g. "CreatedAt" -> "created_at" and "UserID" -> "user_id".
+func toSnakeCase(name string) string {
+	runes := []rune(name)
+	var sb strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prev := runes[i-1]
+			nextIsLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextIsLower) {
+				sb.WriteByte('_')
+			}
+		}
+		sb.WriteRune(unicode.ToLower(r))
+	}
+	return sb.String()
+}
@@ -0,0 +1,236 @@
+package filter
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type testRole string
+
+func (r testRole) EnumValues() []string {
+	return []string{"admin", "editor"}
+}
+
+type testDeletedAt sql.NullTime
+
+type testBase struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	DeletedAt testDeletedAt
+}
+
+type testEntity struct {
+	testBase
+	Username string
+	Age      int32
+	Score    float64
+	Active   bool
+	Role     testRole
+	Nickname *string `json:"nick"`
+	Password string  `query:"-"`
+	Friends  []*testEntity
+	secret   string
+}
+
+func TestSchemaFields(t *testing.T) {
+	schema := SchemaOf[*testEntity]()
+
+	tests := []struct {
+		name     string
+		expected string
+		kind     FieldKind
+	}{
+		{"ID", "ID", KindUUID},
+		{"id", "ID", KindUUID},
+		{"created_at", "CreatedAt", KindTime},
+		{"deleted_at", "DeletedAt", KindTime},
+		{"username", "Username", KindString},
+		{"Age", "Age", KindInt},
+		{"score", "Score", KindFloat},
+		{"active", "Active", KindBool},
+		{"role", "Role", KindEnum},
+		{"nick", "Nickname", KindString},
+	}
+
+	for _, test := range tests {
+		field, ok := schema.Field(test.name)
+		if !ok {
+			t.Errorf("Field(%s) not found", test.name)
+			continue
+		}
+		if field.Name != test.expected || field.Kind != test.kind {
+			t.Errorf("Field(%s) = %s (%s), expected %s (%s)", test.name, field.Name, field.Kind, test.expected, test.kind)
+		}
+	}
+
+	for _, name := range []string{"Friends", "secret", "testBase"} {
+		if _, ok := schema.Field(name); ok {
+			t.Errorf("Field(%s) should not be part of the schema", name)
+		}
+	}
+
+	if SchemaOf[*testEntity]() != schema {
+		t.Errorf("SchemaOf should return the cached schema")
+	}
+}
+
+func TestSchemaCoerce(t *testing.T) {
+	schema := SchemaOf[testEntity]()
+	id := uuid.New()
+
+	tests := []struct {
+		input    string
+		expected Filter
+	}{
+		{"age:gt:30", GreaterThan("age", int32(30))},
+		{"score:le:4.5", LessThanOrEqual("score", 4.5)},
+		{"active:eq:true", Equal("active", true)},
+		{"created_at:ge:2024-01-01", GreaterThanOrEqual("created_at", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))},
+		{`created_at:lt:"2024-01-01T10:30:00Z"`, LessThan("created_at", time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC))},
+		{"id:eq:" + id.String(), Equal("id", id)},
+		{"role:eq:admin", Equal("role", testRole("admin"))},
+		{"role:in:[admin|editor]", In("role", []testRole{"admin", "editor"})},
+		{"age:not_in:[1|2|3]", NotIn("age", []int32{1, 2, 3})},
+		{"age:in:7", In("age", []int32{7})},
+		{"username:like:jo%", Like("username", "jo%")},
+		{"username:ilike:JO%", ILike("username", "JO%")},
+		{"username:starts_with:100%", StartsWith("username", "100%")},
+		{"username:search:quick fox", Search("username", "quick fox")},
+		{"age:between:[18|65]", NewLeaf("age", ComparatorBetween, []int32{18, 65})},
+		{"role:any:[admin|editor]", Any("role", []testRole{"admin", "editor"})},
+		{"friends.age:all:30", All("friends.age", []int32{30})},
+		{"deleted_at:is_null", IsNull("deleted_at")},
+		{`{"field":"nick","op":"eq","value":null}`, Equal("nick", nil)},
+		{"friends.age:gt:30", GreaterThan("friends.age", int32(30))},
+		{"Friends.friends.role:eq:admin", Equal("Friends.friends.role", testRole("admin"))},
+		{"and(username:eq:bob,or(age:gt:30,active:eq:false))", And(
+			Equal("username", "bob"),
+			Or(GreaterThan("age", int32(30)), Equal("active", false)),
+		)},
+	}
+
+	for _, test := range tests {
+		parse := Parse
+		if strings.HasPrefix(test.input, "{") {
+			parse = func(s string) (Filter, error) { return ParseJSON([]byte(s)) }
+		}
+		parsed, err := parse(test.input)
+		if err != nil {
+			t.Errorf("Parse(%s) returned an error: %v", test.input, err)
+			continue
+		}
+		result, err := schema.Coerce(parsed)
+		if err != nil {
+			t.Errorf("Coerce(%s) returned an error: %v", test.input, err)
+			continue
+		}
+		if !compareFilters(result, test.expected) {
+			t.Errorf("Coerce(%s) = %#v, expected %#v", test.input, result, test.expected)
+		}
+	}
+}
+
+func TestSchemaCoerceTypedValues(t *testing.T) {
+	schema := SchemaOf[testEntity]()
+
+	result, err := schema.Coerce(And(GreaterThan("age", 30), In("score", []int{1, 2})))
+	if err != nil {
+		t.Fatalf("Coerce returned an error: %v", err)
+	}
+	expected := And(GreaterThan("age", int32(30)), In("score", []float64{1, 2}))
+	if !compareFilters(result, expected) {
+		t.Errorf("Coerce = %#v, expected %#v", result, expected)
+	}
+}
+
+func TestSchemaCoerceErrors(t *testing.T) {
+	schema := SchemaOf[testEntity]()
+
+	tests := []struct {
+		input    string
+		expected error
+	}{
+		{"age:gt:thirty", ErrInvalidValue},
+		{"age:gt:99999999999", ErrInvalidValue},
+		{"active:eq:maybe", ErrInvalidValue},
+		{"created_at:ge:yesterday", ErrInvalidValue},
+		{"id:eq:not-a-uuid", ErrInvalidValue},
+		{"role:eq:root", ErrInvalidValue},
+		{"role:in:[admin|root]", ErrInvalidValue},
+		{"age:between:[1|2|3]", ErrInvalidValue},
+		{"age:between:18", ErrInvalidValue},
+		{"age:between:[18|old]", ErrInvalidValue},
+		{"role:any:[root]", ErrInvalidValue},
+		{"and(username:eq:bob,age:eq:x)", ErrInvalidValue},
+		{"password:eq:secret", ErrNotFilterable},
+		{"pass:eq:secret", ErrUnknownField},
+		{"friends:eq:x", ErrUnknownField},
+		{"friends.unknown:eq:x", ErrUnknownField},
+		{"enemies.age:eq:1", ErrUnknownField},
+		{"friends.age:eq:x", ErrInvalidValue},
+		{"friends.password:eq:secret", ErrNotFilterable},
+	}
+
+	for _, test := range tests {
+		parsed, err := Parse(test.input)
+		if err != nil {
+			t.Errorf("Parse(%s) returned an error: %v", test.input, err)
+			continue
+		}
+		_, err = schema.Coerce(parsed)
+		var fieldErr *FieldError
+		if !errors.As(err, &fieldErr) || !errors.Is(err, test.expected) {
+			t.Errorf("Coerce(%s) error = %v, expected %v", test.input, err, test.expected)
+		}
+	}
+}
+
+func TestToSnakeCase(t *testing.T) {
+	tests := map[string]string{
+		"ID":        "id",
+		"UserID":    "user_id",
+		"CreatedAt": "created_at",
+		"IP":        "ip",
+		"UserAgent": "user_agent",
+		"HTTPCode":  "http_code",
+		"Field1":    "field1",
+	}
+	for input, expected := range tests {
+		if result := toSnakeCase(input); result != expected {
+			t.Errorf("toSnakeCase(%s) = %s, expected %s", input, result, expected)
+		}
+	}
+}
+
+func TestFormatTypedValues(t *testing.T) {
+	leaf := In("age", []int32{1, 2})
+	if leaf.ToString() != "age:in:[1|2]" {
+		t.Errorf("ToString() = %s, expected age:in:[1|2]", leaf.ToString())
+	}
+	date := GreaterThan("created_at", time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC))
+	if date.ToString() != `created_at:gt:"2024-01-01T10:30:00Z"` {
+		t.Errorf("ToString() = %s", date.ToString())
+	}
+	if !reflect.DeepEqual(mustCoerce(t, date.ToString()), Filter(date)) {
+		t.Errorf("typed time value does not round trip")
+	}
+}
+
+func mustCoerce(t *testing.T, s string) Filter {
+	t.Helper()
+	parsed, err := Parse(s)
+	if err != nil {
+		t.Fatalf("Parse(%s) returned an error: %v", s, err)
+	}
+	result, err := SchemaOf[testEntity]().Coerce(parsed)
+	if err != nil {
+		t.Fatalf("Coerce(%s) returned an error: %v", s, err)
+	}
+	return result
+}
@@ -0,0 +1,348 @@
+package generics
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// convertFunc maps a value of one type to a value of another.
+type convertFunc func(in reflect.Value) reflect.Value
+
+type typePair struct {
+	in  reflect.Type
+	out reflect.Type
+}
+
+// fieldStep copies one field of the input struct to a field of the output struct.
+type fieldStep struct {
+	name    string // Go name of the input field.
+	in      []int
+	out     []int
+	convert convertFunc // Nil when the value is assigned as is.
+}
+
+// structPlan is the compiled mapping between two struct types, so mapping a value does not
+// have to look the fields up again.
+type structPlan struct {
+	steps []fieldStep
+}
+
+// apply copies the fields of in to out, which must be addressable.
+func (p *structPlan) apply(in reflect.Value, out reflect.Value) {
+	for _, step := range p.steps {
+		// Fields promoted through nil embedded pointers are left unset
+		value, err := in.FieldByIndexErr(step.in)
+		if err != nil {
+			continue
+		}
+		target, ok := settableField(out, step.out)
+		if !ok {
+			continue
+		}
+		if step.convert != nil {
+			value = step.convert(value)
+		}
+		target.Set(value)
+	}
+}
+
+// filter returns a plan with the steps of the input fields keep accepts.
+func (p *structPlan) filter(keep func(name string) bool) *structPlan {
+	filtered := &structPlan{}
+	for _, step := range p.steps {
+		if keep(step.name) {
+			filtered.steps = append(filtered.steps, step)
+		}
+	}
+	return filtered
+}
+
+// reads reports whether the plan copies the input field name.
+func (p *structPlan) reads(name string) bool {
+	for _, step := range p.steps {
+		if step.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// settableField returns the field of the struct v at index, allocating the nil embedded
+// pointers on the way.
+func settableField(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, v.CanSet()
+}
+
+// Struct plans are compiled once per pair of types. Plans of recursive types refer to themselves,
+// so a plan is cached before its fields are compiled.
+var (
+	plansMu sync.Mutex
+	plans   = map[typePair]*structPlan{}
+)
+
+// planFor returns the plan mapping the struct type in to the struct type out.
+func planFor(in reflect.Type, out reflect.Type) (*structPlan, error) {
+	plansMu.Lock()
+	defer plansMu.Unlock()
+	c := &planCompiler{}
+	plan, err := c.structPlan(in, out)
+	if err != nil {
+		// Plans compiled along with the failed one may refer to it.
+		for _, pair := range c.added {
+			delete(plans, pair)
+		}
+		return nil, err
+	}
+	return plan, nil
+}
+
+// planCompiler compiles plans while plansMu is held, remembering the plans it caches.
+type planCompiler struct {
+	added []typePair
+}
+
+func (c *planCompiler) structPlan(in reflect.Type, out reflect.Type) (*structPlan, error) {
+	pair := typePair{in, out}
+	if plan, ok := plans[pair]; ok {
+		return plan, nil
+	}
+	plan := &structPlan{}
+	plans[pair] = plan
+	c.added = append(c.added, pair)
+
+	inputFields := mappableFields(in)
+	for _, outputField := range mappableFields(out) {
+		tag, err := ParseMapTag(outputField.Tag.Get("map"))
+		if err != nil {
+			return nil, fmt.Errorf("field %s of %s: %w", outputField.Name, out, err)
+		}
+		if tag.Skip {
+			continue
+		}
+		source := outputField.Name
+		if tag.Name != "" {
+			source = tag.Name
+		}
+		inputField, ok := findField(inputFields, source, tag.Name != "")
+		if !ok {
+			if tag.Name != "" {
+				return nil, fmt.Errorf("field %s of %s: %s has no field %s", outputField.Name, out, in, tag.Name)
+			}
+			continue
+		}
+
+		var using *namedMapper
+		if tag.Using != "" {
+			if using, ok = registeredMapper(tag.Using); !ok {
+				return nil, fmt.Errorf("field %s of %s: no mapper registered as %s", outputField.Name, out, tag.Using)
+			}
+		}
+		convert, err := c.convert(inputField.Type, outputField.Type, using)
+		if err != nil {
+			return nil, fmt.Errorf("field %s of %s: %w", outputField.Name, out, err)
+		}
+		plan.steps = append(plan.steps, fieldStep{
+			name:    inputField.Name,
+			in:      inputField.Index,
+			out:     outputField.Index,
+			convert: convert,
+		})
+	}
+	return plan, nil
+}
+
+// convert compiles the conversion of values of type in to type out. It returns nil when the
+// values are assigned as is. using, if any, maps the innermost values the slices, maps and
+// pointers of in hold.
+func (c *planCompiler) convert(in reflect.Type, out reflect.Type, using *namedMapper) (convertFunc, error) {
+	if using != nil && in.AssignableTo(using.in) && using.out.AssignableTo(out) {
+		return using.convert(in, out), nil
+	}
+	if using == nil {
+		if converter, ok := registeredConverter(in, out); ok {
+			return func(v reflect.Value) reflect.Value {
+				return converter.Call([]reflect.Value{v})[0]
+			}, nil
+		}
+		if in.AssignableTo(out) {
+			return nil, nil
+		}
+	}
+
+	switch {
+	case in.Kind() == reflect.Pointer && out.Kind() == reflect.Pointer:
+		elem, err := c.convert(in.Elem(), out.Elem(), using)
+		if err != nil {
+			return nil, err
+		}
+		return func(v reflect.Value) reflect.Value {
+			if v.IsNil() {
+				return reflect.Zero(out)
+			}
+			p := reflect.New(out.Elem())
+			p.Elem().Set(apply(elem, v.Elem()))
+			return p
+		}, nil
+	case out.Kind() == reflect.Pointer:
+		elem, err := c.convert(in, out.Elem(), using)
+		if err != nil {
+			return nil, err
+		}
+		return func(v reflect.Value) reflect.Value {
+			p := reflect.New(out.Elem())
+			p.Elem().Set(apply(elem, v))
+			return p
+		}, nil
+	case in.Kind() == reflect.Pointer:
+		elem, err := c.convert(in.Elem(), out, using)
+		if err != nil {
+			return nil, err
+		}
+		return func(v reflect.Value) reflect.Value {
+			if v.IsNil() {
+				return reflect.Zero(out)
+			}
+			return apply(elem, v.Elem())
+		}, nil
+	case (in.Kind() == reflect.Slice || in.Kind() == reflect.Array) && out.Kind() == reflect.Slice:
+		elem, err := c.convert(in.Elem(), out.Elem(), using)
+		if err != nil {
+			return nil, err
+		}
+		return func(v reflect.Value) reflect.Value {
+			if v.Kind() == reflect.Slice && v.IsNil() {
+				return reflect.Zero(out)
+			}
+			s := reflect.MakeSlice(out, v.Len(), v.Len())
+			for i := 0; i < v.Len(); i++ {
+				s.Index(i).Set(apply(elem, v.Index(i)))
+			}
+			return s
+		}, nil
+	case in.Kind() == reflect.Map && out.Kind() == reflect.Map:
+		key, err := c.convert(in.Key(), out.Key(), nil)
+		if err != nil {
+			return nil, err
+		}
+		elem, err := c.convert(in.Elem(), out.Elem(), using)
+		if err != nil {
+			return nil, err
+		}
+		return func(v reflect.Value) reflect.Value {
+			if v.IsNil() {
+				return reflect.Zero(out)
+			}
+			m := reflect.MakeMapWithSize(out, v.Len())
+			for it := v.MapRange(); it.Next(); {
+				m.SetMapIndex(apply(key, it.Key()), apply(elem, it.Value()))
+			}
+			return m
+		}, nil
+	case using == nil && in.Kind() == reflect.Struct && out.Kind() == reflect.Struct:
+		plan, err := c.structPlan(in, out)
+		if err != nil {
+			return nil, err
+		}
+		return func(v reflect.Value) reflect.Value {
+			s := reflect.New(out).Elem()
+			plan.apply(v, s)
+			return s
+		}, nil
+	case using == nil && in.Kind() == out.Kind() && in.ConvertibleTo(out):
+		// Named types of the same kind, such as common.EntityName and string.
+		return func(v reflect.Value) reflect.Value {
+			return v.Convert(out)
+		}, nil
+	}
+
+	if using != nil {
+		return nil, fmt.Errorf("mapper %s cannot map %s to %s", using.name, in, out)
+	}
+	return nil, fmt.Errorf("cannot map %s to %s", in, out)
+}
+
+// apply converts v with convert, if any.
+func apply(convert convertFunc, v reflect.Value) reflect.Value {
+	if convert == nil {
+		return v
+	}
+	return convert(v)
+}
+
+// mappableFields returns the exported fields of the struct t, promoted fields included.
+// Embedded structs are mapped through their promoted fields.
+func mappableFields(t reflect.Type) []reflect.StructField {
+	fields := []reflect.StructField{}
+	for _, field := range reflect.VisibleFields(t) {
+		if !field.IsExported() || (field.Anonymous && structType(field.Type) != nil) {
+			continue
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// findField returns the field called name. Names given in map tags may differ in case.
+func findField(fields []reflect.StructField, name string, foldCase bool) (reflect.StructField, bool) {
+	for _, field := range fields {
+		if field.Name == name {
+			return field, true
+		}
+	}
+	if foldCase {
+		for _, field := range fields {
+			if strings.EqualFold(field.Name, name) {
+				return field, true
+			}
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// MapTag is a parsed map struct tag.
+type MapTag struct {
+	Skip  bool
+	Name  string // Input field to read.
+	Using string // Registered mapper to map the values with.
+}
+
+// ParseMapTag parses the map struct tag of an output field: "-" to leave the field unset, or
+// comma separated options, "name=<input field>" and "using=<registered mapper>".
+func ParseMapTag(tag string) (MapTag, error) {
+	if tag == "-" {
+		return MapTag{Skip: true}, nil
+	}
+	parsed := MapTag{}
+	if tag == "" {
+		return parsed, nil
+	}
+	for _, option := range strings.Split(tag, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(option), "=")
+		if !ok || value == "" {
+			return parsed, fmt.Errorf("invalid map tag option %q", option)
+		}
+		switch key {
+		case "name":
+			parsed.Name = value
+		case "using":
+			parsed.Using = value
+		default:
+			return parsed, fmt.Errorf("unknown map tag option %q", key)
+		}
+	}
+	return parsed, nil
+}
@@ -0,0 +1,90 @@
+package generics
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// namedMapper is a mapper registered with RegisterMapper, called through reflection.
+type namedMapper struct {
+	name string
+	in   reflect.Type
+	out  reflect.Type
+	fn   reflect.Value // func(in) out
+}
+
+// convert returns the conversion of values of type in to type out with the mapper. Nil
+// pointers are not passed to the mapper.
+func (m *namedMapper) convert(in reflect.Type, out reflect.Type) convertFunc {
+	return func(v reflect.Value) reflect.Value {
+		if in.Kind() == reflect.Pointer && v.IsNil() {
+			return reflect.Zero(out)
+		}
+		return m.fn.Call([]reflect.Value{v})[0]
+	}
+}
+
+var registry = struct {
+	sync.RWMutex
+	mappers    map[string]*namedMapper
+	converters map[typePair]reflect.Value
+}{
+	mappers:    map[string]*namedMapper{},
+	converters: map[typePair]reflect.Value{},
+}
+
+func init() {
+	RegisterConverter(func(t time.Time) string { return t.Format(time.RFC3339Nano) })
+	RegisterConverter(func(id uuid.UUID) string { return id.String() })
+}
+
+// RegisterMapper registers a mapper under a name, so the fields of other mappers can be mapped
+// with it with the map:"using=<name>" tag. Mappers must be registered before the mappers that
+// use them are built.
+func RegisterMapper[I, O interface{}](name string, mapper Mapper[I, O]) {
+	registry.Lock()
+	registry.mappers[name] = &namedMapper{
+		name: name,
+		in:   reflect.TypeOf((*I)(nil)).Elem(),
+		out:  reflect.TypeOf((*O)(nil)).Elem(),
+		fn:   reflect.ValueOf(mapper.Map),
+	}
+	registry.Unlock()
+	resetPlans()
+}
+
+// RegisterConverter registers the conversion of the values of type I to type O, used by the
+// mappers built afterwards for every field of type I mapped to a field of type O. Conversions
+// from time.Time and uuid.UUID to string are registered by default.
+func RegisterConverter[I, O interface{}](convert func(I) O) {
+	pair := typePair{reflect.TypeOf((*I)(nil)).Elem(), reflect.TypeOf((*O)(nil)).Elem()}
+	registry.Lock()
+	registry.converters[pair] = reflect.ValueOf(convert)
+	registry.Unlock()
+	resetPlans()
+}
+
+// resetPlans drops the cached plans, so the mappers built afterwards see the registrations.
+// Mappers already built keep their plans.
+func resetPlans() {
+	plansMu.Lock()
+	defer plansMu.Unlock()
+	plans = map[typePair]*structPlan{}
+}
+
+func registeredMapper(name string) (*namedMapper, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	mapper, ok := registry.mappers[name]
+	return mapper, ok
+}
+
+func registeredConverter(in reflect.Type, out reflect.Type) (reflect.Value, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	converter, ok := registry.converters[typePair{in, out}]
+	return converter, ok
+}
@@ -7,161 +7,206 @@ import (
 
 type MapperFunc[I, O interface{}] func(input I) O
 
+// Map calls the function, so functions can be used and registered as mappers.
+func (f MapperFunc[I, O]) Map(input I) O {
+	return f(input)
+}
+
 // Mapper is an interface that defines a method to map an input object to an output object.
 // The fields of the input object are copied to the output object.
 type Mapper[I, O interface{}] interface {
 	Map(input I) O
 }
 
+// FieldMapper is implemented by mappers that can tell which fields of the input reach the output.
+// Sparse fieldsets can only select the fields a FieldMapper maps, so fields it leaves out, such as
+// passwords, are never read for clients.
+type FieldMapper interface {
+	MapsField(name string) bool
+}
+
+// RelationMapper is implemented by FieldMappers that map relations with the mappers of their types,
+// so the sparse fieldsets of relations can only select the fields those mappers map.
+type RelationMapper interface {
+	FieldMapper
+	// MapperOf returns the mapper of the input relation with the Go name, or nil when it has none.
+	MapperOf(name string) FieldMapper
+}
+
 // GenericMapperImpl is a struct that implements the Mapper interface.
 // It has two fields: excludedFields and includedFields.
 // excludedFields is a list of fields that should not be copied from the input object to the output object.
 // includedFields is a list of fields that should be copied from the input object to the output object.
 // If both excludedFields and includedFields are empty, all fields are copied.
+//
+// Fields are matched by name, and their values are mapped recursively: structs field by field,
+// slices, arrays and maps element by element, and pointers through the values they point to.
+// Values of other types are converted with the converters registered with RegisterConverter.
+// The map tag of an output field changes how it is filled:
+//
+//	Roles []RoleDTO `map:"name=roles,using=RoleMapper"` // Read from the input field roles, mapped by the mapper registered as RoleMapper.
+//	Secret string   `map:"-"`                           // Left unset.
+//
+// The mapping is compiled once, when the mapper is built, and the constructors panic when the
+// fields cannot be mapped.
 type GenericMapperImpl[I, O interface{}] struct {
 	excludedFields []string
 	includedFields []string
+	plan           *structPlan
 }
 
 func NewGenericMapper[I, O interface{}](excludedFields []string, includedFields []string) Mapper[I, O] {
-	return &GenericMapperImpl[I, O]{excludedFields: excludedFields, includedFields: includedFields}
+	return newGenericMapper[I, O](excludedFields, includedFields)
 }
 
-func NewGenericMapperExcluding[I, O interface{}](excludedFields []string) Mapper[I, O] {
-	// Check if excludedFields are properties of the input type and output type
-
-	var helperInputInstance I
-	var helperOutputInstance O
-
-	inputFields := reflect.VisibleFields(reflect.TypeOf(helperInputInstance))
-	outputFields := reflect.VisibleFields(reflect.TypeOf(helperOutputInstance))
+// newGenericMapper compiles the plan of a mapper, which copies the fields mapped from the input
+// fields that are not excluded and, when there are included fields, are included.
+func newGenericMapper[I, O interface{}](excludedFields []string, includedFields []string) *GenericMapperImpl[I, O] {
+	m := &GenericMapperImpl[I, O]{excludedFields: excludedFields, includedFields: includedFields}
+	m.plan = m.compile()
+	return m
+}
 
-	inputFieldsNames := make([]string, len(inputFields))
-	for i, field := range inputFields {
-		inputFieldsNames[i] = field.Name
+// compile returns the plan of the mapper. It panics when the fields cannot be mapped.
+func (m GenericMapperImpl[I, O]) compile() *structPlan {
+	inputType := structType(reflect.TypeOf((*I)(nil)).Elem())
+	outputType := structType(reflect.TypeOf((*O)(nil)).Elem())
+	if inputType == nil || outputType == nil {
+		panic("The input and output types of a mapper must be structs or pointers to structs")
 	}
-
-	outputFieldsNames := make([]string, len(outputFields))
-	for i, field := range outputFields {
-		outputFieldsNames[i] = field.Name
+	plan, err := planFor(inputType, outputType)
+	if err != nil {
+		panic("Cannot map " + inputType.String() + " to " + outputType.String() + ": " + err.Error())
 	}
+	return plan.filter(func(name string) bool {
+		// If there are excluded fields and the current field is in the excluded fields, skip it
+		if slices.Contains(m.excludedFields, name) {
+			return false
+		}
+		// If there are included fields and the current field is not in the included fields, skip it
+		return len(m.includedFields) == 0 || slices.Contains(m.includedFields, name)
+	})
+}
 
+func NewGenericMapperExcluding[I, O interface{}](excludedFields []string) Mapper[I, O] {
+	// Check if excludedFields are properties of the input type and are mapped to the output type
+	full := newGenericMapper[I, O](nil, nil)
 	for _, excludedField := range excludedFields {
-		if !slices.Contains(inputFieldsNames, excludedField) {
+		if !hasField(reflect.TypeOf((*I)(nil)).Elem(), excludedField) {
 			panic("Excluded field " + excludedField + " is not a property of the input type")
 		}
 
-		if !slices.Contains(outputFieldsNames, excludedField) {
+		if !full.plan.reads(excludedField) {
 			panic("Excluded field " + excludedField + " is not a property of the output type")
 		}
 	}
 
-	// Not excluded fields must be of the same type
-	for _, inputField := range inputFields {
-		if !slices.Contains(excludedFields, inputField.Name) {
-			for _, outputField := range outputFields {
-				if inputField.Name == outputField.Name && inputField.Type != outputField.Type {
-					panic("Field " + inputField.Name + " is not of the same type in the input and output types")
-				}
-			}
-		}
-	}
-
-	return &GenericMapperImpl[I, O]{excludedFields: excludedFields}
+	return newGenericMapper[I, O](excludedFields, nil)
 }
 
 func NewGenericMapperIncluding[I, O interface{}](includedFields []string) Mapper[I, O] {
-	// Check if includedFields are properties of the input type and output type
-
-	var helperInputInstance I
-	var helperOutputInstance O
-
-	inputFields := reflect.VisibleFields(reflect.TypeOf(helperInputInstance))
-	outputFields := reflect.VisibleFields(reflect.TypeOf(helperOutputInstance))
-
-	inputFieldsNames := getFieldNames(inputFields)
-
-	outputFieldsNames := getFieldNames(outputFields)
-
+	// Check if includedFields are properties of the input type and are mapped to the output type
+	full := newGenericMapper[I, O](nil, nil)
 	for _, includedField := range includedFields {
-		if !slices.Contains(inputFieldsNames, includedField) {
+		if !hasField(reflect.TypeOf((*I)(nil)).Elem(), includedField) {
 			panic("Included field " + includedField + " is not a property of the input type")
 		}
 
-		if !slices.Contains(outputFieldsNames, includedField) {
+		if !full.plan.reads(includedField) {
 			panic("Included field " + includedField + " is not a property of the output type")
 		}
 	}
 
-	// Included fields must be of the same type
-	for _, includedField := range includedFields {
-		for _, inputField := range inputFields {
-			if includedField == inputField.Name {
-				for _, outputField := range outputFields {
-					if includedField == outputField.Name && inputField.Type != outputField.Type {
-						panic("Field " + includedField + " is not of the same type in the input and output types")
-					}
-				}
-			}
-		}
-	}
-
-	return &GenericMapperImpl[I, O]{includedFields: includedFields}
+	return newGenericMapper[I, O](nil, includedFields)
 }
 
-func NewGenericMapperDefault[I, O interface{}]() Mapper[I, O] {
-
-	// Every field pressent in the output type must be present in the input type and must be of the same type
-	var helperInputInstance I
-	var helperOutputInstance O
-
-	inputFields := reflect.VisibleFields(reflect.TypeOf(helperInputInstance))
-	outputFields := reflect.VisibleFields(reflect.TypeOf(helperOutputInstance))
-
-	// All fields shared between input and output types must be of the same type
-	for _, inputField := range inputFields {
-		for _, outputField := range outputFields {
-			if inputField.Name == outputField.Name && inputField.Type != outputField.Type {
-				panic("Field " + inputField.Name + " is not of the same type in the input and output types")
-			}
+// ServerOwnedFields are the fields of entities the server sets, which clients cannot write.
+var ServerOwnedFields = []string{"ID", "CreatedAt", "UpdatedAt", "DeletedAt"}
+
+// NewReverseMapper returns a mapper from the DTOs clients send to the entities they describe, which
+// leaves out the ServerOwnedFields and the excludedFields. Server owned fields that are missing
+// from either type are ignored.
+func NewReverseMapper[D, E interface{}](excludedFields ...string) Mapper[D, E] {
+	excluded := slices.Clone(excludedFields)
+	dtoFields := getFieldNames(visibleFields[D]())
+	entityFields := getFieldNames(visibleFields[E]())
+	for _, field := range ServerOwnedFields {
+		if slices.Contains(dtoFields, field) && slices.Contains(entityFields, field) && !slices.Contains(excluded, field) {
+			excluded = append(excluded, field)
 		}
 	}
+	return NewGenericMapperExcluding[D, E](excluded)
+}
 
-	return &GenericMapperImpl[I, O]{
-		excludedFields: []string{},
-		includedFields: []string{},
-	}
+func NewGenericMapperDefault[I, O interface{}]() Mapper[I, O] {
+	// Every field shared between the input and output types must be mappable
+	return newGenericMapper[I, O]([]string{}, []string{})
 }
 
+// Map maps input to a new output. Pointer outputs are allocated, and fields of embedded structs
+// are copied one by one through their promoted fields, so excluding a promoted field such as ID
+// leaves it unset. Map panics on a nil input.
 func (m GenericMapperImpl[I, O]) Map(input I) O {
+	plan := m.plan
+	if plan == nil {
+		plan = m.compile()
+	}
+
 	var output O
 	inputInstance := reflect.ValueOf(input)
+	for inputInstance.Kind() == reflect.Pointer {
+		if inputInstance.IsNil() {
+			panic("cannot map a nil input")
+		}
+		inputInstance = inputInstance.Elem()
+	}
 	outputInstance := reflect.ValueOf(&output).Elem()
+	if outputInstance.Kind() == reflect.Pointer {
+		outputInstance.Set(reflect.New(outputInstance.Type().Elem()))
+		outputInstance = outputInstance.Elem()
+	}
+
+	plan.apply(inputInstance, outputInstance)
+	return output
+}
 
-	inputFields := reflect.VisibleFields(inputInstance.Type())
-	outputFields := reflect.VisibleFields(outputInstance.Type())
+// MapsField reports whether Map maps the input field with the Go name to the output.
+func (m GenericMapperImpl[I, O]) MapsField(name string) bool {
+	plan := m.plan
+	if plan == nil {
+		plan = m.compile()
+	}
+	return plan.reads(name)
+}
 
-	outputFieldsNames := getFieldNames(outputFields)
+// hasField reports whether the struct type t, or the struct it points to, has a visible field name.
+func hasField(t reflect.Type, name string) bool {
+	if t = structType(t); t == nil {
+		return false
+	}
+	_, ok := t.FieldByName(name)
+	return ok
+}
 
-	for i, inputField := range inputFields {
-		// If there are excluded fields and the current field is in the excluded fields, skip it
-		if m.excludedFields != nil && len(m.excludedFields) > 0 && slices.Contains(m.excludedFields, inputField.Name) {
-			continue
-		}
-		// If there are included fields and the current field is not in the included fields, skip it
-		if m.includedFields != nil && len(m.includedFields) > 0 && !slices.Contains(m.includedFields, inputField.Name) {
-			continue
-		}
-		// If the current field is not in the output fields, skip it
-		if !slices.Contains(outputFieldsNames, inputField.Name) {
-			continue
-		}
-		// Copy the field from the input object to the output object
-		outputField := outputInstance.FieldByName(inputField.Name)
-		outputField.Set(inputInstance.Field(i))
+// structType returns t, or the type it points to, when it is a struct, and nil otherwise.
+func structType(t reflect.Type) reflect.Type {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
 	}
+	return t
+}
 
-	return output
+// visibleFields returns the visible fields of T, or of the struct T points to, so mappers can
+// be built for pointers to entities. Types that are not structs have no fields.
+func visibleFields[T interface{}]() []reflect.StructField {
+	t := structType(reflect.TypeOf((*T)(nil)).Elem())
+	if t == nil {
+		return nil
+	}
+	return reflect.VisibleFields(t)
 }
 
 func getFieldNames(fields []reflect.StructField) []string {
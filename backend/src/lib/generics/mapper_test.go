@@ -1,6 +1,11 @@
 package generics
 
-import "testing"
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
 
 type Input struct {
 	Name  string
@@ -192,3 +197,233 @@ func TestNilInput(t *testing.T) {
 	mapper := NewGenericMapperDefault[*Input, Output]()
 	_ = mapper.Map(input)
 }
+
+func TestMapsField(t *testing.T) {
+	mapper := NewGenericMapperExcluding[Input, Output]([]string{"Age"}).(FieldMapper)
+
+	for field, expected := range map[string]bool{"Name": true, "Age": false, "Email": false, "Unknown": false} {
+		if mapper.MapsField(field) != expected {
+			t.Errorf("Expected MapsField(%s) to be %t", field, expected)
+		}
+	}
+
+	included := NewGenericMapperIncluding[Input, Output]([]string{"Age"}).(FieldMapper)
+	if included.MapsField("Name") || !included.MapsField("Age") {
+		t.Errorf("Expected only the included field to be mapped")
+	}
+}
+
+type Base struct {
+	ID        int
+	CreatedAt string
+}
+
+type Account struct {
+	Base
+	Username string
+	Password string
+}
+
+func TestMapPointers(t *testing.T) {
+	mapper := NewGenericMapperExcluding[*Account, *Account]([]string{"Password"})
+
+	input := &Account{Base: Base{ID: 1, CreatedAt: "today"}, Username: "alice", Password: "secret"}
+	output := mapper.Map(input)
+
+	if output == nil || output == input {
+		t.Fatalf("Expected a new output, got %v", output)
+	}
+	if output.ID != 1 || output.CreatedAt != "today" || output.Username != "alice" || output.Password != "" {
+		t.Errorf("Expected the fields but Password to be copied, got %+v", output)
+	}
+}
+
+func TestReverseMapper(t *testing.T) {
+	mapper := NewReverseMapper[*Account, *Account]("Username")
+
+	input := &Account{Base: Base{ID: 1, CreatedAt: "today"}, Username: "alice", Password: "secret"}
+	output := mapper.Map(input)
+
+	if output.ID != 0 || output.CreatedAt != "" || output.Username != "" || output.Password != "secret" {
+		t.Errorf("Expected the server owned and excluded fields to be left out, got %+v", output)
+	}
+
+	// Server owned fields missing from the types are ignored.
+	_ = NewReverseMapper[Input, Output]()
+}
+
+type Permission struct {
+	Entity    string
+	Operation string
+}
+
+type Role struct {
+	Name        string
+	Permissions []*Permission
+	Users       []*User
+}
+
+type User struct {
+	Account
+	Roles      []*Role
+	Tags       map[string]*Permission
+	LastLogin  time.Time
+	Manager    *User
+	Registered *time.Time
+}
+
+type PermissionDTO struct {
+	Entity    string
+	Operation string
+}
+
+type RoleDTO struct {
+	Title       string `map:"name=name"`
+	Permissions []PermissionDTO
+	Users       []UserDTO
+}
+
+type UserDTO struct {
+	ID         int
+	Username   string
+	Password   string    `map:"-"`
+	Groups     []RoleDTO `map:"name=roles"`
+	Tags       map[string]PermissionDTO
+	LastLogin  string
+	Manager    *UserDTO
+	Registered string
+}
+
+type RoleSummary struct {
+	Name  string
+	Count int
+}
+
+type UserSummary struct {
+	Username string
+	Roles    []*RoleSummary `map:"using=RoleSummaryMapper"`
+}
+
+func TestMapNested(t *testing.T) {
+	mapper := NewGenericMapperDefault[*User, UserDTO]()
+
+	login := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	admin := &Role{Name: "admin", Permissions: []*Permission{{Entity: "User", Operation: "READ"}, nil}}
+	input := &User{
+		Account:   Account{Base: Base{ID: 1}, Username: "alice", Password: "secret"},
+		Roles:     []*Role{admin},
+		Tags:      map[string]*Permission{"main": {Entity: "Role", Operation: "UPDATE"}},
+		LastLogin: login,
+		Manager:   &User{Account: Account{Username: "bob"}},
+	}
+	admin.Users = []*User{{Account: Account{Username: "carol"}}}
+	output := mapper.Map(input)
+
+	if output.ID != 1 || output.Username != "alice" || output.Password != "" {
+		t.Errorf("Expected the promoted fields but Password to be mapped, got %+v", output)
+	}
+	if len(output.Groups) != 1 || output.Groups[0].Title != "admin" {
+		t.Fatalf("Expected roles to be mapped to renamed groups, got %+v", output.Groups)
+	}
+	expected := []PermissionDTO{{Entity: "User", Operation: "READ"}, {}}
+	if !reflect.DeepEqual(output.Groups[0].Permissions, expected) {
+		t.Errorf("Expected permissions %+v, got %+v", expected, output.Groups[0].Permissions)
+	}
+	if len(output.Groups[0].Users) != 1 || output.Groups[0].Users[0].Username != "carol" {
+		t.Errorf("Expected the users of the roles to be mapped, got %+v", output.Groups[0].Users)
+	}
+	if output.Tags["main"] != (PermissionDTO{Entity: "Role", Operation: "UPDATE"}) {
+		t.Errorf("Expected the map values to be mapped, got %+v", output.Tags)
+	}
+	if output.LastLogin != "2024-05-01T12:00:00Z" || output.Registered != "" {
+		t.Errorf("Expected times to be converted to strings, got %q and %q", output.LastLogin, output.Registered)
+	}
+	if output.Manager == nil || output.Manager.Username != "bob" || output.Manager.Manager != nil {
+		t.Errorf("Expected the manager to be mapped, got %+v", output.Manager)
+	}
+}
+
+func TestMapUsingRegisteredMapper(t *testing.T) {
+	RegisterMapper("RoleSummaryMapper", MapperFunc[*Role, *RoleSummary](func(role *Role) *RoleSummary {
+		return &RoleSummary{Name: role.Name, Count: len(role.Permissions)}
+	}))
+	mapper := NewGenericMapperDefault[User, UserSummary]()
+
+	input := User{Account: Account{Username: "alice"}, Roles: []*Role{{Name: "admin", Permissions: []*Permission{{}, {}}}, nil}}
+	output := mapper.Map(input)
+
+	if output.Username != "alice" || len(output.Roles) != 2 || *output.Roles[0] != (RoleSummary{Name: "admin", Count: 2}) || output.Roles[1] != nil {
+		t.Errorf("Expected the roles to be mapped by the registered mapper, got %+v", output)
+	}
+}
+
+type Celsius float64
+
+type Reading struct {
+	Temperature Celsius
+	Kind        string
+}
+
+type ReadingDTO struct {
+	Temperature string
+	Kind        []byte `map:"-"`
+}
+
+func TestMapConverters(t *testing.T) {
+	RegisterConverter(func(c Celsius) string { return fmt.Sprintf("%.1f°C", float64(c)) })
+	mapper := NewGenericMapperDefault[Reading, ReadingDTO]()
+
+	if output := mapper.Map(Reading{Temperature: 21.5}); output.Temperature != "21.5°C" {
+		t.Errorf("Expected the registered converter to be used, got %q", output.Temperature)
+	}
+}
+
+func TestMapInvalidTags(t *testing.T) {
+	type unknownSource struct {
+		Name string `map:"name=missing"`
+	}
+	type unknownMapper struct {
+		Name string `map:"using=MissingMapper"`
+	}
+	type unknownOption struct {
+		Name string `map:"rename=x"`
+	}
+	type incompatible struct {
+		Age string
+	}
+
+	for name, build := range map[string]func(){
+		"unknown source": func() { NewGenericMapperDefault[Input, unknownSource]() },
+		"unknown mapper": func() { NewGenericMapperDefault[Input, unknownMapper]() },
+		"unknown option": func() { NewGenericMapperDefault[Input, unknownOption]() },
+		"incompatible":   func() { NewGenericMapperDefault[Input, incompatible]() },
+	} {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("Expected a panic for %s, but code did not panic", name)
+				}
+			}()
+			build()
+		}()
+	}
+}
+
+func BenchmarkMapPage(b *testing.B) {
+	mapper := NewGenericMapperDefault[*User, *UserDTO]()
+	page := make([]*User, 500)
+	for i := range page {
+		page[i] = &User{
+			Account:   Account{Base: Base{ID: i}, Username: "user", Password: "secret"},
+			Roles:     []*Role{{Name: "admin", Permissions: []*Permission{{Entity: "User", Operation: "READ"}}}},
+			LastLogin: time.Now(),
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, user := range page {
+			mapper.Map(user)
+		}
+	}
+}
@@ -0,0 +1,690 @@
+// Package mappergen generates mappers that copy the fields of one struct type to another without
+// reflection. A generated mapper copies the same fields a generics.GenericMapperImpl built with
+// the same included and excluded fields copies, honoring the map tags of the output fields, but
+// the copies are plain assignments checked by the compiler.
+//
+// Generated mappers only copy fields of the same type: fields that would need converting, and
+// fields mapped with a registered mapper, are reported as errors. Relations, fields holding structs
+// declared in the packages of the input or output types, directly, behind a pointer or in a slice,
+// are never copied as is, as they may hold fields the mapper must not copy: they are mapped with
+// the mapper of their own type named in Config.Nested, and reported as errors without one.
+package mappergen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/cmo7/folly4/src/lib/generics"
+)
+
+var (
+	// ErrInvalidType is returned for type specs that are malformed or name no struct type.
+	ErrInvalidType = errors.New("invalid type")
+	// ErrUnmappable is returned when the fields of the types cannot be copied by a generated mapper.
+	ErrUnmappable = errors.New("unmappable field")
+)
+
+// Type is a struct type declared in the package in Dir, or a pointer to it.
+type Type struct {
+	Dir     string
+	Name    string
+	Pointer bool
+}
+
+// ParseType parses a type spec, the directory of a package and the name of a type declared
+// in it, optionally behind a pointer: "*./src/app/models.UserEntity".
+func ParseType(spec string) (Type, error) {
+	t := Type{}
+	if strings.HasPrefix(spec, "*") {
+		t.Pointer = true
+		spec = spec[1:]
+	}
+	dot := strings.LastIndex(spec, ".")
+	if dot <= 0 || dot == len(spec)-1 || strings.ContainsAny(spec[dot+1:], `/\`) {
+		return t, fmt.Errorf("%w: %q is not <package dir>.<type>", ErrInvalidType, spec)
+	}
+	t.Dir, t.Name = spec[:dot], spec[dot+1:]
+	return t, nil
+}
+
+// Config describes a mapper to generate.
+type Config struct {
+	Input    Type
+	Output   Type
+	Name     string   // Name of the mapper type. Defaults to <input>Mapper, or <input>To<output>Mapper for different types.
+	Package  string   // Package of the generated file.
+	Dir      string   // Directory of the generated file, to import the packages of the types from.
+	Excluded []string // Input fields not copied.
+	Included []string // Input fields copied, when not empty.
+	// Nested names the mappers of the relations of the input, by input field. The mappers are
+	// generics.FieldMappers of the generated file's package, like generated mappers, that map the
+	// values of the relation to values of the same type.
+	Nested map[string]string
+}
+
+// Generate returns the formatted source of the mapper described by c.
+func Generate(c Config) ([]byte, error) {
+	if !token.IsIdentifier(c.Package) {
+		return nil, fmt.Errorf("invalid package name %q", c.Package)
+	}
+	if c.Name == "" {
+		c.Name = c.Input.Name + "Mapper"
+		if c.Input.Name != c.Output.Name {
+			c.Name = c.Input.Name + "To" + c.Output.Name + "Mapper"
+		}
+	}
+
+	imports := newImports(c.Dir)
+	input, err := loadStruct(c.Input, imports)
+	if err != nil {
+		return nil, err
+	}
+	output, err := loadStruct(c.Output, imports)
+	if err != nil {
+		return nil, err
+	}
+
+	copies, err := plan(input, output)
+	if err != nil {
+		return nil, err
+	}
+	copies, err = restrict(copies, input, c.Excluded, c.Included)
+	if err != nil {
+		return nil, err
+	}
+	copies, err = nest(copies, c.Nested)
+	if err != nil {
+		return nil, err
+	}
+
+	data := templateData{
+		Package:  c.Package,
+		Name:     c.Name,
+		Input:    input.qualified(c.Input.Pointer),
+		Output:   output.qualified(c.Output.Pointer),
+		Generics: imports.add("github.com/cmo7/folly4/src/lib/generics"),
+		Copies:   copies,
+	}
+	for _, copy := range copies {
+		if copy.Mapper != "" {
+			data.Relations = append(data.Relations, copy)
+		}
+	}
+	if c.Output.Pointer {
+		data.NewOutput = "&" + output.qualified(false) + "{}"
+	}
+	data.Imports = imports.list()
+
+	var buf bytes.Buffer
+	if err := mapperTemplate.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+// fieldCopy is a field of the output assigned from a field of the input.
+type fieldCopy struct {
+	Input  string
+	Output string
+	// Relation is how a relation field holds its structs, empty for other fields.
+	Relation relationKind
+	Mapper   string // Mapper of the structs of a relation.
+}
+
+// relationKind is how a relation field holds its structs.
+type relationKind string
+
+const (
+	relationStruct   relationKind = "struct"   // T
+	relationPointer  relationKind = "pointer"  // *T
+	relationSlice    relationKind = "slice"    // []T
+	relationPointers relationKind = "pointers" // []*T
+)
+
+// plan matches the fields of output with the fields of input the way generics.GenericMapperImpl
+// does: by name, or by the name given in the map tag of the output field.
+func plan(input *structInfo, output *structInfo) ([]fieldCopy, error) {
+	copies := []fieldCopy{}
+	for _, outputField := range output.fields {
+		tag, err := generics.ParseMapTag(outputField.tag.Get("map"))
+		if err != nil {
+			return nil, fmt.Errorf("field %s of %s: %w", outputField.name, output.name, err)
+		}
+		if tag.Skip {
+			continue
+		}
+		if tag.Using != "" {
+			return nil, fmt.Errorf("%w: field %s of %s is mapped with %s, which generated mappers cannot call", ErrUnmappable, outputField.name, output.name, tag.Using)
+		}
+		source := outputField.name
+		if tag.Name != "" {
+			source = tag.Name
+		}
+		inputField, ok := input.field(source, tag.Name != "")
+		if !ok {
+			if tag.Name != "" {
+				return nil, fmt.Errorf("%w: field %s of %s: %s has no field %s", ErrUnmappable, outputField.name, output.name, input.name, tag.Name)
+			}
+			continue
+		}
+		if inputField.typ != outputField.typ {
+			return nil, fmt.Errorf("%w: field %s is %s in %s and %s in %s", ErrUnmappable, outputField.name, inputField.typ, input.name, outputField.typ, output.name)
+		}
+		relation, err := relationOf(inputField.typ, input, output)
+		if err != nil {
+			return nil, fmt.Errorf("field %s of %s: %w", outputField.name, output.name, err)
+		}
+		copies = append(copies, fieldCopy{Input: inputField.name, Output: outputField.name, Relation: relation})
+	}
+	return copies, nil
+}
+
+// relationOf returns how a field of type typ holds structs declared in the packages of input or
+// output, or "" when it holds none.
+func relationOf(typ string, input *structInfo, output *structInfo) (relationKind, error) {
+	isStruct := func(t string) bool { return input.structs[t] || output.structs[t] }
+	switch {
+	case isStruct(typ):
+		return relationStruct, nil
+	case strings.HasPrefix(typ, "*") && isStruct(typ[1:]):
+		return relationPointer, nil
+	case strings.HasPrefix(typ, "[]") && isStruct(typ[2:]):
+		return relationSlice, nil
+	case strings.HasPrefix(typ, "[]*") && isStruct(typ[3:]):
+		return relationPointers, nil
+	}
+	for _, info := range []*structInfo{input, output} {
+		for name := range info.structs {
+			if mentions(typ, name) {
+				return "", fmt.Errorf("%w: %s holds %s, which only structs, pointers and slices can hold", ErrUnmappable, typ, name)
+			}
+		}
+	}
+	return "", nil
+}
+
+// mentions reports whether the type typ is written with the type name.
+func mentions(typ string, name string) bool {
+	for rest := typ; ; {
+		i := strings.Index(rest, name)
+		if i < 0 {
+			return false
+		}
+		rest = rest[i+len(name):]
+		if rest == "" || !(unicode.IsLetter(rune(rest[0])) || unicode.IsDigit(rune(rest[0])) || rest[0] == '_') {
+			return true
+		}
+	}
+}
+
+// restrict keeps the copies of the input fields that are not excluded and, when there are included
+// fields, are included. Like generics.NewGenericMapperExcluding and NewGenericMapperIncluding, the
+// fields named must be input fields that are copied.
+func restrict(copies []fieldCopy, input *structInfo, excluded []string, included []string) ([]fieldCopy, error) {
+	check := func(kind string, names []string) error {
+		for _, name := range names {
+			if _, ok := input.field(name, false); !ok {
+				return fmt.Errorf("%s field %s is not a property of the input type", kind, name)
+			}
+			if !slices.ContainsFunc(copies, func(c fieldCopy) bool { return c.Input == name }) {
+				return fmt.Errorf("%s field %s is not a property of the output type", kind, name)
+			}
+		}
+		return nil
+	}
+	if err := check("Excluded", excluded); err != nil {
+		return nil, err
+	}
+	if err := check("Included", included); err != nil {
+		return nil, err
+	}
+
+	kept := []fieldCopy{}
+	for _, c := range copies {
+		if slices.Contains(excluded, c.Input) || (len(included) > 0 && !slices.Contains(included, c.Input)) {
+			continue
+		}
+		kept = append(kept, c)
+	}
+	return kept, nil
+}
+
+// nest sets the mappers of the relations copied, from the mappers named by input field. Every
+// relation needs one, and mappers can only be named for the relations copied.
+func nest(copies []fieldCopy, nested map[string]string) ([]fieldCopy, error) {
+	for name, mapper := range nested {
+		if !token.IsIdentifier(mapper) {
+			return nil, fmt.Errorf("invalid nested mapper name %q for field %s", mapper, name)
+		}
+		if !slices.ContainsFunc(copies, func(c fieldCopy) bool { return c.Input == name && c.Relation != "" }) {
+			return nil, fmt.Errorf("nested field %s is not a relation the mapper copies", name)
+		}
+	}
+	for i, c := range copies {
+		if c.Relation == "" {
+			continue
+		}
+		mapper, ok := nested[c.Input]
+		if !ok {
+			return nil, fmt.Errorf("%w: field %s is a relation, name its mapper or exclude it", ErrUnmappable, c.Input)
+		}
+		copies[i].Mapper = mapper
+	}
+	return copies, nil
+}
+
+// structInfo is a struct type read from source, with its promoted fields.
+type structInfo struct {
+	name      string // Name of the type, for errors.
+	qualifier string // Package name the generated file refers to the type with, if any.
+	typeName  string
+	fields    []fieldInfo
+	structs   map[string]bool // Struct types of its package, as fieldInfo.typ writes them.
+}
+
+func (s *structInfo) qualified(pointer bool) string {
+	name := s.typeName
+	if s.qualifier != "" {
+		name = s.qualifier + "." + name
+	}
+	if pointer {
+		name = "*" + name
+	}
+	return name
+}
+
+// field returns the field called name. Names given in map tags may differ in case.
+func (s *structInfo) field(name string, foldCase bool) (fieldInfo, bool) {
+	for _, f := range s.fields {
+		if f.name == name {
+			return f, true
+		}
+	}
+	if foldCase {
+		for _, f := range s.fields {
+			if strings.EqualFold(f.name, name) {
+				return f, true
+			}
+		}
+	}
+	return fieldInfo{}, false
+}
+
+// fieldInfo is an exported field of a struct, with its type written with import paths, so
+// types of different packages can be compared.
+type fieldInfo struct {
+	name  string
+	typ   string
+	tag   reflect.StructTag
+	depth int
+}
+
+// sourcePackage is a parsed package.
+type sourcePackage struct {
+	name       string
+	importPath string
+	types      map[string]*ast.TypeSpec
+	imports    map[*ast.TypeSpec]map[string]string // Import paths by name, for the file of each type.
+}
+
+// loadStruct reads the struct type t and the fields it promotes from embedded structs declared
+// in the same package.
+func loadStruct(t Type, imports *importSet) (*structInfo, error) {
+	pkg, err := loadPackage(t.Dir)
+	if err != nil {
+		return nil, err
+	}
+	info := &structInfo{name: pkg.name + "." + t.Name, typeName: t.Name}
+	fields, err := pkg.structFields(t.Name, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	info.fields = visible(fields)
+	info.qualifier = imports.add(pkg.importPath)
+	info.structs = map[string]bool{}
+	for name, spec := range pkg.types {
+		if _, ok := spec.Type.(*ast.StructType); ok {
+			info.structs[pkg.importPath+"."+name] = true
+		}
+	}
+	return info, nil
+}
+
+// loadPackage parses the Go files of the package in dir, but its tests.
+func loadPackage(dir string) (*sourcePackage, error) {
+	importPath, err := importPathOf(dir)
+	if err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	pkg := &sourcePackage{
+		importPath: importPath,
+		types:      map[string]*ast.TypeSpec{},
+		imports:    map[*ast.TypeSpec]map[string]string{},
+	}
+	fset := token.NewFileSet()
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, file, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		pkg.name = f.Name.Name
+		fileImports := map[string]string{}
+		for _, spec := range f.Imports {
+			importPath, _ := strconv.Unquote(spec.Path.Value)
+			name := path.Base(importPath)
+			if spec.Name != nil {
+				name = spec.Name.Name
+			}
+			fileImports[name] = importPath
+		}
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				typeSpec := spec.(*ast.TypeSpec)
+				pkg.types[typeSpec.Name.Name] = typeSpec
+				pkg.imports[typeSpec] = fileImports
+			}
+		}
+	}
+	if pkg.name == "" {
+		return nil, fmt.Errorf("%w: no Go files in %s", ErrInvalidType, dir)
+	}
+	return pkg, nil
+}
+
+// structFields returns the exported fields of the struct type name and of the structs it embeds,
+// at their depth of embedding. seen guards against embedding cycles.
+func (p *sourcePackage) structFields(name string, depth int, seen []string) ([]fieldInfo, error) {
+	spec, ok := p.types[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s.%s is not declared", ErrInvalidType, p.name, name)
+	}
+	st, ok := spec.Type.(*ast.StructType)
+	if !ok || spec.TypeParams != nil {
+		return nil, fmt.Errorf("%w: %s.%s is not a struct type", ErrInvalidType, p.name, name)
+	}
+	if slices.Contains(seen, name) {
+		return nil, fmt.Errorf("%w: %s.%s embeds itself", ErrInvalidType, p.name, name)
+	}
+	seen = append(seen, name)
+
+	fields := []fieldInfo{}
+	for _, field := range st.Fields.List {
+		var tag reflect.StructTag
+		if field.Tag != nil {
+			value, _ := strconv.Unquote(field.Tag.Value)
+			tag = reflect.StructTag(value)
+		}
+		typ, err := p.typeString(spec, field.Type)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(field.Names) == 0 {
+			embedded, ok := field.Type.(*ast.Ident)
+			if !ok {
+				return nil, fmt.Errorf("%w: %s.%s embeds %s, but only structs of the same package can be embedded", ErrUnmappable, p.name, name, typ)
+			}
+			if embeddedSpec, ok := p.types[embedded.Name]; ok {
+				if _, ok := embeddedSpec.Type.(*ast.StructType); ok {
+					promoted, err := p.structFields(embedded.Name, depth+1, seen)
+					if err != nil {
+						return nil, err
+					}
+					fields = append(fields, promoted...)
+					continue
+				}
+			}
+			if ast.IsExported(embedded.Name) {
+				fields = append(fields, fieldInfo{name: embedded.Name, typ: typ, tag: tag, depth: depth})
+			}
+			continue
+		}
+		for _, fieldName := range field.Names {
+			if fieldName.IsExported() {
+				fields = append(fields, fieldInfo{name: fieldName.Name, typ: typ, tag: tag, depth: depth})
+			}
+		}
+	}
+	return fields, nil
+}
+
+// visible returns the fields that can be selected by name: the shallowest of the fields with
+// the same name, unless several are equally shallow, following the rules of Go.
+func visible(fields []fieldInfo) []fieldInfo {
+	result := []fieldInfo{}
+	for i, f := range fields {
+		shadowed := false
+		for j, other := range fields {
+			if other.name == f.name && (other.depth < f.depth || (other.depth == f.depth && i != j)) {
+				shadowed = true
+				break
+			}
+		}
+		if !shadowed {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+// typeString writes the type expression of a field of the type spec, qualifying the types by the
+// import path of their package.
+func (p *sourcePackage) typeString(spec *ast.TypeSpec, expr ast.Expr) (string, error) {
+	var buf bytes.Buffer
+	var err error
+	var write func(ast.Expr)
+	write = func(expr ast.Expr) {
+		switch e := expr.(type) {
+		case *ast.Ident:
+			if _, ok := p.types[e.Name]; ok {
+				buf.WriteString(p.importPath + ".")
+			}
+			buf.WriteString(e.Name)
+		case *ast.SelectorExpr:
+			pkg, _ := e.X.(*ast.Ident)
+			if pkg == nil || p.imports[spec][pkg.Name] == "" {
+				err = fmt.Errorf("%w: cannot resolve the type of a field of %s.%s", ErrInvalidType, p.name, spec.Name.Name)
+				return
+			}
+			buf.WriteString(p.imports[spec][pkg.Name] + "." + e.Sel.Name)
+		case *ast.StarExpr:
+			buf.WriteString("*")
+			write(e.X)
+		case *ast.ArrayType:
+			buf.WriteString("[")
+			if e.Len != nil {
+				write(e.Len)
+			}
+			buf.WriteString("]")
+			write(e.Elt)
+		case *ast.MapType:
+			buf.WriteString("map[")
+			write(e.Key)
+			buf.WriteString("]")
+			write(e.Value)
+		case *ast.BasicLit:
+			buf.WriteString(e.Value)
+		default:
+			// Function, channel, interface and inline struct types are compared as written.
+			var src bytes.Buffer
+			format.Node(&src, token.NewFileSet(), e)
+			buf.Write(src.Bytes())
+		}
+	}
+	write(expr)
+	return buf.String(), err
+}
+
+// importPathOf returns the import path of the package in dir, found from the go.mod file of
+// its module.
+func importPathOf(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for root := abs; ; root = filepath.Dir(root) {
+		content, err := os.ReadFile(filepath.Join(root, "go.mod"))
+		if err == nil {
+			for _, line := range strings.Split(string(content), "\n") {
+				if module, ok := strings.CutPrefix(strings.TrimSpace(line), "module "); ok {
+					rel, err := filepath.Rel(root, abs)
+					if err != nil {
+						return "", err
+					}
+					return path.Join(strings.Trim(strings.TrimSpace(module), `"`), filepath.ToSlash(rel)), nil
+				}
+			}
+			return "", fmt.Errorf("%s has no module line", filepath.Join(root, "go.mod"))
+		}
+		if filepath.Dir(root) == root {
+			return "", fmt.Errorf("%s is not in a Go module", dir)
+		}
+	}
+}
+
+// importSet collects the imports of the generated file.
+type importSet struct {
+	self  string // Import path of the generated file's package.
+	paths []string
+}
+
+func newImports(dir string) *importSet {
+	self, _ := importPathOf(dir)
+	return &importSet{self: self}
+}
+
+// add imports a package and returns the name the generated file refers to it with, which is
+// empty for the package of the generated file.
+func (s *importSet) add(importPath string) string {
+	if importPath == s.self {
+		return ""
+	}
+	if !slices.Contains(s.paths, importPath) {
+		s.paths = append(s.paths, importPath)
+	}
+	return path.Base(importPath)
+}
+
+func (s *importSet) list() []string {
+	paths := slices.Clone(s.paths)
+	slices.Sort(paths)
+	return paths
+}
+
+type templateData struct {
+	Package   string
+	Name      string
+	Input     string
+	Output    string
+	NewOutput string // Expression allocating a pointer output, empty for struct outputs.
+	Generics  string
+	Imports   []string
+	Copies    []fieldCopy
+	Relations []fieldCopy // Copies of relations, mapped with their mappers.
+}
+
+var mapperTemplate = template.Must(template.New("mapper").Parse(`// Code generated by folly generate mapper. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- range .Imports}}
+	"{{.}}"
+{{- end}}
+)
+
+// {{.Name}} maps {{.Input}} to {{.Output}} without reflection.
+type {{.Name}} struct{}
+
+var (
+	_ {{with .Generics}}{{.}}.{{end}}Mapper[{{.Input}}, {{.Output}}] = {{.Name}}{}
+	_ {{with .Generics}}{{.}}.{{end}}RelationMapper = {{.Name}}{}
+)
+
+// Map copies the fields of input to a new output.
+func ({{.Name}}) Map(input {{.Input}}) {{.Output}} {
+{{- if .NewOutput}}
+	output := {{.NewOutput}}
+{{- else}}
+	var output {{.Output}}
+{{- end}}
+{{- range .Copies}}
+{{- if eq .Relation "struct"}}
+	output.{{.Output}} = {{.Mapper}}{}.Map(input.{{.Input}})
+{{- else if eq .Relation "pointer"}}
+	if input.{{.Input}} != nil {
+		output.{{.Output}} = {{.Mapper}}{}.Map(input.{{.Input}})
+	}
+{{- else if eq .Relation "slice"}}
+	if input.{{.Input}} != nil {
+		output.{{.Output}} = input.{{.Input}}[:0:0]
+		for _, value := range input.{{.Input}} {
+			output.{{.Output}} = append(output.{{.Output}}, {{.Mapper}}{}.Map(value))
+		}
+	}
+{{- else if eq .Relation "pointers"}}
+	if input.{{.Input}} != nil {
+		output.{{.Output}} = input.{{.Input}}[:0:0]
+		for _, value := range input.{{.Input}} {
+			if value != nil {
+				value = {{.Mapper}}{}.Map(value)
+			}
+			output.{{.Output}} = append(output.{{.Output}}, value)
+		}
+	}
+{{- else}}
+	output.{{.Output}} = input.{{.Input}}
+{{- end}}
+{{- end}}
+	return output
+}
+
+// MapsField reports whether Map maps the input field with the Go name to the output.
+func ({{.Name}}) MapsField(name string) bool {
+{{- if .Copies}}
+	switch name {
+	case {{range $i, $c := .Copies}}{{if $i}}, {{end}}"{{$c.Input}}"{{end}}:
+		return true
+	}
+{{- end}}
+	return false
+}
+
+// MapperOf returns the mapper of the input relation with the Go name, or nil when it has none.
+func ({{.Name}}) MapperOf(name string) {{with .Generics}}{{.}}.{{end}}FieldMapper {
+{{- if .Relations}}
+	switch name {
+{{- range .Relations}}
+	case "{{.Input}}":
+		return {{.Mapper}}{}
+{{- end}}
+	}
+{{- end}}
+	return nil
+}
+`))
@@ -0,0 +1,114 @@
+package mappergen
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func mustParseType(t *testing.T, spec string) Type {
+	typ, err := ParseType(spec)
+	if err != nil {
+		t.Fatalf("ParseType(%q) returned an error: %v", spec, err)
+	}
+	return typ
+}
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		golden string
+		config Config
+	}{
+		{"user_excluding.golden", Config{
+			Input:    mustParseType(t, "*testdata/models.User"),
+			Output:   mustParseType(t, "*testdata/models.User"),
+			Package:  "models",
+			Dir:      "testdata/models",
+			Excluded: []string{"Password"},
+			Nested:   map[string]string{"Roles": "RoleMapper"},
+		}},
+		{"user_including.golden", Config{
+			Input:    mustParseType(t, "testdata/models.User"),
+			Output:   mustParseType(t, "testdata/models.User"),
+			Name:     "UserSummaryMapper",
+			Package:  "mappers",
+			Dir:      "testdata/mappers",
+			Included: []string{"ID", "Username"},
+		}},
+		{"user_dto.golden", Config{
+			Input:   mustParseType(t, "*testdata/models.User"),
+			Output:  mustParseType(t, "testdata/dto.UserDTO"),
+			Package: "dto",
+			Dir:     "testdata/dto",
+			Nested:  map[string]string{"Roles": "RoleMapper"},
+		}},
+		{"team_nested.golden", Config{
+			Input:   mustParseType(t, "*testdata/models.Team"),
+			Output:  mustParseType(t, "*testdata/models.Team"),
+			Package: "mappers",
+			Dir:     "testdata/mappers",
+			Nested:  map[string]string{"Lead": "UserMapper", "Members": "MemberMapper", "Office": "OfficeMapper"},
+		}},
+	}
+
+	for _, test := range tests {
+		source, err := Generate(test.config)
+		if err != nil {
+			t.Errorf("%s: Generate returned an error: %v", test.golden, err)
+			continue
+		}
+		golden := filepath.Join("testdata", test.golden)
+		if *update {
+			if err := os.WriteFile(golden, source, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		expected, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(source) != string(expected) {
+			t.Errorf("%s: generated source differs from the golden file:\n%s", test.golden, source)
+		}
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	user := mustParseType(t, "testdata/models.User")
+	tests := []struct {
+		name     string
+		config   Config
+		expected error
+	}{
+		{"unknown type", Config{Input: user, Output: mustParseType(t, "testdata/models.Group")}, ErrInvalidType},
+		{"mismatched types", Config{Input: user, Output: mustParseType(t, "testdata/dto.MismatchDTO")}, ErrUnmappable},
+		{"registered mapper", Config{Input: user, Output: mustParseType(t, "testdata/dto.UsingDTO")}, ErrUnmappable},
+		{"unknown excluded field", Config{Input: user, Output: user, Excluded: []string{"Unknown"}}, nil},
+		{"unmapped included field", Config{Input: user, Output: mustParseType(t, "testdata/dto.UserDTO"), Included: []string{"Password"}}, nil},
+		{"relation without mapper", Config{Input: user, Output: user}, ErrUnmappable},
+		{"map of relations", Config{Input: mustParseType(t, "testdata/models.Directory"), Output: mustParseType(t, "testdata/models.Directory")}, ErrUnmappable},
+		{"nested field not a relation", Config{Input: user, Output: user, Nested: map[string]string{"Roles": "RoleMapper", "Email": "EmailMapper"}}, nil},
+		{"nested field excluded", Config{Input: user, Output: user, Excluded: []string{"Roles"}, Nested: map[string]string{"Roles": "RoleMapper"}}, nil},
+		{"invalid nested mapper", Config{Input: user, Output: user, Nested: map[string]string{"Roles": "roles.Mapper"}}, nil},
+	}
+
+	for _, test := range tests {
+		test.config.Package = "mappers"
+		test.config.Dir = "testdata/mappers"
+		_, err := Generate(test.config)
+		if err == nil || (test.expected != nil && !errors.Is(err, test.expected)) {
+			t.Errorf("%s: Generate returned %v, want %v", test.name, err, test.expected)
+		}
+	}
+
+	for _, spec := range []string{"User", "testdata/models.", ".User", "testdata/models"} {
+		if _, err := ParseType(spec); !errors.Is(err, ErrInvalidType) {
+			t.Errorf("ParseType(%q) = %v, want %v", spec, err, ErrInvalidType)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package dto
+
+import (
+	"github.com/cmo7/folly4/src/lib/generics/mappergen/testdata/models"
+	"github.com/google/uuid"
+)
+
+type UserDTO struct {
+	ID       uuid.UUID
+	Login    string `map:"name=username"`
+	Password string `map:"-"`
+	Email    string
+	Roles    []*models.Role
+	Extra    string
+}
+
+type MismatchDTO struct {
+	Username []byte
+}
+
+type UsingDTO struct {
+	Roles []string `map:"using=RoleNameMapper"`
+}
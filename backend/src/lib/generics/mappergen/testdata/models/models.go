@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Base struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+}
+
+type User struct {
+	Base
+	Username string
+	Password string
+	Email    string
+	Roles    []*Role
+	secret   string
+}
+
+type Role struct {
+	Base
+	Name string
+}
+
+type Team struct {
+	Base
+	Name    string
+	Lead    *User
+	Members []User
+	Office  Office
+}
+
+type Office struct {
+	City string
+}
+
+type Directory struct {
+	Roles map[string]*Role
+}
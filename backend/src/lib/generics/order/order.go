@@ -1,6 +1,7 @@
 package order
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 )
@@ -12,6 +13,15 @@ const (
 	Desc OrderDirection = "desc"
 )
 
+var (
+	// ErrUnknownField is returned when an OrderBy references a field that the entity does not have.
+	ErrUnknownField = errors.New("unknown sort field")
+	// ErrNotSortable is returned when an OrderBy references a field tagged with `query:"-"` or `query:"nosort"`.
+	ErrNotSortable = errors.New("field is not sortable")
+	// ErrInvalidDirection is returned when a direction is neither asc nor desc.
+	ErrInvalidDirection = errors.New("invalid sort direction")
+)
+
 type OrderBy struct {
 	Field     string
 	Direction OrderDirection
@@ -51,7 +61,10 @@ func parseOrerBy(s string) (OrderBy, error) {
 		return OrderBy{}, fmt.Errorf("invalid order by format: %s", s)
 	}
 
-	direction := OrderDirection(parts[1])
+	direction := OrderDirection(strings.ToLower(parts[1]))
+	if direction != Asc && direction != Desc {
+		return OrderBy{}, fmt.Errorf("%w: %s", ErrInvalidDirection, parts[1])
+	}
 
 	return OrderBy{Field: parts[0], Direction: direction}, nil
 }
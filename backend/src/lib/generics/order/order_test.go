@@ -37,7 +37,9 @@ func TestParse(t *testing.T) {
 	}{
 		{"name:asc", []OrderBy{{Field: "name", Direction: Asc}}, false},
 		{"name:asc,age:desc", []OrderBy{{Field: "name", Direction: Asc}, {Field: "age", Direction: Desc}}, false},
+		{"name:DESC", []OrderBy{{Field: "name", Direction: Desc}}, false},
 		{"invalid", nil, true},
+		{"name:sideways", nil, true},
 	}
 
 	for _, test := range tests {
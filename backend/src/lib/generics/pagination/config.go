@@ -0,0 +1,77 @@
+package pagination
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+func init() {
+	// Default page sizes, for every entity unless configured under pagination.entities.<entity>, e.g.
+	//
+	//	[pagination.entities.audit]
+	//	default_size = 50
+	//	max_size = 500
+	viper.SetDefault("pagination.default_size", 10)
+	viper.SetDefault("pagination.max_size", 100)
+}
+
+// SizeLimits are the default and the largest page size of the listings of an entity.
+type SizeLimits struct {
+	Default int
+	Max     int
+}
+
+// LimitsFor returns the page size limits configured for an entity.
+func LimitsFor(entity string) SizeLimits {
+	key := "pagination.entities." + strings.ToLower(entity) + "."
+	limits := SizeLimits{
+		Default: viper.GetInt("pagination.default_size"),
+		Max:     viper.GetInt("pagination.max_size"),
+	}
+	if viper.IsSet(key + "default_size") {
+		limits.Default = viper.GetInt(key + "default_size")
+	}
+	if viper.IsSet(key + "max_size") {
+		limits.Max = viper.GetInt(key + "max_size")
+	}
+	if limits.Max < 1 {
+		limits.Max = 1
+	}
+	limits.Default = min(max(limits.Default, 1), limits.Max)
+	return limits
+}
+
+// Size returns the page size to use for a requested size: the default when none was requested
+// and never more than the maximum.
+func (l SizeLimits) Size(requested int) int {
+	if requested < 1 {
+		return l.Default
+	}
+	return min(requested, l.Max)
+}
+
+// ErrInvalidCountMode is returned for unknown count modes.
+var ErrInvalidCountMode = errors.New("invalid count mode")
+
+// CountMode tells how the rows of an offset paginated listing are counted.
+type CountMode string
+
+const (
+	CountExact    CountMode = "exact"    // Count the rows. The default.
+	CountEstimate CountMode = "estimate" // Estimate the rows from the statistics of the database, which is cheap but approximate.
+	CountNone     CountMode = "none"     // Do not count the rows.
+)
+
+// ParseCountMode parses a count mode. The empty string is the exact count.
+func ParseCountMode(s string) (CountMode, error) {
+	switch mode := CountMode(strings.ToLower(s)); mode {
+	case "":
+		return CountExact, nil
+	case CountExact, CountEstimate, CountNone:
+		return mode, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrInvalidCountMode, s)
+}
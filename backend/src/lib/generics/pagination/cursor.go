@@ -0,0 +1,58 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidCursor is returned for cursors that are malformed or were issued for another order.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is an opaque token that marks a position in a keyset paginated listing.
+// The empty cursor is the start of the listing.
+type Cursor string
+
+// CursorPosition is the content of a Cursor: the sort keys of the row it points at.
+// The last sort key is always the primary key, which makes every position unique.
+type CursorPosition struct {
+	Backward  bool              `json:"b,omitempty"` // Read the rows before the position instead of after it.
+	Inclusive bool              `json:"i,omitempty"` // Read the row at the position too.
+	Keys      []string          `json:"k"`           // The sort keys as "column:direction".
+	Values    []json.RawMessage `json:"v"`           // The values of the sort keys in the row.
+}
+
+// Encode returns the cursor that points at the position. Values are already encoded JSON, so only
+// invalid raw values fail.
+func (p CursorPosition) Encode() (Cursor, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return "", fmt.Errorf("pagination: encoding cursor: %w", err)
+	}
+	return Cursor(base64.RawURLEncoding.EncodeToString(data)), nil
+}
+
+// Decode returns the position the cursor points at.
+func (c Cursor) Decode() (CursorPosition, error) {
+	var p CursorPosition
+	data, err := base64.RawURLEncoding.DecodeString(string(c))
+	if err != nil {
+		return p, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &p); err != nil || len(p.Keys) == 0 || len(p.Keys) != len(p.Values) {
+		return CursorPosition{}, ErrInvalidCursor
+	}
+	return p, nil
+}
+
+// CursorPageable requests the page of Size rows that follows, or precedes for backward
+// cursors, the position of Cursor.
+type CursorPageable struct {
+	Cursor Cursor
+	Size   int
+}
+
+func NewCursorPageable(cursor Cursor, size int) CursorPageable {
+	return CursorPageable{Cursor: cursor, Size: size}
+}
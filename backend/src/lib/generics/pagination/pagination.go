@@ -1,22 +1,144 @@
 package pagination
 
+import "encoding/json"
+
+// Page is a page of a listing. Offset pages carry their page number and, unless counting was
+// skipped, the row counts; keyset pages carry the cursors of the neighbouring pages instead.
 type Page[T any] struct {
-	Content  []T   `json:"content"`
-	Page     int   `json:"page"`
-	Size     int   `json:"size"`
-	Total    int64 `json:"total"`
-	Filtered int64 `json:"filtered"`
+	Content    []T       `json:"content"`
+	Page       int       `json:"page"`
+	Size       int       `json:"size"`
+	Total      int64     `json:"total"`      // Rows of the listing without filter.
+	Filtered   int64     `json:"filtered"`   // Rows of the listing.
+	TotalPages int64     `json:"totalPages"` // Pages of the listing.
+	HasNext    bool      `json:"hasNext"`
+	HasPrev    bool      `json:"hasPrev"`
+	Count      CountMode `json:"count"`                // How the counts were obtained. CountNone leaves them unset.
+	NextCursor Cursor    `json:"nextCursor,omitempty"` // Empty on the last page.
+	PrevCursor Cursor    `json:"prevCursor,omitempty"` // Empty on the first page.
+
+	keyset bool
 }
 
+// NewPage returns an offset page with exact counts.
 func NewPage[T any](content []T, page int, size int, total int64, filtered int64) Page[T] {
-	return Page[T]{Content: content, Page: page, Size: size, Total: total, Filtered: filtered}
+	p := Page[T]{Content: content, Page: page, Size: size, Total: total, Filtered: filtered, Count: CountExact}
+	p.TotalPages = pages(filtered, size)
+	p.HasNext = int64(page) < p.TotalPages
+	p.HasPrev = page > 1
+	return p
+}
+
+// NewEstimatedPage returns an offset page with estimated counts. hasNext must be known exactly,
+// usually by reading one row more than the page holds, and corrects the estimates where they
+// contradict it.
+func NewEstimatedPage[T any](content []T, page int, size int, total int64, filtered int64, hasNext bool) Page[T] {
+	p := Page[T]{Content: content, Page: page, Size: size, Total: total, Filtered: filtered, Count: CountEstimate, HasNext: hasNext, HasPrev: page > 1}
+	read := int64(max(page-1, 0))*int64(size) + int64(len(content))
+	switch {
+	case !hasNext && len(content) > 0:
+		// The last page: the rows of the listing are known.
+		p.Filtered = read
+	case hasNext:
+		p.Filtered = max(filtered, read+1)
+	}
+	p.Total = max(p.Total, p.Filtered)
+	p.TotalPages = pages(p.Filtered, size)
+	return p
+}
+
+// NewUncountedPage returns an offset page whose rows were not counted.
+func NewUncountedPage[T any](content []T, page int, size int, hasNext bool) Page[T] {
+	return Page[T]{Content: content, Page: page, Size: size, Count: CountNone, HasNext: hasNext, HasPrev: page > 1}
+}
+
+// NewCursorPage returns a keyset page.
+func NewCursorPage[T any](content []T, size int, next Cursor, prev Cursor) Page[T] {
+	return Page[T]{Content: content, Size: size, NextCursor: next, PrevCursor: prev, HasNext: next != "", HasPrev: prev != "", keyset: true}
+}
+
+// pages returns the number of pages of size that hold rows.
+func pages(rows int64, size int) int64 {
+	if size < 1 {
+		return 0
+	}
+	return (rows + int64(size) - 1) / int64(size)
+}
+
+// Keyset reports whether the page was read with a cursor.
+func (p Page[T]) Keyset() bool {
+	return p.keyset
+}
+
+// MarshalJSON writes keyset pages without page number and counts, which they do not have,
+// and leaves the counts out of offset pages that were not counted.
+func (p Page[T]) MarshalJSON() ([]byte, error) {
+	if p.keyset {
+		return json.Marshal(struct {
+			Content    []T    `json:"content"`
+			Size       int    `json:"size"`
+			HasNext    bool   `json:"hasNext"`
+			HasPrev    bool   `json:"hasPrev"`
+			NextCursor Cursor `json:"nextCursor,omitempty"`
+			PrevCursor Cursor `json:"prevCursor,omitempty"`
+		}{p.Content, p.Size, p.HasNext, p.HasPrev, p.NextCursor, p.PrevCursor})
+	}
+
+	var total, filtered, totalPages *int64
+	if p.Count != CountNone {
+		total, filtered, totalPages = &p.Total, &p.Filtered, &p.TotalPages
+	}
+	return json.Marshal(struct {
+		Content    []T       `json:"content"`
+		Page       int       `json:"page"`
+		Size       int       `json:"size"`
+		Total      *int64    `json:"total,omitempty"`
+		Filtered   *int64    `json:"filtered,omitempty"`
+		TotalPages *int64    `json:"totalPages,omitempty"`
+		HasNext    bool      `json:"hasNext"`
+		HasPrev    bool      `json:"hasPrev"`
+		Count      CountMode `json:"count,omitempty"`
+	}{p.Content, p.Page, p.Size, total, filtered, totalPages, p.HasNext, p.HasPrev, p.Count})
 }
 
 type Pageable struct {
-	Page int
-	Size int
+	Page  int
+	Size  int
+	Count CountMode // How to count the rows of the listing. Empty is CountExact.
 }
 
 func NewPageable(page int, size int) Pageable {
 	return Pageable{Page: page, Size: size}
 }
+
+// Map returns the page with its content converted by f.
+func Map[T any, U any](p Page[T], f func(T) U) Page[U] {
+	content := make([]U, 0, len(p.Content))
+	for _, item := range p.Content {
+		content = append(content, f(item))
+	}
+	return Page[U]{
+		Content:    content,
+		Page:       p.Page,
+		Size:       p.Size,
+		Total:      p.Total,
+		Filtered:   p.Filtered,
+		TotalPages: p.TotalPages,
+		HasNext:    p.HasNext,
+		HasPrev:    p.HasPrev,
+		Count:      p.Count,
+		NextCursor: p.NextCursor,
+		PrevCursor: p.PrevCursor,
+		keyset:     p.keyset,
+	}
+}
+
+// Normalized returns the pageable with the first page and a size of one for values out of range.
+func (p Pageable) Normalized() Pageable {
+	p.Page = max(p.Page, 1)
+	p.Size = max(p.Size, 1)
+	if p.Count == "" {
+		p.Count = CountExact
+	}
+	return p
+}
@@ -0,0 +1,118 @@
+package pagination
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestPageJSON(t *testing.T) {
+	tests := []struct {
+		page     Page[int]
+		expected string
+	}{
+		{NewPage([]int{1, 2}, 1, 2, 10, 4), `{"content":[1,2],"page":1,"size":2,"total":10,"filtered":4,"totalPages":2,"hasNext":true,"hasPrev":false,"count":"exact"}`},
+		{NewPage([]int{5}, 3, 2, 5, 5), `{"content":[5],"page":3,"size":2,"total":5,"filtered":5,"totalPages":3,"hasNext":false,"hasPrev":true,"count":"exact"}`},
+		{NewUncountedPage([]int{1, 2}, 2, 2, true), `{"content":[1,2],"page":2,"size":2,"hasNext":true,"hasPrev":true,"count":"none"}`},
+		{NewCursorPage([]int{1, 2}, 2, "next", ""), `{"content":[1,2],"size":2,"hasNext":true,"hasPrev":false,"nextCursor":"next"}`},
+		{NewCursorPage([]int{}, 2, "", "prev"), `{"content":[],"size":2,"hasNext":false,"hasPrev":true,"prevCursor":"prev"}`},
+	}
+	for _, test := range tests {
+		data, err := json.Marshal(test.page)
+		if err != nil {
+			t.Fatalf("Marshal returned an error: %v", err)
+		}
+		if string(data) != test.expected {
+			t.Errorf("Marshal = %s, expected %s", data, test.expected)
+		}
+	}
+}
+
+func TestCursor(t *testing.T) {
+	position := CursorPosition{Backward: true, Keys: []string{"age:desc", "id:asc"}, Values: []json.RawMessage{[]byte(`30`), []byte(`"x"`)}}
+	cursor, err := position.Encode()
+	if err != nil {
+		t.Fatalf("Encode returned an error: %v", err)
+	}
+	decoded, err := cursor.Decode()
+	if err != nil {
+		t.Fatalf("Decode returned an error: %v", err)
+	}
+	if !decoded.Backward || len(decoded.Keys) != 2 || decoded.Keys[0] != "age:desc" || string(decoded.Values[1]) != `"x"` {
+		t.Errorf("Decode = %+v, expected %+v", decoded, position)
+	}
+
+	unmatched, err := CursorPosition{Keys: []string{"id:asc"}}.Encode()
+	if err != nil {
+		t.Fatalf("Encode returned an error: %v", err)
+	}
+	for _, cursor := range []Cursor{"%%%", Cursor("e30"), unmatched} {
+		if _, err := cursor.Decode(); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("Decode(%s) error = %v, expected %v", cursor, err, ErrInvalidCursor)
+		}
+	}
+
+	// Values that are not JSON cannot be encoded.
+	invalid := CursorPosition{Keys: []string{"id:asc"}, Values: []json.RawMessage{[]byte(`{`)}}
+	if cursor, err := invalid.Encode(); err == nil {
+		t.Errorf("Encode = %s, expected an error", cursor)
+	}
+}
+
+func TestNewEstimatedPage(t *testing.T) {
+	tests := []struct {
+		page                        Page[int]
+		filtered, totalPages, total int64
+	}{
+		// The estimates are kept while they agree with the rows read.
+		{NewEstimatedPage([]int{1, 2}, 1, 2, 100, 40, true), 40, 20, 100},
+		// A next page means at least one row more than read.
+		{NewEstimatedPage([]int{1, 2}, 3, 2, 3, 3, true), 7, 4, 7},
+		// The last page gives the exact row count.
+		{NewEstimatedPage([]int{1}, 3, 2, 100, 40, false), 5, 3, 100},
+	}
+	for _, test := range tests {
+		p := test.page
+		if p.Filtered != test.filtered || p.TotalPages != test.totalPages || p.Total != test.total || p.Count != CountEstimate {
+			t.Errorf("NewEstimatedPage = %+v, expected filtered %d, %d pages and total %d", p, test.filtered, test.totalPages, test.total)
+		}
+	}
+}
+
+func TestLimitsFor(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.SetDefault("pagination.default_size", 10)
+	viper.SetDefault("pagination.max_size", 100)
+	viper.Set("pagination.entities.audit.max_size", 500)
+	viper.Set("pagination.entities.tiny.max_size", 5)
+
+	tests := []struct {
+		entity    string
+		requested int
+		expected  int
+	}{
+		{"User", 0, 10},
+		{"User", 25, 25},
+		{"User", 1000000, 100},
+		{"Audit", 1000, 500},
+		{"Tiny", 0, 5},
+	}
+	for _, test := range tests {
+		if size := LimitsFor(test.entity).Size(test.requested); size != test.expected {
+			t.Errorf("LimitsFor(%s).Size(%d) = %d, expected %d", test.entity, test.requested, size, test.expected)
+		}
+	}
+}
+
+func TestParseCountMode(t *testing.T) {
+	for input, expected := range map[string]CountMode{"": CountExact, "exact": CountExact, "NONE": CountNone, "estimate": CountEstimate} {
+		if mode, err := ParseCountMode(input); err != nil || mode != expected {
+			t.Errorf("ParseCountMode(%q) = %v, %v, expected %v", input, mode, err, expected)
+		}
+	}
+	if _, err := ParseCountMode("approximate"); !errors.Is(err, ErrInvalidCountMode) {
+		t.Errorf("ParseCountMode(approximate) error = %v, expected %v", err, ErrInvalidCountMode)
+	}
+}
@@ -1,21 +1,269 @@
 // Package relation provides functionality to parse and handle relations.
 //
-// Relation represents a type alias for string to define relations.
+// Relation is a relation to load with an entity. It may restrict and order the related
+// entities it loads and load further relations of them in turn.
 //
-// Parse takes a comma-separated string and returns a slice of Relation.
-// Each element in the input string is split by commas and converted to a Relation type.
+// Parse reads a list of relation specs such as
+//
+//	roles(order=name:asc;filter=name:like:a%).permissions,author
+//
+// into a tree of Relation, in which specs sharing a path are merged.
 package relation
 
-import "strings"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/cmo7/folly4/src/lib/generics/filter"
+	"github.com/cmo7/folly4/src/lib/generics/order"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	// The deepest relation path clients may load, e.g. 2 for roles.permissions.
+	viper.SetDefault("relations.max_depth", 3)
+}
+
+var (
+	// ErrInvalidRelation is returned for relation specs that do not follow the grammar.
+	ErrInvalidRelation = errors.New("invalid relation")
+	// ErrUnknownRelation is returned when a relation spec names a relation the entity does not have.
+	ErrUnknownRelation = errors.New("unknown relation")
+	// ErrTooDeep is returned for relation paths deeper than relations.max_depth.
+	ErrTooDeep = errors.New("relation path too deep")
+)
+
+type Relation struct {
+	Name      string          // Name of the relation, as written by the client.
+	Filter    filter.Filter   // Only load the related entities matching the filter. Nil loads all of them.
+	Order     []order.OrderBy // Order of the related entities.
+	Relations []Relation      // Relations to load with the related entities.
+}
+
+// New returns the relation at a dotted path such as "Roles.Permissions", without filters or orders.
+func New(path string) Relation {
+	names := strings.Split(path, ".")
+	r := Relation{Name: names[len(names)-1]}
+	for i := len(names) - 2; i >= 0; i-- {
+		r = Relation{Name: names[i], Relations: []Relation{r}}
+	}
+	return r
+}
+
+// String returns the spec of the relation, which Parse reads back.
+func (r Relation) String() string {
+	return strings.Join(r.specs(), ",")
+}
 
-type Relation string
+// specs returns a spec for every path of the relation. Only the first one carries the options.
+func (r Relation) specs() []string {
+	head := r.Name
+	options := []string{}
+	if len(r.Order) > 0 {
+		orders := make([]string, len(r.Order))
+		for i, orderBy := range r.Order {
+			orders[i] = orderBy.Field + ":" + string(orderBy.Direction)
+		}
+		options = append(options, "order="+strings.Join(orders, ","))
+	}
+	if r.Filter != nil {
+		options = append(options, "filter="+r.Filter.ToString())
+	}
+	if len(options) > 0 {
+		head += "(" + strings.Join(options, ";") + ")"
+	}
+	if len(r.Relations) == 0 {
+		return []string{head}
+	}
+
+	specs := []string{}
+	for _, child := range r.Relations {
+		for _, spec := range child.specs() {
+			prefix := r.Name
+			if len(specs) == 0 {
+				prefix = head
+			}
+			specs = append(specs, prefix+"."+spec)
+		}
+	}
+	return specs
+}
+
+// Depth returns the length of the longest path of relations.
+func Depth(relations []Relation) int {
+	depth := 0
+	for _, r := range relations {
+		depth = max(depth, 1+Depth(r.Relations))
+	}
+	return depth
+}
+
+// MaxDepth returns the deepest relation path clients may load.
+func MaxDepth() int {
+	return viper.GetInt("relations.max_depth")
+}
 
+/**
+* Parse reads relation specs:
+*
+*	relations = spec { "," spec }
+*	spec      = segment { "." segment }
+*	segment   = name [ "(" option { ";" option } ")" ]
+*	option    = "order=" order | "filter=" filter
+*
+* where order is in the format of order.Parse and filter in the compact syntax of filter.Parse.
+* Options apply to the entities of the segment they follow. Specs that share a path are merged,
+* and a segment may only get its options once.
+ */
 func Parse(s string) ([]Relation, error) {
-	orderStrings := strings.Split(s, ",")
-	relations := make([]Relation, len(orderStrings))
-	for i, orderString := range orderStrings {
-		relations[i] = Relation(orderString)
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	specs, err := split(s, ',')
+	if err != nil {
+		return nil, err
+	}
+
+	var relations []Relation
+	for _, spec := range specs {
+		segments, err := split(spec, '.')
+		if err != nil {
+			return nil, err
+		}
+		path := make([]Relation, len(segments))
+		for i, segment := range segments {
+			if path[i], err = parseSegment(segment); err != nil {
+				return nil, err
+			}
+		}
+		if relations, err = merge(relations, path); err != nil {
+			return nil, err
+		}
 	}
 
+	if depth, maxDepth := Depth(relations), MaxDepth(); depth > maxDepth {
+		return nil, fmt.Errorf("%w: %d relations, at most %d", ErrTooDeep, depth, maxDepth)
+	}
 	return relations, nil
 }
+
+// parseSegment parses a relation name and its options.
+func parseSegment(segment string) (Relation, error) {
+	segment = strings.TrimSpace(segment)
+	name, options, hasOptions := strings.Cut(segment, "(")
+	name = strings.TrimSpace(name)
+	if !isName(name) {
+		return Relation{}, fmt.Errorf("%w: %q is not a relation name", ErrInvalidRelation, name)
+	}
+	r := Relation{Name: name}
+	if !hasOptions {
+		return r, nil
+	}
+	if !strings.HasSuffix(options, ")") {
+		return Relation{}, fmt.Errorf("%w: missing ')' after the options of %s", ErrInvalidRelation, name)
+	}
+
+	parts, err := split(strings.TrimSuffix(options, ")"), ';')
+	if err != nil {
+		return Relation{}, err
+	}
+	for _, part := range parts {
+		key, value, ok := strings.Cut(part, "=")
+		key = strings.TrimSpace(key)
+		switch {
+		case !ok:
+			return Relation{}, fmt.Errorf("%w: option %q of %s is not key=value", ErrInvalidRelation, part, name)
+		case key == "order" && r.Order == nil:
+			if r.Order, err = order.Parse(strings.TrimSpace(value)); err != nil {
+				return Relation{}, fmt.Errorf("%w: order of %s: %w", ErrInvalidRelation, name, err)
+			}
+		case key == "filter" && r.Filter == nil:
+			if r.Filter, err = filter.Parse(value); err != nil {
+				return Relation{}, fmt.Errorf("%w: filter of %s: %w", ErrInvalidRelation, name, err)
+			}
+		case key == "order" || key == "filter":
+			return Relation{}, fmt.Errorf("%w: %s of %s is given twice", ErrInvalidRelation, key, name)
+		default:
+			return Relation{}, fmt.Errorf("%w: unknown option %q of %s", ErrInvalidRelation, key, name)
+		}
+	}
+	return r, nil
+}
+
+func isName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// merge adds the path of relations to the tree, each segment below the previous one.
+func merge(relations []Relation, path []Relation) ([]Relation, error) {
+	if len(path) == 0 {
+		return relations, nil
+	}
+	segment := path[0]
+	for i := range relations {
+		if relations[i].Name != segment.Name {
+			continue
+		}
+		existing := &relations[i]
+		if segment.Filter != nil || segment.Order != nil {
+			if existing.Filter != nil || existing.Order != nil {
+				return nil, fmt.Errorf("%w: options of %s are given twice", ErrInvalidRelation, segment.Name)
+			}
+			existing.Filter, existing.Order = segment.Filter, segment.Order
+		}
+		nested, err := merge(existing.Relations, path[1:])
+		if err != nil {
+			return nil, err
+		}
+		existing.Relations = nested
+		return relations, nil
+	}
+	nested, err := merge(nil, path[1:])
+	if err != nil {
+		return nil, err
+	}
+	segment.Relations = nested
+	return append(relations, segment), nil
+}
+
+// split splits s at every sep outside parentheses, double quotes and backslash escapes,
+// so separators inside the options of a segment, such as the commas of a filter, are kept.
+func split(s string, sep rune) ([]string, error) {
+	parts := []string{}
+	depth, start := 0, 0
+	quoted, escaped := false, false
+	for i, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+		case quoted:
+		case r == '(':
+			depth++
+		case r == ')':
+			if depth--; depth < 0 {
+				return nil, fmt.Errorf("%w: unexpected ')' in %q", ErrInvalidRelation, s)
+			}
+		case r == sep && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	if depth > 0 || quoted {
+		return nil, fmt.Errorf("%w: unclosed '(' or '\"' in %q", ErrInvalidRelation, s)
+	}
+	return append(parts, s[start:]), nil
+}
@@ -1,8 +1,13 @@
 package relation
 
 import (
+	"errors"
 	"reflect"
 	"testing"
+
+	"github.com/cmo7/folly4/src/lib/generics/filter"
+	"github.com/cmo7/folly4/src/lib/generics/order"
+	"github.com/spf13/viper"
 )
 
 func TestParse(t *testing.T) {
@@ -10,10 +15,28 @@ func TestParse(t *testing.T) {
 		input    string
 		expected []Relation
 	}{
-		{"a,b,c", []Relation{"a", "b", "c"}},
-		{"", []Relation{""}},
-		{"one,two,three", []Relation{"one", "two", "three"}},
-		{"single", []Relation{"single"}},
+		{"a,b,c", []Relation{{Name: "a"}, {Name: "b"}, {Name: "c"}}},
+		{"", nil},
+		{"single", []Relation{{Name: "single"}}},
+		{"roles.permissions", []Relation{New("roles.permissions")}},
+		{"roles.permissions, roles.users ,author", []Relation{
+			{Name: "roles", Relations: []Relation{{Name: "permissions"}, {Name: "users"}}},
+			{Name: "author"},
+		}},
+		{"roles(order=name:asc;filter=name:like:a%).permissions", []Relation{{
+			Name:      "roles",
+			Order:     []order.OrderBy{order.AscOrderBy("name")},
+			Filter:    filter.Like("name", "a%"),
+			Relations: []Relation{{Name: "permissions"}},
+		}}},
+		{"roles(filter=or(name:eq:a,name:eq:\"b;c)\")),roles.permissions(order=entity:desc,operation:asc)", []Relation{{
+			Name:   "roles",
+			Filter: filter.Or(filter.Equal("name", "a"), filter.Equal("name", "b;c)")),
+			Relations: []Relation{{
+				Name:  "permissions",
+				Order: []order.OrderBy{order.DescOrderBy("entity"), order.AscOrderBy("operation")},
+			}},
+		}}},
 	}
 
 	for _, test := range tests {
@@ -22,7 +45,52 @@ func TestParse(t *testing.T) {
 			t.Errorf("Parse(%q) returned an error: %v", test.input, err)
 		}
 		if !reflect.DeepEqual(result, test.expected) {
-			t.Errorf("Parse(%q) = %v, want %v", test.input, result, test.expected)
+			t.Errorf("Parse(%q) = %+v, want %+v", test.input, result, test.expected)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected error
+	}{
+		{"roles..permissions", ErrInvalidRelation},
+		{"roles(order=name:asc", ErrInvalidRelation},
+		{"roles(order=name:up)", ErrInvalidRelation},
+		{"roles(filter=name:bad)", ErrInvalidRelation},
+		{"roles(limit=5)", ErrInvalidRelation},
+		{"roles(order=name:asc;order=name:desc)", ErrInvalidRelation},
+		{"roles(order=name:asc),roles(filter=name:eq:a)", ErrInvalidRelation},
+		{"roles)", ErrInvalidRelation},
+		{"a.b.c.d", ErrTooDeep},
+	}
+	for _, test := range tests {
+		if _, err := Parse(test.input); !errors.Is(err, test.expected) {
+			t.Errorf("Parse(%q) error = %v, expected %v", test.input, err, test.expected)
+		}
+	}
+
+	t.Cleanup(func() { viper.Set("relations.max_depth", 3) })
+	viper.Set("relations.max_depth", 1)
+	if _, err := Parse("roles.permissions"); !errors.Is(err, ErrTooDeep) {
+		t.Errorf("Parse with max depth 1 error = %v, expected %v", err, ErrTooDeep)
+	}
+}
+
+func TestString(t *testing.T) {
+	for _, spec := range []string{
+		"roles",
+		"roles.permissions",
+		"roles(order=name:asc;filter=name:like:a%).permissions,roles.users",
+		"children(filter=and(age:gt:3,name:eq:x)).siblings",
+	} {
+		relations, err := Parse(spec)
+		if err != nil || len(relations) != 1 {
+			t.Fatalf("Parse(%q) = %v, %v", spec, relations, err)
+		}
+		if s := relations[0].String(); s != spec {
+			t.Errorf("String() = %q, expected %q", s, spec)
 		}
 	}
 }
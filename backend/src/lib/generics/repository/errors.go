@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+)
+
+// The kinds of errors databases return for statements that break a constraint or conflict with
+// concurrent transactions, whatever the engine. Repositories return them in a DatabaseError.
+var (
+	ErrUniqueViolation      = errors.New("unique constraint violated")
+	ErrForeignKeyViolation  = errors.New("foreign key constraint violated")
+	ErrNotNullViolation     = errors.New("not null constraint violated")
+	ErrCheckViolation       = errors.New("check constraint violated")
+	ErrDeadlock             = errors.New("deadlock detected")
+	ErrSerializationFailure = errors.New("could not serialize transaction")
+	ErrLockTimeout          = errors.New("lock wait timeout")
+)
+
+// DatabaseError is an error of the database classified in one of the kinds of the package, with
+// what the database reported about the constraint and column involved. It matches its kind and
+// the driver error with errors.Is and errors.As.
+type DatabaseError struct {
+	Kind       error
+	Table      string // Empty when the database does not report it.
+	Constraint string // Empty when the database does not report it.
+	Column     string // Empty when the database does not report it and it cannot be told from the constraint.
+	Field      string // Public name of the field of the entity stored in Column, if any.
+	Err        error  // The error of the driver.
+}
+
+func (e *DatabaseError) Error() string {
+	message := e.Kind.Error()
+	if e.Column != "" {
+		message += ": " + strings.TrimPrefix(e.Table+"."+e.Column, ".")
+	}
+	if e.Constraint != "" {
+		message += " (" + e.Constraint + ")"
+	}
+	return message
+}
+
+func (e *DatabaseError) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// Retryable reports whether err is the error of a transaction that failed because of concurrent
+// transactions, so running it again may succeed.
+func Retryable(err error) bool {
+	return errors.Is(err, ErrDeadlock) || errors.Is(err, ErrSerializationFailure) || errors.Is(err, ErrLockTimeout)
+}
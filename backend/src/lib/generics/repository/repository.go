@@ -23,6 +23,7 @@ type Repository[E common.Entity] interface {
 	Delete(ctx context.Context, payload E) error
 	FindOne(ctx context.Context, id uuid.UUID, relations []relation.Relation) (E, error)
 	FindAll(ctx context.Context, pageable pagination.Pageable, filter filter.Filter, relations []relation.Relation, orderBys []order.OrderBy) (pagination.Page[E], error)
+	FindAllCursor(ctx context.Context, pageable pagination.CursorPageable, filter filter.Filter, relations []relation.Relation, orderBys []order.OrderBy) (pagination.Page[E], error)
 	Count(ctx context.Context, filter filter.Filter) (int64, error)
 	Associate(ctx context.Context, id uuid.UUID, association string, targetId uuid.UUID) (E, error)
 	Dissociate(ctx context.Context, id uuid.UUID, association string, targetId uuid.UUID) (E, error)
@@ -42,6 +42,7 @@ func NewRouter[E common.Entity, D common.Entity](controller *controller.CrudCont
 	r.Get("/random", r.controller.Random())
 	r.Get("/first", r.controller.First())
 	r.Get("/combo", r.controller.Combo())
+	r.Post("/search", r.controller.Search())
 	r.Post("/", r.controller.Create())
 	r.Get("/{id}", r.controller.Find())
 	r.Put("/{id}", r.controller.Update())
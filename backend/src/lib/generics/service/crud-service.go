@@ -26,6 +26,7 @@ type CrudService[E common.Entity] interface {
 	Delete(ctx context.Context, payload E) error
 	FindOne(ctx context.Context, id uuid.UUID, relations []relation.Relation) (E, error)
 	FindAll(ctx context.Context, pageable pagination.Pageable, filter filter.Filter, relations []relation.Relation, orderBys []order.OrderBy) (pagination.Page[E], error)
+	FindAllCursor(ctx context.Context, pageable pagination.CursorPageable, filter filter.Filter, relations []relation.Relation, orderBys []order.OrderBy) (pagination.Page[E], error)
 	Count(ctx context.Context, filter filter.Filter) (int64, error)
 	Associate(ctx context.Context, id uuid.UUID, association string, targetId uuid.UUID) (E, error)
 	Dissociate(ctx context.Context, id uuid.UUID, association string, targetId uuid.UUID) (E, error)
@@ -311,6 +312,32 @@ func (s *CrudServiceWithHooks[E]) FindAll(ctx context.Context, pageable paginati
 	return page, err
 }
 
+func (s *CrudServiceWithHooks[E]) FindAllCursor(ctx context.Context, pageable pagination.CursorPageable, f filter.Filter, relations []relation.Relation, orderBys []order.OrderBy) (pagination.Page[E], error) {
+	if s.BeforeFind != nil {
+		if err := s.BeforeFind(ctx); err != nil {
+			return pagination.NewCursorPage[E]([]E{}, 0, "", ""), err
+		}
+	}
+
+	page, err := s.repo.FindAllCursor(ctx, pageable, f, relations, orderBys)
+
+	if err != nil {
+		if s.OnFindFail != nil {
+			if err := s.OnFindFail(ctx, err, page.Content...); err != nil {
+				return page, err
+			}
+		}
+	}
+
+	if s.AfterFind != nil {
+		if err := s.AfterFind(ctx, page.Content...); err != nil {
+			return page, err
+		}
+	}
+
+	return page, err
+}
+
 func (s *CrudServiceWithHooks[E]) Count(ctx context.Context, f filter.Filter) (int64, error) {
 	if s.BeforeCount != nil {
 		if err := s.BeforeCount(ctx); err != nil {
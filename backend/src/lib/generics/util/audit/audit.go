@@ -23,13 +23,26 @@ const (
 	AuditActionAssociate  AuditAction = "ASSOCIATE"
 	AuditActionDissociate AuditAction = "DISSOCIATE"
 
-	AuditActionLogin  AuditAction = "LOGIN"
-	AuditActionLogout AuditAction = "LOGOUT"
+	AuditActionLogin   AuditAction = "LOGIN"
+	AuditActionRefresh AuditAction = "REFRESH"
+	AuditActionLogout  AuditAction = "LOGOUT"
 
 	AuditActionApprove AuditAction = "APPROVE"
 	AuditActionReject  AuditAction = "REJECT"
 )
 
+// EnumValues lists every known audit action. It implements filter.Enum.
+func (a AuditAction) EnumValues() []string {
+	return []string{
+		string(AuditActionNone),
+		string(AuditActionCreate), string(AuditActionRead), string(AuditActionUpdate), string(AuditActionDelete),
+		string(AuditActionEnable), string(AuditActionDisable),
+		string(AuditActionAssociate), string(AuditActionDissociate),
+		string(AuditActionLogin), string(AuditActionRefresh), string(AuditActionLogout),
+		string(AuditActionApprove), string(AuditActionReject),
+	}
+}
+
 type AuditActionResult string
 
 const (
@@ -38,6 +51,15 @@ const (
 	AuditActionResultFailure AuditActionResult = "FAILURE"
 )
 
+// EnumValues lists every known audit action result. It implements filter.Enum.
+func (r AuditActionResult) EnumValues() []string {
+	return []string{
+		string(AuditActionResultNone),
+		string(AuditActionResultSuccess),
+		string(AuditActionResultFailure),
+	}
+}
+
 type Audit interface {
 	common.Entity
 	GetAction() AuditAction
@@ -0,0 +1,182 @@
+package credentials
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cmo7/folly4/src/lib/generics/apperror"
+	"github.com/cmo7/folly4/src/lib/generics/common"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func init() {
+	// New passwords are hashed with the configured algorithm and cost. Passwords hashed with
+	// another algorithm or cost are hashed again the next time they are verified, e.g.
+	//
+	//	[password]
+	//	algorithm = "bcrypt"
+	//	bcrypt_cost = 12
+	viper.SetDefault("password.algorithm", string(Argon2id))
+	viper.SetDefault("password.bcrypt_cost", 12)
+	viper.SetDefault("password.argon2_memory", 64*1024) // KiB
+	viper.SetDefault("password.argon2_iterations", 3)
+	viper.SetDefault("password.argon2_parallelism", 2)
+}
+
+// Credentials is an entity that signs in with a password, stored hashed.
+type Credentials interface {
+	common.Entity
+	GetPassword() string
+	SetPassword(password string)
+}
+
+type Algorithm string
+
+const (
+	Argon2id Algorithm = "argon2id"
+	Bcrypt   Algorithm = "bcrypt"
+)
+
+var (
+	// ErrUnknownHash is returned for stored hashes of no known algorithm.
+	ErrUnknownHash = errors.New("unknown password hash")
+	// ErrPasswordTooLong is returned for passwords bcrypt cannot hash, longer than 72 bytes.
+	ErrPasswordTooLong = bcrypt.ErrPasswordTooLong
+	// ErrInvalidCredentials is returned for sign ins with an unknown name or a wrong password,
+	// which are not told apart.
+	ErrInvalidCredentials = apperror.New(apperror.ErrUnauthorized, nil, "invalid username or password")
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// Argon2Params are the cost parameters of argon2id hashes.
+type Argon2Params struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// Hasher hashes passwords with an algorithm and cost, and verifies them against hashes of any
+// algorithm it knows.
+type Hasher struct {
+	Algorithm  Algorithm
+	BcryptCost int
+	Argon2     Argon2Params
+}
+
+// NewHasher returns the hasher configured under password.
+func NewHasher() *Hasher {
+	return &Hasher{
+		Algorithm:  Algorithm(viper.GetString("password.algorithm")),
+		BcryptCost: viper.GetInt("password.bcrypt_cost"),
+		Argon2: Argon2Params{
+			Memory:      viper.GetUint32("password.argon2_memory"),
+			Iterations:  viper.GetUint32("password.argon2_iterations"),
+			Parallelism: uint8(viper.GetUint("password.argon2_parallelism")),
+		},
+	}
+}
+
+// Hash returns the hash of password, in the modular crypt format of the algorithm:
+// "$2a$12$..." for bcrypt and "$argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>" for argon2id.
+func (h *Hasher) Hash(password string) (string, error) {
+	switch h.Algorithm {
+	case Bcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.BcryptCost)
+		return string(hash), err
+	case Argon2id:
+		salt := make([]byte, argon2SaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, h.Argon2.Iterations, h.Argon2.Memory, h.Argon2.Parallelism, argon2KeyLength)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2.Version, h.Argon2.Memory, h.Argon2.Iterations, h.Argon2.Parallelism,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+	}
+	return "", fmt.Errorf("unknown password algorithm %q", h.Algorithm)
+}
+
+// Verify reports whether password is the password of hash, and whether hash should be replaced
+// by a new one because it was made with another algorithm or cost than the hasher's.
+func (h *Hasher) Verify(hash string, password string) (ok bool, rehash bool, err error) {
+	switch {
+	case isBcrypt(hash):
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, err
+		}
+		cost, err := bcrypt.Cost([]byte(hash))
+		return true, h.Algorithm != Bcrypt || cost != h.BcryptCost, err
+	case strings.HasPrefix(hash, "$argon2id$"):
+		params, salt, key, err := parseArgon2id(hash)
+		if err != nil {
+			return false, false, err
+		}
+		actual := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+		if subtle.ConstantTimeCompare(actual, key) != 1 {
+			return false, false, nil
+		}
+		return true, h.Algorithm != Argon2id || params != h.Argon2, nil
+	}
+	return false, false, ErrUnknownHash
+}
+
+// IsHash reports whether value looks like a password hash of a known algorithm, rather than a
+// password.
+func IsHash(value string) bool {
+	if isBcrypt(value) {
+		return true
+	}
+	_, _, _, err := parseArgon2id(value)
+	return err == nil
+}
+
+func isBcrypt(value string) bool {
+	if len(value) != 60 {
+		return false
+	}
+	for _, prefix := range []string{"$2a$", "$2b$", "$2x$", "$2y$"} {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseArgon2id reads the parameters, salt and key of an argon2id hash.
+func parseArgon2id(hash string) (Argon2Params, []byte, []byte, error) {
+	params := Argon2Params{}
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return params, nil, nil, ErrUnknownHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrUnknownHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, ErrUnknownHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrUnknownHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, ErrUnknownHash
+	}
+	return params, salt, key, nil
+}
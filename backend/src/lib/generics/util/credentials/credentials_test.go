@@ -0,0 +1,88 @@
+package credentials
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Cheap costs, so the tests run fast.
+var (
+	argon2Hasher = &Hasher{Algorithm: Argon2id, BcryptCost: 4, Argon2: Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1}}
+	bcryptHasher = &Hasher{Algorithm: Bcrypt, BcryptCost: 4, Argon2: argon2Hasher.Argon2}
+)
+
+func TestHashAndVerify(t *testing.T) {
+	for _, hasher := range []*Hasher{argon2Hasher, bcryptHasher} {
+		hash, err := hasher.Hash("correct horse")
+		assert.Nil(t, err)
+		assert.True(t, IsHash(hash), hash)
+		assert.NotContains(t, hash, "correct horse")
+
+		other, err := hasher.Hash("correct horse")
+		assert.Nil(t, err)
+		assert.NotEqual(t, hash, other, "hashes are salted")
+
+		ok, rehash, err := hasher.Verify(hash, "correct horse")
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		assert.False(t, rehash)
+
+		ok, _, err = hasher.Verify(hash, "battery staple")
+		assert.Nil(t, err)
+		assert.False(t, ok)
+	}
+	assert.True(t, strings.HasPrefix(must(argon2Hasher.Hash("x")), "$argon2id$v=19$m=1024,t=1,p=1$"))
+	assert.True(t, strings.HasPrefix(must(bcryptHasher.Hash("x")), "$2a$04$"))
+}
+
+func TestVerifyAsksToRehash(t *testing.T) {
+	stronger := *argon2Hasher
+	stronger.Argon2.Iterations = 2
+
+	ok, rehash, err := stronger.Verify(must(argon2Hasher.Hash("secret")), "secret")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.True(t, rehash, "other argon2id parameters")
+
+	ok, rehash, err = argon2Hasher.Verify(must(bcryptHasher.Hash("secret")), "secret")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.True(t, rehash, "other algorithm")
+
+	costlier := *bcryptHasher
+	costlier.BcryptCost = 5
+	_, rehash, _ = costlier.Verify(must(bcryptHasher.Hash("secret")), "secret")
+	assert.True(t, rehash, "other bcrypt cost")
+
+	// Wrong passwords are never rehashed.
+	_, rehash, _ = stronger.Verify(must(argon2Hasher.Hash("secret")), "guess")
+	assert.False(t, rehash)
+}
+
+func TestVerifyUnknownHash(t *testing.T) {
+	_, _, err := argon2Hasher.Verify("secret", "secret")
+	assert.ErrorIs(t, err, ErrUnknownHash)
+	_, _, err = argon2Hasher.Verify("$argon2id$v=19$m=1024$salt$key", "secret")
+	assert.ErrorIs(t, err, ErrUnknownHash)
+}
+
+func TestIsHash(t *testing.T) {
+	assert.False(t, IsHash("hunter22"))
+	assert.False(t, IsHash("$2a$not a hash"))
+	assert.False(t, IsHash("$argon2id$looks like one"))
+	assert.True(t, IsHash("$2y$10$abcdefghijklmnopqrstuuABCDEFGHIJKLMNOPQRSTUVWXYZ01234"))
+}
+
+func TestBcryptPasswordTooLong(t *testing.T) {
+	_, err := bcryptHasher.Hash(strings.Repeat("a", 73))
+	assert.ErrorIs(t, err, ErrPasswordTooLong)
+}
+
+func must(hash string, err error) string {
+	if err != nil {
+		panic(err)
+	}
+	return hash
+}
@@ -2,8 +2,7 @@ package permission
 
 import (
 	"context"
-	"fmt"
-
+	"github.com/cmo7/folly4/src/lib/generics/apperror"
 	"github.com/cmo7/folly4/src/lib/generics/common"
 )
 
@@ -26,12 +25,27 @@ const (
 
 	OperationApprove Operation = "APPROVE"
 	OperationReject  Operation = "REJECT"
+
+	// OperationAll is the operation of permissions for every operation, see Wildcard.
+	OperationAll Operation = Wildcard
 )
 
 func (o Operation) String() string {
 	return string(o)
 }
 
+// EnumValues lists every known operation. It implements filter.Enum.
+func (o Operation) EnumValues() []string {
+	return []string{
+		string(OperationCreate), string(OperationRead), string(OperationUpdate), string(OperationDelete),
+		string(OperationEnable), string(OperationDisable),
+		string(OperationAssociate), string(OperationDissociate),
+		string(OperationLogin), string(OperationLogout),
+		string(OperationApprove), string(OperationReject),
+		string(OperationAll),
+	}
+}
+
 // Permission is an interface that represents a permission.
 // It provides methods to retrieve the permission's ID, name, and description.
 type Permission interface {
@@ -43,10 +57,13 @@ type Permission interface {
 	ToString() string
 }
 
+// Role is a set of permissions users are given together. A role has the permissions of the roles
+// it extends, its parents, too.
 type Role interface {
 	common.Entity
 	GetPermissions() []Permission
 	SetPermissions(permissions []Permission)
+	GetParents() []Role
 }
 
 type User interface {
@@ -67,60 +84,69 @@ func WithUser(ctx context.Context, user User) context.Context {
 	return context.WithValue(ctx, UserKey{}, user)
 }
 
-func GetUser(ctx context.Context) User {
-	return ctx.Value(UserKey{}).(User)
+// GetUser returns the user of ctx, if it has one.
+func GetUser(ctx context.Context) (User, bool) {
+	user, ok := ctx.Value(UserKey{}).(User)
+	return user, ok && user != nil
+}
+
+// Principal returns the user of ctx, or Anonymous when it has none.
+func Principal(ctx context.Context) User {
+	if user, ok := GetUser(ctx); ok {
+		return user
+	}
+	return Anonymous
+}
+
+// WithSystem returns a context with the System principal, for the CLI and background jobs.
+func WithSystem(ctx context.Context) context.Context {
+	ctx = WithUser(ctx, System)
+	ctx = WithRoles(ctx, nil)
+	return WithPermissions(ctx, nil)
 }
 
 func WithRoles(ctx context.Context, roles []Role) context.Context {
 	return context.WithValue(ctx, RolesKey{}, roles)
 }
 
-func GetRoles(ctx context.Context) []Role {
-	return ctx.Value(RolesKey{}).([]Role)
+// GetRoles returns the roles of ctx, if it has them.
+func GetRoles(ctx context.Context) ([]Role, bool) {
+	roles, ok := ctx.Value(RolesKey{}).([]Role)
+	return roles, ok
 }
 
 func WithPermissions(ctx context.Context, permissions []Permission) context.Context {
 	return context.WithValue(ctx, PermissionsKey{}, permissions)
 }
 
-func GetPermissions(ctx context.Context) []Permission {
-	return ctx.Value(PermissionsKey{}).([]Permission)
+// GetPermissions returns the permissions of ctx, if it has them.
+func GetPermissions(ctx context.Context) ([]Permission, bool) {
+	permissions, ok := ctx.Value(PermissionsKey{}).([]Permission)
+	return permissions, ok
 }
 
-func getFullPermissionListFromContext(ctx context.Context) []Permission {
-	// Get the permissions from the context.
-	permissions := GetPermissions(ctx)
-
-	// Get the roles from the context.
-	roles := GetRoles(ctx)
-	// Get the permissions from the roles.
-	for _, role := range roles {
-		permissions = append(permissions, role.GetPermissions()...)
+// EffectivePermissions returns the permissions of the user of ctx, granted to them, to their roles
+// or to the parents of their roles, and the permissions they imply, once each. Permissions may
+// have wildcards.
+func EffectivePermissions(ctx context.Context) []Permission {
+	set, err := effective(ctx)
+	if err != nil {
+		return []Permission{}
 	}
-
-	// Get the user from the context.
-	user := GetUser(ctx)
-	// Get the permissions from the user.
-	permissions = append(permissions, user.GetPermissions()...)
-
-	// Get the permissions from the user's roles.
-	for _, role := range user.GetRoles() {
-		permissions = append(permissions, role.GetPermissions()...)
-	}
-
-	return permissions
+	return set.Permissions()
 }
 
+// HasPermission reports whether the user of ctx may perform operation on entity. The System
+// principal may perform every operation. Users whose roles extend themselves have no permissions.
 func HasPermission(ctx context.Context, operation Operation, entity common.EntityName) bool {
-	permissions := getFullPermissionListFromContext(ctx)
-	for _, p := range permissions {
-		if p.GetEntity() == entity && p.GetOperation() == operation {
-			return true
-		}
+	if Principal(ctx) == System {
+		return true
 	}
-	return false
+	set, err := effective(ctx)
+	return err == nil && set.Has(operation, entity)
 }
 
+// PermissionDenied returns the apperror.ErrForbidden error for a user without permission for the operation.
 func PermissionDenied(ctx context.Context, operation Operation, entity common.EntityName) error {
-	return fmt.Errorf("permission denied: %s %s for user %s", operation, entity, GetUser(ctx).GetID())
+	return apperror.Forbidden("permission denied: %s %s for user %s", operation, entity, Principal(ctx).GetName())
 }
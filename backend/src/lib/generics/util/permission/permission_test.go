@@ -0,0 +1,103 @@
+package permission
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cmo7/folly4/src/lib/generics/apperror"
+	"github.com/cmo7/folly4/src/lib/generics/common"
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+type account struct {
+	id    uuid.UUID
+	roles []Role
+}
+
+func (a *account) GetID() uuid.UUID                 { return a.id }
+func (a *account) SetID(id uuid.UUID)               { a.id = id }
+func (a *account) GetName() string                  { return "alice" }
+func (a *account) GetEntityName() common.EntityName { return "Account" }
+func (a *account) GetRoles() []Role                 { return a.roles }
+func (a *account) SetRoles(roles []Role)            { a.roles = roles }
+func (a *account) GetPermissions() []Permission     { return nil }
+func (a *account) SetPermissions(_ []Permission)    {}
+
+func withPublic(t *testing.T, permissions ...string) {
+	viper.Set("permission.public", permissions)
+	ReloadPublicRole()
+	t.Cleanup(func() {
+		viper.Set("permission.public", []string{})
+		ReloadPublicRole()
+	})
+}
+
+func TestAccessorsWithoutUser(t *testing.T) {
+	ctx := context.Background()
+	_, ok := GetUser(ctx)
+	assert.False(t, ok)
+	_, ok = GetRoles(ctx)
+	assert.False(t, ok)
+	_, ok = GetPermissions(ctx)
+	assert.False(t, ok)
+	assert.Equal(t, Anonymous, Principal(ctx))
+
+	alice := &account{id: uuid.New()}
+	user, ok := GetUser(WithUser(ctx, alice))
+	assert.True(t, ok)
+	assert.Equal(t, alice, user)
+}
+
+func TestAnonymousHasPublicPermissions(t *testing.T) {
+	ctx := context.Background()
+	assert.False(t, HasPermission(ctx, OperationRead, "User"))
+
+	withPublic(t, "User:READ", "not a permission", "Role:SMILE")
+	assert.True(t, HasPermission(ctx, OperationRead, "User"))
+	assert.False(t, HasPermission(ctx, OperationUpdate, "User"))
+	assert.False(t, HasPermission(ctx, OperationRead, "Role"))
+	assert.Equal(t, []string{"User:READ"}, names(EffectivePermissions(ctx)))
+
+	// Users have the public permissions too.
+	writer := &role{name: "writer", permissions: []Permission{NewPermission("User", OperationUpdate)}}
+	alice := WithUser(ctx, &account{id: uuid.New(), roles: []Role{writer}})
+	assert.True(t, HasPermission(alice, OperationRead, "User"))
+	assert.True(t, HasPermission(alice, OperationUpdate, "User"))
+	assert.Equal(t, []string{"User:UPDATE", "User:READ"}, names(EffectivePermissions(alice)))
+}
+
+func TestSystemPassesEveryCheck(t *testing.T) {
+	ctx := WithSystem(context.Background())
+	assert.True(t, HasPermission(ctx, OperationDelete, "User"))
+	assert.Equal(t, SystemID, Principal(ctx).GetID())
+	assert.Nil(t, System.GetRoles())
+}
+
+func TestPermissionDenied(t *testing.T) {
+	err := PermissionDenied(context.Background(), OperationRead, "User")
+	assert.True(t, errors.Is(err, apperror.ErrForbidden))
+	assert.Contains(t, err.Error(), "anonymous")
+}
+
+func TestParsePermission(t *testing.T) {
+	p, err := ParsePermission(" User:read ")
+	assert.Nil(t, err)
+	assert.Equal(t, common.EntityName("User"), p.GetEntity())
+	assert.Equal(t, OperationRead, p.GetOperation())
+
+	for _, invalid := range []string{"", "User", ":READ", "User:SMILE", "User:"} {
+		_, err := ParsePermission(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func names(permissions []Permission) []string {
+	result := []string{}
+	for _, p := range permissions {
+		result = append(result, p.ToString())
+	}
+	return result
+}
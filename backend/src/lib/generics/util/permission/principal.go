@@ -0,0 +1,134 @@
+package permission
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/cmo7/folly4/src/lib/generics/common"
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	// Everyone, anonymous or not, has the permissions of the public role, as "Entity:OPERATION", e.g.
+	//
+	//	[permission]
+	//	public = ["User:READ"]
+	viper.SetDefault("permission.public", []string{})
+}
+
+// SystemID is the ID the System principal is recorded with in audit logs.
+var SystemID = uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+var (
+	// Anonymous is the principal of requests without a user. It has the public role.
+	Anonymous User = &principal{id: uuid.Nil, name: "anonymous", roles: func() []Role { return []Role{PublicRole()} }}
+	// System is the principal of the CLI and background jobs. It passes every permission check.
+	System User = &principal{id: SystemID, name: "system", roles: func() []Role { return nil }}
+)
+
+// principal is a user that is not stored, such as Anonymous and System.
+type principal struct {
+	id    uuid.UUID
+	name  string
+	roles func() []Role
+}
+
+func (p *principal) GetID() uuid.UUID                 { return p.id }
+func (p *principal) SetID(_ uuid.UUID)                {}
+func (p *principal) GetName() string                  { return p.name }
+func (p *principal) GetEntityName() common.EntityName { return "User" }
+func (p *principal) GetRoles() []Role                 { return p.roles() }
+func (p *principal) SetRoles(_ []Role)                {}
+func (p *principal) GetPermissions() []Permission     { return nil }
+func (p *principal) SetPermissions(_ []Permission)    {}
+
+// role is a role that is not stored, such as the public role.
+type role struct {
+	name        string
+	permissions []Permission
+}
+
+func (r *role) GetID() uuid.UUID                        { return uuid.Nil }
+func (r *role) SetID(_ uuid.UUID)                       {}
+func (r *role) GetName() string                         { return r.name }
+func (r *role) GetEntityName() common.EntityName        { return "Role" }
+func (r *role) GetPermissions() []Permission            { return r.permissions }
+func (r *role) SetPermissions(permissions []Permission) { r.permissions = permissions }
+func (r *role) GetParents() []Role                      { return nil }
+
+// grant is a permission that is not stored, such as those of the public role.
+type grant struct {
+	entity    common.EntityName
+	operation Operation
+}
+
+// NewPermission returns the permission of operation on entity.
+func NewPermission(entity common.EntityName, operation Operation) Permission {
+	return &grant{entity: entity, operation: operation}
+}
+
+func (g *grant) GetID() uuid.UUID                   { return uuid.Nil }
+func (g *grant) SetID(_ uuid.UUID)                  {}
+func (g *grant) GetName() string                    { return g.ToString() }
+func (g *grant) GetEntityName() common.EntityName   { return "Permission" }
+func (g *grant) GetEntity() common.EntityName       { return g.entity }
+func (g *grant) SetEntity(entity common.EntityName) { g.entity = entity }
+func (g *grant) GetOperation() Operation            { return g.operation }
+func (g *grant) SetOperation(operation Operation)   { g.operation = operation }
+func (g *grant) ToString() string                   { return g.entity.String() + ":" + g.operation.String() }
+
+// ParsePermission returns the permission s describes as "Entity:OPERATION". Either may be the
+// Wildcard.
+func ParsePermission(s string) (Permission, error) {
+	entity, operation, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok || entity == "" {
+		return nil, fmt.Errorf("invalid permission %q, expected Entity:OPERATION", s)
+	}
+	for _, known := range Operation("").EnumValues() {
+		if strings.EqualFold(operation, known) {
+			return NewPermission(common.EntityName(entity), Operation(known)), nil
+		}
+	}
+	return nil, fmt.Errorf("invalid permission %q, unknown operation %q", s, operation)
+}
+
+// publicRole is the public role, parsed from the configuration when first needed.
+var publicRole struct {
+	sync.Mutex
+	role Role
+}
+
+// PublicRole returns the role with the configured public permissions, parsed once. Invalid
+// permissions are logged and left out.
+func PublicRole() Role {
+	publicRole.Lock()
+	defer publicRole.Unlock()
+	if publicRole.role == nil {
+		publicRole.role = parsePublicRole()
+	}
+	return publicRole.role
+}
+
+// ReloadPublicRole parses the public permissions of the configuration again, after it changed.
+func ReloadPublicRole() {
+	publicRole.Lock()
+	publicRole.role = parsePublicRole()
+	publicRole.Unlock()
+	Invalidate()
+}
+
+func parsePublicRole() Role {
+	public := &role{name: "public", permissions: []Permission{}}
+	for _, s := range viper.GetStringSlice("permission.public") {
+		p, err := ParsePermission(s)
+		if err != nil {
+			log.Printf("permission: public role: %v", err)
+			continue
+		}
+		public.permissions = append(public.permissions, p)
+	}
+	return public
+}
@@ -0,0 +1,243 @@
+package permission
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/cmo7/folly4/src/lib/generics/common"
+	"github.com/google/uuid"
+)
+
+// Wildcard matches every entity, as the entity of a permission, or every operation, as its
+// operation: "*:READ", "User:*" and "*:*".
+const Wildcard = "*"
+
+// Implications are the operations implied by each operation. A permission for an operation is a
+// permission for the operations it implies too.
+var Implications = map[Operation][]Operation{
+	OperationUpdate: {OperationRead},
+	OperationDelete: {OperationRead},
+}
+
+// ErrRoleCycle is returned for roles that extend themselves, directly or through their parents.
+var ErrRoleCycle = errors.New("role cycle")
+
+// Set is a set of effective permissions, with the operations they imply, which may have
+// wildcards.
+type Set struct {
+	grants      map[common.EntityName]map[Operation]bool
+	permissions []Permission
+}
+
+// NewSet returns the set of permissions and the permissions they imply.
+func NewSet(permissions ...Permission) *Set {
+	s := &Set{grants: map[common.EntityName]map[Operation]bool{}}
+	for _, p := range permissions {
+		s.Add(p)
+	}
+	return s
+}
+
+// Add adds p, and the permissions it implies, to the set.
+func (s *Set) Add(p Permission) {
+	if s.grant(p.GetEntity(), p.GetOperation()) {
+		s.permissions = append(s.permissions, p)
+	}
+	for _, implied := range s.implied(p.GetOperation(), map[Operation]bool{}) {
+		if s.grant(p.GetEntity(), implied) {
+			s.permissions = append(s.permissions, NewPermission(p.GetEntity(), implied))
+		}
+	}
+}
+
+// grant records operation on entity, and reports whether it was new.
+func (s *Set) grant(entity common.EntityName, operation Operation) bool {
+	if s.grants[entity] == nil {
+		s.grants[entity] = map[Operation]bool{}
+	}
+	if s.grants[entity][operation] {
+		return false
+	}
+	s.grants[entity][operation] = true
+	return true
+}
+
+// implied returns the operations operation implies, transitively.
+func (s *Set) implied(operation Operation, seen map[Operation]bool) []Operation {
+	operations := []Operation{}
+	for _, implied := range Implications[operation] {
+		if !seen[implied] {
+			seen[implied] = true
+			operations = append(operations, implied)
+			operations = append(operations, s.implied(implied, seen)...)
+		}
+	}
+	return operations
+}
+
+// Has reports whether the set permits operation on entity, by a permission for them or for the
+// Wildcard.
+func (s *Set) Has(operation Operation, entity common.EntityName) bool {
+	for _, e := range []common.EntityName{entity, Wildcard} {
+		if s.grants[e][operation] || s.grants[e][OperationAll] {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions returns the permissions of the set, once each, in the order they were added.
+func (s *Set) Permissions() []Permission {
+	return append([]Permission{}, s.permissions...)
+}
+
+// Resolve returns the set of permissions, and of the permissions of roles and of their parents.
+// It returns ErrRoleCycle if a role extends itself.
+func Resolve(permissions []Permission, roles []Role) (*Set, error) {
+	r := resolver{set: NewSet(permissions...), visited: map[string]bool{}}
+	for _, role := range roles {
+		if err := r.visit(role); err != nil {
+			return nil, err
+		}
+	}
+	return r.set, nil
+}
+
+// resolver walks the role graph depth first. Roles on the path being walked are visited but not
+// done yet, so meeting one of them again is a cycle.
+type resolver struct {
+	set     *Set
+	visited map[string]bool // Done once true.
+	path    []string
+}
+
+func (r *resolver) visit(role Role) error {
+	key := roleKey(role)
+	r.path = append(r.path, role.GetName())
+	defer func() { r.path = r.path[:len(r.path)-1] }()
+	if done, ok := r.visited[key]; ok {
+		if done {
+			return nil
+		}
+		return fmt.Errorf("%w: %s", ErrRoleCycle, strings.Join(r.path, " -> "))
+	}
+
+	r.visited[key] = false
+	for _, p := range role.GetPermissions() {
+		r.set.Add(p)
+	}
+	for _, parent := range role.GetParents() {
+		if err := r.visit(parent); err != nil {
+			return err
+		}
+	}
+	r.visited[key] = true
+	return nil
+}
+
+// roleKey identifies role by its ID, or by its name for roles that are not stored.
+func roleKey(role Role) string {
+	if role.GetID() != uuid.Nil {
+		return role.GetID().String()
+	}
+	return "name:" + role.GetName()
+}
+
+// maxCached is the number of principals whose permissions are cached. The cache is emptied when
+// it is full.
+const maxCached = 4096
+
+// cache holds the effective permission sets of principals, resolved once per version of the roles
+// and permissions. Invalidate moves to a new version.
+var cache = struct {
+	sync.Mutex
+	version uint64
+	sets    map[cacheKey]cached
+}{sets: map[cacheKey]cached{}}
+
+// cacheKey identifies a principal, the roles and permissions of their context, and the version
+// of the roles and permissions.
+type cacheKey struct {
+	principal uuid.UUID
+	context   string
+	version   uint64
+}
+
+type cached struct {
+	set *Set
+	err error
+}
+
+// Invalidate discards the cached permissions of every principal. It must be called when roles or
+// permissions change, as the cache would keep the permissions they had.
+func Invalidate() {
+	cache.Lock()
+	defer cache.Unlock()
+	cache.version++
+	clear(cache.sets)
+}
+
+// effective returns the effective permission set of the principal of ctx: their permissions and
+// those of the context, the permissions of their roles and of the roles of the context, with their
+// parents, and the permissions of the public role. Principals without an ID are not cached, as
+// nothing tells them apart.
+func effective(ctx context.Context) (*Set, error) {
+	user := Principal(ctx)
+	if user.GetID() == uuid.Nil {
+		return resolveContext(ctx)
+	}
+
+	cache.Lock()
+	key := cacheKey{principal: user.GetID(), context: contextKey(ctx), version: cache.version}
+	entry, ok := cache.sets[key]
+	cache.Unlock()
+	if ok {
+		return entry.set, entry.err
+	}
+
+	set, err := resolveContext(ctx)
+	cache.Lock()
+	defer cache.Unlock()
+	if key.version == cache.version {
+		if len(cache.sets) >= maxCached {
+			clear(cache.sets)
+		}
+		cache.sets[key] = cached{set: set, err: err}
+	}
+	return set, err
+}
+
+// contextKey identifies the roles and permissions of ctx, which are added to those of the principal.
+func contextKey(ctx context.Context) string {
+	var b strings.Builder
+	roles, _ := GetRoles(ctx)
+	for _, role := range roles {
+		b.WriteString(roleKey(role))
+		b.WriteByte(',')
+	}
+	b.WriteByte(';')
+	permissions, _ := GetPermissions(ctx)
+	for _, p := range permissions {
+		b.WriteString(p.ToString())
+		b.WriteByte(',')
+	}
+	return b.String()
+}
+
+func resolveContext(ctx context.Context) (*Set, error) {
+	user := Principal(ctx)
+	permissions, _ := GetPermissions(ctx)
+	permissions = append(append([]Permission{}, permissions...), user.GetPermissions()...)
+	roles, _ := GetRoles(ctx)
+	roles = append(append(append([]Role{}, roles...), user.GetRoles()...), PublicRole())
+
+	set, err := Resolve(permissions, roles)
+	if err != nil {
+		log.Printf("permission: user %s has no permissions: %v", user.GetName(), err)
+	}
+	return set, err
+}
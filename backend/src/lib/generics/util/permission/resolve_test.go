@@ -0,0 +1,168 @@
+package permission
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cmo7/folly4/src/lib/generics/common"
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+type inheritingRole struct {
+	role
+	id      uuid.UUID
+	parents []Role
+}
+
+func (r *inheritingRole) GetID() uuid.UUID   { return r.id }
+func (r *inheritingRole) GetParents() []Role { return r.parents }
+
+func newRole(name string, permissions ...string) *inheritingRole {
+	r := &inheritingRole{role: role{name: name}, id: uuid.New()}
+	for _, s := range permissions {
+		p, err := ParsePermission(s)
+		if err != nil {
+			panic(err)
+		}
+		r.permissions = append(r.permissions, p)
+	}
+	return r
+}
+
+// countingUser counts how many times its roles are read.
+type countingUser struct {
+	account
+	reads int
+}
+
+func (u *countingUser) GetRoles() []Role {
+	u.reads++
+	return u.roles
+}
+
+func TestWildcards(t *testing.T) {
+	for _, tt := range []struct {
+		permission string
+		operation  Operation
+		entity     common.EntityName
+		expected   bool
+	}{
+		{"User:READ", OperationRead, "User", true},
+		{"User:READ", OperationRead, "Role", false},
+		{"*:READ", OperationRead, "Role", true},
+		{"*:READ", OperationCreate, "Role", false},
+		{"User:*", OperationDelete, "User", true},
+		{"User:*", OperationDelete, "Role", false},
+		{"*:*", OperationApprove, "Role", true},
+	} {
+		p, err := ParsePermission(tt.permission)
+		assert.Nil(t, err)
+		assert.Equal(t, tt.expected, NewSet(p).Has(tt.operation, tt.entity), tt.permission, tt.operation, tt.entity)
+	}
+}
+
+func TestImplications(t *testing.T) {
+	set := NewSet(NewPermission("User", OperationUpdate), NewPermission("User", OperationRead))
+	assert.True(t, set.Has(OperationRead, "User"))
+	assert.False(t, set.Has(OperationDelete, "User"))
+	assert.Equal(t, []string{"User:UPDATE", "User:READ"}, names(set.Permissions()))
+
+	set = NewSet(NewPermission(Wildcard, OperationDelete))
+	assert.True(t, set.Has(OperationRead, "Role"))
+	assert.False(t, set.Has(OperationUpdate, "Role"))
+}
+
+func TestResolveInheritance(t *testing.T) {
+	viewer := newRole("viewer", "*:READ")
+	editor := newRole("editor", "User:UPDATE")
+	editor.parents = []Role{viewer}
+	auditor := newRole("auditor", "Audit:READ")
+	auditor.parents = []Role{viewer}
+	admin := newRole("admin", "Role:CREATE")
+	admin.parents = []Role{editor, auditor}
+
+	set, err := Resolve(nil, []Role{admin})
+	assert.Nil(t, err)
+	assert.True(t, set.Has(OperationCreate, "Role"))
+	assert.True(t, set.Has(OperationUpdate, "User"))
+	assert.True(t, set.Has(OperationRead, "Session"))
+	assert.False(t, set.Has(OperationDelete, "User"))
+	assert.Equal(t, []string{"Role:CREATE", "User:UPDATE", "User:READ", "*:READ", "Audit:READ"}, names(set.Permissions()))
+}
+
+func TestResolveCycles(t *testing.T) {
+	viewer := newRole("viewer", "*:READ")
+	editor := newRole("editor", "User:UPDATE")
+	admin := newRole("admin")
+	admin.parents = []Role{editor}
+	editor.parents = []Role{viewer}
+	viewer.parents = []Role{admin}
+
+	_, err := Resolve(nil, []Role{admin})
+	assert.True(t, errors.Is(err, ErrRoleCycle))
+	assert.Contains(t, err.Error(), "admin -> editor -> viewer -> admin")
+
+	self := newRole("self", "User:READ")
+	self.parents = []Role{self}
+	_, err = Resolve(nil, []Role{self})
+	assert.True(t, errors.Is(err, ErrRoleCycle))
+
+	// Users whose roles extend themselves have no permissions.
+	ctx := WithUser(context.Background(), &account{id: uuid.New(), roles: []Role{admin}})
+	assert.False(t, HasPermission(ctx, OperationRead, "User"))
+	assert.Empty(t, EffectivePermissions(ctx))
+}
+
+func TestEffectivePermissionsAreCached(t *testing.T) {
+	user := &countingUser{account: account{id: uuid.New(), roles: []Role{newRole("viewer", "*:READ")}}}
+	ctx := WithUser(context.Background(), user)
+	for i := 0; i < 3; i++ {
+		assert.True(t, HasPermission(ctx, OperationRead, "User"))
+		assert.False(t, HasPermission(ctx, OperationUpdate, "User"))
+	}
+	assert.Equal(t, 1, user.reads)
+
+	// Changing the roles of the context resolves the permissions again.
+	ctx = WithRoles(ctx, []Role{newRole("editor", "User:UPDATE")})
+	assert.True(t, HasPermission(ctx, OperationUpdate, "User"))
+	assert.Equal(t, 2, user.reads)
+}
+
+func TestEffectivePermissionsAreSharedByContexts(t *testing.T) {
+	viewer := newRole("viewer", "*:READ")
+	user := &countingUser{account: account{id: uuid.New(), roles: []Role{viewer}}}
+	for i := 0; i < 3; i++ {
+		ctx := WithRoles(WithUser(context.Background(), user), []Role{viewer})
+		assert.True(t, HasPermission(ctx, OperationRead, "User"))
+	}
+	assert.Equal(t, 1, user.reads)
+
+	// Changes of roles or permissions discard the cache.
+	viewer.SetPermissions([]Permission{NewPermission("User", OperationUpdate)})
+	Invalidate()
+	ctx := WithRoles(WithUser(context.Background(), user), []Role{viewer})
+	assert.True(t, HasPermission(ctx, OperationUpdate, "User"))
+	assert.Equal(t, 2, user.reads)
+
+	// Users without an ID are not cached.
+	anonymous := &countingUser{account: account{roles: []Role{viewer}}}
+	ctx = WithUser(context.Background(), anonymous)
+	assert.True(t, HasPermission(ctx, OperationUpdate, "User"))
+	assert.True(t, HasPermission(ctx, OperationUpdate, "User"))
+	assert.Equal(t, 2, anonymous.reads)
+}
+
+func TestPublicRoleIsParsedOnce(t *testing.T) {
+	withPublic(t, "User:READ")
+	assert.Same(t, PublicRole(), PublicRole())
+	assert.True(t, HasPermission(context.Background(), OperationRead, "User"))
+
+	// The configuration is parsed again on reload only.
+	viper.Set("permission.public", []string{"User:UPDATE"})
+	assert.False(t, HasPermission(context.Background(), OperationUpdate, "User"))
+	ReloadPublicRole()
+	assert.True(t, HasPermission(context.Background(), OperationUpdate, "User"))
+}
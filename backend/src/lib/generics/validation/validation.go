@@ -0,0 +1,297 @@
+// Package validation validates entities before they are stored, with the rules of the validate
+// struct tags of their fields and, for rules that involve several fields, their own Validate
+// method:
+//
+//	type UserEntity struct {
+//		Username string `validate:"required,min=3"`
+//		Email    string `validate:"required,email"`
+//	}
+//
+// The problems found are returned as an apperror.ValidationError, one FieldError per field, named
+// by the json name of the field or, without one, its Go name.
+package validation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/cmo7/folly4/src/lib/generics/apperror"
+)
+
+// Tag is the struct tag with the comma separated rules of a field:
+//   - required: the value is not empty, nil or blank.
+//   - email: the value is an email address, without a display name.
+//   - min=<n>, max=<n>: bounds of numbers, of the length of strings in characters, and of the
+//     number of items of slices and maps.
+//   - oneof=<a b c>: the value is one of the space separated values.
+//
+// Rules other than required do not apply to empty values, so optional fields can be left empty.
+const Tag = "validate"
+
+// Validator is implemented by entities with rules the tags cannot express. Validate is only
+// called when the fields satisfy the rules of their tags.
+type Validator interface {
+	Validate(ctx context.Context) error
+}
+
+// check returns the problem with a non empty value, if any.
+type check func(v reflect.Value) (string, bool)
+
+// fieldRules are the rules of a field of a struct.
+type fieldRules struct {
+	name     string // Name of the field in FieldErrors.
+	goName   string
+	index    []int
+	required bool
+	checks   []check
+}
+
+// The rules of a struct type are parsed once.
+var rules sync.Map // map[reflect.Type]rulesOrError
+
+type rulesOrError struct {
+	fields []fieldRules
+	err    error
+}
+
+// Validate checks the fields of the struct v points to against the rules of their tags and, when
+// they satisfy them and v is a Validator, v itself. It returns nil or an error that matches
+// apperror.ErrValidation: errors of Validate that do not are wrapped in one. Invalid tags are
+// reported as other errors.
+func Validate(ctx context.Context, v interface{}) error {
+	problems, err := Struct(v)
+	if err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return apperror.Validation(problems...)
+	}
+	validator, ok := v.(Validator)
+	if !ok {
+		return nil
+	}
+	if err := validator.Validate(ctx); err != nil {
+		if errors.Is(err, apperror.ErrValidation) {
+			return err
+		}
+		return apperror.New(apperror.ErrValidation, err, "%s", err.Error())
+	}
+	return nil
+}
+
+// Struct returns the problems of the fields of the struct v, or the struct v points to, with the
+// rules of their tags.
+func Struct(v interface{}) ([]apperror.FieldError, error) {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	if value.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("validation: %T is not a struct", v)
+	}
+	fields, err := rulesOf(value.Type())
+	if err != nil {
+		return nil, err
+	}
+
+	problems := []apperror.FieldError{}
+	for _, field := range fields {
+		// Fields promoted through nil embedded pointers are empty.
+		fieldValue, err := value.FieldByIndexErr(field.index)
+		if err != nil {
+			fieldValue = reflect.Value{}
+		}
+		if message, ok := field.validate(fieldValue); !ok {
+			problems = append(problems, apperror.FieldError{Field: field.name, Message: message})
+		}
+	}
+	return problems, nil
+}
+
+// Field checks value against the rules of the field called name of the struct v, or the struct v
+// points to, for updates of a single field. The field may be named by its Go name, json name or
+// column name. Fields the struct does not have are not validated.
+func Field(v interface{}, name string, value interface{}) error {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return fmt.Errorf("validation: %T is not a struct", v)
+	}
+	fields, err := rulesOf(t)
+	if err != nil {
+		return err
+	}
+	for _, field := range fields {
+		// Column names are the snake_case Go names.
+		if name != field.name && !strings.EqualFold(strings.ReplaceAll(name, "_", ""), field.goName) {
+			continue
+		}
+		if message, ok := field.validate(reflect.ValueOf(value)); !ok {
+			return apperror.Validation(apperror.FieldError{Field: field.name, Message: message})
+		}
+		return nil
+	}
+	return nil
+}
+
+// validate checks the value of the field, which is invalid for missing values.
+func (f *fieldRules) validate(v reflect.Value) (string, bool) {
+	for v.IsValid() && (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) && !v.IsNil() {
+		v = v.Elem()
+	}
+	if isEmpty(v) {
+		if f.required {
+			return "is required", false
+		}
+		return "", true
+	}
+	for _, check := range f.checks {
+		if message, ok := check(v); !ok {
+			return message, false
+		}
+	}
+	return "", true
+}
+
+func isEmpty(v reflect.Value) bool {
+	if !v.IsValid() {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(v.String()) == ""
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return v.IsNil()
+	}
+	return v.IsZero()
+}
+
+// rulesOf returns the rules of the fields of the struct type t, promoted fields included.
+func rulesOf(t reflect.Type) ([]fieldRules, error) {
+	if cached, ok := rules.Load(t); ok {
+		return cached.(rulesOrError).fields, cached.(rulesOrError).err
+	}
+
+	fields := []fieldRules{}
+	var err error
+	for _, field := range reflect.VisibleFields(t) {
+		tag, ok := field.Tag.Lookup(Tag)
+		if !ok || !field.IsExported() {
+			continue
+		}
+		parsed := fieldRules{
+			name:   publicName(field),
+			goName: field.Name,
+			index:  field.Index,
+		}
+		if parsed.required, parsed.checks, err = parseTag(tag); err != nil {
+			err = fmt.Errorf("validation: field %s of %s: %w", field.Name, t, err)
+			break
+		}
+		fields = append(fields, parsed)
+	}
+	if err != nil {
+		fields = nil
+	}
+	rules.Store(t, rulesOrError{fields: fields, err: err})
+	return fields, err
+}
+
+// parseTag parses the rules of a validate tag.
+func parseTag(tag string) (bool, []check, error) {
+	required := false
+	checks := []check{}
+	for _, option := range strings.Split(tag, ",") {
+		name, param, hasParam := strings.Cut(strings.TrimSpace(option), "=")
+		switch {
+		case name == "":
+			continue
+		case name == "required" && !hasParam:
+			required = true
+		case name == "email" && !hasParam:
+			checks = append(checks, checkEmail)
+		case (name == "min" || name == "max") && hasParam:
+			bound, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				return false, nil, fmt.Errorf("invalid %s rule %q", name, param)
+			}
+			checks = append(checks, checkBound(name == "min", bound))
+		case name == "oneof" && hasParam:
+			checks = append(checks, checkOneOf(strings.Fields(param)))
+		default:
+			return false, nil, fmt.Errorf("unknown rule %q", option)
+		}
+	}
+	return required, checks, nil
+}
+
+func checkEmail(v reflect.Value) (string, bool) {
+	const message = "must be a valid email address"
+	if v.Kind() != reflect.String {
+		return message, false
+	}
+	address, err := mail.ParseAddress(v.String())
+	if err != nil || address.Address != v.String() {
+		return message, false
+	}
+	return "", true
+}
+
+// checkBound returns the check of the lower bound, if min, or the upper bound of a value.
+func checkBound(min bool, bound float64) check {
+	word := "most"
+	if min {
+		word = "least"
+	}
+	return func(v reflect.Value) (string, bool) {
+		var size float64
+		format := "must be at %s %v"
+		switch v.Kind() {
+		case reflect.String:
+			size, format = float64(utf8.RuneCountInString(v.String())), "must be at %s %v characters long"
+		case reflect.Slice, reflect.Array, reflect.Map:
+			size, format = float64(v.Len()), "must have at %s %v items"
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			size = float64(v.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			size = float64(v.Uint())
+		case reflect.Float32, reflect.Float64:
+			size = v.Float()
+		default:
+			return fmt.Sprintf(format, word, bound), false
+		}
+		if (min && size < bound) || (!min && size > bound) {
+			return fmt.Sprintf(format, word, bound), false
+		}
+		return "", true
+	}
+}
+
+func checkOneOf(values []string) check {
+	message := "must be one of " + strings.Join(values, ", ")
+	return func(v reflect.Value) (string, bool) {
+		value := fmt.Sprint(v.Interface())
+		for _, allowed := range values {
+			if value == allowed {
+				return "", true
+			}
+		}
+		return message, false
+	}
+}
+
+// publicName returns the json name of a field or, without one, its Go name.
+func publicName(field reflect.StructField) string {
+	if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "" && name != "-" {
+		return name
+	}
+	return field.Name
+}
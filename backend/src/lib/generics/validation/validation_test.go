@@ -0,0 +1,114 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cmo7/folly4/src/lib/generics/apperror"
+	"github.com/stretchr/testify/assert"
+)
+
+type Base struct {
+	Code string `validate:"required"`
+}
+
+type account struct {
+	Base
+	Username string   `json:"username" validate:"required,min=3,max=8"`
+	Email    string   `json:"email" validate:"required,email"`
+	Nickname *string  `validate:"min=2"`
+	Age      int      `validate:"max=130"`
+	Tags     []string `validate:"max=2"`
+	Plan     string   `validate:"oneof=free pro"`
+	Password string
+}
+
+type team struct {
+	Name    string `validate:"required"`
+	Members int
+}
+
+func (t *team) Validate(ctx context.Context) error {
+	if t.Members > 10 {
+		return errors.New("teams have 10 members at most")
+	}
+	if t.Members < 0 {
+		return apperror.Validation(apperror.FieldError{Field: "Members", Message: "must not be negative"})
+	}
+	return nil
+}
+
+func TestValidate(t *testing.T) {
+	ctx := context.Background()
+	short := "x"
+
+	assert.Nil(t, Validate(ctx, &account{Base: Base{Code: "A1"}, Username: "alice", Email: "alice@example.com"}))
+
+	err := Validate(ctx, &account{
+		Username: "al",
+		Email:    "Alice <alice@example.com>",
+		Nickname: &short,
+		Age:      200,
+		Tags:     []string{"a", "b", "c"},
+		Plan:     "gold",
+	})
+	assert.True(t, errors.Is(err, apperror.ErrValidation))
+	assert.Equal(t, []apperror.FieldError{
+		{Field: "Code", Message: "is required"},
+		{Field: "username", Message: "must be at least 3 characters long"},
+		{Field: "email", Message: "must be a valid email address"},
+		{Field: "Nickname", Message: "must be at least 2 characters long"},
+		{Field: "Age", Message: "must be at most 130"},
+		{Field: "Tags", Message: "must have at most 2 items"},
+		{Field: "Plan", Message: "must be one of free, pro"},
+	}, apperror.Fields(err))
+
+	err = Validate(ctx, &account{Base: Base{Code: "A1"}, Username: "   ", Email: "alice@example.com"})
+	assert.Equal(t, []apperror.FieldError{{Field: "username", Message: "is required"}}, apperror.Fields(err))
+}
+
+func TestValidateCallsValidator(t *testing.T) {
+	ctx := context.Background()
+
+	assert.Nil(t, Validate(ctx, &team{Name: "core", Members: 3}))
+
+	// The Validate method is not called for teams with invalid fields.
+	err := Validate(ctx, &team{Members: 11})
+	assert.Equal(t, []apperror.FieldError{{Field: "Name", Message: "is required"}}, apperror.Fields(err))
+
+	err = Validate(ctx, &team{Name: "core", Members: 11})
+	assert.True(t, errors.Is(err, apperror.ErrValidation))
+	assert.Equal(t, "teams have 10 members at most", err.Error())
+
+	err = Validate(ctx, &team{Name: "core", Members: -1})
+	assert.Equal(t, []apperror.FieldError{{Field: "Members", Message: "must not be negative"}}, apperror.Fields(err))
+}
+
+func TestField(t *testing.T) {
+	assert.Nil(t, Field(&account{}, "username", "alice"))
+	assert.Nil(t, Field(&account{}, "Password", ""))
+	assert.Nil(t, Field(&account{}, "unknown", 1))
+
+	for _, name := range []string{"email", "Email"} {
+		err := Field(&account{}, name, "alice")
+		assert.Equal(t, []apperror.FieldError{{Field: "email", Message: "must be a valid email address"}}, apperror.Fields(err))
+	}
+	err := Field(&account{}, "code", nil)
+	assert.Equal(t, []apperror.FieldError{{Field: "Code", Message: "is required"}}, apperror.Fields(err))
+}
+
+func TestInvalidTags(t *testing.T) {
+	type unknownRule struct {
+		Name string `validate:"required,lowercase"`
+	}
+	type invalidBound struct {
+		Name string `validate:"min=three"`
+	}
+
+	for _, v := range []interface{}{&unknownRule{}, &invalidBound{}} {
+		err := Validate(context.Background(), v)
+		assert.NotNil(t, err)
+		assert.False(t, errors.Is(err, apperror.ErrValidation))
+	}
+}
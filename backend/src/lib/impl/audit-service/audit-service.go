@@ -3,50 +3,58 @@ package auditservice
 import (
 	"context"
 	"encoding/json"
+	"reflect"
+	"strings"
 
 	"github.com/cmo7/folly4/src/lib/generics/common"
 	"github.com/cmo7/folly4/src/lib/generics/repository"
 	"github.com/cmo7/folly4/src/lib/generics/service"
 	"github.com/cmo7/folly4/src/lib/generics/util/audit"
+	"github.com/cmo7/folly4/src/lib/generics/util/permission"
+	"github.com/google/uuid"
 )
 
 // AuditService is a service that provides audit functionality. It is a wrapper around a CrudService.
 // It adds hooks to the CrudService to create an audit log for each action.
 // Its generic types are E, which is the entity type, and A, which is the audit type.
 // audit.Audit is an interface that represents an audit log. It is expected to be implemented by the user.
+// The values of the redacted fields, such as password hashes, are left out of the audit logs.
 type AuditService[E common.Entity, A audit.Audit] struct {
 	service.CrudServiceWithHooks[E]                          // Embed the CrudServiceWithHooks to inherit its methods.
 	auditRepository                 repository.Repository[A] // The repository to store the audit logs.
+	redactedFields                  []string                 // The Go names of the fields whose values are not logged.
 }
 
 func NewAuditService[E common.Entity, A audit.Audit](
 	crudService service.CrudService[E],
 	auditRepository repository.Repository[A],
+	redactedFields ...string,
 ) *AuditService[E, A] {
 	service := &AuditService[E, A]{
 		CrudServiceWithHooks: service.NewCrudServiceWithHooks(crudService),
 		auditRepository:      auditRepository,
+		redactedFields:       redactedFields,
 	}
 
 	// Add hooks to create audit logs for each action.
 	service.AddBeforeCreateHook(func(ctx context.Context, payload E) error {
-		a := audit.GetAudit[A](ctx)
+		a := auditEntry[A](ctx)
 		a.SetAction(audit.AuditActionCreate)
 		a.SetEntity(payload.GetEntityName())
 		a.SetEntityID(payload.GetID())
-		a.SetNewValue(serializeEntity(payload))
+		a.SetNewValue(service.serialize(payload))
 		return nil
 	})
 
 	service.AddAfterCreateHook(func(ctx context.Context, payload E) error {
-		a := audit.GetAudit[A](ctx)
+		a := auditEntry[A](ctx)
 		a.SetActionResult(audit.AuditActionResultSuccess)
 		_, err := service.auditRepository.Create(ctx, a)
 		return err
 	})
 
 	service.AddOnCreateFailHook(func(ctx context.Context, err error, failedEntity E) error {
-		a := audit.GetAudit[A](ctx)
+		a := auditEntry[A](ctx)
 		a.SetActionResult(audit.AuditActionResultFailure)
 		a.SetMessage(err.Error())
 		_, err = service.auditRepository.Create(ctx, a)
@@ -54,24 +62,24 @@ func NewAuditService[E common.Entity, A audit.Audit](
 	})
 
 	service.AddBeforeUpdateHook(func(ctx context.Context, payload E) error {
-		a := audit.GetAudit[A](ctx)
+		a := auditEntry[A](ctx)
 		a.SetAction(audit.AuditActionUpdate)
 		a.SetEntity(payload.GetEntityName())
 		a.SetEntityID(payload.GetID())
-		a.SetNewValue(serializeEntity(payload))
+		a.SetNewValue(service.serialize(payload))
 		return nil
 	})
 
 	service.AddAfterUpdateHook(func(ctx context.Context, payload E) error {
-		a := audit.GetAudit[A](ctx)
+		a := auditEntry[A](ctx)
 		a.SetActionResult(audit.AuditActionResultSuccess)
-		a.SetPrevValue(serializeEntity(payload))
+		a.SetPrevValue(service.serialize(payload))
 		_, err := service.auditRepository.Create(ctx, a)
 		return err
 	})
 
 	service.AddOnUpdateFailHook(func(ctx context.Context, err error, failedEntity E) error {
-		a := audit.GetAudit[A](ctx)
+		a := auditEntry[A](ctx)
 		a.SetActionResult(audit.AuditActionResultFailure)
 		a.SetMessage(err.Error())
 		_, err = service.auditRepository.Create(ctx, a)
@@ -79,7 +87,7 @@ func NewAuditService[E common.Entity, A audit.Audit](
 	})
 
 	service.AddBeforeDeleteHook(func(ctx context.Context, id E) error {
-		a := audit.GetAudit[A](ctx)
+		a := auditEntry[A](ctx)
 		a.SetAction(audit.AuditActionDelete)
 		a.SetEntity(id.GetEntityName())
 		a.SetEntityID(id.GetID())
@@ -87,14 +95,14 @@ func NewAuditService[E common.Entity, A audit.Audit](
 	})
 
 	service.AddAfterDeleteHook(func(ctx context.Context, id E) error {
-		a := audit.GetAudit[A](ctx)
+		a := auditEntry[A](ctx)
 		a.SetActionResult(audit.AuditActionResultSuccess)
 		_, err := service.auditRepository.Create(ctx, a)
 		return err
 	})
 
 	service.AddOnDeleteFailHook(func(ctx context.Context, err error, id E) error {
-		a := audit.GetAudit[A](ctx)
+		a := auditEntry[A](ctx)
 		a.SetActionResult(audit.AuditActionResultFailure)
 		a.SetMessage(err.Error())
 		_, err = service.auditRepository.Create(ctx, a)
@@ -105,7 +113,7 @@ func NewAuditService[E common.Entity, A audit.Audit](
 		if len(entities) == 0 {
 			return nil
 		}
-		a := audit.GetAudit[A](ctx)
+		a := auditEntry[A](ctx)
 		a.SetAction(audit.AuditActionRead)
 		a.SetEntity(entities[0].GetEntityName())
 		return nil
@@ -115,13 +123,13 @@ func NewAuditService[E common.Entity, A audit.Audit](
 		if len(entities) == 0 {
 			return nil
 		}
-		a := audit.GetAudit[A](ctx)
+		a := auditEntry[A](ctx)
 		a.SetActionResult(audit.AuditActionResultSuccess)
 		return nil
 	})
 
 	service.AddOnFindFailHook(func(ctx context.Context, err error, entities ...E) error {
-		a := audit.GetAudit[A](ctx)
+		a := auditEntry[A](ctx)
 		a.SetActionResult(audit.AuditActionResultFailure)
 		a.SetMessage(err.Error())
 		_, err = service.auditRepository.Create(ctx, a)
@@ -129,20 +137,20 @@ func NewAuditService[E common.Entity, A audit.Audit](
 	})
 
 	service.AddBeforeAssocHook(func(ctx context.Context) error {
-		a := audit.GetAudit[A](ctx)
+		a := auditEntry[A](ctx)
 		a.SetAction(audit.AuditActionAssociate)
 		return nil
 	})
 
 	service.AddAfterAssocHook(func(ctx context.Context, entity E) error {
-		a := audit.GetAudit[A](ctx)
+		a := auditEntry[A](ctx)
 		a.SetActionResult(audit.AuditActionResultSuccess)
 		_, err := service.auditRepository.Create(ctx, a)
 		return err
 	})
 
 	service.AddOnAssocFailHook(func(ctx context.Context, err error, entity E) error {
-		a := audit.GetAudit[A](ctx)
+		a := auditEntry[A](ctx)
 		a.SetActionResult(audit.AuditActionResultFailure)
 		a.SetMessage(err.Error())
 		_, err = service.auditRepository.Create(ctx, a)
@@ -154,11 +162,55 @@ func NewAuditService[E common.Entity, A audit.Audit](
 
 // Create creates an entity and an audit log for the creation.
 
-func serializeEntity(entity common.Entity) string {
+// auditEntry returns the audit entry of ctx. Entries without a user record the principal of ctx,
+// such as permission.System for the CLI and background jobs.
+func auditEntry[A audit.Audit](ctx context.Context) A {
+	a := audit.GetAudit[A](ctx)
+	if a.GetUserID() == uuid.Nil {
+		a.SetUserID(permission.Principal(ctx).GetID())
+	}
+	return a
+}
+
+// redacted replaces the values of redacted fields in audit logs.
+const redacted = "REDACTED"
+
+// serialize returns the JSON of entity, with the values of the redacted fields replaced, or an
+// empty string when it cannot be serialized.
+func (s *AuditService[E, A]) serialize(entity E) string {
 	bytes, err := json.Marshal(entity)
-	if err != nil {
+	if err != nil || len(s.redactedFields) == 0 {
+		return string(bytes)
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(bytes, &fields); err != nil {
+		return ""
+	}
+	t := reflect.TypeOf(entity)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	for _, name := range s.redactedFields {
+		key := jsonName(t, name)
+		if _, ok := fields[key]; ok {
+			fields[key] = json.RawMessage(`"` + redacted + `"`)
+		}
+	}
+	if bytes, err = json.Marshal(fields); err != nil {
 		return ""
 	}
 	return string(bytes)
+}
 
+// jsonName returns the JSON name of the field of t with the Go name.
+func jsonName(t reflect.Type, name string) string {
+	field, ok := t.FieldByName(name)
+	if !ok {
+		return name
+	}
+	if tag, _, _ := strings.Cut(field.Tag.Get("json"), ","); tag != "" {
+		return tag
+	}
+	return name
 }
@@ -0,0 +1,130 @@
+package credentialsservice
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/cmo7/folly4/src/lib/generics/apperror"
+	"github.com/cmo7/folly4/src/lib/generics/filter"
+	"github.com/cmo7/folly4/src/lib/generics/repository"
+	"github.com/cmo7/folly4/src/lib/generics/service"
+	"github.com/cmo7/folly4/src/lib/generics/util/credentials"
+)
+
+// CredentialsService is a service that hashes the passwords of entities before they are created or
+// updated. It is a wrapper around a CrudService, and verifies passwords against the stored hashes.
+// Clients always send passwords: values that look like password hashes are rejected.
+// Its generic type E is the entity type, which implements credentials.Credentials.
+type CredentialsService[E credentials.Credentials] struct {
+	service.CrudServiceWithHooks[E]                          // Embed the CrudServiceWithHooks to inherit its methods.
+	repository                      repository.Repository[E] // The repository the stored hashes are read from and rehashed in.
+	passwordField                   string                   // The field that stores the password hash.
+	hasher                          *credentials.Hasher
+}
+
+func NewCredentialsService[E credentials.Credentials](
+	crudService service.CrudService[E],
+	repository repository.Repository[E],
+	passwordField string,
+) *CredentialsService[E] {
+	service := &CredentialsService[E]{
+		CrudServiceWithHooks: service.NewCrudServiceWithHooks(crudService),
+		repository:           repository,
+		passwordField:        passwordField,
+		hasher:               credentials.NewHasher(),
+	}
+
+	service.AddBeforeCreateHook(func(ctx context.Context, payload E) error {
+		hash, err := service.hash(payload.GetPassword())
+		if err != nil {
+			return err
+		}
+		payload.SetPassword(hash)
+		return nil
+	})
+
+	// Updates without a password keep the stored one.
+	service.AddBeforeUpdateHook(func(ctx context.Context, payload E) error {
+		if payload.GetPassword() == "" {
+			stored, err := service.repository.FindOne(ctx, payload.GetID(), nil)
+			if err != nil {
+				return err
+			}
+			payload.SetPassword(stored.GetPassword())
+			return nil
+		}
+		hash, err := service.hash(payload.GetPassword())
+		if err != nil {
+			return err
+		}
+		payload.SetPassword(hash)
+		return nil
+	})
+
+	return service
+}
+
+// UpdateField hashes the new value of the password field. Other fields are updated as they are.
+func (s *CredentialsService[E]) UpdateField(ctx context.Context, payload E, field string, value interface{}) (E, error) {
+	if !strings.EqualFold(strings.ReplaceAll(field, "_", ""), s.passwordField) {
+		return s.GetRepo().UpdateField(ctx, payload, field, value)
+	}
+	password, _ := value.(string)
+	hash, err := s.hash(password)
+	if err != nil {
+		return payload, err
+	}
+	return s.GetRepo().UpdateField(ctx, payload, field, hash)
+}
+
+// Verify returns the entity f matches if password is its password, or
+// credentials.ErrInvalidCredentials. Hashes made with another algorithm or cost than the configured
+// ones are replaced.
+func (s *CredentialsService[E]) Verify(ctx context.Context, f filter.Filter, password string) (E, error) {
+	var zero E
+	entity, err := s.repository.First(ctx, f)
+	if errors.Is(err, apperror.ErrNotFound) {
+		// Hash the password anyway, so unknown names take as long to answer as wrong passwords.
+		s.hasher.Hash(password)
+		return zero, credentials.ErrInvalidCredentials
+	}
+	if err != nil {
+		return zero, err
+	}
+
+	ok, rehash, err := s.hasher.Verify(entity.GetPassword(), password)
+	if err != nil {
+		return zero, err
+	}
+	if !ok {
+		return zero, credentials.ErrInvalidCredentials
+	}
+	if rehash {
+		// The password is right, failing to store its new hash does not fail the sign in.
+		if hash, err := s.hasher.Hash(password); err != nil {
+			log.Printf("rehashing the password of %s %s: %v", entity.GetEntityName(), entity.GetID(), err)
+		} else if _, err := s.repository.UpdateField(ctx, entity, s.passwordField, hash); err != nil {
+			log.Printf("rehashing the password of %s %s: %v", entity.GetEntityName(), entity.GetID(), err)
+		} else {
+			entity.SetPassword(hash)
+		}
+	}
+	return entity, nil
+}
+
+// hash returns the hash of a password sent by a client.
+func (s *CredentialsService[E]) hash(password string) (string, error) {
+	switch {
+	case password == "":
+		return "", apperror.Validation(apperror.FieldError{Field: s.passwordField, Message: "is required"})
+	case credentials.IsHash(password):
+		return "", apperror.Validation(apperror.FieldError{Field: s.passwordField, Message: "must be a password, not a password hash"})
+	}
+	hash, err := s.hasher.Hash(password)
+	if errors.Is(err, credentials.ErrPasswordTooLong) {
+		return "", apperror.Validation(apperror.FieldError{Field: s.passwordField, Message: "must be at most 72 bytes long"})
+	}
+	return hash, err
+}
@@ -0,0 +1,176 @@
+package gorm_impl
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cmo7/folly4/src/data/database"
+	"github.com/cmo7/folly4/src/lib/generics/filter"
+	"github.com/cmo7/folly4/src/lib/generics/pagination"
+	"gorm.io/gorm"
+)
+
+// page builds the page of entities read with scopePage, counting the rows of the listing as asked
+// by pageable. The filter must already be resolved.
+func (r *GormGenericRepository[E]) page(ctx context.Context, pageable pagination.Pageable, f filter.Filter, entities []E) (pagination.Page[E], error) {
+	if pageable.Count == pagination.CountExact {
+		filtered, err := r.count(ctx, f)
+		if err != nil {
+			return pagination.Page[E]{}, err
+		}
+		total := filtered
+		if f != nil {
+			if total, err = r.total(ctx); err != nil {
+				return pagination.Page[E]{}, err
+			}
+		}
+		return pagination.NewPage(entities, pageable.Page, pageable.Size, total, filtered), nil
+	}
+
+	// Without an exact count, the extra row read by scopePage tells whether there is a next page.
+	hasNext := len(entities) > pageable.Size
+	if hasNext {
+		entities = entities[:pageable.Size]
+	}
+	if pageable.Count == pagination.CountNone {
+		return pagination.NewUncountedPage(entities, pageable.Page, pageable.Size, hasNext), nil
+	}
+
+	total, err := r.estimate(ctx, nil)
+	if err != nil {
+		return pagination.Page[E]{}, err
+	}
+	filtered := total
+	if f != nil {
+		if filtered, err = r.estimate(ctx, f); err != nil {
+			return pagination.Page[E]{}, err
+		}
+	}
+	return pagination.NewEstimatedPage(entities, pageable.Page, pageable.Size, total, filtered, hasNext), nil
+}
+
+// estimate estimates the rows matching an already resolved filter from the statistics of the engine,
+// without reading them:
+//
+//	Postgres: pg_class.reltuples for the table, the row estimate of EXPLAIN for a filter.
+//	MySQL:    information_schema.TABLES.TABLE_ROWS for the table, the rows and filtered estimates of EXPLAIN for a filter.
+//
+// SQLite keeps no row estimates, so the rows are counted, as they are when the statistics are missing.
+func (r *GormGenericRepository[E]) estimate(ctx context.Context, f filter.Filter) (int64, error) {
+	registry, err := r.fields()
+	if err != nil {
+		return 0, err
+	}
+	db := r.db.WithContext(ctx)
+
+	var estimate sql.NullInt64
+	switch engine := database.Engine(db.Dialector.Name()); {
+	case engine == database.Postgres && f == nil:
+		// reltuples is -1 for tables that were never vacuumed or analyzed.
+		err = db.Raw("SELECT reltuples::bigint FROM pg_class WHERE oid = to_regclass(?) AND reltuples >= 0", registry.schema.Table).Scan(&estimate).Error
+	case engine == database.MySQL && f == nil:
+		err = db.Raw("SELECT TABLE_ROWS FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?", registry.schema.Table).Scan(&estimate).Error
+	case engine == database.Postgres || engine == database.MySQL:
+		estimate.Int64, err = r.explain(ctx, engine, f)
+		estimate.Valid = err == nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if !estimate.Valid {
+		return r.count(ctx, f)
+	}
+	return estimate.Int64, nil
+}
+
+// explain returns the number of rows the query planner expects the filter to select.
+func (r *GormGenericRepository[E]) explain(ctx context.Context, engine database.Engine, f filter.Filter) (int64, error) {
+	stmt := r.db.Session(&gorm.Session{DryRun: true, NewDB: true}).WithContext(ctx).
+		Model(new(E)).Scopes(scopeFilter(f)).Find(&[]E{}).Statement
+	if stmt.Error != nil {
+		return 0, stmt.Error
+	}
+
+	query := "EXPLAIN " + stmt.SQL.String()
+	if engine == database.Postgres {
+		query = "EXPLAIN (FORMAT JSON) " + stmt.SQL.String()
+	}
+	rows, err := r.db.ConnPool.QueryContext(ctx, query, stmt.Vars...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	if engine == database.Postgres {
+		return explainPostgres(rows)
+	}
+	return explainMySQL(rows)
+}
+
+// explainPostgres reads the row estimate of the top plan node of EXPLAIN (FORMAT JSON).
+func explainPostgres(rows *sql.Rows) (int64, error) {
+	if !rows.Next() {
+		return 0, fmt.Errorf("explain returned no plan: %w", rows.Err())
+	}
+	var plan string
+	if err := rows.Scan(&plan); err != nil {
+		return 0, err
+	}
+	return parsePostgresPlan(plan)
+}
+
+func parsePostgresPlan(plan string) (int64, error) {
+	var plans []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		}
+	}
+	if err := json.Unmarshal([]byte(plan), &plans); err != nil || len(plans) == 0 {
+		return 0, fmt.Errorf("unexpected explain output: %s", plan)
+	}
+	return int64(plans[0].Plan.Rows), nil
+}
+
+// explainMySQL reads the rows examined in the table of the query, the first row of EXPLAIN,
+// and the percentage of them the conditions are expected to keep.
+func explainMySQL(rows *sql.Rows) (int64, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	if !rows.Next() {
+		return 0, fmt.Errorf("explain returned no plan: %w", rows.Err())
+	}
+	values := make([]sql.NullString, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return 0, err
+	}
+
+	plan := map[string]string{}
+	for i, column := range columns {
+		plan[strings.ToLower(column)] = values[i].String
+	}
+	return parseMySQLPlan(plan)
+}
+
+func parseMySQLPlan(plan map[string]string) (int64, error) {
+	examined, err := strconv.ParseFloat(plan["rows"], 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected explain rows: %q", plan["rows"])
+	}
+	kept := 100.0
+	if plan["filtered"] != "" {
+		if kept, err = strconv.ParseFloat(plan["filtered"], 64); err != nil {
+			return 0, fmt.Errorf("unexpected explain filtered: %q", plan["filtered"])
+		}
+	}
+	return int64(examined * kept / 100), nil
+}
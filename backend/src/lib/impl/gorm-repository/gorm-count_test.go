@@ -0,0 +1,74 @@
+package gorm_impl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cmo7/folly4/src/lib/generics/filter"
+	"github.com/cmo7/folly4/src/lib/generics/order"
+	"github.com/cmo7/folly4/src/lib/generics/pagination"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindAllCountModes(t *testing.T) {
+	setupTest(t)
+	seedKeysetParents(t)
+	ctx := createContext(t, 5*time.Second)
+	orderBys := []order.OrderBy{order.AscOrderBy("name")}
+	adults := filter.GreaterThan("age", 26)
+
+	tests := []struct {
+		pageable   pagination.Pageable
+		f          filter.Filter
+		names      []string
+		hasNext    bool
+		filtered   int64
+		totalPages int64
+	}{
+		{pagination.Pageable{Page: 1, Size: 3}, nil, []string{"Alice", "Bob", "Charlie"}, true, 7, 3},
+		{pagination.Pageable{Page: 3, Size: 3, Count: pagination.CountExact}, nil, []string{"Grace"}, false, 7, 3},
+		{pagination.Pageable{Page: 2, Size: 2, Count: pagination.CountExact}, adults, []string{"Dave", "Eve"}, true, 5, 3},
+		{pagination.Pageable{Page: 1, Size: 3, Count: pagination.CountNone}, nil, []string{"Alice", "Bob", "Charlie"}, true, 0, 0},
+		{pagination.Pageable{Page: 3, Size: 3, Count: pagination.CountNone}, nil, []string{"Grace"}, false, 0, 0},
+		{pagination.Pageable{Page: 1, Size: 2, Count: pagination.CountNone}, adults, []string{"Alice", "Charlie"}, true, 0, 0},
+		// SQLite keeps no estimates, so the rows are counted.
+		{pagination.Pageable{Page: 1, Size: 3, Count: pagination.CountEstimate}, nil, []string{"Alice", "Bob", "Charlie"}, true, 7, 3},
+		{pagination.Pageable{Page: 2, Size: 3, Count: pagination.CountEstimate}, adults, []string{"Eve", "Grace"}, false, 5, 2},
+	}
+
+	for _, test := range tests {
+		page, err := parentRepository.FindAll(ctx, test.pageable, test.f, nil, orderBys)
+		assert.Nil(t, err)
+		names := []string{}
+		for _, p := range page.Content {
+			names = append(names, p.Name)
+		}
+		assert.Equal(t, test.names, names, "%+v", test.pageable)
+		assert.Equal(t, test.hasNext, page.HasNext, "%+v", test.pageable)
+		assert.Equal(t, test.pageable.Page > 1, page.HasPrev, "%+v", test.pageable)
+		assert.Equal(t, test.filtered, page.Filtered, "%+v", test.pageable)
+		assert.Equal(t, test.totalPages, page.TotalPages, "%+v", test.pageable)
+	}
+
+	combo, err := parentRepository.ComboBox(ctx, pagination.Pageable{Page: 2, Size: 3, Count: pagination.CountNone}, nil, nil, orderBys)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Dave", "Eve", "Frank"}, []string{combo.Content[0].Name, combo.Content[1].Name, combo.Content[2].Name})
+	assert.True(t, combo.HasNext)
+}
+
+func TestParsePlans(t *testing.T) {
+	rows, err := parsePostgresPlan(`[{"Plan": {"Node Type": "Seq Scan", "Plan Rows": 1234, "Plan Width": 8}}]`)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1234), rows)
+	_, err = parsePostgresPlan(`[]`)
+	assert.NotNil(t, err)
+
+	rows, err = parseMySQLPlan(map[string]string{"rows": "2000", "filtered": "33.33"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(666), rows)
+	rows, err = parseMySQLPlan(map[string]string{"rows": "10"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), rows)
+	_, err = parseMySQLPlan(map[string]string{"rows": ""})
+	assert.NotNil(t, err)
+}
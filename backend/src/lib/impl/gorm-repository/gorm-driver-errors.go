@@ -0,0 +1,154 @@
+package gorm_impl
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/cmo7/folly4/src/lib/generics/repository"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+)
+
+// classifyError returns the error of the SQLite, MySQL or Postgres driver in the chain of err as
+// a repository.DatabaseError, with the table, constraint and column the database reported.
+// It returns false for errors of other kinds and drivers.
+func classifyError(err error) (*repository.DatabaseError, bool) {
+	var (
+		sqliteErr   sqlite3.Error
+		mysqlErr    *mysql.MySQLError
+		postgresErr *pgconn.PgError
+	)
+	var classified *repository.DatabaseError
+	switch {
+	case errors.As(err, &sqliteErr):
+		classified = classifySQLite(sqliteErr)
+	case errors.As(err, &mysqlErr):
+		classified = classifyMySQL(mysqlErr)
+	case errors.As(err, &postgresErr):
+		classified = classifyPostgres(postgresErr)
+	}
+	if classified == nil {
+		return nil, false
+	}
+	classified.Err = err
+	return classified, true
+}
+
+// SQLite names the columns of the constraint that failed as "table.column", comma separated,
+// after the kind of constraint: "UNIQUE constraint failed: users.email". Check constraints are
+// named by their name or expression instead.
+func classifySQLite(err sqlite3.Error) *repository.DatabaseError {
+	var kind error
+	switch err.ExtendedCode {
+	case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+		kind = repository.ErrUniqueViolation
+	case sqlite3.ErrConstraintForeignKey:
+		kind = repository.ErrForeignKeyViolation
+	case sqlite3.ErrConstraintNotNull:
+		kind = repository.ErrNotNullViolation
+	case sqlite3.ErrConstraintCheck:
+		_, constraint, _ := strings.Cut(err.Error(), "constraint failed: ")
+		return &repository.DatabaseError{Kind: repository.ErrCheckViolation, Constraint: constraint}
+	default:
+		if err.Code == sqlite3.ErrBusy || err.Code == sqlite3.ErrLocked {
+			return &repository.DatabaseError{Kind: repository.ErrLockTimeout}
+		}
+		return nil
+	}
+
+	classified := &repository.DatabaseError{Kind: kind}
+	if _, columns, ok := strings.Cut(err.Error(), "constraint failed: "); ok {
+		// Composite constraints name every column, the first one is reported.
+		first, _, _ := strings.Cut(columns, ",")
+		classified.Table, classified.Column, _ = strings.Cut(strings.TrimSpace(first), ".")
+	}
+	return classified
+}
+
+var (
+	// Duplicate entry 'a@b.c' for key 'users.uni_users_email'; older servers leave the table out.
+	mysqlDuplicateKey = regexp.MustCompile(`for key '(?:[^']*\.)?([^'.]+)'`)
+	// ... a foreign key constraint fails (`db`.`children`, CONSTRAINT `fk_x` FOREIGN KEY (`parent_id`) ...
+	mysqlForeignKey = regexp.MustCompile("\\(`[^`]*`\\.`([^`]*)`, CONSTRAINT `([^`]*)` FOREIGN KEY \\(`([^`]*)`")
+	// Column 'email' cannot be null, or Field 'email' doesn't have a default value.
+	mysqlColumn = regexp.MustCompile(`(?:Column|Field) '([^']*)'`)
+	// Check constraint 'chk_users_age' is violated.
+	mysqlCheck = regexp.MustCompile(`constraint '([^']*)'`)
+)
+
+// MySQL only reports the constraint and column in the message of the error.
+func classifyMySQL(err *mysql.MySQLError) *repository.DatabaseError {
+	switch err.Number {
+	case 1062, 1586: // ER_DUP_ENTRY, ER_DUP_ENTRY_WITH_KEY_NAME
+		classified := &repository.DatabaseError{Kind: repository.ErrUniqueViolation}
+		if match := mysqlDuplicateKey.FindStringSubmatch(err.Message); match != nil {
+			classified.Constraint = match[1]
+		}
+		return classified
+	case 1451, 1452, 1216, 1217: // ER_ROW_IS_REFERENCED_2, ER_NO_REFERENCED_ROW_2 and their older versions
+		classified := &repository.DatabaseError{Kind: repository.ErrForeignKeyViolation}
+		if match := mysqlForeignKey.FindStringSubmatch(err.Message); match != nil {
+			classified.Table, classified.Constraint, classified.Column = match[1], match[2], match[3]
+		}
+		return classified
+	case 1048, 1364: // ER_BAD_NULL_ERROR, ER_NO_DEFAULT_FOR_FIELD
+		classified := &repository.DatabaseError{Kind: repository.ErrNotNullViolation}
+		if match := mysqlColumn.FindStringSubmatch(err.Message); match != nil {
+			classified.Column = match[1]
+		}
+		return classified
+	case 3819: // ER_CHECK_CONSTRAINT_VIOLATED
+		classified := &repository.DatabaseError{Kind: repository.ErrCheckViolation}
+		if match := mysqlCheck.FindStringSubmatch(err.Message); match != nil {
+			classified.Constraint = match[1]
+		}
+		return classified
+	case 1213: // ER_LOCK_DEADLOCK
+		return &repository.DatabaseError{Kind: repository.ErrDeadlock}
+	case 1205: // ER_LOCK_WAIT_TIMEOUT
+		return &repository.DatabaseError{Kind: repository.ErrLockTimeout}
+	}
+	return nil
+}
+
+// Key (email)=(a@b.c) already exists.
+var postgresKey = regexp.MustCompile(`^Key \(([^),]+)`)
+
+// Postgres reports the table, constraint and, for not null violations, the column in fields of
+// the error. The columns of unique and foreign keys are in its detail.
+func classifyPostgres(err *pgconn.PgError) *repository.DatabaseError {
+	var kind error
+	switch err.Code {
+	case "23505": // unique_violation
+		kind = repository.ErrUniqueViolation
+	case "23503": // foreign_key_violation
+		kind = repository.ErrForeignKeyViolation
+	case "23502": // not_null_violation
+		kind = repository.ErrNotNullViolation
+	case "23514": // check_violation
+		kind = repository.ErrCheckViolation
+	case "40P01": // deadlock_detected
+		kind = repository.ErrDeadlock
+	case "40001": // serialization_failure
+		kind = repository.ErrSerializationFailure
+	case "55P03": // lock_not_available
+		kind = repository.ErrLockTimeout
+	default:
+		return nil
+	}
+
+	classified := &repository.DatabaseError{
+		Kind:       kind,
+		Table:      err.TableName,
+		Constraint: err.ConstraintName,
+		Column:     err.ColumnName,
+	}
+	// Rows still referenced by others name the referenced key, not a column of the table.
+	referenced := strings.Contains(err.Detail, "is still referenced")
+	if match := postgresKey.FindStringSubmatch(err.Detail); classified.Column == "" && !referenced && match != nil {
+		classified.Column = strings.Trim(strings.TrimSpace(match[1]), `"`)
+	}
+	return classified
+}
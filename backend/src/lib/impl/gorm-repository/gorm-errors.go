@@ -0,0 +1,106 @@
+package gorm_impl
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cmo7/folly4/src/lib/generics/apperror"
+	"github.com/cmo7/folly4/src/lib/generics/common"
+	"github.com/cmo7/folly4/src/lib/generics/filter"
+	"github.com/cmo7/folly4/src/lib/generics/repository"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// translateError returns the error GORM returned for a statement on E as an error of the kind
+// of apperror it is, keeping the GORM error in its chain. Errors of the database drivers are
+// classified first, see classifyError, and keep their repository.DatabaseError in the chain.
+// Invalid full-text searches are filter.ErrInvalidValue. Other errors are returned as they are.
+func (r *GormGenericRepository[E]) translateError(err error) error {
+	name := common.EntityNameOf[E]()
+	if classified, ok := classifyError(err); ok {
+		if registry, registryErr := r.fields(); registryErr == nil {
+			registry.resolveConstraint(classified)
+		}
+		err = classified
+	}
+
+	var classified *repository.DatabaseError
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return apperror.New(apperror.ErrNotFound, err, "%s not found", name)
+	case errors.Is(err, repository.ErrUniqueViolation) && errors.As(err, &classified) && classified.Field != "":
+		return apperror.New(apperror.ErrConflict, err, "%s with this %s already exists", name, classified.Field)
+	case errors.Is(err, gorm.ErrDuplicatedKey), errors.Is(err, repository.ErrUniqueViolation):
+		return apperror.New(apperror.ErrConflict, err, "%s already exists", name)
+	case errors.Is(err, gorm.ErrForeignKeyViolated), errors.Is(err, repository.ErrForeignKeyViolation):
+		return apperror.New(apperror.ErrConflict, err, "%s refers to or is referred to by other entities", name)
+	case errors.Is(err, repository.ErrNotNullViolation), errors.Is(err, repository.ErrCheckViolation):
+		message := "is required"
+		if errors.Is(err, repository.ErrCheckViolation) {
+			message = "is invalid"
+		}
+		field := "" // Errors GORM translated itself do not name the field.
+		if errors.As(err, &classified) {
+			field = firstNonEmpty(classified.Field, classified.Column, classified.Constraint)
+		}
+		return &apperror.ValidationError{Fields: []apperror.FieldError{{Field: field, Message: message}}, Err: err}
+	case repository.Retryable(err):
+		return apperror.New(apperror.ErrUnavailable, err, "%s could not be saved because of concurrent changes, try again", name)
+	case searchSyntaxError(err):
+		return fmt.Errorf("%w: search query: %w", filter.ErrInvalidValue, err)
+	}
+	return err
+}
+
+// resolveConstraint completes the column of a database error from the constraint it names, when
+// the constraint is one of the schema, and names the field of the entity stored in the column.
+func (r *fieldRegistry) resolveConstraint(classified *repository.DatabaseError) {
+	if classified.Table != "" && classified.Table != r.schema.Table {
+		return
+	}
+	if classified.Column == "" && classified.Constraint != "" {
+		if field := r.constraintField(classified.Constraint); field != nil {
+			classified.Column = field.DBName
+		}
+	}
+	if field, ok := r.schema.FieldsByDBName[classified.Column]; ok {
+		if classified.Table == "" {
+			classified.Table = r.schema.Table
+		}
+		classified.Field = publicNames(field)[0]
+	}
+}
+
+// constraintField returns the field constrained by the unique, check or foreign key constraint
+// called name that GORM creates for the schema, if any. Constraints and indexes over several
+// fields return their first field.
+func (r *fieldRegistry) constraintField(name string) *schema.Field {
+	if unique, ok := r.schema.ParseUniqueConstraints()[name]; ok {
+		return unique.Field
+	}
+	if index, ok := r.schema.ParseIndexes()[name]; ok && len(index.Fields) > 0 {
+		return index.Fields[0].Field
+	}
+	if check, ok := r.schema.ParseCheckConstraints()[name]; ok && check.Field != nil {
+		return check.Field
+	}
+	for _, rel := range r.schema.Relationships.Relations {
+		if constraint := rel.ParseConstraint(); constraint != nil && constraint.Name == name &&
+			constraint.Schema == r.schema && len(constraint.ForeignKeys) > 0 {
+			return constraint.ForeignKeys[0]
+		}
+	}
+	return nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,256 @@
+package gorm_impl
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/cmo7/folly4/src/lib/generics/apperror"
+	"github.com/cmo7/folly4/src/lib/generics/common"
+	"github.com/cmo7/folly4/src/lib/generics/filter"
+	"github.com/cmo7/folly4/src/lib/generics/repository"
+	"github.com/go-sql-driver/mysql"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type AccountEntity struct {
+	ID       uuid.UUID `gorm:"type:char(36);primary_key"`
+	Email    string    `gorm:"unique" json:"email"`
+	Nickname *string   `gorm:"not null"`
+	Age      int       `gorm:"check:chk_account_entities_age,age >= 0"`
+}
+
+func (e *AccountEntity) BeforeCreate(tx *gorm.DB) error {
+	e.ID = uuid.New()
+	return nil
+}
+
+func (e AccountEntity) GetID() uuid.UUID {
+	return e.ID
+}
+
+func (e *AccountEntity) SetID(id uuid.UUID) {
+	e.ID = id
+}
+
+func (e AccountEntity) GetName() string {
+	return e.Email
+}
+
+func (e AccountEntity) GetEntityName() common.EntityName {
+	return common.EntityName("AccountEntity")
+}
+
+// sqliteError returns the error SQLite returns for the statement, run on a database with tables
+// of users and their children.
+func sqliteError(t *testing.T, statement string) error {
+	db, err := gorm.Open(sqlite.Open("file::memory:?_foreign_keys=on"), &gorm.Config{})
+	assert.Nil(t, err)
+	assert.Nil(t, db.Exec(`CREATE TABLE users (
+		id INTEGER PRIMARY KEY, email TEXT UNIQUE, first TEXT, last TEXT, password TEXT NOT NULL,
+		age INTEGER CONSTRAINT chk_users_age CHECK (age >= 0), UNIQUE (first, last))`).Error)
+	assert.Nil(t, db.Exec(`CREATE TABLE children (id INTEGER PRIMARY KEY, user_id INTEGER REFERENCES users (id))`).Error)
+	assert.Nil(t, db.Exec(`INSERT INTO users (id, email, first, last, password) VALUES (1, 'a@b.c', 'Ann', 'Lee', 'x')`).Error)
+	return db.Exec(statement).Error
+}
+
+func TestClassifyError(t *testing.T) {
+	testCases := []struct {
+		name     string
+		err      error
+		expected repository.DatabaseError
+	}{
+		{
+			name:     "sqlite unique",
+			err:      sqliteError(t, `INSERT INTO users (email, password) VALUES ('a@b.c', 'x')`),
+			expected: repository.DatabaseError{Kind: repository.ErrUniqueViolation, Table: "users", Column: "email"},
+		},
+		{
+			name:     "sqlite composite unique",
+			err:      sqliteError(t, `INSERT INTO users (first, last, password) VALUES ('Ann', 'Lee', 'x')`),
+			expected: repository.DatabaseError{Kind: repository.ErrUniqueViolation, Table: "users", Column: "first"},
+		},
+		{
+			name:     "sqlite foreign key",
+			err:      sqliteError(t, `INSERT INTO children (user_id) VALUES (2)`),
+			expected: repository.DatabaseError{Kind: repository.ErrForeignKeyViolation},
+		},
+		{
+			name:     "sqlite not null",
+			err:      sqliteError(t, `INSERT INTO users (email) VALUES ('d@e.f')`),
+			expected: repository.DatabaseError{Kind: repository.ErrNotNullViolation, Table: "users", Column: "password"},
+		},
+		{
+			name:     "sqlite check",
+			err:      sqliteError(t, `INSERT INTO users (password, age) VALUES ('x', -1)`),
+			expected: repository.DatabaseError{Kind: repository.ErrCheckViolation, Constraint: "chk_users_age"},
+		},
+		{
+			name:     "sqlite busy",
+			err:      sqlite3.Error{Code: sqlite3.ErrBusy, ExtendedCode: sqlite3.ErrBusySnapshot},
+			expected: repository.DatabaseError{Kind: repository.ErrLockTimeout},
+		},
+		{
+			name:     "mysql duplicate entry",
+			err:      &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'a@b.c' for key 'users.uni_users_email'"},
+			expected: repository.DatabaseError{Kind: repository.ErrUniqueViolation, Constraint: "uni_users_email"},
+		},
+		{
+			name:     "mysql 5 duplicate entry",
+			err:      &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'a@b.c' for key 'uni_users_email'"},
+			expected: repository.DatabaseError{Kind: repository.ErrUniqueViolation, Constraint: "uni_users_email"},
+		},
+		{
+			name: "mysql foreign key",
+			err: &mysql.MySQLError{Number: 1452, Message: "Cannot add or update a child row: a foreign key constraint fails " +
+				"(`folly`.`children`, CONSTRAINT `fk_parents_children` FOREIGN KEY (`parent_id`) REFERENCES `parents` (`id`))"},
+			expected: repository.DatabaseError{Kind: repository.ErrForeignKeyViolation, Table: "children", Constraint: "fk_parents_children", Column: "parent_id"},
+		},
+		{
+			name:     "mysql not null",
+			err:      &mysql.MySQLError{Number: 1048, Message: "Column 'password' cannot be null"},
+			expected: repository.DatabaseError{Kind: repository.ErrNotNullViolation, Column: "password"},
+		},
+		{
+			name:     "mysql check",
+			err:      &mysql.MySQLError{Number: 3819, Message: "Check constraint 'chk_users_age' is violated."},
+			expected: repository.DatabaseError{Kind: repository.ErrCheckViolation, Constraint: "chk_users_age"},
+		},
+		{
+			name:     "mysql deadlock",
+			err:      &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock; try restarting transaction"},
+			expected: repository.DatabaseError{Kind: repository.ErrDeadlock},
+		},
+		{
+			name:     "mysql lock wait timeout",
+			err:      &mysql.MySQLError{Number: 1205, Message: "Lock wait timeout exceeded; try restarting transaction"},
+			expected: repository.DatabaseError{Kind: repository.ErrLockTimeout},
+		},
+		{
+			name:     "postgres unique",
+			err:      &pgconn.PgError{Code: "23505", TableName: "users", ConstraintName: "uni_users_email", Detail: "Key (email)=(a@b.c) already exists."},
+			expected: repository.DatabaseError{Kind: repository.ErrUniqueViolation, Table: "users", Constraint: "uni_users_email", Column: "email"},
+		},
+		{
+			name: "postgres foreign key",
+			err: &pgconn.PgError{Code: "23503", TableName: "children", ConstraintName: "fk_parents_children",
+				Detail: `Key (parent_id)=(1) is not present in table "parents".`},
+			expected: repository.DatabaseError{Kind: repository.ErrForeignKeyViolation, Table: "children", Constraint: "fk_parents_children", Column: "parent_id"},
+		},
+		{
+			name: "postgres referenced row",
+			err: &pgconn.PgError{Code: "23503", TableName: "children", ConstraintName: "fk_parents_children",
+				Detail: `Key (id)=(1) is still referenced from table "children".`},
+			expected: repository.DatabaseError{Kind: repository.ErrForeignKeyViolation, Table: "children", Constraint: "fk_parents_children"},
+		},
+		{
+			name:     "postgres not null",
+			err:      &pgconn.PgError{Code: "23502", TableName: "users", ColumnName: "password"},
+			expected: repository.DatabaseError{Kind: repository.ErrNotNullViolation, Table: "users", Column: "password"},
+		},
+		{
+			name:     "postgres check",
+			err:      &pgconn.PgError{Code: "23514", TableName: "users", ConstraintName: "chk_users_age"},
+			expected: repository.DatabaseError{Kind: repository.ErrCheckViolation, Table: "users", Constraint: "chk_users_age"},
+		},
+		{
+			name:     "postgres deadlock",
+			err:      &pgconn.PgError{Code: "40P01"},
+			expected: repository.DatabaseError{Kind: repository.ErrDeadlock},
+		},
+		{
+			name:     "postgres serialization failure",
+			err:      &pgconn.PgError{Code: "40001"},
+			expected: repository.DatabaseError{Kind: repository.ErrSerializationFailure},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			wrapped := fmt.Errorf("saving: %w", tc.err)
+			classified, ok := classifyError(wrapped)
+			assert.True(t, ok)
+			tc.expected.Err = wrapped
+			assert.Equal(t, &tc.expected, classified)
+			assert.True(t, errors.Is(classified, tc.expected.Kind))
+			assert.True(t, errors.Is(classified, tc.err))
+		})
+	}
+
+	_, ok := classifyError(&mysql.MySQLError{Number: 1146, Message: "Table 'folly.users' doesn't exist"})
+	assert.False(t, ok)
+	_, ok = classifyError(errors.New("boom"))
+	assert.False(t, ok)
+	assert.True(t, repository.Retryable(&repository.DatabaseError{Kind: repository.ErrSerializationFailure}))
+	assert.False(t, repository.Retryable(&repository.DatabaseError{Kind: repository.ErrUniqueViolation}))
+}
+
+func TestTranslateConstraintErrors(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.Nil(t, err)
+	assert.Nil(t, db.AutoMigrate(&AccountEntity{}))
+	accounts := NewGormGenericRepository[*AccountEntity](db)
+	ctx := createContext(t, 5*time.Second)
+	nickname := "ally"
+
+	_, err = accounts.Create(ctx, &AccountEntity{Email: "a@b.c", Nickname: &nickname})
+	assert.Nil(t, err)
+
+	_, err = accounts.Create(ctx, &AccountEntity{Email: "a@b.c", Nickname: &nickname})
+	assert.True(t, errors.Is(err, apperror.ErrConflict))
+	assert.True(t, errors.Is(err, repository.ErrUniqueViolation))
+	assert.Equal(t, "AccountEntity with this email already exists", err.Error())
+	var classified *repository.DatabaseError
+	assert.True(t, errors.As(err, &classified))
+	assert.Equal(t, "account_entities", classified.Table)
+	assert.Equal(t, "email", classified.Column)
+
+	_, err = accounts.Create(ctx, &AccountEntity{Email: "d@e.f"})
+	assert.True(t, errors.Is(err, apperror.ErrValidation))
+	assert.Equal(t, []apperror.FieldError{{Field: "Nickname", Message: "is required"}}, apperror.Fields(err))
+
+	_, err = accounts.Create(ctx, &AccountEntity{Email: "g@h.i", Nickname: &nickname, Age: -1})
+	assert.True(t, errors.Is(err, repository.ErrCheckViolation))
+	assert.Equal(t, []apperror.FieldError{{Field: "Age", Message: "is invalid"}}, apperror.Fields(err))
+}
+
+func TestTranslateSearchSyntaxErrors(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.Nil(t, err)
+	accounts := NewGormGenericRepository[*AccountEntity](db)
+
+	for _, message := range []string{`fts5: syntax error near ""`, "unterminated string"} {
+		err := accounts.translateError(errors.New(message))
+		assert.True(t, errors.Is(err, filter.ErrInvalidValue), message)
+	}
+	other := errors.New("no such table: account_entities")
+	assert.Equal(t, other, accounts.translateError(other))
+}
+
+func TestResolveConstraint(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.Nil(t, err)
+	registry, err := newFieldRegistry(db, &AccountEntity{})
+	assert.Nil(t, err)
+
+	classified := &repository.DatabaseError{Kind: repository.ErrUniqueViolation, Constraint: "uni_account_entities_email"}
+	registry.resolveConstraint(classified)
+	assert.Equal(t, &repository.DatabaseError{
+		Kind:       repository.ErrUniqueViolation,
+		Table:      "account_entities",
+		Constraint: "uni_account_entities_email",
+		Column:     "email",
+		Field:      "email",
+	}, classified)
+
+	// Constraints of other tables are left alone.
+	classified = &repository.DatabaseError{Kind: repository.ErrNotNullViolation, Table: "users", Column: "email"}
+	registry.resolveConstraint(classified)
+	assert.Equal(t, "", classified.Field)
+}
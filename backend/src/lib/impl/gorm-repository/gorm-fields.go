@@ -0,0 +1,235 @@
+package gorm_impl
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/cmo7/folly4/src/lib/generics/common"
+	"github.com/cmo7/folly4/src/lib/generics/filter"
+	"github.com/cmo7/folly4/src/lib/generics/order"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// registeredField is a column of an entity that clients may reference by name.
+type registeredField struct {
+	Name    string // Go field name.
+	Column  string // Database column name.
+	Options common.QueryOptions
+}
+
+// registeredRelation is a relation of an entity that clients may traverse with a dotted path.
+type registeredRelation struct {
+	Relationship *schema.Relationship
+	Options      common.QueryOptions
+}
+
+// schemaNames holds the public names of the columns and relations of a single schema.
+type schemaNames struct {
+	fields    map[string]registeredField
+	relations map[string]registeredRelation
+}
+
+// fieldPath is a resolved field reference: the relations traversed from the root entity,
+// if any, and the column reached at the end of them.
+type fieldPath struct {
+	relations []*schema.Relationship
+	column    string
+}
+
+// fieldRegistry maps the public names of the fields of an entity to their columns.
+// It is built from the GORM schema of the entity, so only real columns can ever reach
+// the generated SQL. A field can be referenced by its json name, its Go name or its column name,
+// and fields of related entities by a dotted path such as "roles.name".
+type fieldRegistry struct {
+	schema *schema.Schema
+
+	mu    *sync.Mutex
+	names map[*schema.Schema]*schemaNames // Built on demand for every schema reached.
+
+	searchIndexes map[string]bool // Tables with a full-text index table, see searchIndexSuffix.
+}
+
+// newFieldRegistry parses the GORM schema of model, and looks up the full-text index tables
+// of the database.
+func newFieldRegistry(db *gorm.DB, model interface{}) (*fieldRegistry, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, err
+	}
+	return &fieldRegistry{
+		schema:        stmt.Schema,
+		mu:            &sync.Mutex{},
+		names:         map[*schema.Schema]*schemaNames{},
+		searchIndexes: searchIndexes(db),
+	}, nil
+}
+
+// rootedAt returns the registry of the fields of a related schema, which shares the names built so far.
+func (r *fieldRegistry) rootedAt(s *schema.Schema) *fieldRegistry {
+	return &fieldRegistry{schema: s, mu: r.mu, names: r.names, searchIndexes: r.searchIndexes}
+}
+
+// namesOf returns the public names of the columns and relations of s.
+func (r *fieldRegistry) namesOf(s *schema.Schema) *schemaNames {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if names, ok := r.names[s]; ok {
+		return names
+	}
+
+	names := &schemaNames{fields: map[string]registeredField{}, relations: map[string]registeredRelation{}}
+	for _, f := range s.Fields {
+		if f.DBName == "" {
+			continue
+		}
+		field := registeredField{
+			Name:    f.Name,
+			Column:  f.DBName,
+			Options: common.ParseQueryTag(f.StructField.Tag),
+		}
+		for _, name := range publicNames(f) {
+			if _, exists := names.fields[name]; !exists {
+				names.fields[name] = field
+			}
+		}
+	}
+	for _, rel := range s.Relationships.Relations {
+		relation := registeredRelation{Relationship: rel, Options: common.ParseQueryTag(rel.Field.StructField.Tag)}
+		for _, name := range publicNames(rel.Field) {
+			if _, exists := names.relations[name]; !exists {
+				names.relations[name] = relation
+			}
+		}
+	}
+	r.names[s] = names
+	return names
+}
+
+// publicNames returns every name a field can be referenced by.
+func publicNames(f *schema.Field) []string {
+	names := []string{}
+	if tag, ok := f.StructField.Tag.Lookup("json"); ok {
+		if name := strings.Split(tag, ",")[0]; name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	names = append(names, f.Name, toSnakeCase(f.Name))
+	if f.DBName != "" {
+		names = append(names, f.DBName)
+	}
+	return names
+}
+
+// toSnakeCase converts a Go field name to the snake_case name GORM uses for columns.
+func toSnakeCase(name string) string {
+	return schema.NamingStrategy{}.ColumnName("", name)
+}
+
+// lookup resolves a field name or dotted path. The options of the result only allow what
+// every relation traversed and the field itself allow.
+func (r *fieldRegistry) lookup(name string) (fieldPath, common.QueryOptions, bool) {
+	path := fieldPath{}
+	options := common.QueryOptions{Filterable: true, Sortable: true}
+	current := r.schema
+
+	segments := strings.Split(name, ".")
+	for _, segment := range segments[:len(segments)-1] {
+		relation, ok := r.namesOf(current).relations[segment]
+		if !ok {
+			return fieldPath{}, options, false
+		}
+		path.relations = append(path.relations, relation.Relationship)
+		options.Filterable = options.Filterable && relation.Options.Filterable
+		options.Sortable = options.Sortable && relation.Options.Sortable
+		current = relation.Relationship.FieldSchema
+	}
+
+	field, ok := r.namesOf(current).fields[segments[len(segments)-1]]
+	if !ok {
+		return fieldPath{}, options, false
+	}
+	path.column = field.Column
+	options.Filterable = options.Filterable && field.Options.Filterable
+	options.Sortable = options.Sortable && field.Options.Sortable
+	return path, options, true
+}
+
+// filterField returns the path of a field that is used in a filter.
+func (r *fieldRegistry) filterField(name string) (fieldPath, error) {
+	path, options, ok := r.lookup(name)
+	if !ok {
+		return fieldPath{}, &filter.FieldError{Field: name, Err: filter.ErrUnknownField}
+	}
+	if !options.Filterable {
+		return fieldPath{}, &filter.FieldError{Field: name, Err: filter.ErrNotFilterable}
+	}
+	return path, nil
+}
+
+// sortField returns the path of a field that is used in an order by.
+func (r *fieldRegistry) sortField(name string) (fieldPath, error) {
+	path, options, ok := r.lookup(name)
+	if !ok {
+		return fieldPath{}, fmt.Errorf("%w: %s", order.ErrUnknownField, name)
+	}
+	if !options.Sortable {
+		return fieldPath{}, fmt.Errorf("%w: %s", order.ErrNotSortable, name)
+	}
+	return path, nil
+}
+
+// resolveFilter returns a copy of f in which every field name has been replaced by its column.
+// Leaves on fields of related entities become relationLeafs, and the values of searches
+// searchQuerys.
+func (r *fieldRegistry) resolveFilter(f filter.Filter) (filter.Filter, error) {
+	switch f := f.(type) {
+	case nil:
+		return nil, nil
+	case filter.Leaf:
+		path, err := r.filterField(f.Field)
+		if err != nil {
+			return nil, err
+		}
+		if f.Comparator == filter.ComparatorSearch && f.Value != nil {
+			table := r.schema.Table
+			if len(path.relations) > 0 {
+				table = path.relations[len(path.relations)-1].FieldSchema.Table
+			}
+			f.Value = searchQuery{text: fmt.Sprint(f.Value), indexed: r.searchIndexes[table]}
+		}
+		if len(path.relations) > 0 {
+			return relationLeaf{Leaf: f, path: path}, nil
+		}
+		f.Field = path.column
+		return f, nil
+	case filter.Composite:
+		filters := make([]filter.Filter, 0, len(f.Filters))
+		for _, child := range f.Filters {
+			resolved, err := r.resolveFilter(child)
+			if err != nil {
+				return nil, err
+			}
+			filters = append(filters, resolved)
+		}
+		return filter.Composite{Operator: f.Operator, Filters: filters}, nil
+	}
+	return nil, fmt.Errorf("unsupported filter type %T", f)
+}
+
+// resolveOrder resolves the fields of orderBys to the columns to sort by.
+func (r *fieldRegistry) resolveOrder(orderBys []order.OrderBy) ([]sortColumn, error) {
+	resolved := make([]sortColumn, 0, len(orderBys))
+	for _, orderBy := range orderBys {
+		path, err := r.sortField(orderBy.Field)
+		if err != nil {
+			return nil, err
+		}
+		if orderBy.Direction != order.Asc && orderBy.Direction != order.Desc {
+			return nil, fmt.Errorf("%w: %s", order.ErrInvalidDirection, orderBy.Direction)
+		}
+		resolved = append(resolved, sortColumn{path: path, desc: orderBy.Direction == order.Desc})
+	}
+	return resolved, nil
+}
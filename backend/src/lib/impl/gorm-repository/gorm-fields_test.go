@@ -0,0 +1,110 @@
+package gorm_impl
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cmo7/folly4/src/lib/generics/filter"
+	"github.com/cmo7/folly4/src/lib/generics/order"
+	"github.com/cmo7/folly4/src/lib/generics/pagination"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestFieldRegistryNames(t *testing.T) {
+	registry, err := parentRepository.fields()
+	assert.Nil(t, err)
+
+	for _, name := range []string{"Nickname", "nickname", "BirthDate", "birth_date", "position", "Rank", "rank"} {
+		_, err := registry.filterField(name)
+		assert.Nil(t, err, name)
+	}
+
+	path, err := registry.filterField("position")
+	assert.Nil(t, err)
+	assert.Equal(t, "rank", path.column)
+	assert.Empty(t, path.relations)
+
+	path, err = registry.filterField("Children.siblings.name")
+	assert.Nil(t, err)
+	assert.Equal(t, "name", path.column)
+	assert.Len(t, path.relations, 2)
+
+	_, err = registry.filterField("Children")
+	assert.True(t, errors.Is(err, filter.ErrUnknownField))
+	_, err = registry.filterField("children.unknown")
+	assert.True(t, errors.Is(err, filter.ErrUnknownField))
+	_, err = registry.filterField("secret")
+	assert.True(t, errors.Is(err, filter.ErrNotFilterable))
+	_, err = registry.filterField("children.parent.secret")
+	assert.True(t, errors.Is(err, filter.ErrNotFilterable))
+	_, err = registry.sortField("secret")
+	assert.True(t, errors.Is(err, order.ErrNotSortable))
+	_, err = registry.sortField("position")
+	assert.True(t, errors.Is(err, order.ErrNotSortable))
+	_, err = registry.sortField("name; DROP TABLE parent_entities")
+	assert.True(t, errors.Is(err, order.ErrUnknownField))
+}
+
+func TestFindAllRejectsFields(t *testing.T) {
+	setupTest(t)
+	ctx := createContext(t, 5*time.Second)
+	pageable := pagination.Pageable{Page: 1, Size: 10}
+
+	testCases := []struct {
+		name     string
+		filter   filter.Filter
+		orderBys []order.OrderBy
+		expected error
+	}{
+		{"unknown filter field", filter.Equal("unknown", "x"), nil, filter.ErrUnknownField},
+		{"nested unknown filter field", filter.And(filter.Equal("name", "x"), filter.Not(filter.Equal("1=1 OR name", "x"))), nil, filter.ErrUnknownField},
+		{"non filterable field", filter.Equal("Secret", "x"), nil, filter.ErrNotFilterable},
+		{"unknown sort field", nil, []order.OrderBy{order.AscOrderBy("name DESC, (SELECT 1)")}, order.ErrUnknownField},
+		{"non sortable field", nil, []order.OrderBy{order.DescOrderBy("secret")}, order.ErrNotSortable},
+		{"invalid direction", nil, []order.OrderBy{{Field: "name", Direction: "sideways"}}, order.ErrInvalidDirection},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parentRepository.FindAll(ctx, pageable, tc.filter, nil, tc.orderBys)
+			assert.True(t, errors.Is(err, tc.expected), "FindAll error = %v", err)
+			_, err = parentRepository.ComboBox(ctx, pageable, tc.filter, nil, tc.orderBys)
+			assert.True(t, errors.Is(err, tc.expected), "ComboBox error = %v", err)
+		})
+	}
+
+	_, err := parentRepository.Count(ctx, filter.Equal("secret", "x"))
+	assert.True(t, errors.Is(err, filter.ErrNotFilterable))
+	_, err = parentRepository.First(ctx, filter.Equal("unknown", "x"))
+	assert.True(t, errors.Is(err, filter.ErrUnknownField))
+}
+
+func TestFindAllMapsFieldsToColumns(t *testing.T) {
+	setupTest(t)
+	seedFilterParents(t)
+	ctx := createContext(t, 5*time.Second)
+
+	page, err := parentRepository.FindAll(ctx, pagination.Pageable{Page: 1, Size: 10},
+		filter.GreaterThan("Age", 25), nil, []order.OrderBy{order.DescOrderBy("Name")})
+	assert.Nil(t, err)
+
+	names := []string{}
+	for _, p := range page.Content {
+		names = append(names, p.Name)
+	}
+	assert.Equal(t, []string{"Dave", "Charlie", "Alice"}, names)
+}
+
+func TestScopeOrderSQL(t *testing.T) {
+	db := parentRepository.db.Session(&gorm.Session{DryRun: true})
+	registry, err := parentRepository.fields()
+	assert.Nil(t, err)
+	columns, err := registry.resolveOrder([]order.OrderBy{order.AscOrderBy("name"), order.DescOrderBy("age")})
+	assert.Nil(t, err)
+
+	stmt := db.Model(&ParentEntity{}).Scopes(scopeOrder(columns)).Find(&[]ParentEntity{}).Statement
+
+	assert.Contains(t, stmt.SQL.String(), "ORDER BY `parent_entities`.`name`,`parent_entities`.`age` DESC")
+}
@@ -0,0 +1,198 @@
+package gorm_impl
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+
+	"github.com/cmo7/folly4/src/data/database"
+	"github.com/cmo7/folly4/src/lib/generics/order"
+	"github.com/cmo7/folly4/src/lib/generics/pagination"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+/**
+* Keyset pagination reads the rows that follow the sort keys of the last row of the previous page,
+* instead of skipping the rows of the previous pages with OFFSET:
+*
+*	ORDER BY created_at, id
+*	WHERE created_at > ? OR (created_at = ? AND id > ?)
+*
+* NULL sorts lower than any value, as SQLite and MySQL do. Postgres is told so with NULLS FIRST/LAST.
+ */
+
+var scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+// keysetColumn is a sort key of a keyset paginated listing.
+type keysetColumn struct {
+	field    *schema.Field
+	desc     bool
+	nullable bool
+}
+
+// key identifies the column and direction in cursors.
+func (c keysetColumn) key() string {
+	if c.desc {
+		return c.field.DBName + ":" + string(order.Desc)
+	}
+	return c.field.DBName + ":" + string(order.Asc)
+}
+
+func (c keysetColumn) column() clause.Column {
+	return clause.Column{Table: clause.CurrentTable, Name: c.field.DBName}
+}
+
+// reversed returns the sort keys that read the listing backwards.
+func reversed(columns []keysetColumn) []keysetColumn {
+	out := slices.Clone(columns)
+	for i := range out {
+		out[i].desc = !out[i].desc
+	}
+	return out
+}
+
+// keysetColumns returns the sort keys of a listing ordered by orderBys, already resolved to columns,
+// followed by the primary key. Fields of related entities cannot be keys: their sort value is an aggregate.
+func keysetColumns(s *schema.Schema, orderBys []order.OrderBy, columns []sortColumn) ([]keysetColumn, error) {
+	primaryKey := s.PrioritizedPrimaryField
+	if primaryKey == nil {
+		return nil, fmt.Errorf("keyset pagination of %s requires a primary key", s.Name)
+	}
+
+	keys := make([]keysetColumn, 0, len(columns)+1)
+	for i, c := range columns {
+		if len(c.path.relations) > 0 {
+			return nil, fmt.Errorf("%w: %s cannot be sorted with a cursor", order.ErrNotSortable, orderBys[i].Field)
+		}
+		field := s.LookUpField(c.path.column)
+		if field == nil {
+			return nil, fmt.Errorf("%w: %s", order.ErrUnknownField, orderBys[i].Field)
+		}
+		keys = append(keys, keysetColumn{field: field, desc: c.desc, nullable: nullable(field)})
+		if field == primaryKey {
+			// Rows are unique from here on, later keys never decide anything.
+			return keys, nil
+		}
+	}
+	return append(keys, keysetColumn{field: primaryKey}), nil
+}
+
+// nullable reports whether a column may hold NULL.
+func nullable(f *schema.Field) bool {
+	if f.PrimaryKey || f.NotNull {
+		return false
+	}
+	return f.FieldType.Kind() == reflect.Ptr || reflect.PointerTo(f.FieldType).Implements(scannerType)
+}
+
+// keysetPosition returns the position of a row.
+func keysetPosition(ctx context.Context, columns []keysetColumn, row reflect.Value, backward bool) (pagination.CursorPosition, error) {
+	row = reflect.Indirect(row)
+	position := pagination.CursorPosition{Backward: backward}
+	for _, c := range columns {
+		value, _ := c.field.ValueOf(ctx, row)
+		data, err := json.Marshal(value)
+		if err != nil {
+			return pagination.CursorPosition{}, fmt.Errorf("encoding cursor value of %s: %w", c.field.Name, err)
+		}
+		position.Keys = append(position.Keys, c.key())
+		position.Values = append(position.Values, data)
+	}
+	return position, nil
+}
+
+// keysetValues decodes the values of a position into the types of the columns. The position must
+// have been issued for the same sort keys.
+func keysetValues(columns []keysetColumn, position pagination.CursorPosition) ([]interface{}, error) {
+	if len(position.Keys) != len(columns) {
+		return nil, pagination.ErrInvalidCursor
+	}
+	values := make([]interface{}, len(columns))
+	for i, c := range columns {
+		if position.Keys[i] != c.key() {
+			return nil, pagination.ErrInvalidCursor
+		}
+		raw := bytes.TrimSpace(position.Values[i])
+		if bytes.Equal(raw, []byte("null")) {
+			continue
+		}
+		value := reflect.New(c.field.FieldType)
+		if err := json.Unmarshal(raw, value.Interface()); err != nil {
+			return nil, pagination.ErrInvalidCursor
+		}
+		values[i] = value.Elem().Interface()
+	}
+	return values, nil
+}
+
+// keysetCondition selects the rows that come after values in the order of columns,
+// and the row at values too if inclusive.
+func keysetCondition(columns []keysetColumn, values []interface{}, inclusive bool) clause.Expression {
+	alternatives := []clause.Expression{}
+	ties := []clause.Expression{}
+	for i, c := range columns {
+		column := c.column()
+		if after := c.after(column, values[i]); after != nil {
+			alternatives = append(alternatives, group(" AND ", append(slices.Clone(ties), after)))
+		}
+		if values[i] == nil {
+			ties = append(ties, clause.Expr{SQL: "? IS NULL", Vars: []interface{}{column}})
+		} else {
+			ties = append(ties, clause.Expr{SQL: "? = ?", Vars: []interface{}{column, values[i]}})
+		}
+	}
+	if inclusive {
+		alternatives = append(alternatives, group(" AND ", ties))
+	}
+	if len(alternatives) == 0 {
+		return alwaysFalse
+	}
+	return group(" OR ", alternatives)
+}
+
+// after selects the rows whose column comes strictly after value, or returns nil if none can.
+func (c keysetColumn) after(column clause.Column, value interface{}) clause.Expression {
+	switch {
+	case !c.desc && value == nil:
+		return clause.Expr{SQL: "? IS NOT NULL", Vars: []interface{}{column}}
+	case !c.desc:
+		return clause.Expr{SQL: "? > ?", Vars: []interface{}{column, value}}
+	case value == nil:
+		return nil
+	case c.nullable:
+		return clause.Expr{SQL: "(? < ? OR ? IS NULL)", Vars: []interface{}{column, value, column}}
+	}
+	return clause.Expr{SQL: "? < ?", Vars: []interface{}{column, value}}
+}
+
+// keysetOrder is the ORDER BY of a keyset listing.
+type keysetOrder []keysetColumn
+
+func (o keysetOrder) Build(builder clause.Builder) {
+	postgres := false
+	if stmt, ok := builder.(*gorm.Statement); ok {
+		postgres = database.Engine(stmt.Dialector.Name()) == database.Postgres
+	}
+	for i, c := range o {
+		if i > 0 {
+			builder.WriteByte(',')
+		}
+		builder.WriteQuoted(c.column())
+		if c.desc {
+			builder.WriteString(" DESC")
+		}
+		if postgres && c.nullable {
+			if c.desc {
+				builder.WriteString(" NULLS LAST")
+			} else {
+				builder.WriteString(" NULLS FIRST")
+			}
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package gorm_impl
+
+import (
+	"cmp"
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/cmo7/folly4/src/lib/generics/filter"
+	"github.com/cmo7/folly4/src/lib/generics/order"
+	"github.com/cmo7/folly4/src/lib/generics/pagination"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func seedKeysetParents(t *testing.T) []ParentEntity {
+	ctx := createContext(t, 5*time.Second)
+	nick := func(s string) *string { return &s }
+	parents := []ParentEntity{
+		{Name: "Alice", Age: 30, Nickname: nick("ali")},
+		{Name: "Bob", Age: 25},
+		{Name: "Charlie", Age: 30, Nickname: nick("chuck")},
+		{Name: "Dave", Age: 35},
+		{Name: "Eve", Age: 30},
+		{Name: "Frank", Age: 25, Nickname: nick("frankie")},
+		{Name: "Grace", Age: 40, Nickname: nick("ali")},
+	}
+	for i := range parents {
+		_, err := parentRepository.Create(ctx, &parents[i])
+		assert.Nil(t, err)
+	}
+	return parents
+}
+
+// walkCursor reads a whole listing page by page, forwards and then backwards, and returns the
+// ids read in each direction.
+func walkCursor(t *testing.T, f filter.Filter, orderBys ...order.OrderBy) ([]string, []string) {
+	ctx := createContext(t, 5*time.Second)
+	forward := []string{}
+	pages := [][]string{}
+	cursor := pagination.Cursor("")
+	var last pagination.Page[*ParentEntity]
+	for i := 0; ; i++ {
+		page, err := parentRepository.FindAllCursor(ctx, pagination.NewCursorPageable(cursor, 2), f, nil, orderBys)
+		assert.Nil(t, err)
+		assert.True(t, page.Keyset())
+		assert.Equal(t, i > 0, page.PrevCursor != "", "only the first page has no previous page")
+		ids := []string{}
+		for _, p := range page.Content {
+			ids = append(ids, p.ID.String())
+		}
+		forward = append(forward, ids...)
+		pages = append(pages, ids)
+		last = page
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	backward := slices.Clone(pages[len(pages)-1])
+	for i := len(pages) - 2; i >= 0 && last.PrevCursor != ""; i-- {
+		page, err := parentRepository.FindAllCursor(ctx, pagination.NewCursorPageable(last.PrevCursor, 2), f, nil, orderBys)
+		assert.Nil(t, err)
+		assert.NotEqual(t, "", page.NextCursor, "a page read backwards has a next page")
+		ids := []string{}
+		for _, p := range page.Content {
+			ids = append(ids, p.ID.String())
+		}
+		assert.Equal(t, pages[i], ids, "pages must be the same in both directions")
+		backward = append(ids, backward...)
+		last = page
+	}
+	assert.Equal(t, pagination.Cursor(""), last.PrevCursor, "the first page has no previous page")
+	return forward, backward
+}
+
+func TestFindAllCursor(t *testing.T) {
+	setupTest(t)
+	parents := seedKeysetParents(t)
+
+	nickname := func(p ParentEntity) string {
+		if p.Nickname == nil {
+			return ""
+		}
+		return "~" + *p.Nickname // NULL sorts before any value.
+	}
+	tests := []struct {
+		name     string
+		orderBys []order.OrderBy
+		f        filter.Filter
+		compare  func(a, b ParentEntity) int
+		keep     func(p ParentEntity) bool
+	}{
+		{"id", nil, nil, func(a, b ParentEntity) int { return 0 }, nil},
+		{"age asc", []order.OrderBy{order.AscOrderBy("age")}, nil,
+			func(a, b ParentEntity) int { return cmp.Compare(a.Age, b.Age) }, nil},
+		{"age desc, name", []order.OrderBy{order.DescOrderBy("age"), order.AscOrderBy("name")}, nil,
+			func(a, b ParentEntity) int { return cmp.Or(cmp.Compare(b.Age, a.Age), cmp.Compare(a.Name, b.Name)) }, nil},
+		{"nullable asc", []order.OrderBy{order.AscOrderBy("nickname")}, nil,
+			func(a, b ParentEntity) int { return cmp.Compare(nickname(a), nickname(b)) }, nil},
+		{"nullable desc", []order.OrderBy{order.DescOrderBy("nickname")}, nil,
+			func(a, b ParentEntity) int { return cmp.Compare(nickname(b), nickname(a)) }, nil},
+		{"filtered", []order.OrderBy{order.AscOrderBy("age")}, filter.NotEqual("age", 35),
+			func(a, b ParentEntity) int { return cmp.Compare(a.Age, b.Age) },
+			func(p ParentEntity) bool { return p.Age != 35 }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expected := []string{}
+			sorted := slices.Clone(parents)
+			slices.SortFunc(sorted, func(a, b ParentEntity) int {
+				return cmp.Or(test.compare(a, b), cmp.Compare(a.ID.String(), b.ID.String()))
+			})
+			for _, p := range sorted {
+				if test.keep == nil || test.keep(p) {
+					expected = append(expected, p.ID.String())
+				}
+			}
+
+			forward, backward := walkCursor(t, test.f, test.orderBys...)
+			assert.Equal(t, expected, forward)
+			assert.Equal(t, expected, backward)
+		})
+	}
+}
+
+func TestFindAllCursorStableUnderInserts(t *testing.T) {
+	setupTest(t)
+	seedKeysetParents(t)
+	ctx := createContext(t, 5*time.Second)
+	orderBys := []order.OrderBy{order.AscOrderBy("age")}
+
+	first, err := parentRepository.FindAllCursor(ctx, pagination.NewCursorPageable("", 3), nil, nil, orderBys)
+	assert.Nil(t, err)
+	// A row inserted before the position does not shift the following pages.
+	_, err = parentRepository.Create(ctx, &ParentEntity{Name: "Young", Age: 1})
+	assert.Nil(t, err)
+
+	second, err := parentRepository.FindAllCursor(ctx, pagination.NewCursorPageable(first.NextCursor, 3), nil, nil, orderBys)
+	assert.Nil(t, err)
+	offset, err := parentRepository.FindAll(ctx, pagination.NewPageable(2, 3), nil, nil, append(orderBys, order.AscOrderBy("id")))
+	assert.Nil(t, err)
+
+	assert.Equal(t, 30, first.Content[2].Age)
+	assert.NotEqual(t, first.Content[2].ID, second.Content[0].ID)
+	assert.Equal(t, first.Content[2].ID, offset.Content[0].ID, "offset pagination repeats the last row")
+
+	// A page whose rows were all deleted is empty and leads back.
+	third, err := parentRepository.FindAllCursor(ctx, pagination.NewCursorPageable(second.NextCursor, 3), nil, nil, orderBys)
+	assert.Nil(t, err)
+	assert.Len(t, third.Content, 1)
+	assert.Nil(t, parentRepository.Delete(ctx, third.Content[0]))
+	last, err := parentRepository.FindAllCursor(ctx, pagination.NewCursorPageable(second.NextCursor, 3), nil, nil, orderBys)
+	assert.Nil(t, err)
+	assert.Len(t, last.Content, 0)
+	assert.Equal(t, pagination.Cursor(""), last.NextCursor)
+	back, err := parentRepository.FindAllCursor(ctx, pagination.NewCursorPageable(last.PrevCursor, 3), nil, nil, orderBys)
+	assert.Nil(t, err)
+	assert.Equal(t, second.Content[len(second.Content)-1].ID, back.Content[len(back.Content)-1].ID)
+}
+
+func TestFindAllCursorErrors(t *testing.T) {
+	setupTest(t)
+	seedKeysetParents(t)
+	ctx := createContext(t, 5*time.Second)
+
+	page, err := parentRepository.FindAllCursor(ctx, pagination.NewCursorPageable("", 2), nil, nil, []order.OrderBy{order.AscOrderBy("age")})
+	assert.Nil(t, err)
+
+	empty, err := pagination.CursorPosition{}.Encode()
+	assert.Nil(t, err)
+	tests := []struct {
+		cursor   pagination.Cursor
+		orderBys []order.OrderBy
+		expected error
+	}{
+		{"not a cursor!", nil, pagination.ErrInvalidCursor},
+		{empty, nil, pagination.ErrInvalidCursor},
+		{page.NextCursor, []order.OrderBy{order.DescOrderBy("age")}, pagination.ErrInvalidCursor},
+		{page.NextCursor, nil, pagination.ErrInvalidCursor},
+		{"", []order.OrderBy{order.AscOrderBy("children.name")}, order.ErrNotSortable},
+		{"", []order.OrderBy{order.AscOrderBy("position")}, order.ErrNotSortable},
+	}
+	for _, test := range tests {
+		_, err := parentRepository.FindAllCursor(ctx, pagination.NewCursorPageable(test.cursor, 2), nil, nil, test.orderBys)
+		assert.ErrorIs(t, err, test.expected)
+	}
+
+	tampered := pagination.CursorPosition{Keys: []string{"age:asc", "id:asc"}, Values: []json.RawMessage{[]byte(`"x"`), []byte(`"y"`)}}
+	cursor, err := tampered.Encode()
+	assert.Nil(t, err)
+	_, err = parentRepository.FindAllCursor(ctx, pagination.NewCursorPageable(cursor, 2), nil, nil, []order.OrderBy{order.AscOrderBy("age")})
+	assert.ErrorIs(t, err, pagination.ErrInvalidCursor)
+}
+
+func TestScopeKeysetSQL(t *testing.T) {
+	registry, err := parentRepository.fields()
+	assert.Nil(t, err)
+	orderBys := []order.OrderBy{order.DescOrderBy("nickname"), order.AscOrderBy("age")}
+	columns, err := registry.resolveOrder(orderBys)
+	assert.Nil(t, err)
+	keys, err := keysetColumns(registry.schema, orderBys, columns)
+	assert.Nil(t, err)
+	values := []interface{}{"ali", 30, "6ba7b810-9dad-11d1-80b4-00c04fd430c8"}
+
+	db := parentRepository.db.Session(&gorm.Session{DryRun: true})
+	stmt := db.Model(&ParentEntity{}).Scopes(scopeKeyset(keys, values, false, 3)).Find(&[]ParentEntity{}).Statement
+	assert.Contains(t, stmt.SQL.String(),
+		"WHERE ((`parent_entities`.`nickname` < ? OR `parent_entities`.`nickname` IS NULL) OR "+
+			"(`parent_entities`.`nickname` = ? AND `parent_entities`.`age` > ?) OR "+
+			"(`parent_entities`.`nickname` = ? AND `parent_entities`.`age` = ? AND `parent_entities`.`id` > ?)) "+
+			"ORDER BY `parent_entities`.`nickname` DESC,`parent_entities`.`age`,`parent_entities`.`id` LIMIT 3")
+
+	pg, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	assert.Nil(t, err)
+	stmt = pg.Model(&ParentEntity{}).Scopes(scopeKeyset(reversed(keys), nil, false, 3)).Find(&[]ParentEntity{}).Statement
+	assert.Contains(t, stmt.SQL.String(), `ORDER BY "parent_entities"."nickname" NULLS FIRST,"parent_entities"."age" DESC,"parent_entities"."id" DESC LIMIT $1`)
+}
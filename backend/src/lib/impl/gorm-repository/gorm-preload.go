@@ -0,0 +1,70 @@
+package gorm_impl
+
+import (
+	"fmt"
+
+	"github.com/cmo7/folly4/src/lib/generics/fieldset"
+	"github.com/cmo7/folly4/src/lib/generics/filter"
+	"github.com/cmo7/folly4/src/lib/generics/relation"
+	"gorm.io/gorm/schema"
+)
+
+// preload is a relation to load, resolved against the GORM schema: the path GORM knows the
+// relation by, the resolved filter and order of the entities it loads and the columns it reads.
+type preload struct {
+	path    string // GORM relation path, such as "Roles.Permissions".
+	filter  filter.Filter
+	columns []sortColumn
+	selects []string // Nil reads every column.
+}
+
+// conditional reports whether the preload restricts, orders or narrows the entities it loads.
+func (p preload) conditional() bool {
+	return p.filter != nil || len(p.columns) > 0 || p.selects != nil
+}
+
+// resolveRelations validates a tree of relations against the schema of the entity and flattens
+// it into the preloads GORM runs, parents before their nested relations. The fieldset narrows
+// the columns read for the relations it names.
+func (r *fieldRegistry) resolveRelations(relations []relation.Relation, fs fieldset.Fieldset) ([]preload, error) {
+	return r.resolveRelationsAt(r.schema, "", "", relations, fs)
+}
+
+// resolveRelationsAt resolves relations of s, which is reached by the GORM path prefix and the
+// client path name.
+func (r *fieldRegistry) resolveRelationsAt(s *schema.Schema, prefix string, name string, relations []relation.Relation, fs fieldset.Fieldset) ([]preload, error) {
+	preloads := []preload{}
+	for _, rel := range relations {
+		clientPath := rel.Name
+		if name != "" {
+			clientPath = name + "." + rel.Name
+		}
+		registered, ok := r.namesOf(s).relations[rel.Name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", relation.ErrUnknownRelation, clientPath)
+		}
+
+		related := r.rootedAt(registered.Relationship.FieldSchema)
+		p := preload{path: prefix + registered.Relationship.Name}
+		var err error
+		if p.filter, err = related.resolveFilter(rel.Filter); err != nil {
+			return nil, fmt.Errorf("relation %s: %w", clientPath, err)
+		}
+		if p.columns, err = related.resolveOrder(rel.Order); err != nil {
+			return nil, fmt.Errorf("relation %s: %w", clientPath, err)
+		}
+		if fields, ok := fs.Fields(p.path); ok {
+			if p.selects, err = selectColumns(related.schema, registered.Relationship, fields); err != nil {
+				return nil, fmt.Errorf("relation %s: %w", clientPath, err)
+			}
+		}
+
+		nested, err := r.resolveRelationsAt(related.schema, p.path+".", clientPath, rel.Relations, fs)
+		if err != nil {
+			return nil, err
+		}
+		preloads = append(preloads, p)
+		preloads = append(preloads, nested...)
+	}
+	return preloads, nil
+}
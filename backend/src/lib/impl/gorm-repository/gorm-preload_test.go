@@ -0,0 +1,97 @@
+package gorm_impl
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cmo7/folly4/src/lib/generics/filter"
+	"github.com/cmo7/folly4/src/lib/generics/order"
+	"github.com/cmo7/folly4/src/lib/generics/pagination"
+	"github.com/cmo7/folly4/src/lib/generics/relation"
+	"github.com/stretchr/testify/assert"
+)
+
+// findChildrenByParent reads the parents of seedRelationParents with the relations of spec
+// and returns the names of the children loaded for each parent.
+func findChildrenByParent(t *testing.T, spec string) map[string][]string {
+	ctx := createContext(t, 5*time.Second)
+	relations, err := relation.Parse(spec)
+	assert.Nil(t, err)
+	page, err := parentRepository.FindAll(ctx, pagination.Pageable{Page: 1, Size: 10}, nil, relations, []order.OrderBy{order.AscOrderBy("name")})
+	assert.Nil(t, err)
+
+	children := map[string][]string{}
+	for _, p := range page.Content {
+		names := []string{}
+		for _, c := range p.Children {
+			names = append(names, c.Name)
+		}
+		children[p.Name] = names
+	}
+	return children
+}
+
+func TestPreloadConditions(t *testing.T) {
+	setupTest(t)
+	seedRelationParents(t)
+
+	children := findChildrenByParent(t, "children(order=name:asc)")
+	assert.Equal(t, []string{"Amy", "Ann"}, children["Alice"])
+	assert.Equal(t, []string{"Ben"}, children["Bob"])
+	assert.Empty(t, children["Dave"])
+
+	children = findChildrenByParent(t, "children(order=name:desc)")
+	assert.Equal(t, []string{"Ann", "Amy"}, children["Alice"])
+
+	children = findChildrenByParent(t, "children(filter=name:like:A%;order=name:asc)")
+	assert.Equal(t, []string{"Amy", "Ann"}, children["Alice"])
+	assert.Empty(t, children["Bob"])
+
+	children = findChildrenByParent(t, "children(filter=name:eq:Amy)")
+	assert.Equal(t, []string{"Amy"}, children["Alice"])
+	assert.Empty(t, children["Charlie"])
+
+	children = findChildrenByParent(t, "children(filter=siblings.name:eq:Amy)")
+	assert.Equal(t, []string{"Ann"}, children["Alice"])
+}
+
+func TestPreloadNested(t *testing.T) {
+	setupTest(t)
+	seedRelationParents(t)
+	ctx := createContext(t, 5*time.Second)
+
+	relations, err := relation.Parse("children(filter=name:eq:Ann).siblings,children.parent")
+	assert.Nil(t, err)
+	parent, err := parentRepository.First(ctx, filter.Equal("name", "Alice"))
+	assert.Nil(t, err)
+	loaded, err := parentRepository.FindOne(ctx, parent.ID, relations)
+	assert.Nil(t, err)
+
+	assert.Len(t, loaded.Children, 1)
+	ann := loaded.Children[0]
+	assert.Equal(t, "Ann", ann.Name)
+	assert.Len(t, ann.Siblings, 1)
+	assert.Equal(t, "Amy", ann.Siblings[0].Name)
+	assert.Equal(t, "Alice", ann.Parent.Name)
+}
+
+func TestPreloadErrors(t *testing.T) {
+	setupTest(t)
+	ctx := createContext(t, 5*time.Second)
+
+	tests := []struct {
+		relations []relation.Relation
+		expected  error
+	}{
+		{[]relation.Relation{relation.New("kids")}, relation.ErrUnknownRelation},
+		{[]relation.Relation{relation.New("children.toys")}, relation.ErrUnknownRelation},
+		{[]relation.Relation{relation.New("children.name")}, relation.ErrUnknownRelation},
+		{[]relation.Relation{{Name: "children", Filter: filter.GreaterThan("age", 1)}}, filter.ErrUnknownField},
+		{[]relation.Relation{{Name: "children", Relations: []relation.Relation{{Name: "parent", Order: []order.OrderBy{order.AscOrderBy("position")}}}}}, order.ErrNotSortable},
+	}
+	for _, test := range tests {
+		_, err := parentRepository.FindAll(ctx, pagination.Pageable{Page: 1, Size: 10}, nil, test.relations, nil)
+		assert.True(t, errors.Is(err, test.expected), "%v: %v", test.relations, err)
+	}
+}
@@ -0,0 +1,208 @@
+package gorm_impl
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/cmo7/folly4/src/lib/generics/filter"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+/**
+* Fields of related entities are never joined into the main query, since joining a has-many
+* or many2many relation would repeat the rows of the root entity and break pagination and counts.
+* Instead they are reached through correlated subqueries:
+*
+*	roles.name:eq:admin  ->  EXISTS (SELECT 1 FROM user_roles rel_1_join INNER JOIN roles rel_1 ON ... WHERE ...)
+*	roles.name:asc       ->  ORDER BY (SELECT MIN(rel_1.name) FROM ...)
+ */
+
+// relationLeaf is a filter leaf on a column of a related entity.
+// It matches the root entity when at least one related row matches the leaf.
+type relationLeaf struct {
+	filter.Leaf // Field is the dotted path requested by the client.
+	path        fieldPath
+}
+
+// sortColumn is a resolved order by.
+type sortColumn struct {
+	path fieldPath
+	desc bool
+}
+
+var deletedAtType = reflect.TypeOf(gorm.DeletedAt{})
+
+// relationAlias is the alias of the i-th related table of a subquery. Aliasing by position
+// lets a path traverse the same table more than once, e.g. children.siblings.name.
+func relationAlias(i int) string {
+	return fmt.Sprintf("rel_%d", i+1)
+}
+
+// pathColumn returns the column at the end of a path, qualified by its table or alias.
+func pathColumn(path fieldPath) clause.Column {
+	if len(path.relations) == 0 {
+		return clause.Column{Table: clause.CurrentTable, Name: path.column}
+	}
+	return clause.Column{Table: relationAlias(len(path.relations) - 1), Name: path.column}
+}
+
+// relationSubquery selects from the tables reached by following relations from the current table.
+type relationSubquery struct {
+	relations []*schema.Relationship
+	selection clause.Expression
+	where     clause.Expression
+}
+
+// subqueryTable is a table of a relation subquery and the conditions that join it.
+type subqueryTable struct {
+	table      clause.Table
+	conditions []clause.Expression
+}
+
+func (q relationSubquery) Build(builder clause.Builder) {
+	tables := []subqueryTable{}
+	owner := clause.CurrentTable
+	for i, rel := range q.relations {
+		alias := relationAlias(i)
+		tables = append(tables, relationTables(rel, owner, alias)...)
+		owner = alias
+	}
+
+	builder.WriteString("(SELECT ")
+	q.selection.Build(builder)
+	builder.WriteString(" FROM ")
+	builder.WriteQuoted(tables[0].table)
+	for _, t := range tables[1:] {
+		builder.WriteString(" INNER JOIN ")
+		builder.WriteQuoted(t.table)
+		builder.WriteString(" ON ")
+		group(" AND ", t.conditions).Build(builder)
+	}
+
+	// The first table is correlated with the outer query in the WHERE clause.
+	conditions := tables[0].conditions
+	if q.where != nil {
+		conditions = append(conditions, q.where)
+	}
+	builder.WriteString(" WHERE ")
+	group(" AND ", conditions).Build(builder)
+	builder.WriteByte(')')
+}
+
+// relationTables returns the tables that must be joined to follow rel from the owner table.
+// A many2many relation goes through its join table first.
+func relationTables(rel *schema.Relationship, owner, alias string) []subqueryTable {
+	related := subqueryTable{table: clause.Table{Name: rel.FieldSchema.Table, Alias: alias}}
+
+	if rel.JoinTable == nil {
+		for _, ref := range rel.References {
+			switch {
+			case ref.PrimaryKey == nil:
+				related.conditions = append(related.conditions, equals(clause.Column{Table: alias, Name: ref.ForeignKey.DBName}, ref.PrimaryValue))
+			case ref.OwnPrimaryKey:
+				related.conditions = append(related.conditions, equals(clause.Column{Table: alias, Name: ref.ForeignKey.DBName}, clause.Column{Table: owner, Name: ref.PrimaryKey.DBName}))
+			default:
+				related.conditions = append(related.conditions, equals(clause.Column{Table: alias, Name: ref.PrimaryKey.DBName}, clause.Column{Table: owner, Name: ref.ForeignKey.DBName}))
+			}
+		}
+		related.conditions = append(related.conditions, notDeleted(rel.FieldSchema, alias)...)
+		return []subqueryTable{related}
+	}
+
+	joinAlias := alias + "_join"
+	join := subqueryTable{table: clause.Table{Name: rel.JoinTable.Table, Alias: joinAlias}}
+	for _, ref := range rel.References {
+		column := clause.Column{Table: joinAlias, Name: ref.ForeignKey.DBName}
+		switch {
+		case ref.PrimaryKey == nil:
+			join.conditions = append(join.conditions, equals(column, ref.PrimaryValue))
+		case ref.OwnPrimaryKey:
+			join.conditions = append(join.conditions, equals(column, clause.Column{Table: owner, Name: ref.PrimaryKey.DBName}))
+		default:
+			related.conditions = append(related.conditions, equals(column, clause.Column{Table: alias, Name: ref.PrimaryKey.DBName}))
+		}
+	}
+	related.conditions = append(related.conditions, notDeleted(rel.FieldSchema, alias)...)
+	return []subqueryTable{join, related}
+}
+
+func equals(left, right interface{}) clause.Expression {
+	return clause.Expr{SQL: "? = ?", Vars: []interface{}{left, right}}
+}
+
+// notDeleted excludes soft deleted rows of a related table, as GORM does for the root table.
+func notDeleted(s *schema.Schema, alias string) []clause.Expression {
+	for _, f := range s.Fields {
+		if f.FieldType == deletedAtType && f.DBName != "" {
+			return []clause.Expression{clause.Expr{SQL: "? IS NULL", Vars: []interface{}{clause.Column{Table: alias, Name: f.DBName}}}}
+		}
+	}
+	return nil
+}
+
+// relationCondition translates a relationLeaf into an EXISTS subquery.
+// An all leaf needs one subquery per value, since each value may be held by a different related row.
+func relationCondition(f relationLeaf) (clause.Expression, error) {
+	if f.Comparator == filter.ComparatorAll {
+		exprs := []clause.Expression{}
+		values := reflect.ValueOf(listValue(f.Value))
+		for i := 0; i < values.Len(); i++ {
+			expr, err := relationCondition(relationLeaf{Leaf: filter.Equal(f.Field, values.Index(i).Interface()), path: f.path})
+			if err != nil {
+				return nil, err
+			}
+			exprs = append(exprs, expr)
+		}
+		return group(" AND ", exprs), nil
+	}
+
+	related := f.path.relations[len(f.path.relations)-1].FieldSchema
+	condition, err := compare(pathColumn(f.path), related, f.Leaf)
+	if err != nil {
+		return nil, err
+	}
+	return exists{relationSubquery{
+		relations: f.path.relations,
+		selection: clause.Expr{SQL: "1"},
+		where:     condition,
+	}}, nil
+}
+
+// exists wraps a subquery in EXISTS.
+type exists struct {
+	subquery relationSubquery
+}
+
+func (e exists) Build(builder clause.Builder) {
+	builder.WriteString("EXISTS ")
+	e.subquery.Build(builder)
+}
+
+// orderList is the expression of an ORDER BY clause. A column of a related entity sorts by
+// its smallest value in ascending order and by its largest value in descending order.
+type orderList []sortColumn
+
+func (l orderList) Build(builder clause.Builder) {
+	for i, c := range l {
+		if i > 0 {
+			builder.WriteByte(',')
+		}
+		if len(c.path.relations) == 0 {
+			builder.WriteQuoted(pathColumn(c.path))
+		} else {
+			aggregate := "MIN(?)"
+			if c.desc {
+				aggregate = "MAX(?)"
+			}
+			relationSubquery{
+				relations: c.path.relations,
+				selection: clause.Expr{SQL: aggregate, Vars: []interface{}{pathColumn(c.path)}},
+			}.Build(builder)
+		}
+		if c.desc {
+			builder.WriteString(" DESC")
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package gorm_impl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cmo7/folly4/src/app/models"
+	"github.com/cmo7/folly4/src/lib/generics/filter"
+	"github.com/cmo7/folly4/src/lib/generics/order"
+	"github.com/cmo7/folly4/src/lib/generics/pagination"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// seedRelationParents creates the parents of seedFilterParents with these children:
+// Alice: Ann and Amy (siblings), Bob: Ben, Charlie: Cid, Dave: none.
+func seedRelationParents(t *testing.T) {
+	seedFilterParents(t)
+	ctx := createContext(t, 5*time.Second)
+
+	children := map[string][]string{"Alice": {"Ann", "Amy"}, "Bob": {"Ben"}, "Charlie": {"Cid"}}
+	created := map[string]*ChildEntity{}
+	for parentName, names := range children {
+		parent, err := parentRepository.First(ctx, filter.Equal("name", parentName))
+		assert.Nil(t, err)
+		for _, name := range names {
+			child, err := childRepository.Create(ctx, &ChildEntity{Name: name, ParentID: parent.ID})
+			assert.Nil(t, err)
+			created[name] = child
+		}
+	}
+	// Appending through the association would run the BeforeCreate hook of Amy again.
+	err := childRepository.db.Table("child_entity_siblings").
+		Create(map[string]interface{}{"child_entity_id": created["Ann"].ID, "sibling_id": created["Amy"].ID}).Error
+	assert.Nil(t, err)
+}
+
+func findChildNames(t *testing.T, f filter.Filter, orderBys ...order.OrderBy) []string {
+	ctx := createContext(t, 5*time.Second)
+	if len(orderBys) == 0 {
+		orderBys = []order.OrderBy{order.AscOrderBy("name")}
+	}
+	page, err := childRepository.FindAll(ctx, pagination.Pageable{Page: 1, Size: 10}, f, nil, orderBys)
+	assert.Nil(t, err)
+
+	names := []string{}
+	for _, c := range page.Content {
+		names = append(names, c.Name)
+	}
+	assert.Equal(t, int64(len(names)), page.Filtered)
+	return names
+}
+
+func TestRelationFilter(t *testing.T) {
+	setupTest(t)
+	seedRelationParents(t)
+
+	testCases := []struct {
+		name     string
+		filter   filter.Filter
+		expected []string
+	}{
+		{"has many", filter.Like("children.name", "A%"), []string{"Alice"}},
+		{"has many with a list", filter.In("Children.Name", []string{"Ben", "Cid"}), []string{"Bob", "Charlie"}},
+		{"negated has many", filter.Not(filter.IsNotNull("children.id")), []string{"Dave"}},
+		{"combined with root fields", filter.Or(filter.Equal("children.name", "Ben"), filter.GreaterThan("age", 35)), []string{"Bob", "Charlie"}},
+		{"nested many2many", filter.Equal("children.siblings.name", "Amy"), []string{"Alice"}},
+		{"back to the root table", filter.Equal("children.parent.name", "Bob"), []string{"Bob"}},
+		{"any", filter.Any("children.name", []string{"Ann", "Ben"}), []string{"Alice", "Bob"}},
+		{"all held by different rows", filter.All("children.name", []string{"Ann", "Amy"}), []string{"Alice"}},
+		{"all held by different parents", filter.All("children.name", []string{"Ann", "Ben"}), []string{}},
+		{"not all", filter.Not(filter.All("children.name", []string{"Ann", "Amy"})), []string{"Bob", "Charlie", "Dave"}},
+		{"ilike", filter.ILike("children.name", "c%"), []string{"Charlie"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, findNames(t, tc.filter))
+		})
+	}
+
+	// Alice has two matching children but is counted once.
+	ctx := createContext(t, 5*time.Second)
+	page, err := parentRepository.FindAll(ctx, pagination.Pageable{Page: 1, Size: 1}, filter.Like("children.name", "A%"), nil, nil)
+	assert.Nil(t, err)
+	assert.Len(t, page.Content, 1)
+	assert.Equal(t, int64(1), page.Filtered)
+	assert.Equal(t, int64(4), page.Total)
+
+	assert.Equal(t, []string{"Amy", "Ann"}, findChildNames(t, filter.Equal("parent.name", "Alice")))
+	assert.Equal(t, []string{"Ann"}, findChildNames(t, filter.Equal("siblings.name", "Amy")))
+	assert.Equal(t, []string{"Ann"}, findChildNames(t, filter.GreaterThan("siblings.parent.age", 25)))
+}
+
+func TestRelationOrder(t *testing.T) {
+	setupTest(t)
+	seedRelationParents(t)
+	ctx := createContext(t, 5*time.Second)
+
+	testCases := []struct {
+		name     string
+		orderBys []order.OrderBy
+		expected []string
+	}{
+		{"has many ascending", []order.OrderBy{order.AscOrderBy("children.name")}, []string{"Dave", "Alice", "Bob", "Charlie"}},
+		{"has many descending", []order.OrderBy{order.DescOrderBy("children.name")}, []string{"Charlie", "Bob", "Alice", "Dave"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			page, err := parentRepository.FindAll(ctx, pagination.Pageable{Page: 1, Size: 10}, nil, nil, tc.orderBys)
+			assert.Nil(t, err)
+			assert.Equal(t, int64(4), page.Filtered)
+
+			names := []string{}
+			for _, p := range page.Content {
+				names = append(names, p.Name)
+			}
+			assert.Equal(t, tc.expected, names)
+		})
+	}
+
+	assert.Equal(t, []string{"Cid", "Amy", "Ann", "Ben"},
+		findChildNames(t, nil, order.DescOrderBy("parent.age"), order.AscOrderBy("name")))
+}
+
+func TestRelationFilterSQL(t *testing.T) {
+	db := parentRepository.db.Session(&gorm.Session{DryRun: true})
+	repository := NewGormGenericRepository[*models.UserEntity](db)
+	registry, err := repository.fields()
+	assert.Nil(t, err)
+
+	f, err := registry.resolveFilter(filter.Equal("roles.name", "admin"))
+	assert.Nil(t, err)
+
+	stmt := db.Model(&models.UserEntity{}).Scopes(scopeFilter(f)).Find(&[]models.UserEntity{}).Statement
+
+	assert.Contains(t, stmt.SQL.String(), "EXISTS (SELECT 1 FROM `user_roles` `rel_1_join` "+
+		"INNER JOIN `role_entities` `rel_1` ON (`rel_1_join`.`role_entity_id` = `rel_1`.`id` AND `rel_1`.`deleted_at` IS NULL) "+
+		"WHERE (`rel_1_join`.`user_entity_id` = `user_entities`.`id` AND `rel_1`.`name` = ?))")
+	assert.Equal(t, []interface{}{"admin"}, stmt.Vars)
+}
@@ -1,11 +1,16 @@
 package gorm_impl
 
 import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+
 	"github.com/cmo7/folly4/src/lib/generics/filter"
-	"github.com/cmo7/folly4/src/lib/generics/order"
 	"github.com/cmo7/folly4/src/lib/generics/pagination"
-	"github.com/cmo7/folly4/src/lib/generics/relation"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
 )
 
 /**
@@ -13,138 +18,282 @@ import (
  */
 
 // scopePage recieves a Pageable and applies the limit and offset to the query.
+// Unless the rows are counted exactly, it reads one row more than the page holds,
+// which tells whether there is a next page.
 func scopePage(pageable pagination.Pageable) func(*gorm.DB) *gorm.DB {
 	// Validate the page and size
-	if pageable.Page < 1 {
-		pageable.Page = 1
-	}
-	if pageable.Size < 1 {
-		pageable.Size = 1
-	}
+	pageable = pageable.Normalized()
 	limit := pageable.Size
 	offset := pageable.Size * (pageable.Page - 1)
+	if pageable.Count != pagination.CountExact {
+		limit++
+	}
 	return func(db *gorm.DB) *gorm.DB {
 		return db.Limit(limit).Offset(offset)
 	}
 }
 
-// scopePreload recieves a list of relations and applies the preload to the query.
-func scopePreload(relations []relation.Relation) func(*gorm.DB) *gorm.DB {
+// scopeKeyset orders the query by the sort keys of a keyset listing and reads the rows that
+// come after values, or at them if inclusive, up to limit. Nil values read from the start of the listing.
+func scopeKeyset(columns []keysetColumn, values []interface{}, inclusive bool, limit int) func(*gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
-		for _, relation := range relations {
-			db = db.Preload(string(relation))
+		if values != nil {
+			db = db.Clauses(clause.Where{Exprs: []clause.Expression{keysetCondition(columns, values, inclusive)}})
 		}
-		return db
+		return db.Clauses(clause.OrderBy{Expression: keysetOrder(columns)}).Limit(limit)
 	}
 }
 
-// scopeOrder recieves a list of OrderBys and applies the order to the query.
-func scopeOrder(orderBys []order.OrderBy) func(*gorm.DB) *gorm.DB {
+// scopePreload recieves a list of resolved relations and applies the preload to the query.
+// Relations with a filter or an order load their entities with a conditional preload.
+func scopePreload(preloads []preload) func(*gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
-		for _, orderBy := range orderBys {
-			if orderBy.Direction == order.Asc {
-				db = db.Order(orderBy.Field)
-			} else {
-				db = db.Order(orderBy.Field + " DESC")
+		for _, p := range preloads {
+			if !p.conditional() {
+				db = db.Preload(p.path)
+				continue
 			}
+			db = db.Preload(p.path, func(tx *gorm.DB) *gorm.DB {
+				return tx.Scopes(scopeSelect(p.selects), scopeOrder(p.columns), scopeFilter(p.filter))
+			})
 		}
 		return db
 	}
 }
 
+// scopeSelect narrows the columns read by the query. Nil columns read every column.
+func scopeSelect(columns []string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if columns == nil {
+			return db
+		}
+		return db.Select(columns)
+	}
+}
+
+// scopeOrder recieves a list of resolved sort columns and applies the order to the query.
+// Columns are quoted, never concatenated.
+func scopeOrder(columns []sortColumn) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(columns) == 0 {
+			return db
+		}
+		return db.Clauses(clause.OrderBy{Expression: orderList(columns)})
+	}
+}
+
 // scopeFilter recieves a Filter and applies the filter to the query.
+// The fields of the filter must already be resolved to column names.
+// The filter is translated into a single WHERE expression with bound parameters.
+// A nil filter or an empty and() leaves the query unchanged.
 func scopeFilter(f filter.Filter) func(*gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
-		if f.IsComposite() {
-			return filterComposite(f.(filter.Composite))(db)
+		expr, err := filterExpression(f)
+		if err != nil {
+			db.AddError(err)
+			return db
 		}
-		return db
+		if expr == nil {
+			return db
+		}
+		return db.Clauses(clause.Where{Exprs: []clause.Expression{expr}})
+	}
+}
+
+// alwaysFalse is the condition of an or() without alternatives.
+var alwaysFalse = clause.Expr{SQL: "1 = 0"}
+
+// filterExpression translates a filter into a clause expression.
+// A nil expression means the filter does not restrict the query.
+func filterExpression(f filter.Filter) (clause.Expression, error) {
+	switch f := f.(type) {
+	case nil:
+		return nil, nil
+	case filter.Leaf:
+		return compare(clause.Column{Table: clause.CurrentTable, Name: f.Field}, nil, f)
+	case relationLeaf:
+		return relationCondition(f)
+	case filter.Composite:
+		return composite(f)
 	}
+	return nil, fmt.Errorf("unsupported filter type %T", f)
 }
 
-func filterComposite(f filter.Composite) func(*gorm.DB) *gorm.DB {
+func composite(f filter.Composite) (clause.Expression, error) {
+	exprs := make([]clause.Expression, 0, len(f.Filters))
+	for _, child := range f.Filters {
+		expr, err := filterExpression(child)
+		if err != nil {
+			return nil, err
+		}
+		if expr == nil {
+			// An unrestricted child makes an or() unrestricted and is a no-op in and()/not().
+			if f.Operator == filter.LogicalOr {
+				return nil, nil
+			}
+			continue
+		}
+		exprs = append(exprs, expr)
+	}
+
 	switch f.Operator {
 	case filter.LogicalAnd:
-		return andCompose(f.Filters)
+		return group(" AND ", exprs), nil
 	case filter.LogicalOr:
-		return orCompose(f.Filters)
+		if len(exprs) == 0 {
+			return alwaysFalse, nil
+		}
+		return group(" OR ", exprs), nil
 	case filter.LogicalNot:
-		return notCompose(f.Filters)
+		if len(f.Filters) == 0 {
+			return nil, fmt.Errorf("not() requires a filter")
+		}
+		if len(exprs) == 0 {
+			return alwaysFalse, nil
+		}
+		return negation{expr: group(" AND ", exprs)}, nil
 	}
-	return nil
+	return nil, fmt.Errorf("unsupported logical operator: %s", f.Operator)
 }
 
-func andCompose(filters []filter.Filter) func(*gorm.DB) *gorm.DB {
-	return func(db *gorm.DB) *gorm.DB {
-		for _, f := range filters {
-			if f.IsComposite() {
-				db = db.Where(filterComposite(f.(filter.Composite))(db))
-			} else {
-				db = db.Where(compare(f.(filter.Leaf))(db))
-			}
-		}
-		return db
+// groupExpression joins expressions with a logical operator and wraps them in parentheses.
+type groupExpression struct {
+	operator string
+	exprs    []clause.Expression
+}
+
+func group(operator string, exprs []clause.Expression) clause.Expression {
+	switch len(exprs) {
+	case 0:
+		return nil
+	case 1:
+		return exprs[0]
 	}
+	return groupExpression{operator: operator, exprs: exprs}
 }
 
-func orCompose(filters []filter.Filter) func(*gorm.DB) *gorm.DB {
-	return func(db *gorm.DB) *gorm.DB {
-		for _, f := range filters {
-			if f.IsComposite() {
-				db = db.Or(filterComposite(f.(filter.Composite))(db))
-			} else {
-				db = db.Or(compare(f.(filter.Leaf))(db))
-			}
+func (g groupExpression) Build(builder clause.Builder) {
+	builder.WriteByte('(')
+	for i, expr := range g.exprs {
+		if i > 0 {
+			builder.WriteString(g.operator)
 		}
-		return db
+		expr.Build(builder)
 	}
+	builder.WriteByte(')')
 }
 
-func notCompose(filters []filter.Filter) func(*gorm.DB) *gorm.DB {
-	return func(db *gorm.DB) *gorm.DB {
-		for _, f := range filters {
-			if f.IsComposite() {
-				db = db.Not(filterComposite(f.(filter.Composite))(db))
-			} else {
-				db = db.Not(compare(f.(filter.Leaf))(db))
-			}
+// negation wraps an expression in NOT (...).
+type negation struct {
+	expr clause.Expression
+}
+
+func (n negation) Build(builder clause.Builder) {
+	builder.WriteString("NOT (")
+	n.expr.Build(builder)
+	builder.WriteByte(')')
+}
+
+// compare translates a leaf on column into a comparison with a bound value.
+// s is the schema of the table of the column, or nil for the root entity.
+// A nil expression means the leaf does not restrict the query.
+func compare(column clause.Column, s *schema.Schema, f filter.Leaf) (clause.Expression, error) {
+	if f.Value == nil {
+		switch f.Comparator {
+		case filter.ComparatorEqual, filter.ComparatorIsNull:
+			return clause.Expr{SQL: "? IS NULL", Vars: []interface{}{column}}, nil
+		case filter.ComparatorNotEqual, filter.ComparatorIsNotNull:
+			return clause.Expr{SQL: "? IS NOT NULL", Vars: []interface{}{column}}, nil
 		}
-		return db
+		return nil, fmt.Errorf("comparator %s on field %s requires a value", f.Comparator, f.Field)
 	}
-}
 
-func compare(f filter.Leaf) func(*gorm.DB) *gorm.DB {
-	return func(db *gorm.DB) *gorm.DB {
-		if f.Value == nil {
-			return db
+	switch f.Comparator {
+	case filter.ComparatorEqual:
+		return clause.Expr{SQL: "? = ?", Vars: []interface{}{column, f.Value}}, nil
+	case filter.ComparatorNotEqual:
+		return clause.Expr{SQL: "? <> ?", Vars: []interface{}{column, f.Value}}, nil
+	case filter.ComparatorGreaterThan:
+		return clause.Expr{SQL: "? > ?", Vars: []interface{}{column, f.Value}}, nil
+	case filter.ComparatorGreaterThanOrEqual:
+		return clause.Expr{SQL: "? >= ?", Vars: []interface{}{column, f.Value}}, nil
+	case filter.ComparatorLessThan:
+		return clause.Expr{SQL: "? < ?", Vars: []interface{}{column, f.Value}}, nil
+	case filter.ComparatorLessThanOrEqual:
+		return clause.Expr{SQL: "? <= ?", Vars: []interface{}{column, f.Value}}, nil
+	case filter.ComparatorLike:
+		return clause.Expr{SQL: "? LIKE ?", Vars: []interface{}{column, f.Value}}, nil
+	case filter.ComparatorNotLike:
+		return clause.Expr{SQL: "? NOT LIKE ?", Vars: []interface{}{column, f.Value}}, nil
+	case filter.ComparatorILike:
+		// LOWER on both sides is the only case-insensitive match that SQLite, MySQL and Postgres share.
+		return clause.Expr{SQL: "LOWER(?) LIKE LOWER(?)", Vars: []interface{}{column, f.Value}}, nil
+	case filter.ComparatorStartsWith:
+		return likeLiteral(column, escapeLike(fmt.Sprint(f.Value))+"%"), nil
+	case filter.ComparatorEndsWith:
+		return likeLiteral(column, "%"+escapeLike(fmt.Sprint(f.Value))), nil
+	case filter.ComparatorContains:
+		return likeLiteral(column, "%"+escapeLike(fmt.Sprint(f.Value))+"%"), nil
+	case filter.ComparatorBetween:
+		values := reflect.ValueOf(f.Value)
+		if values.Kind() != reflect.Slice || values.Len() != 2 {
+			return nil, fmt.Errorf("comparator between on field %s requires two values", f.Field)
 		}
-		switch f.Comparator {
-		case filter.ComparatorEqual:
-			return db.Where(f.Field + " = ?")
-		case filter.ComparatorNotEqual:
-			return db.Where(f.Field + " != ?")
-		case filter.ComparatorGreaterThan:
-			return db.Where(f.Field + " > ?")
-		case filter.ComparatorGreaterThanOrEqual:
-			return db.Where(f.Field + " >= ?")
-		case filter.ComparatorLessThan:
-			return db.Where(f.Field + " < ?")
-		case filter.ComparatorLessThanOrEqual:
-			return db.Where(f.Field + " <= ?")
-		case filter.ComparatorLike:
-			return db.Where(f.Field + " LIKE ?")
-		case filter.ComparatorNotLike:
-			return db.Where(f.Field + " NOT LIKE ?")
-		case filter.ComparatorIn:
-			return db.Where(f.Field + " IN (?)")
-		case filter.ComparatorNotIn:
-			return db.Where(f.Field + " NOT IN (?)")
-		case filter.ComparatorIsNull:
-			return db.Where(f.Field + " IS NULL")
-		case filter.ComparatorIsNotNull:
-			return db.Where(f.Field + " IS NOT NULL")
-		default:
-			return db.Where(f.Field + " = ?")
+		return clause.Expr{SQL: "? BETWEEN ? AND ?", Vars: []interface{}{column, values.Index(0).Interface(), values.Index(1).Interface()}}, nil
+	case filter.ComparatorAll:
+		exprs := []clause.Expression{}
+		values := reflect.ValueOf(listValue(f.Value))
+		for i := 0; i < values.Len(); i++ {
+			exprs = append(exprs, clause.Expr{SQL: "? = ?", Vars: []interface{}{column, values.Index(i).Interface()}})
 		}
+		return group(" AND ", exprs), nil
+	case filter.ComparatorSearch:
+		query, ok := f.Value.(searchQuery)
+		if !ok {
+			query = searchQuery{text: fmt.Sprint(f.Value)}
+		}
+		return searchExpression{column: column, schema: s, query: query}, nil
+	case filter.ComparatorIn, filter.ComparatorAny:
+		// Nothing is in an empty list, not even NULL.
+		if reflect.ValueOf(listValue(f.Value)).Len() == 0 {
+			return alwaysFalse, nil
+		}
+		return clause.Expr{SQL: "? IN ?", Vars: []interface{}{column, listValue(f.Value)}}, nil
+	case filter.ComparatorNotIn:
+		if reflect.ValueOf(listValue(f.Value)).Len() == 0 {
+			return nil, nil
+		}
+		return clause.Expr{SQL: "? NOT IN ?", Vars: []interface{}{column, listValue(f.Value)}}, nil
+	case filter.ComparatorIsNull:
+		return clause.Expr{SQL: "? IS NULL", Vars: []interface{}{column}}, nil
+	case filter.ComparatorIsNotNull:
+		return clause.Expr{SQL: "? IS NOT NULL", Vars: []interface{}{column}}, nil
+	}
+	return nil, fmt.Errorf("unsupported comparator: %s", f.Comparator)
+}
+
+// likeEscape is the escape character of literal like patterns. Unlike a backslash it needs
+// no escaping in the string literals of any supported engine.
+const likeEscape = "!"
+
+// escapeLike escapes the wildcards of a value that must be matched literally.
+func escapeLike(value string) string {
+	return strings.NewReplacer(likeEscape, likeEscape+likeEscape, "%", likeEscape+"%", "_", likeEscape+"_").Replace(value)
+}
+
+func likeLiteral(column clause.Column, pattern string) clause.Expression {
+	return clause.Expr{SQL: "? LIKE ? ESCAPE '" + likeEscape + "'", Vars: []interface{}{column, pattern}}
+}
+
+// listValue returns the value of an in/not_in leaf as a slice, wrapping scalar values.
+// GORM expands slices into a parenthesized list of bound parameters.
+func listValue(value interface{}) interface{} {
+	if _, ok := value.(driver.Valuer); ok {
+		return []interface{}{value}
+	}
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Slice, reflect.Array:
+		return value
 	}
+	return []interface{}{value}
 }
@@ -0,0 +1,227 @@
+package gorm_impl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cmo7/folly4/src/lib/generics/filter"
+	"github.com/cmo7/folly4/src/lib/generics/order"
+	"github.com/cmo7/folly4/src/lib/generics/pagination"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func seedFilterParents(t *testing.T) {
+	ctx := createContext(t, 5*time.Second)
+	ali, chuck := "ali", "chuck"
+	parents := []ParentEntity{
+		{Name: "Alice", Age: 30, Nickname: &ali},
+		{Name: "Bob", Age: 25},
+		{Name: "Charlie", Age: 40, Nickname: &chuck},
+		{Name: "Dave", Age: 35},
+	}
+	for _, p := range parents {
+		_, err := parentRepository.Create(ctx, &p)
+		assert.Nil(t, err)
+	}
+}
+
+func findNames(t *testing.T, f filter.Filter) []string {
+	ctx := createContext(t, 5*time.Second)
+	page, err := parentRepository.FindAll(ctx, pagination.Pageable{Page: 1, Size: 10}, f, nil, []order.OrderBy{order.AscOrderBy("name")})
+	assert.Nil(t, err)
+
+	names := []string{}
+	for _, p := range page.Content {
+		names = append(names, p.Name)
+	}
+
+	count, err := parentRepository.Count(ctx, f)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(names)), count, "Count should match the number of rows found")
+	assert.Equal(t, page.Filtered, count)
+
+	// The filter must select the same rows when evaluated in memory.
+	var parents []ParentEntity
+	err = parentRepository.db.WithContext(ctx).Preload("Children.Parent").Preload("Children.Siblings").Order("name").Find(&parents).Error
+	assert.Nil(t, err)
+	matched := []string{}
+	for _, p := range parents {
+		ok, err := filter.Match(p, f)
+		assert.Nil(t, err)
+		if ok {
+			matched = append(matched, p.Name)
+		}
+	}
+	assert.Equal(t, names, matched, "filter.Match should agree with the database")
+	return names
+}
+
+func TestScopeFilterComparators(t *testing.T) {
+	setupTest(t)
+	seedFilterParents(t)
+
+	testCases := []struct {
+		name     string
+		filter   filter.Filter
+		expected []string
+	}{
+		{"eq", filter.Equal("name", "Bob"), []string{"Bob"}},
+		{"ne", filter.NotEqual("name", "Bob"), []string{"Alice", "Charlie", "Dave"}},
+		{"gt", filter.GreaterThan("age", 30), []string{"Charlie", "Dave"}},
+		{"ge", filter.GreaterThanOrEqual("age", 30), []string{"Alice", "Charlie", "Dave"}},
+		{"lt", filter.LessThan("age", 30), []string{"Bob"}},
+		{"le", filter.LessThanOrEqual("age", 30), []string{"Alice", "Bob"}},
+		{"like", filter.Like("name", "%li%"), []string{"Alice", "Charlie"}},
+		{"not_like", filter.NotLike("name", "%li%"), []string{"Bob", "Dave"}},
+		{"in", filter.In("age", []int{25, 40}), []string{"Bob", "Charlie"}},
+		{"in with a single value", filter.In("name", "Dave"), []string{"Dave"}},
+		{"in with an empty list", filter.In("name", []string{}), []string{}},
+		{"not_in", filter.NotIn("name", []string{"Alice", "Bob"}), []string{"Charlie", "Dave"}},
+		{"not_in with an empty list", filter.NotIn("nickname", []string{}), []string{"Alice", "Bob", "Charlie", "Dave"}},
+		{"not of in with an empty list", filter.Not(filter.In("nickname", []string{})), []string{"Alice", "Bob", "Charlie", "Dave"}},
+		{"is_null", filter.IsNull("nickname"), []string{"Bob", "Dave"}},
+		{"is_not_null", filter.IsNotNull("nickname"), []string{"Alice", "Charlie"}},
+		{"eq nil", filter.Equal("nickname", nil), []string{"Bob", "Dave"}},
+		{"between", filter.Between("age", 30, 35), []string{"Alice", "Dave"}},
+		{"starts_with", filter.StartsWith("name", "Ch"), []string{"Charlie"}},
+		{"ends_with", filter.EndsWith("name", "e"), []string{"Alice", "Charlie", "Dave"}},
+		{"contains", filter.Contains("name", "li"), []string{"Alice", "Charlie"}},
+		{"contains matches wildcards literally", filter.Contains("name", "_"), []string{}},
+		{"ilike", filter.ILike("name", "ALI%"), []string{"Alice"}},
+		{"any", filter.Any("age", []int{25, 40}), []string{"Bob", "Charlie"}},
+		{"all of one value", filter.All("age", []int{30}), []string{"Alice"}},
+		{"all of different values", filter.All("age", []int{30, 35}), []string{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, findNames(t, tc.filter))
+		})
+	}
+}
+
+func TestScopeFilterComposites(t *testing.T) {
+	setupTest(t)
+	seedFilterParents(t)
+
+	testCases := []struct {
+		name     string
+		filter   filter.Filter
+		expected []string
+	}{
+		{"nil filter", nil, []string{"Alice", "Bob", "Charlie", "Dave"}},
+		{"empty and", filter.And(), []string{"Alice", "Bob", "Charlie", "Dave"}},
+		{"empty or", filter.Or(), []string{}},
+		{"and", filter.And(filter.GreaterThan("age", 25), filter.IsNull("nickname")), []string{"Dave"}},
+		{"or", filter.Or(filter.Equal("name", "Alice"), filter.Equal("name", "Dave")), []string{"Alice", "Dave"}},
+		{"not leaf", filter.Not(filter.Equal("name", "Alice")), []string{"Bob", "Charlie", "Dave"}},
+		{"not and", filter.Not(filter.And(filter.Equal("name", "Alice"), filter.Equal("age", 30))), []string{"Bob", "Charlie", "Dave"}},
+		{"not or", filter.Not(filter.Or(filter.Equal("name", "Alice"), filter.Equal("name", "Bob"))), []string{"Charlie", "Dave"}},
+		{"or of ands", filter.Or(
+			filter.And(filter.GreaterThanOrEqual("age", 30), filter.IsNotNull("nickname")),
+			filter.Equal("name", "Bob"),
+		), []string{"Alice", "Bob", "Charlie"}},
+		{"and of ors", filter.And(
+			filter.Or(filter.Equal("name", "Alice"), filter.Equal("name", "Bob")),
+			filter.Or(filter.Equal("age", 25), filter.Equal("age", 40)),
+		), []string{"Bob"}},
+		{"or with an unrestricted branch", filter.Or(filter.Equal("name", "Alice"), filter.And()), []string{"Alice", "Bob", "Charlie", "Dave"}},
+		{"deeply nested", filter.And(
+			filter.Not(filter.Or(filter.Equal("name", "Dave"), filter.And(filter.Like("name", "A%"), filter.Not(filter.IsNull("nickname"))))),
+			filter.GreaterThan("age", 20),
+		), []string{"Bob", "Charlie"}},
+		{"bound value", filter.Equal("name", "x' OR '1'='1"), []string{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, findNames(t, tc.filter))
+		})
+	}
+}
+
+func TestScopeFilterParsed(t *testing.T) {
+	setupTest(t)
+	seedFilterParents(t)
+
+	f, err := filter.Parse("and(name:ne:Bob,or(age:gt:35,nickname:eq:ali))")
+	assert.Nil(t, err)
+	f, err = filter.SchemaOf[*ParentEntity]().Coerce(f)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"Alice", "Charlie"}, findNames(t, f))
+}
+
+func TestScopeFilterSQL(t *testing.T) {
+	db := parentRepository.db.Session(&gorm.Session{DryRun: true})
+	f := filter.And(
+		filter.Equal("name", "Alice"),
+		filter.Or(filter.GreaterThan("age", 30), filter.Not(filter.In("age", []int{1, 2}))),
+	)
+
+	stmt := db.Model(&ParentEntity{}).Scopes(scopeFilter(f)).Find(&[]ParentEntity{}).Statement
+
+	assert.Contains(t, stmt.SQL.String(),
+		"WHERE (`parent_entities`.`name` = ? AND (`parent_entities`.`age` > ? OR NOT (`parent_entities`.`age` IN (?,?))))")
+	assert.Equal(t, []interface{}{"Alice", 30, 1, 2}, stmt.Vars)
+}
+
+func TestScopeFilterInvalidComparator(t *testing.T) {
+	setupTest(t)
+
+	ctx := createContext(t, 5*time.Second)
+	_, err := parentRepository.Count(ctx, filter.NewLeaf("name", "unknown", "x"))
+	assert.NotNil(t, err)
+}
+
+func TestEscapeLike(t *testing.T) {
+	assert.Equal(t, "100!% !_off!!", escapeLike("100% _off!"))
+}
+
+func TestScopeFilterSearchSQL(t *testing.T) {
+	testCases := []struct {
+		name      string
+		dialector gorm.Dialector
+		setup     string
+		expected  string
+		vars      []interface{}
+	}{
+		{"sqlite", sqlite.Open(":memory:"), "CREATE TABLE parent_entities_fts (id, name)",
+			"WHERE `parent_entities`.`id` IN (SELECT `parent_entities_fts`.`id` FROM `parent_entities_fts` WHERE `parent_entities_fts`.`name` MATCH ?)",
+			[]interface{}{"quick fox"}},
+		{"sqlite without index", sqlite.Open(":memory:"), "",
+			"WHERE (LOWER(`parent_entities`.`name`) LIKE ? ESCAPE '!' AND LOWER(`parent_entities`.`name`) LIKE ? ESCAPE '!')",
+			[]interface{}{"%quick%", "%fox%"}},
+		{"mysql", mysql.New(mysql.Config{DSN: "user:pass@tcp(localhost:3306)/db", SkipInitializeWithVersion: true}), "",
+			"WHERE MATCH (`parent_entities`.`name`) AGAINST (? IN NATURAL LANGUAGE MODE)",
+			[]interface{}{"quick fox"}},
+		{"postgres", postgres.Open("host=localhost user=user dbname=db"), "",
+			`WHERE to_tsvector('simple', "parent_entities"."name") @@ plainto_tsquery('simple', $1)`,
+			[]interface{}{"quick fox"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db, err := gorm.Open(tc.dialector, &gorm.Config{DisableAutomaticPing: true})
+			assert.Nil(t, err)
+			if tc.setup != "" {
+				assert.Nil(t, db.Exec(tc.setup).Error)
+			}
+			registry, err := newFieldRegistry(db, &ParentEntity{})
+			assert.Nil(t, err)
+			f, err := registry.resolveFilter(filter.Search("name", "quick fox"))
+			assert.Nil(t, err)
+			db = db.Session(&gorm.Session{DryRun: true})
+
+			stmt := db.Model(&ParentEntity{}).Scopes(scopeFilter(f)).Find(&[]ParentEntity{}).Statement
+
+			assert.Nil(t, stmt.Error)
+			assert.Contains(t, stmt.SQL.String(), tc.expected)
+			assert.Equal(t, tc.vars, stmt.Vars)
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package gorm_impl
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cmo7/folly4/src/data/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// searchConfig is the Postgres text search configuration used by the search comparator.
+// Expression indexes must use the same configuration, e.g.
+//
+//	CREATE INDEX users_username_search ON users USING GIN (to_tsvector('simple', username));
+const searchConfig = "simple"
+
+// searchIndexSuffix names the SQLite FTS5 table that indexes an entity table. The index table
+// holds the primary key of the entity and the searchable columns under the same names, e.g.
+//
+//	CREATE VIRTUAL TABLE users_fts USING fts5(id UNINDEXED, username);
+//
+// and is kept up to date by the application, usually with triggers. Tables without an index table
+// are searched with LIKE, word by word, like filter.Match does. Index tables are looked up once per
+// repository, so tables created while it runs are only used after a restart.
+const searchIndexSuffix = "_fts"
+
+// searchQuery is the value of a resolved search leaf: the text searched for, and whether the table
+// of the column has an index table.
+type searchQuery struct {
+	text    string
+	indexed bool
+}
+
+// searchExpression is a full-text search on a column, written for the engine of the statement:
+//
+//	SQLite:   users.id IN (SELECT users_fts.id FROM users_fts WHERE users_fts.username MATCH ?),
+//	          or LOWER(users.username) LIKE ? for each word without a users_fts table.
+//	          Invalid FTS5 queries, such as an unbalanced ", fail the statement, see searchSyntaxError.
+//	MySQL:    MATCH (users.username) AGAINST (? IN NATURAL LANGUAGE MODE), which needs a FULLTEXT index.
+//	Postgres: to_tsvector('simple', users.username) @@ plainto_tsquery('simple', ?)
+type searchExpression struct {
+	column clause.Column
+	schema *schema.Schema // Schema of the table of the column; nil for the root entity.
+	query  searchQuery
+}
+
+func (e searchExpression) Build(builder clause.Builder) {
+	stmt, ok := builder.(*gorm.Statement)
+	if !ok {
+		builder.AddError(fmt.Errorf("full-text search requires a gorm statement"))
+		return
+	}
+
+	switch engine := database.Engine(stmt.Dialector.Name()); engine {
+	case database.SQLite:
+		s := e.schema
+		if s == nil {
+			s = stmt.Schema
+		}
+		if s == nil || s.PrioritizedPrimaryField == nil {
+			builder.AddError(fmt.Errorf("full-text search on %s requires a primary key", e.column.Name))
+			return
+		}
+		if !e.query.indexed {
+			e.buildLike(builder)
+			return
+		}
+		index := s.Table + searchIndexSuffix
+		primaryKey := s.PrioritizedPrimaryField.DBName
+		builder.WriteQuoted(clause.Column{Table: e.column.Table, Name: primaryKey})
+		builder.WriteString(" IN (SELECT ")
+		builder.WriteQuoted(clause.Column{Table: index, Name: primaryKey})
+		builder.WriteString(" FROM ")
+		builder.WriteQuoted(clause.Table{Name: index})
+		builder.WriteString(" WHERE ")
+		builder.WriteQuoted(clause.Column{Table: index, Name: e.column.Name})
+		builder.WriteString(" MATCH ")
+		builder.AddVar(builder, e.query.text)
+		builder.WriteByte(')')
+	case database.MySQL:
+		builder.WriteString("MATCH (")
+		builder.WriteQuoted(e.column)
+		builder.WriteString(") AGAINST (")
+		builder.AddVar(builder, e.query.text)
+		builder.WriteString(" IN NATURAL LANGUAGE MODE)")
+	case database.Postgres:
+		builder.WriteString("to_tsvector('" + searchConfig + "', ")
+		builder.WriteQuoted(e.column)
+		builder.WriteString(") @@ plainto_tsquery('" + searchConfig + "', ")
+		builder.AddVar(builder, e.query.text)
+		builder.WriteByte(')')
+	default:
+		builder.AddError(fmt.Errorf("full-text search is not supported on %s", engine))
+	}
+}
+
+// buildLike writes a case-insensitive LIKE match of every word of the query, for engines without
+// a full-text index on the column. A query without words matches every row.
+func (e searchExpression) buildLike(builder clause.Builder) {
+	exprs := []clause.Expression{}
+	for _, word := range strings.Fields(strings.ToLower(e.query.text)) {
+		exprs = append(exprs, clause.Expr{
+			SQL:  "LOWER(?) LIKE ? ESCAPE '" + likeEscape + "'",
+			Vars: []interface{}{e.column, "%" + escapeLike(word) + "%"},
+		})
+	}
+	expr := group(" AND ", exprs)
+	if expr == nil {
+		expr = clause.Expr{SQL: "1 = 1"}
+	}
+	expr.Build(builder)
+}
+
+// searchIndexes returns the tables of the database that have an index table. Only SQLite searches
+// index tables; other engines, and databases whose tables cannot be listed, have none.
+func searchIndexes(db *gorm.DB) map[string]bool {
+	indexes := map[string]bool{}
+	if database.Engine(db.Dialector.Name()) != database.SQLite {
+		return indexes
+	}
+	var tables []string
+	if db.Raw("SELECT name FROM sqlite_master WHERE type = 'table'").Scan(&tables).Error != nil {
+		return indexes
+	}
+	for _, table := range tables {
+		if table, ok := strings.CutSuffix(table, searchIndexSuffix); ok {
+			indexes[table] = true
+		}
+	}
+	return indexes
+}
+
+// searchSyntaxError reports whether err is the error of an invalid FTS5 query, which SQLite only
+// reports when it runs the statement.
+func searchSyntaxError(err error) bool {
+	message := err.Error()
+	return strings.Contains(message, "fts5: syntax error") || strings.Contains(message, "unterminated string")
+}
@@ -0,0 +1,80 @@
+package gorm_impl
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/cmo7/folly4/src/lib/generics/common"
+	"github.com/cmo7/folly4/src/lib/generics/fieldset"
+	"gorm.io/gorm/schema"
+)
+
+// selection returns the columns of E to read for the fieldset in ctx, or nil to read every column.
+// extra are fields that must be read anyway, such as the sort keys of a keyset listing.
+func (r *GormGenericRepository[E]) selection(ctx context.Context, extra ...*schema.Field) ([]string, error) {
+	fields, ok := fieldset.FromContext(ctx, common.EntityNameOf[E]()).Fields("")
+	if !ok {
+		return nil, nil
+	}
+	registry, err := r.fields()
+	if err != nil {
+		return nil, err
+	}
+	columns, err := selectColumns(registry.schema, nil, fields)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range extra {
+		if !slices.Contains(columns, f.DBName) {
+			columns = append(columns, f.DBName)
+		}
+	}
+	return columns, nil
+}
+
+// selectColumns returns the columns of s to read for the selected fields, named by their Go names.
+// The keys that relate the rows to the entities they are loaded with through via, if any, and to
+// the relations loaded with them are read as well. Selected relations have no column.
+func selectColumns(s *schema.Schema, via *schema.Relationship, fields []string) ([]string, error) {
+	columns := []string{}
+	add := func(f *schema.Field) {
+		if f != nil && f.Schema == s && f.DBName != "" && !slices.Contains(columns, f.DBName) {
+			columns = append(columns, f.DBName)
+		}
+	}
+
+	for _, f := range s.PrimaryFields {
+		add(f)
+	}
+	for _, name := range fields {
+		if _, ok := s.Relationships.Relations[name]; ok {
+			continue
+		}
+		f, ok := s.FieldsByName[name]
+		if !ok || f.DBName == "" {
+			return nil, fmt.Errorf("%w: %s", fieldset.ErrUnknownField, name)
+		}
+		add(f)
+	}
+
+	names := make([]string, 0, len(s.Relationships.Relations))
+	for name := range s.Relationships.Relations {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	relationships := make([]*schema.Relationship, 0, len(names)+1)
+	for _, name := range names {
+		relationships = append(relationships, s.Relationships.Relations[name])
+	}
+	if via != nil {
+		relationships = append(relationships, via)
+	}
+	for _, rel := range relationships {
+		for _, ref := range rel.References {
+			add(ref.ForeignKey)
+			add(ref.PrimaryKey)
+		}
+	}
+	return columns, nil
+}
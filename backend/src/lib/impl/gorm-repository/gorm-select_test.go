@@ -0,0 +1,105 @@
+package gorm_impl
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cmo7/folly4/src/lib/generics/fieldset"
+	"github.com/cmo7/folly4/src/lib/generics/filter"
+	"github.com/cmo7/folly4/src/lib/generics/order"
+	"github.com/cmo7/folly4/src/lib/generics/pagination"
+	"github.com/cmo7/folly4/src/lib/generics/relation"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindSelectsFieldset(t *testing.T) {
+	setupTest(t)
+	seedKeysetParents(t)
+	ctx := fieldset.WithFieldset(createContext(t, 5*time.Second), "ParentEntity", fieldset.Fieldset{"": {"Name"}})
+
+	page, err := parentRepository.FindAll(ctx, pagination.Pageable{Page: 1, Size: 10}, nil, nil, []order.OrderBy{order.AscOrderBy("name")})
+	assert.Nil(t, err)
+	assert.Len(t, page.Content, 7)
+	assert.EqualValues(t, 7, page.Filtered)
+	for _, p := range page.Content {
+		assert.NotEqual(t, uuid.Nil, p.ID, "the primary key is always read")
+		assert.NotEqual(t, "", p.Name)
+		assert.Zero(t, p.Age, "fields outside the fieldset are not read")
+		assert.Nil(t, p.Nickname)
+	}
+
+	first, err := parentRepository.First(ctx, filter.Equal("name", "Alice"))
+	assert.Nil(t, err)
+	assert.Equal(t, "Alice", first.Name)
+	assert.Zero(t, first.Age)
+
+	found, err := parentRepository.FindOne(ctx, first.ID, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "Alice", found.Name)
+	assert.Zero(t, found.Age)
+
+	other := fieldset.WithFieldset(createContext(t, 5*time.Second), "ChildEntity", fieldset.Fieldset{"": {"Name"}})
+	found, err = parentRepository.FindOne(other, first.ID, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 30, found.Age, "the fieldset of another entity does not narrow the read")
+}
+
+func TestFindSelectsRelationFieldset(t *testing.T) {
+	setupTest(t)
+	seedRelationParents(t)
+	ctx := fieldset.WithFieldset(createContext(t, 5*time.Second), "ParentEntity", fieldset.Fieldset{
+		"":                  {"Name", "Children"},
+		"Children":          {"Name"},
+		"Children.Siblings": {"Name"},
+	})
+
+	relations, err := relation.Parse("children(order=name:asc).siblings")
+	assert.Nil(t, err)
+	alice, err := parentRepository.FindAll(ctx, pagination.Pageable{Page: 1, Size: 1}, filter.Equal("name", "Alice"), relations, nil)
+	assert.Nil(t, err)
+	assert.Len(t, alice.Content, 1)
+	assert.Zero(t, alice.Content[0].Age)
+
+	children := alice.Content[0].Children
+	assert.Len(t, children, 2, "the foreign keys are read to load the relation")
+	assert.Equal(t, "Amy", children[0].Name)
+	assert.Equal(t, "Ann", children[1].Name)
+	assert.Len(t, children[1].Siblings, 1)
+	assert.Equal(t, "Amy", children[1].Siblings[0].Name)
+}
+
+func TestFindAllCursorSelectsSortKeys(t *testing.T) {
+	setupTest(t)
+	seedKeysetParents(t)
+	ctx := fieldset.WithFieldset(createContext(t, 5*time.Second), "ParentEntity", fieldset.Fieldset{"": {"Name"}})
+
+	names := []string{}
+	cursor := pagination.Cursor("")
+	for {
+		page, err := parentRepository.FindAllCursor(ctx, pagination.NewCursorPageable(cursor, 3), nil, nil, []order.OrderBy{order.DescOrderBy("age"), order.AscOrderBy("name")})
+		assert.Nil(t, err)
+		for _, p := range page.Content {
+			names = append(names, p.Name)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	assert.Equal(t, []string{"Grace", "Dave", "Alice", "Charlie", "Eve", "Bob", "Frank"}, names)
+}
+
+func TestFindSelectsUnknownField(t *testing.T) {
+	setupTest(t)
+	seedRelationParents(t)
+
+	ctx := fieldset.WithFieldset(createContext(t, 5*time.Second), "ParentEntity", fieldset.Fieldset{"": {"Unknown"}})
+	_, err := parentRepository.FindAll(ctx, pagination.Pageable{Page: 1, Size: 10}, nil, nil, nil)
+	assert.True(t, errors.Is(err, fieldset.ErrUnknownField))
+
+	ctx = fieldset.WithFieldset(createContext(t, 5*time.Second), "ParentEntity", fieldset.Fieldset{"Children": {"Unknown"}})
+	_, err = parentRepository.FindAll(ctx, pagination.Pageable{Page: 1, Size: 10}, nil, []relation.Relation{relation.New("Children")}, nil)
+	assert.True(t, errors.Is(err, fieldset.ErrUnknownField))
+}
@@ -0,0 +1,205 @@
+package gorm_impl
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cmo7/folly4/src/data/database"
+	"github.com/cmo7/folly4/src/lib/generics/filter"
+	"github.com/cmo7/folly4/src/lib/generics/pagination"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func init() {
+	// Read the rows of a page and their exact count in one statement where the engine supports
+	// window functions, and keep the count of the rows without filter for total_cache_ttl.
+	viper.SetDefault("database.window_count", true)
+	viper.SetDefault("database.total_cache_ttl", "5s")
+}
+
+// windowCountColumn is the column that holds COUNT(*) OVER() in the rows of a page.
+const windowCountColumn = "folly_window_count"
+
+// totalCache keeps the count of the rows of a table for a short time, so that filtered listings
+// do not count the whole table on every page.
+type totalCache struct {
+	mu      sync.Mutex
+	total   int64
+	expires time.Time
+}
+
+func (c *totalCache) get() (int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.total, time.Now().Before(c.expires)
+}
+
+func (c *totalCache) set(total int64, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.total, c.expires = total, time.Now().Add(ttl)
+}
+
+func (c *totalCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expires = time.Time{}
+}
+
+// total counts the rows without filter, or returns the count cached less than the TTL ago.
+func (r *GormGenericRepository[E]) total(ctx context.Context) (int64, error) {
+	if total, ok := r.totals.get(); ok {
+		return total, nil
+	}
+	total, err := r.count(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	r.totals.set(total, r.totalTTL)
+	return total, nil
+}
+
+// windowed reports whether FindAll reads exact counts with COUNT(*) OVER().
+// The engine is asked for its version once.
+func (r *GormGenericRepository[E]) windowed(ctx context.Context) bool {
+	if !r.windowCount {
+		return false
+	}
+	r.windowOnce.Do(func() {
+		r.windowSupported = windowFunctions(r.db.WithContext(ctx))
+	})
+	return r.windowSupported
+}
+
+// windowFunctions reports whether the engine evaluates window functions, which came with
+// SQLite 3.25, MySQL 8.0 and MariaDB 10.2. Every supported Postgres version has them.
+func windowFunctions(db *gorm.DB) bool {
+	var version string
+	switch database.Engine(db.Dialector.Name()) {
+	case database.Postgres:
+		return true
+	case database.SQLite:
+		if db.Raw("SELECT sqlite_version()").Scan(&version).Error != nil {
+			return false
+		}
+		return versionAtLeast(version, 3, 25)
+	case database.MySQL:
+		if db.Raw("SELECT VERSION()").Scan(&version).Error != nil {
+			return false
+		}
+		if strings.Contains(strings.ToLower(version), "mariadb") {
+			return versionAtLeast(version, 10, 2)
+		}
+		return versionAtLeast(version, 8, 0)
+	}
+	return false
+}
+
+// versionAtLeast reports whether a version string such as "8.0.36-log" is at least major.minor.
+func versionAtLeast(version string, major int, minor int) bool {
+	var vMajor, vMinor int
+	if _, err := fmt.Sscanf(version, "%d.%d", &vMajor, &vMinor); err != nil {
+		return false
+	}
+	return vMajor > major || (vMajor == major && vMinor >= minor)
+}
+
+// findAllWindow reads a page with exact counts in one statement: COUNT(*) OVER() is evaluated
+// after WHERE and before LIMIT, so every row carries the number of rows matching the filter.
+// Pages past the end have no rows to carry it and are counted apart. The filter and the order
+// must already be resolved.
+func (r *GormGenericRepository[E]) findAllWindow(ctx context.Context, pageable pagination.Pageable, f filter.Filter, selects []string, preloads []preload, columns []sortColumn) (pagination.Page[E], error) {
+	db := r.db.WithContext(ctx)
+	rows, err := db.Model(new(E)).Clauses(clause.Select{Expression: windowSelect(selects)}).Scopes(
+		scopePage(pageable),
+		scopeOrder(columns),
+		scopeFilter(f),
+	).Rows()
+	if err != nil {
+		return pagination.Page[E]{}, r.translateError(err)
+	}
+	defer rows.Close()
+
+	entities := []E{}
+	var filtered int64
+	if rows.Next() {
+		// The count is the same in every row, so it is read from the first one, which is then
+		// scanned again into the entities together with the rest.
+		names, err := rows.Columns()
+		if err != nil {
+			return pagination.Page[E]{}, r.translateError(err)
+		}
+		dest := make([]interface{}, len(names))
+		for i, name := range names {
+			if name == windowCountColumn {
+				dest[i] = &filtered
+			} else {
+				dest[i] = new(interface{})
+			}
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return pagination.Page[E]{}, r.translateError(err)
+		}
+		if err := db.ScanRows(rows, &entities); err != nil {
+			return pagination.Page[E]{}, r.translateError(err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return pagination.Page[E]{}, r.translateError(err)
+	}
+	rows.Close()
+
+	if len(entities) == 0 && pageable.Page > 1 {
+		if filtered, err = r.count(ctx, f); err != nil {
+			return pagination.Page[E]{}, err
+		}
+	}
+	if err := r.preloadScanned(ctx, entities, preloads); err != nil {
+		return pagination.Page[E]{}, r.translateError(err)
+	}
+
+	total := filtered
+	if f != nil {
+		if total, err = r.total(ctx); err != nil {
+			return pagination.Page[E]{}, err
+		}
+	} else {
+		r.totals.set(total, r.totalTTL)
+	}
+	return pagination.NewPage(entities, pageable.Page, pageable.Size, total, filtered), nil
+}
+
+// windowSelect selects the columns of the query, all of them when nil, and the count of its rows.
+func windowSelect(columns []string) clause.Expr {
+	count := clause.Column{Name: windowCountColumn}
+	if columns == nil {
+		return clause.Expr{SQL: "?.*, COUNT(*) OVER() AS ?", Vars: []interface{}{clause.Table{Name: clause.CurrentTable}, count}}
+	}
+	vars := make([]interface{}, 0, len(columns)+1)
+	for _, column := range columns {
+		vars = append(vars, clause.Column{Table: clause.CurrentTable, Name: column})
+	}
+	return clause.Expr{SQL: strings.Repeat("?, ", len(columns)) + "COUNT(*) OVER() AS ?", Vars: append(vars, count)}
+}
+
+// preloadScanned loads the relations of entities that were scanned from rows, which Find would
+// have loaded with them, by running the preload step of the GORM query callbacks.
+func (r *GormGenericRepository[E]) preloadScanned(ctx context.Context, entities []E, preloads []preload) error {
+	if len(entities) == 0 || len(preloads) == 0 {
+		return nil
+	}
+	tx := scopePreload(preloads)(r.db.WithContext(ctx))
+	if err := tx.Statement.Parse(&entities); err != nil {
+		return err
+	}
+	tx.Statement.Dest = &entities
+	tx.Statement.ReflectValue = reflect.ValueOf(&entities).Elem()
+	r.db.Callback().Query().Get("gorm:preload")(tx)
+	return tx.Error
+}
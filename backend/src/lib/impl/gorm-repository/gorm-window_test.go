@@ -0,0 +1,165 @@
+package gorm_impl
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cmo7/folly4/src/lib/generics/filter"
+	"github.com/cmo7/folly4/src/lib/generics/order"
+	"github.com/cmo7/folly4/src/lib/generics/pagination"
+	"github.com/cmo7/folly4/src/lib/generics/relation"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// countStatements counts the statements run on db until the end of the test.
+func countStatements(t testing.TB, db *gorm.DB) func() []string {
+	var mu sync.Mutex
+	var statements []string
+	record := func(tx *gorm.DB) {
+		mu.Lock()
+		defer mu.Unlock()
+		statements = append(statements, tx.Statement.SQL.String())
+	}
+	assert.Nil(t, db.Callback().Query().After("gorm:query").Register("test:count_query", record))
+	assert.Nil(t, db.Callback().Row().After("gorm:row").Register("test:count_row", record))
+	t.Cleanup(func() {
+		db.Callback().Query().Remove("test:count_query")
+		db.Callback().Row().Remove("test:count_row")
+	})
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		read := statements
+		statements = nil
+		return read
+	}
+}
+
+func TestFindAllWindow(t *testing.T) {
+	setupTest(t)
+	seedRelationParents(t)
+	ctx := createContext(t, 5*time.Second)
+	assert.True(t, parentRepository.windowed(ctx))
+
+	queries := NewGormGenericRepository[*ParentEntity](parentRepository.db)
+	queries.windowCount = false
+
+	orderBys := []order.OrderBy{order.AscOrderBy("name")}
+	tests := []struct {
+		pageable pagination.Pageable
+		f        filter.Filter
+	}{
+		{pagination.Pageable{Page: 1, Size: 2}, nil},
+		{pagination.Pageable{Page: 2, Size: 3}, nil},
+		{pagination.Pageable{Page: 1, Size: 2}, filter.GreaterThan("age", 26)},
+		{pagination.Pageable{Page: 5, Size: 2}, nil},
+		{pagination.Pageable{Page: 5, Size: 2}, filter.Equal("name", "Bob")},
+		{pagination.Pageable{Page: 1, Size: 2}, filter.Equal("name", "Nobody")},
+	}
+	for _, test := range tests {
+		windowPage, err := parentRepository.FindAll(ctx, test.pageable, test.f, []relation.Relation{relation.New("Children")}, orderBys)
+		assert.Nil(t, err)
+		queriesPage, err := queries.FindAll(ctx, test.pageable, test.f, []relation.Relation{relation.New("Children")}, orderBys)
+		assert.Nil(t, err)
+		assert.Equal(t, queriesPage, windowPage, "%+v %v", test.pageable, test.f)
+	}
+
+	page, err := parentRepository.FindAll(ctx, pagination.Pageable{Page: 1, Size: 1}, nil, []relation.Relation{relation.New("Children")}, orderBys)
+	assert.Nil(t, err)
+	assert.Equal(t, "Alice", page.Content[0].Name)
+	assert.Len(t, page.Content[0].Children, 2)
+}
+
+func TestFindAllWindowStatements(t *testing.T) {
+	setupTest(t)
+	seedKeysetParents(t)
+	ctx := createContext(t, 5*time.Second)
+	statements := countStatements(t, parentRepository.db)
+	adults := filter.GreaterThan("age", 26)
+
+	page, err := parentRepository.FindAll(ctx, pagination.Pageable{Page: 1, Size: 2}, nil, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(7), page.Filtered)
+	read := statements()
+	assert.Len(t, read, 1)
+	assert.Contains(t, read[0], "COUNT(*) OVER()")
+
+	// The filtered listing takes the total cached by the unfiltered one.
+	page, err = parentRepository.FindAll(ctx, pagination.Pageable{Page: 1, Size: 2}, adults, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), page.Filtered)
+	assert.Equal(t, int64(7), page.Total)
+	assert.Len(t, statements(), 1)
+
+	// Rows written through the repository invalidate the cached total.
+	_, err = parentRepository.Create(ctx, &ParentEntity{Name: "Heidi", Age: 20})
+	assert.Nil(t, err)
+	statements()
+	page, err = parentRepository.FindAll(ctx, pagination.Pageable{Page: 1, Size: 2}, adults, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(8), page.Total)
+	assert.Len(t, statements(), 2)
+}
+
+func TestVersionAtLeast(t *testing.T) {
+	tests := []struct {
+		version      string
+		major, minor int
+		expected     bool
+	}{
+		{"3.45.1", 3, 25, true},
+		{"3.24.0", 3, 25, false},
+		{"8.0.36-log", 8, 0, true},
+		{"5.7.44", 8, 0, false},
+		{"10.11.6-MariaDB-0+deb12u1", 10, 2, true},
+		{"unknown", 8, 0, false},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, versionAtLeast(test.version, test.major, test.minor), test.version)
+	}
+}
+
+// BenchmarkFindAll compares reading exact counts with separate COUNT queries and with COUNT(*) OVER().
+// In-memory SQLite has no round trips to save, so the gain only shows against a database over the network.
+func BenchmarkFindAll(b *testing.B) {
+	db := parentRepository.db
+	truncateDB(db)
+	b.Cleanup(func() { truncateDB(db) })
+	parents := make([]ParentEntity, 1000)
+	for i := range parents {
+		parents[i] = ParentEntity{Name: fmt.Sprintf("Parent%04d", i), Age: i % 80}
+	}
+	if err := db.CreateInBatches(parents, 100).Error; err != nil {
+		b.Fatal(err)
+	}
+
+	queries := NewGormGenericRepository[*ParentEntity](db)
+	queries.windowCount = false
+	queries.totalTTL = 0
+	window := NewGormGenericRepository[*ParentEntity](db)
+
+	orderBys := []order.OrderBy{order.AscOrderBy("name")}
+	benchmarks := []struct {
+		name       string
+		repository *GormGenericRepository[*ParentEntity]
+		f          filter.Filter
+	}{
+		{"queries/unfiltered", queries, nil},
+		{"queries/filtered", queries, filter.GreaterThan("age", 40)},
+		{"window/unfiltered", window, nil},
+		{"window/filtered", window, filter.GreaterThan("age", 40)},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			ctx := createContext(b, time.Minute)
+			for i := 0; i < b.N; i++ {
+				if _, err := bm.repository.FindAll(ctx, pagination.Pageable{Page: 3, Size: 20}, bm.f, nil, orderBys); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -2,138 +2,359 @@ package gorm_impl
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
 
+	"github.com/cmo7/folly4/src/lib/generics/apperror"
 	"github.com/cmo7/folly4/src/lib/generics/common"
+	"github.com/cmo7/folly4/src/lib/generics/fieldset"
 	"github.com/cmo7/folly4/src/lib/generics/filter"
 	"github.com/cmo7/folly4/src/lib/generics/order"
 	"github.com/cmo7/folly4/src/lib/generics/pagination"
 	"github.com/cmo7/folly4/src/lib/generics/relation"
 	"github.com/google/uuid"
+	"github.com/spf13/viper"
 	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
 )
 
 type GormGenericRepository[E common.Entity] struct {
 	db *gorm.DB
+
+	// The field registry is built lazily from the GORM schema of E.
+	registryOnce sync.Once
+	registry     *fieldRegistry
+	registryErr  error
+
+	// Exact counts are read with COUNT(*) OVER() when configured and supported by the engine,
+	// which is checked once. The unfiltered count is cached for totalTTL.
+	windowCount     bool
+	windowOnce      sync.Once
+	windowSupported bool
+	totals          totalCache
+	totalTTL        time.Duration
 }
 
 func NewGormGenericRepository[E common.Entity](db *gorm.DB) *GormGenericRepository[E] {
-	return &GormGenericRepository[E]{db: db}
+	return &GormGenericRepository[E]{
+		db:          db,
+		windowCount: viper.GetBool("database.window_count"),
+		totalTTL:    viper.GetDuration("database.total_cache_ttl"),
+	}
+}
+
+// fields returns the field registry of E, which validates and maps the fields used in filters and orders.
+func (r *GormGenericRepository[E]) fields() (*fieldRegistry, error) {
+	r.registryOnce.Do(func() {
+		r.registry, r.registryErr = newFieldRegistry(r.db, new(E))
+	})
+	return r.registry, r.registryErr
+}
+
+// resolve validates the client supplied filter and order fields and maps them to columns.
+func (r *GormGenericRepository[E]) resolve(f filter.Filter, orderBys []order.OrderBy) (filter.Filter, []sortColumn, error) {
+	registry, err := r.fields()
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err = registry.resolveFilter(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	columns, err := registry.resolveOrder(orderBys)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, columns, nil
+}
+
+// preloads validates the relations to load against the schema of E and resolves them to GORM preloads,
+// narrowed by the fieldset in ctx.
+func (r *GormGenericRepository[E]) preloads(ctx context.Context, relations []relation.Relation) ([]preload, error) {
+	registry, err := r.fields()
+	if err != nil {
+		return nil, err
+	}
+	return registry.resolveRelations(relations, fieldset.FromContext(ctx, common.EntityNameOf[E]()))
 }
 
 func (r *GormGenericRepository[E]) Create(ctx context.Context, payload E) (E, error) {
 	result := r.db.WithContext(ctx).Create(&payload)
-	return payload, result.Error
+	r.totals.invalidate()
+	return payload, r.translateError(result.Error)
 }
 
+// Update saves every field of payload but its creation time, which clients do not send back.
 func (r *GormGenericRepository[E]) Update(ctx context.Context, payload E) (E, error) {
-	result := r.db.WithContext(ctx).Save(&payload)
-	return payload, result.Error
+	result := r.db.WithContext(ctx).Omit("CreatedAt").Save(&payload)
+	return payload, r.translateError(result.Error)
 }
 
 func (r *GormGenericRepository[E]) UpdateField(ctx context.Context, payload E, field string, value interface{}) (E, error) {
 	result := r.db.WithContext(ctx).Model(&payload).Update(field, value)
-	return payload, result.Error
+	return payload, r.translateError(result.Error)
 }
 
 func (r *GormGenericRepository[E]) Delete(ctx context.Context, payload E) error {
 	result := r.db.WithContext(ctx).Delete(&payload)
-	return result.Error
+	r.totals.invalidate()
+	return r.translateError(result.Error)
 }
 
 func (r *GormGenericRepository[E]) FindOne(ctx context.Context, id uuid.UUID, relations []relation.Relation) (E, error) {
 	var entity E
-	result := r.db.WithContext(ctx).Scopes(scopePreload(relations)).First(&entity, id)
-	return entity, result.Error
+	selects, err := r.selection(ctx)
+	if err != nil {
+		return entity, err
+	}
+	preloads, err := r.preloads(ctx, relations)
+	if err != nil {
+		return entity, err
+	}
+	result := r.db.WithContext(ctx).Scopes(scopeSelect(selects), scopePreload(preloads)).First(&entity, id)
+	return entity, r.translateError(result.Error)
 }
 
+// FindAll reads a page of an offset paginated listing, counted as asked by pageable.Count.
+// Exact counts are read together with the rows where the engine supports window functions.
 func (r *GormGenericRepository[E]) FindAll(ctx context.Context, pageable pagination.Pageable, f filter.Filter, relations []relation.Relation, orderBys []order.OrderBy) (pagination.Page[E], error) {
 	var entities []E
 
+	f, columns, err := r.resolve(f, orderBys)
+	if err != nil {
+		return pagination.Page[E]{}, err
+	}
+	selects, err := r.selection(ctx)
+	if err != nil {
+		return pagination.Page[E]{}, err
+	}
+	preloads, err := r.preloads(ctx, relations)
+	if err != nil {
+		return pagination.Page[E]{}, err
+	}
+
+	pageable = pageable.Normalized()
+	if pageable.Count == pagination.CountExact && r.windowed(ctx) {
+		return r.findAllWindow(ctx, pageable, f, selects, preloads, columns)
+	}
 	result := r.db.WithContext(ctx).Scopes(
+		scopeSelect(selects),
 		scopePage(pageable),
-		scopePreload(relations),
-		scopeOrder(orderBys),
+		scopePreload(preloads),
+		scopeOrder(columns),
 		scopeFilter(f),
 	).Find(&entities)
 	if result.Error != nil {
-		return pagination.Page[E]{}, result.Error
+		return pagination.Page[E]{}, r.translateError(result.Error)
 	}
 
-	filteredCount, err := r.Count(ctx, f)
+	return r.page(ctx, pageable, f, entities)
+}
+
+// FindAllCursor reads a page of a keyset paginated listing. Instead of skipping the rows of the previous
+// pages, it reads on from the sort keys stored in the cursor, which stays fast on deep pages and does not
+// repeat or skip rows when rows are inserted meanwhile. The primary key is always the last sort key.
+// Keyset pages are not counted.
+func (r *GormGenericRepository[E]) FindAllCursor(ctx context.Context, pageable pagination.CursorPageable, f filter.Filter, relations []relation.Relation, orderBys []order.OrderBy) (pagination.Page[E], error) {
+	f, columns, err := r.resolve(f, orderBys)
 	if err != nil {
 		return pagination.Page[E]{}, err
 	}
-
-	count, err := r.Count(ctx, filter.Composite{Operator: filter.LogicalAnd, Filters: []filter.Filter{}})
+	registry, err := r.fields()
 	if err != nil {
 		return pagination.Page[E]{}, err
 	}
+	keys, err := keysetColumns(registry.schema, orderBys, columns)
+	if err != nil {
+		return pagination.Page[E]{}, err
+	}
+	// The sort keys are read to build the cursors.
+	keyFields := make([]*schema.Field, len(keys))
+	for i, key := range keys {
+		keyFields[i] = key.field
+	}
+	selects, err := r.selection(ctx, keyFields...)
+	if err != nil {
+		return pagination.Page[E]{}, err
+	}
+	preloads, err := r.preloads(ctx, relations)
+	if err != nil {
+		return pagination.Page[E]{}, err
+	}
+
+	var position pagination.CursorPosition
+	var values []interface{}
+	if pageable.Cursor != "" {
+		if position, err = pageable.Cursor.Decode(); err != nil {
+			return pagination.Page[E]{}, err
+		}
+		if values, err = keysetValues(keys, position); err != nil {
+			return pagination.Page[E]{}, err
+		}
+	}
+	read := keys
+	if position.Backward {
+		read = reversed(keys)
+	}
+
+	size := max(pageable.Size, 1)
+	var entities []E
+	result := r.db.WithContext(ctx).Scopes(
+		scopeSelect(selects),
+		scopeKeyset(read, values, position.Inclusive, size+1),
+		scopePreload(preloads),
+		scopeFilter(f),
+	).Find(&entities)
+	if result.Error != nil {
+		return pagination.Page[E]{}, r.translateError(result.Error)
+	}
+
+	// The extra row tells whether there is more to read in this direction.
+	more := len(entities) > size
+	if more {
+		entities = entities[:size]
+	}
+	if position.Backward {
+		slices.Reverse(entities)
+	}
+
+	var next, prev pagination.Cursor
+	if len(entities) == 0 {
+		// Nothing on this side of the position: the only way is back across it, row at the position included.
+		if pageable.Cursor != "" {
+			position.Backward = !position.Backward
+			position.Inclusive = true
+			var err error
+			if position.Backward {
+				prev, err = position.Encode()
+			} else {
+				next, err = position.Encode()
+			}
+			if err != nil {
+				return pagination.Page[E]{}, err
+			}
+		}
+		return pagination.NewCursorPage(entities, size, next, prev), nil
+	}
+	if more || position.Backward {
+		last, err := keysetPosition(ctx, keys, reflect.ValueOf(entities[len(entities)-1]), false)
+		if err != nil {
+			return pagination.Page[E]{}, err
+		}
+		if next, err = last.Encode(); err != nil {
+			return pagination.Page[E]{}, err
+		}
+	}
+	if (more && position.Backward) || (!position.Backward && pageable.Cursor != "") {
+		first, err := keysetPosition(ctx, keys, reflect.ValueOf(entities[0]), true)
+		if err != nil {
+			return pagination.Page[E]{}, err
+		}
+		if prev, err = first.Encode(); err != nil {
+			return pagination.Page[E]{}, err
+		}
+	}
+	return pagination.NewCursorPage(entities, size, next, prev), nil
+}
 
-	return pagination.Page[E]{Content: entities, Page: pageable.Page, Size: pageable.Size, Total: count, Filtered: filteredCount}, result.Error
+func (r *GormGenericRepository[E]) Count(ctx context.Context, f filter.Filter) (int64, error) {
+	f, _, err := r.resolve(f, nil)
+	if err != nil {
+		return 0, err
+	}
+	return r.count(ctx, f)
 }
 
-func (r *GormGenericRepository[E]) Count(ctx context.Context, filter filter.Filter) (int64, error) {
+// count counts the rows matching an already resolved filter.
+func (r *GormGenericRepository[E]) count(ctx context.Context, f filter.Filter) (int64, error) {
 	var count int64
-	result := r.db.WithContext(ctx).Model(new(E)).Scopes(scopeFilter(filter)).Count(&count)
-	return count, result.Error
+	result := r.db.WithContext(ctx).Model(new(E)).Scopes(scopeFilter(f)).Count(&count)
+	return count, r.translateError(result.Error)
 }
 
+// Associate adds the entity with targetId to the relation of the entity with id named association,
+// and returns the entity with the relation loaded.
 func (r *GormGenericRepository[E]) Associate(ctx context.Context, id uuid.UUID, association string, targetId uuid.UUID) (E, error) {
-	var entity E
-	r.db.WithContext(ctx).Model(&entity).Association(association).Append(&targetId)
-	return entity, nil
+	return r.changeAssociation(ctx, id, association, targetId, (*gorm.Association).Append)
 }
 
+// Dissociate removes the entity with targetId from the relation of the entity with id named
+// association, and returns the entity with the relation loaded.
 func (r *GormGenericRepository[E]) Dissociate(ctx context.Context, id uuid.UUID, association string, targetId uuid.UUID) (E, error) {
+	return r.changeAssociation(ctx, id, association, targetId, (*gorm.Association).Delete)
+}
+
+// changeAssociation applies change to the relation named association of the entity with id, with
+// the entity with targetId. Both entities must exist.
+func (r *GormGenericRepository[E]) changeAssociation(ctx context.Context, id uuid.UUID, association string, targetId uuid.UUID, change func(*gorm.Association, ...interface{}) error) (E, error) {
 	var entity E
-	r.db.WithContext(ctx).Model(&entity).Association(association).Delete(&targetId)
-	return entity, nil
+	registry, err := r.fields()
+	if err != nil {
+		return entity, err
+	}
+	registered, ok := registry.namesOf(registry.schema).relations[association]
+	if !ok {
+		return entity, fmt.Errorf("%w: %s", relation.ErrUnknownRelation, association)
+	}
+	related := registered.Relationship.FieldSchema
+
+	db := r.db.WithContext(ctx)
+	if err := db.First(&entity, id).Error; err != nil {
+		return entity, r.translateError(err)
+	}
+	target := reflect.New(related.ModelType).Interface()
+	if err := db.First(target, targetId).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return entity, apperror.New(apperror.ErrNotFound, err, "%s not found", related.Name)
+		}
+		return entity, r.translateError(err)
+	}
+	if err := change(db.Model(entity).Association(registered.Relationship.Name), target); err != nil {
+		return entity, r.translateError(err)
+	}
+	return r.FindOne(ctx, id, []relation.Relation{relation.New(association)})
 }
 
 func (r *GormGenericRepository[E]) Exists(ctx context.Context, id uuid.UUID) (bool, error) {
 	var entity E
-	result := r.db.WithContext(ctx).First(&entity, id)
-	return result.RowsAffected > 0, result.Error
+	result := r.db.WithContext(ctx).Limit(1).Find(&entity, id)
+	return result.RowsAffected > 0, r.translateError(result.Error)
 }
 
 func (r *GormGenericRepository[E]) Random(ctx context.Context) (E, error) {
 	var entity E
-	result := r.db.WithContext(ctx).Order("RANDOM()").First(&entity)
-	return entity, result.Error
+	selects, err := r.selection(ctx)
+	if err != nil {
+		return entity, err
+	}
+	result := r.db.WithContext(ctx).Scopes(scopeSelect(selects)).Order("RANDOM()").First(&entity)
+	return entity, r.translateError(result.Error)
 }
 
-func (r *GormGenericRepository[E]) First(ctx context.Context, filter filter.Filter) (E, error) {
+func (r *GormGenericRepository[E]) First(ctx context.Context, f filter.Filter) (E, error) {
 	var entity E
-	result := r.db.WithContext(ctx).Scopes(scopeFilter(filter)).First(&entity)
-	return entity, result.Error
-}
-
-func (r *GormGenericRepository[E]) ComboBox(ctx context.Context, pageable pagination.Pageable, f filter.Filter, relations []relation.Relation, orderBys []order.OrderBy) (pagination.Page[common.ComboOption], error) {
-	var entities []E
-	result := r.db.WithContext(ctx).Scopes(
-		scopePage(pageable),
-		scopePreload(relations),
-		scopeOrder(orderBys),
-		scopeFilter(f),
-	).Find(&entities)
-	if result.Error != nil {
-		return pagination.Page[common.ComboOption]{}, result.Error
+	f, _, err := r.resolve(f, nil)
+	if err != nil {
+		return entity, err
 	}
-
-	filteredCount, err := r.Count(ctx, f)
+	selects, err := r.selection(ctx)
 	if err != nil {
-		return pagination.Page[common.ComboOption]{}, err
+		return entity, err
 	}
+	result := r.db.WithContext(ctx).Scopes(scopeSelect(selects), scopeFilter(f)).First(&entity)
+	return entity, r.translateError(result.Error)
+}
 
-	count, err := r.Count(ctx, filter.Composite{Operator: filter.LogicalAnd, Filters: []filter.Filter{}})
+func (r *GormGenericRepository[E]) ComboBox(ctx context.Context, pageable pagination.Pageable, f filter.Filter, relations []relation.Relation, orderBys []order.OrderBy) (pagination.Page[common.ComboOption], error) {
+	page, err := r.FindAll(ctx, pageable, f, relations, orderBys)
 	if err != nil {
 		return pagination.Page[common.ComboOption]{}, err
 	}
-
-	var options []common.ComboOption
-	for _, entity := range entities {
-		options = append(options, common.ComboOption{ID: entity.GetID(), Name: entity.GetName()})
-	}
-
-	return pagination.Page[common.ComboOption]{Content: options, Page: pageable.Page, Size: pageable.Size, Total: count, Filtered: filteredCount}, result.Error
+	return pagination.Map(page, func(entity E) common.ComboOption {
+		return common.ComboOption{ID: entity.GetID(), Name: entity.GetName()}
+	}), nil
 }
@@ -2,14 +2,17 @@ package gorm_impl
 
 import (
 	"context"
+	"errors"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/cmo7/folly4/src/lib/generics/apperror"
 	"github.com/cmo7/folly4/src/lib/generics/common"
 	"github.com/cmo7/folly4/src/lib/generics/filter"
 	"github.com/cmo7/folly4/src/lib/generics/order"
 	"github.com/cmo7/folly4/src/lib/generics/pagination"
+	"github.com/cmo7/folly4/src/lib/generics/relation"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/driver/sqlite"
@@ -20,6 +23,10 @@ import (
 type ParentEntity struct {
 	ID        uuid.UUID `gorm:"type:char(36);primary_key"`
 	Name      string
+	Age       int
+	Nickname  *string
+	Secret    string        `query:"-"`
+	Rank      int           `json:"position" query:"nosort"`
 	BirthDate time.Time     `gorm:"type:date"`
 	Children  []ChildEntity `gorm:"foreignKey:ParentID"`
 }
@@ -28,16 +35,21 @@ type ChildEntity struct {
 	ID       uuid.UUID `gorm:"type:char(36);primary_key"`
 	Name     string
 	ParentID uuid.UUID      `gorm:"type:char(36)"`
+	Parent   *ParentEntity  `gorm:"foreignKey:ParentID"`
 	Siblings []*ChildEntity `gorm:"many2many:child_entity_siblings"`
 }
 
 func (e *ParentEntity) BeforeCreate(tx *gorm.DB) error {
-	e.ID = uuid.New()
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
 	return nil
 }
 
 func (e *ChildEntity) BeforeCreate(tx *gorm.DB) error {
-	e.ID = uuid.New()
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
 	return nil
 }
 
@@ -107,8 +119,9 @@ func setupTest(t *testing.T) {
 	})
 }
 
-func createContext(timeout time.Duration) context.Context {
-	ctx, _ := context.WithTimeout(context.Background(), timeout)
+func createContext(t testing.TB, timeout time.Duration) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	t.Cleanup(cancel)
 	return ctx
 }
 
@@ -124,7 +137,7 @@ func TestMain(m *testing.M) {
 func TestGormGenericRepositoryCreateParent(t *testing.T) {
 	setupTest(t)
 
-	ctx := createContext(5 * time.Second)
+	ctx := createContext(t, 5*time.Second)
 	parent := ParentEntity{Name: "Parent"}
 	result, err := parentRepository.Create(ctx, &parent)
 
@@ -135,7 +148,7 @@ func TestGormGenericRepositoryCreateParent(t *testing.T) {
 func TestGormGenericRepositoryCreateChild(t *testing.T) {
 	setupTest(t)
 
-	ctx := createContext(5 * time.Second)
+	ctx := createContext(t, 5*time.Second)
 
 	parent := ParentEntity{Name: "Parent"}
 	createdParent, err := parentRepository.Create(ctx, &parent)
@@ -152,7 +165,7 @@ func TestGormGenericRepositoryCreateChild(t *testing.T) {
 func TestGormGenericRepositoryFindParentWithChildren(t *testing.T) {
 	setupTest(t)
 
-	ctx := createContext(5 * time.Second)
+	ctx := createContext(t, 5*time.Second)
 
 	parent := ParentEntity{Name: "Parent"}
 	child := ChildEntity{Name: "Child"}
@@ -175,7 +188,7 @@ func TestGormGenericRepositoryFindParentWithChildren(t *testing.T) {
 func TestGormGenericRepositoryPagination(t *testing.T) {
 	setupTest(t)
 
-	ctx := createContext(5 * time.Second)
+	ctx := createContext(t, 5*time.Second)
 
 	parents := []ParentEntity{
 		{Name: "Parent1"},
@@ -195,10 +208,94 @@ func TestGormGenericRepositoryPagination(t *testing.T) {
 	assert.Equal(t, 2, len(page.Content))
 }
 
+func TestGormGenericRepositoryAssociate(t *testing.T) {
+	setupTest(t)
+
+	ctx := createContext(t, 5*time.Second)
+	parent, err := parentRepository.Create(ctx, &ParentEntity{Name: "Parent"})
+	assert.Nil(t, err)
+	child, err := childRepository.Create(ctx, &ChildEntity{Name: "Child"})
+	assert.Nil(t, err)
+
+	associated, err := parentRepository.Associate(ctx, parent.ID, "children", child.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, parent.ID, associated.ID)
+	if assert.Len(t, associated.Children, 1) {
+		assert.Equal(t, child.ID, associated.Children[0].ID)
+	}
+
+	dissociated, err := parentRepository.Dissociate(ctx, parent.ID, "children", child.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, parent.ID, dissociated.ID)
+	assert.Empty(t, dissociated.Children)
+
+	testCases := []struct {
+		name        string
+		id          uuid.UUID
+		association string
+		target      uuid.UUID
+		expected    error
+	}{
+		{"missing entity", uuid.New(), "children", child.ID, apperror.ErrNotFound},
+		{"missing target", parent.ID, "children", uuid.New(), apperror.ErrNotFound},
+		{"unknown relation", parent.ID, "friends", child.ID, relation.ErrUnknownRelation},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parentRepository.Associate(ctx, tc.id, tc.association, tc.target)
+			assert.ErrorIs(t, err, tc.expected)
+			_, err = parentRepository.Dissociate(ctx, tc.id, tc.association, tc.target)
+			assert.ErrorIs(t, err, tc.expected)
+		})
+	}
+}
+
+func TestGormGenericRepositorySearchWithoutIndex(t *testing.T) {
+	setupTest(t)
+
+	ctx := createContext(t, 5*time.Second)
+	for _, name := range []string{"The quick brown fox", "Quicksilver", "Lazy dog", "100% fox"} {
+		_, err := parentRepository.Create(ctx, &ParentEntity{Name: name})
+		assert.Nil(t, err)
+	}
+
+	// Without a parent_entities_fts table, SQLite searches every word with LIKE.
+	testCases := []struct {
+		query    string
+		expected []string
+	}{
+		{"QUICK fox", []string{"The quick brown fox"}},
+		{"quick", []string{"Quicksilver", "The quick brown fox"}},
+		{"%", []string{"100% fox"}},
+		{"_", []string{}},
+		{"", []string{"100% fox", "Lazy dog", "Quicksilver", "The quick brown fox"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.query, func(t *testing.T) {
+			page, err := parentRepository.FindAll(ctx, pagination.Pageable{Page: 1, Size: 10}, filter.Search("name", tc.query), nil, []order.OrderBy{order.AscOrderBy("name")})
+			assert.Nil(t, err)
+			names := []string{}
+			for _, parent := range page.Content {
+				names = append(names, parent.Name)
+			}
+			assert.Equal(t, tc.expected, names)
+		})
+	}
+
+	// Index tables are looked up once per repository, so one created afterwards is not searched.
+	assert.Nil(t, parentRepository.db.Exec("CREATE TABLE parent_entities_fts (id, name)").Error)
+	t.Cleanup(func() {
+		parentRepository.db.Exec("DROP TABLE parent_entities_fts")
+	})
+	page, err := parentRepository.FindAll(ctx, pagination.Pageable{Page: 1, Size: 10}, filter.Search("name", "lazy"), nil, nil)
+	assert.Nil(t, err)
+	assert.Len(t, page.Content, 1)
+}
+
 func TestGormGenericRepositorySortByNameCases(t *testing.T) {
 	setupTest(t)
 
-	ctx := createContext(5 * time.Second)
+	ctx := createContext(t, 5*time.Second)
 
 	parents := []ParentEntity{
 		{Name: "Charlie"},
@@ -252,10 +349,33 @@ func TestGormGenericRepositorySortByNameCases(t *testing.T) {
 func TestGormGenericRepositoryTimeout(t *testing.T) {
 	setupTest(t)
 
-	ctx := createContext(0 * time.Millisecond) // Timeout immediately
+	ctx := createContext(t, 0*time.Millisecond) // Timeout immediately
 	parent := ParentEntity{Name: "Parent"}
 	_, err := parentRepository.Create(ctx, &parent)
 
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "context deadline exceeded")
 }
+
+func TestGormGenericRepositoryNotFound(t *testing.T) {
+	setupTest(t)
+	ctx := createContext(t, 5*time.Second)
+
+	_, err := parentRepository.FindOne(ctx, uuid.New(), nil)
+	assert.True(t, errors.Is(err, apperror.ErrNotFound))
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+	assert.Equal(t, "ParentEntity not found", err.Error())
+
+	_, err = parentRepository.First(ctx, filter.Equal("name", "Nobody"))
+	assert.True(t, errors.Is(err, apperror.ErrNotFound))
+
+	exists, err := parentRepository.Exists(ctx, uuid.New())
+	assert.Nil(t, err)
+	assert.False(t, exists)
+
+	parent, err := parentRepository.Create(ctx, &ParentEntity{Name: "Alice"})
+	assert.Nil(t, err)
+	exists, err = parentRepository.Exists(ctx, parent.ID)
+	assert.Nil(t, err)
+	assert.True(t, exists)
+}
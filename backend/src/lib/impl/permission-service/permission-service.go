@@ -32,12 +32,24 @@ func NewPermissionService[E common.Entity, P permission.Permission](
 		return permission.PermissionDenied(ctx, permission.OperationCreate, payload.GetEntityName())
 	})
 
-	service.AddBeforeFindHook(func(ctx context.Context, entities ...E) error {
-		if permission.HasPermission(ctx, permission.OperationRead, entities[0].GetEntityName()) {
+	// Every method that reads entities, or tells whether they exist, needs the read permission.
+	// FindAll and FindAllCursor run the find hook without entities, so the entity name is taken
+	// from the type.
+	canRead := func(ctx context.Context) error {
+		var entity E
+		if permission.HasPermission(ctx, permission.OperationRead, entity.GetEntityName()) {
 			return nil
 		}
-		return permission.PermissionDenied(ctx, permission.OperationRead, entities[0].GetEntityName())
+		return permission.PermissionDenied(ctx, permission.OperationRead, entity.GetEntityName())
+	}
+	service.AddBeforeFindHook(func(ctx context.Context, _ ...E) error {
+		return canRead(ctx)
 	})
+	service.AddBeforeFirstHook(canRead)
+	service.AddBeforeRandomHook(canRead)
+	service.AddBeforeComboHook(canRead)
+	service.AddBeforeCountHook(canRead)
+	service.AddBeforeExistsHook(canRead)
 
 	service.AddBeforeUpdateHook(func(ctx context.Context, payload E) error {
 		if permission.HasPermission(ctx, permission.OperationUpdate, payload.GetEntityName()) {
@@ -0,0 +1,109 @@
+package permissionservice
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cmo7/folly4/src/lib/generics/apperror"
+	"github.com/cmo7/folly4/src/lib/generics/common"
+	"github.com/cmo7/folly4/src/lib/generics/pagination"
+	"github.com/cmo7/folly4/src/lib/generics/util/permission"
+	gorm_impl "github.com/cmo7/folly4/src/lib/impl/gorm-repository"
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type NoteEntity struct {
+	ID   uuid.UUID `gorm:"type:char(36);primary_key"`
+	Text string
+}
+
+func (e *NoteEntity) BeforeCreate(tx *gorm.DB) error {
+	e.ID = uuid.New()
+	return nil
+}
+
+func (e *NoteEntity) GetID() uuid.UUID                 { return e.ID }
+func (e *NoteEntity) SetID(id uuid.UUID)               { e.ID = id }
+func (e *NoteEntity) GetName() string                  { return e.Text }
+func (e *NoteEntity) GetEntityName() common.EntityName { return "Note" }
+
+func newNoteService(t *testing.T) *PermissionService[*NoteEntity, permission.Permission] {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	assert.Nil(t, err)
+	assert.Nil(t, db.AutoMigrate(&NoteEntity{}))
+	assert.Nil(t, db.Create(&NoteEntity{Text: "hello"}).Error)
+	return NewPermissionService[*NoteEntity, permission.Permission](gorm_impl.NewGormGenericRepository[*NoteEntity](db), nil)
+}
+
+func TestFindAllChecksReadPermission(t *testing.T) {
+	s := newNoteService(t)
+	for _, test := range []struct {
+		name    string
+		ctx     context.Context
+		public  []string
+		allowed bool
+	}{
+		{"anonymous", context.Background(), nil, false},
+		{"anonymous with public read", context.Background(), []string{"Note:READ"}, true},
+		{"system", permission.WithSystem(context.Background()), nil, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			viper.Set("permission.public", test.public)
+			permission.ReloadPublicRole()
+			defer func() {
+				viper.Set("permission.public", []string{})
+				permission.ReloadPublicRole()
+			}()
+
+			page, err := s.FindAll(test.ctx, pagination.Pageable{Page: 1, Size: 10}, nil, nil, nil)
+			cursorPage, cursorErr := s.FindAllCursor(test.ctx, pagination.CursorPageable{Size: 10}, nil, nil, nil)
+			if test.allowed {
+				assert.Nil(t, err)
+				assert.Len(t, page.Content, 1)
+				assert.Nil(t, cursorErr)
+				assert.Len(t, cursorPage.Content, 1)
+			} else {
+				assert.True(t, errors.Is(err, apperror.ErrForbidden), err)
+				assert.True(t, errors.Is(cursorErr, apperror.ErrForbidden), cursorErr)
+			}
+		})
+	}
+}
+
+func TestReadsCheckReadPermission(t *testing.T) {
+	s := newNoteService(t)
+	reads := map[string]func(ctx context.Context) error{
+		"First": func(ctx context.Context) error {
+			_, err := s.First(ctx, nil)
+			return err
+		},
+		"Random": func(ctx context.Context) error {
+			_, err := s.Random(ctx)
+			return err
+		},
+		"ComboBox": func(ctx context.Context) error {
+			_, err := s.ComboBox(ctx, pagination.Pageable{Page: 1, Size: 10}, nil, nil, nil)
+			return err
+		},
+		"Count": func(ctx context.Context) error {
+			_, err := s.Count(ctx, nil)
+			return err
+		},
+		"Exists": func(ctx context.Context) error {
+			_, err := s.Exists(ctx, uuid.New())
+			return err
+		},
+	}
+	for name, read := range reads {
+		t.Run(name, func(t *testing.T) {
+			err := read(context.Background())
+			assert.True(t, errors.Is(err, apperror.ErrForbidden), err)
+			assert.Nil(t, read(permission.WithSystem(context.Background())))
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package validationservice
+
+import (
+	"context"
+
+	"github.com/cmo7/folly4/src/lib/generics/common"
+	"github.com/cmo7/folly4/src/lib/generics/service"
+	"github.com/cmo7/folly4/src/lib/generics/validation"
+)
+
+// ValidationService is a service that validates entities before they are created or updated. It is a
+// wrapper around a CrudService. Entities are validated with the rules of their validate tags and, if
+// they implement validation.Validator, their Validate method. Invalid entities are not passed to the
+// wrapped service, and an apperror.ValidationError with the problems of their fields is returned.
+type ValidationService[E common.Entity] struct {
+	service.CrudServiceWithHooks[E] // Embed the CrudServiceWithHooks to inherit its methods.
+}
+
+func NewValidationService[E common.Entity](crudService service.CrudService[E]) *ValidationService[E] {
+	service := &ValidationService[E]{
+		CrudServiceWithHooks: service.NewCrudServiceWithHooks(crudService),
+	}
+
+	service.AddBeforeCreateHook(func(ctx context.Context, payload E) error {
+		return validation.Validate(ctx, payload)
+	})
+
+	service.AddBeforeUpdateHook(func(ctx context.Context, payload E) error {
+		return validation.Validate(ctx, payload)
+	})
+
+	return service
+}
+
+// UpdateField validates the new value of the field alone, as the rest of payload is not stored.
+func (s *ValidationService[E]) UpdateField(ctx context.Context, payload E, field string, value interface{}) (E, error) {
+	if err := validation.Field(payload, field, value); err != nil {
+		return payload, err
+	}
+	return s.GetRepo().UpdateField(ctx, payload, field, value)
+}